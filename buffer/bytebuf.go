@@ -40,12 +40,15 @@ import (
 //
 // Method Reset will reset both read index and write index to 0.
 // Method Release will release read bytes and recalculate indexes.
+// Method ReadSlice works like ReadBytes without copy, the returned slice shares memory with buffer
+// and should not be modified.
 type ByteBuf interface {
 	io.Writer
 	io.Reader
 
 	ReadIndex() int
 	ReadBytes(length int) []byte
+	ReadSlice(length int) []byte
 	ReadableBytes() int
 
 	WriteIndex() int
@@ -94,6 +97,27 @@ func (pb *elasticUnsafeByteBuf) ReadBytes(length int) []byte {
 	return result
 }
 
+// ReadSlice returns a slice of this buffer's data starting at the current read index without copy
+// and increases the read index by the length of the slice.
+// The slice stays valid after Release since released buffer is reallocated, but it may be
+// overwritten by writing after Reset.
+func (pb *elasticUnsafeByteBuf) ReadSlice(length int) []byte {
+
+	if length < 0 {
+		return []byte{}
+	}
+
+	targetReadIndex := pb.readIndex + length
+	if targetReadIndex > pb.writeIndex {
+		targetReadIndex = pb.writeIndex
+	}
+
+	result := pb.buffer[pb.readIndex:targetReadIndex:targetReadIndex]
+	pb.readIndex = targetReadIndex
+
+	return result
+}
+
 // WriteBytes transfers the specified source array's data to this buffer starting at the current
 // write index and increases the write index by the number of the transferred bytes.
 func (pb *elasticUnsafeByteBuf) WriteBytes(bytes []byte) {
@@ -206,3 +230,14 @@ func NewElasticUnsafeByteBuf(initSize int) ByteBuf {
 		capacity:   initSize,
 	}
 }
+
+// Create a new instance of ElasticUnsafeByteBuf which wraps specified bytes as readable bytes
+// without copy.
+func WrapElasticUnsafeByteBuf(bytes []byte) ByteBuf {
+	return &elasticUnsafeByteBuf{
+		buffer:     bytes,
+		readIndex:  0,
+		writeIndex: len(bytes),
+		capacity:   len(bytes),
+	}
+}
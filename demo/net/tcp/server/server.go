@@ -149,12 +149,12 @@ func initHandler() peer.ChannelHandler {
 	handler := peer.FunctionalChannelHandler{}
 
 	handler.HandleActivate = func(channel peer.Channel) error {
-		logging.Debug(">>> Remote %s activate.", channel.Remote().String())
+		logging.ForChannel(channel).Debug(">>> Activate.")
 		return nil
 	}
 
 	handler.HandleRead = func(channel peer.Channel, in interface{}) error {
-		logging.Debug(">>> Remote %s: %v.", channel.Remote().String(), in)
+		logging.ForChannel(channel).Debug(">>> Read %v.", in)
 		switch msg := in.(type) {
 		case *tCommand:
 			mId := msg.Id
@@ -166,12 +166,12 @@ func initHandler() peer.ChannelHandler {
 	}
 
 	handler.HandleInactivate = func(channel peer.Channel) error {
-		logging.Debug(">>> Remote %s inactivate.", channel.Remote().String())
+		logging.ForChannel(channel).Debug(">>> Inactivate.")
 		return nil
 	}
 
 	handler.HandleError = func(channel peer.Channel, err error) {
-		logging.Warn(">>> Remote %s error: %s.", channel.Remote().String(), err.Error())
+		logging.ForChannel(channel).Warn(">>> Error %s.", err.Error())
 	}
 	return &handler
 }
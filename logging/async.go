@@ -0,0 +1,180 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package logging
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+const defaultAsyncCapacity = 1024
+
+// OverflowPolicy defines the behavior of AsyncLogger while its queue is full.
+type OverflowPolicy uint8
+
+const (
+	// OverflowDrop drop the new record.
+	OverflowDrop OverflowPolicy = iota
+	// OverflowDropOldest drop the oldest queued record to make room for the new one.
+	OverflowDropOldest
+	// OverflowBlock block invoker until there is room in queue.
+	OverflowBlock
+)
+
+// AsyncConfig provide properties for AsyncLogger creation.
+type AsyncConfig struct {
+	// Capacity is the max number of queued records. Default is 1024.
+	Capacity int
+	// Overflow is the policy applied while queue is full. Default is OverflowDrop.
+	Overflow OverflowPolicy
+}
+
+// AsyncLogger is the interface of Logger which enqueue records and write them to the wrapped logger
+// in a dedicated goroutine, so slow outputs will not stall invokers on hot path.
+// Methods:
+//  Dropped returns the number of records dropped by overflow policy.
+//  Close write all queued records and stop the goroutine. Records after close will be dropped.
+//
+// Model:
+//  +---------+     +-------------------+     +-----------+     +--------+
+//  | invoker | → → | queue (bounded)   | → → | goroutine | → → | logger |
+//  +---------+     +-------------------+     +-----------+     +--------+
+type AsyncLogger interface {
+	Logger
+	Dropped() uint64
+	Close()
+}
+
+type asyncRecord struct {
+	level   Level
+	message string
+}
+
+// queuedLogger is the default implementation of AsyncLogger interface based on buffered channel.
+type queuedLogger struct {
+	logger   Logger
+	overflow OverflowPolicy
+	queue    chan asyncRecord
+	dropped  uint64
+	closed   bool
+	mutex    sync.RWMutex
+	doneC    chan uint8
+}
+
+func (l *queuedLogger) Trace(format string, args ...interface{}) {
+	l.enqueue(LTrace, format, args...)
+}
+
+func (l *queuedLogger) Debug(format string, args ...interface{}) {
+	l.enqueue(LDebug, format, args...)
+}
+
+func (l *queuedLogger) Info(format string, args ...interface{}) {
+	l.enqueue(LInfo, format, args...)
+}
+
+func (l *queuedLogger) Warn(format string, args ...interface{}) {
+	l.enqueue(LWarn, format, args...)
+}
+
+func (l *queuedLogger) Error(format string, args ...interface{}) {
+	l.enqueue(LError, format, args...)
+}
+
+func (l *queuedLogger) Dropped() uint64 {
+	return atomic.LoadUint64(&l.dropped)
+}
+
+func (l *queuedLogger) Close() {
+	l.mutex.Lock()
+	if l.closed {
+		l.mutex.Unlock()
+		return
+	}
+	l.closed = true
+	close(l.queue)
+	l.mutex.Unlock()
+	<-l.doneC
+}
+
+// enqueue format record eagerly, since args may be changed by invoker before written, and put it
+// into queue with overflow policy.
+func (l *queuedLogger) enqueue(level Level, format string, args ...interface{}) {
+	record := asyncRecord{level: level, message: fmt.Sprintf(format, args...)}
+
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	if l.closed {
+		atomic.AddUint64(&l.dropped, 1)
+		return
+	}
+
+	switch l.overflow {
+	case OverflowBlock:
+		l.queue <- record
+	case OverflowDropOldest:
+		for {
+			select {
+			case l.queue <- record:
+				return
+			default:
+			}
+			select {
+			case <-l.queue:
+				atomic.AddUint64(&l.dropped, 1)
+			default:
+			}
+		}
+	default:
+		select {
+		case l.queue <- record:
+		default:
+			atomic.AddUint64(&l.dropped, 1)
+		}
+	}
+}
+
+// drain write queued records to wrapped logger until queue closed.
+func (l *queuedLogger) drain() {
+	defer close(l.doneC)
+	for record := range l.queue {
+		writeLevel(l.logger, record.level, "%s", record.message)
+	}
+}
+
+// NewAsyncLogger create a new AsyncLogger instance which write records to specified logger.
+func NewAsyncLogger(logger Logger, config AsyncConfig) AsyncLogger {
+	capacity := config.Capacity
+	if capacity <= 0 {
+		capacity = defaultAsyncCapacity
+	}
+	asyncLogger := &queuedLogger{
+		logger:   logger,
+		overflow: config.Overflow,
+		queue:    make(chan asyncRecord, capacity),
+		doneC:    make(chan uint8),
+	}
+	go asyncLogger.drain()
+	return asyncLogger
+}
@@ -0,0 +1,69 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package logging
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ChannelInfo is the interface of network channel which records of channel logger are bound with.
+type ChannelInfo interface {
+	Id() uint64
+	Remote() net.Addr
+}
+
+// channelLogger is the implementation of Logger which write records through global logger proxy
+// with id and remote address of channel as prefix.
+type channelLogger struct {
+	prefix string
+}
+
+func (l *channelLogger) Trace(format string, args ...interface{}) {
+	proxy.Trace(l.prefix+format, args...)
+}
+
+func (l *channelLogger) Debug(format string, args ...interface{}) {
+	proxy.Debug(l.prefix+format, args...)
+}
+
+func (l *channelLogger) Info(format string, args ...interface{}) {
+	proxy.Info(l.prefix+format, args...)
+}
+
+func (l *channelLogger) Warn(format string, args ...interface{}) {
+	proxy.Warn(l.prefix+format, args...)
+}
+
+func (l *channelLogger) Error(format string, args ...interface{}) {
+	proxy.Error(l.prefix+format, args...)
+}
+
+// ForChannel returns a Logger which write records through global logger proxy with id and remote
+// address of specified channel as prefix, such as:
+//  [id: 0x0000002a, remote: 127.0.0.1:9090] Read 12 bytes.
+func ForChannel(channel ChannelInfo) Logger {
+	prefix := fmt.Sprintf("[id: 0x%08x, remote: %s] ", channel.Id(), channel.Remote().String())
+	return &channelLogger{prefix: strings.Replace(prefix, "%", "%%", -1)}
+}
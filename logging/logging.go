@@ -22,6 +22,15 @@
 
 package logging
 
+import (
+	"errors"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+)
+
 type Level uint8
 
 const (
@@ -41,51 +50,220 @@ type Logger interface {
 	Error(format string, args ...interface{})
 }
 
+// LevelEnv is the environment variable of level spec used by the global logger proxy.
+const LevelEnv = "MATCHA_LOG_LEVEL"
+
+var (
+	ErrInvalidLevel     = errors.New("invalid level")
+	ErrInvalidLevelSpec = errors.New("invalid level spec")
+)
+
+// levelNames is the name of levels used in level spec.
+var levelNames = map[string]Level{
+	"trace":   LTrace,
+	"debug":   LDebug,
+	"info":    LInfo,
+	"warn":    LWarn,
+	"warning": LWarn,
+	"error":   LError,
+	"none":    LNone,
+	"off":     LNone,
+}
+
+// ParseLevel returns level of specified case-insensitive name such as "debug".
+func ParseLevel(name string) (Level, error) {
+	if level, ok := levelNames[strings.ToLower(strings.TrimSpace(name))]; ok {
+		return level, nil
+	}
+	return 0, ErrInvalidLevel
+}
+
+// String returns name of level.
+func (l Level) String() string {
+	switch l {
+	case LTrace:
+		return "trace"
+	case LDebug:
+		return "debug"
+	case LInfo:
+		return "info"
+	case LWarn:
+		return "warn"
+	case LError:
+		return "error"
+	case LNone:
+		return "none"
+	}
+	return "unknown"
+}
+
+// parseLevelSpec parse comma separated global level and module levels such as
+// "warn, net/tcp=trace, task=error". Global level is nil if it is not specified.
+func parseLevelSpec(spec string) (global *Level, modules map[string]Level, err error) {
+	modules = make(map[string]Level)
+	for _, item := range strings.Split(spec, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		pair := strings.SplitN(item, "=", 2)
+		level, err := ParseLevel(pair[len(pair)-1])
+		if err != nil {
+			return nil, nil, ErrInvalidLevelSpec
+		}
+		if len(pair) == 1 {
+			global = &level
+			continue
+		}
+		module := strings.TrimSpace(pair[0])
+		if module == "" {
+			return nil, nil, ErrInvalidLevelSpec
+		}
+		modules[module] = level
+	}
+	return global, modules, nil
+}
+
+// loggingPackage is the package path of logging which will be skipped while resolving module of caller.
+var loggingPackage = reflect.TypeOf(LoggerProxy{}).PkgPath()
+
+// LoggerProxy dispatch records to registered loggers. A record will be dispatched only if its level
+// reaches the level of module which the caller belongs to, or the global level if no module matches,
+// and will be further filtered by level of each logger if set.
+//                                          → logger level 1 → logger 1
+//  record → module level or global level → → ...
+//                                          → logger level N → logger N
 type LoggerProxy struct {
-	level   Level
-	loggers map[string]Logger
+	level        Level
+	loggers      map[string]Logger
+	loggerLevels map[string]Level
+	moduleLevels map[string]Level
+	mutex        sync.RWMutex
 }
 
 func (p *LoggerProxy) AddLogger(name string, logger Logger) {
 	if name != "" && logger != nil {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
 		p.loggers[name] = logger
 	}
 }
 
 func (p *LoggerProxy) RemoveLogger(name string) {
 	if name != "" {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
 		delete(p.loggers, name)
+		delete(p.loggerLevels, name)
 	}
 }
 
 func (p *LoggerProxy) output(level Level, format string, args ...interface{}) {
 
-	if level&p.level != p.level {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	threshold := p.level
+	if len(p.moduleLevels) > 0 {
+		if moduleLevel, ok := p.callerModuleLevel(); ok {
+			threshold = moduleLevel
+		}
+	}
+	if !enabled(level, threshold) {
 		return
 	}
 
-	for _, logger := range p.loggers {
-		switch level {
-		case LTrace:
-			logger.Trace(format, args...)
-			break
-		case LDebug:
-			logger.Debug(format, args...)
-			break
-		case LInfo:
-			logger.Info(format, args...)
-			break
-		case LWarn:
-			logger.Warn(format, args...)
-			break
-		case LError:
-			logger.Error(format, args...)
-			break
+	for name, logger := range p.loggers {
+		if loggerLevel, ok := p.loggerLevels[name]; ok && !enabled(level, loggerLevel) {
+			continue
+		}
+		writeLevel(logger, level, format, args...)
+	}
+}
+
+// callerModuleLevel returns level of the longest module matches package of the first caller
+// outside logging package.
+func (p *LoggerProxy) callerModuleLevel() (Level, bool) {
+	pcs := make([]uintptr, 16)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		pkg := packageOf(frame.Function)
+		if pkg != loggingPackage {
+			var matched string
+			for module := range p.moduleLevels {
+				if len(module) > len(matched) && matchModule(pkg, module) {
+					matched = module
+				}
+			}
+			level, ok := p.moduleLevels[matched]
+			return level, ok
+		}
+		if !more {
+			return 0, false
 		}
 	}
 }
 
+// SetLoggerLevel set level of specified logger which filters records dispatched to it.
+func (p *LoggerProxy) SetLoggerLevel(name string, level Level) {
+	if name != "" {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		p.loggerLevels[name] = level
+	}
+}
+
+// SetModuleLevel set level of specified module which overrides global level for records logged
+// from packages of the module, such as "net/tcp" for net/tcp and its sub packages.
+func (p *LoggerProxy) SetModuleLevel(module string, level Level) {
+	module = strings.Trim(strings.TrimSpace(module), "/")
+	if module != "" {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		p.moduleLevels[module] = level
+	}
+}
+
+// RemoveModuleLevel remove level of specified module, records of the module will follow global level.
+func (p *LoggerProxy) RemoveModuleLevel(module string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	delete(p.moduleLevels, strings.Trim(strings.TrimSpace(module), "/"))
+}
+
+// SetModuleLevels set levels of modules with spec like "net/tcp=trace, task=warn".
+func (p *LoggerProxy) SetModuleLevels(spec string) error {
+	global, modules, err := parseLevelSpec(spec)
+	if err != nil {
+		return err
+	}
+	if global != nil {
+		return ErrInvalidLevelSpec
+	}
+	for module, level := range modules {
+		p.SetModuleLevel(module, level)
+	}
+	return nil
+}
+
+// Configure set global level and levels of modules with spec like "warn, net/tcp=trace, task=error".
+func (p *LoggerProxy) Configure(spec string) error {
+	global, modules, err := parseLevelSpec(spec)
+	if err != nil {
+		return err
+	}
+	if global != nil {
+		p.SetLevel(*global)
+	}
+	for module, level := range modules {
+		p.SetModuleLevel(module, level)
+	}
+	return nil
+}
+
 func (p *LoggerProxy) SetLevel(level Level) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
 	p.level = level
 }
 
@@ -109,7 +287,22 @@ func (p *LoggerProxy) Error(format string, args ...interface{}) {
 	p.output(LError, format, args...)
 }
 
-var proxy = &LoggerProxy{level: LNone, loggers: make(map[string]Logger)}
+var proxy = newLoggerProxy()
+
+// newLoggerProxy create the global logger proxy configured with level spec in environment variable
+// MATCHA_LOG_LEVEL. Invalid spec will be ignored.
+func newLoggerProxy() *LoggerProxy {
+	p := &LoggerProxy{
+		level:        LNone,
+		loggers:      make(map[string]Logger),
+		loggerLevels: make(map[string]Level),
+		moduleLevels: make(map[string]Level),
+	}
+	if spec := os.Getenv(LevelEnv); spec != "" {
+		p.Configure(spec)
+	}
+	return p
+}
 
 // SetLogLevel set output limit to global logger proxy.
 func SetLogLevel(level Level) {
@@ -125,6 +318,43 @@ func AddLogger(name string, logger Logger) {
 	}
 }
 
+// Configure set output limit of global logger proxy with level spec like "warn, net/tcp=trace".
+func Configure(spec string) error {
+	if proxy != nil {
+		return proxy.Configure(spec)
+	}
+	return nil
+}
+
+// SetLoggerLevel set output limit to specified logger registered in global logger proxy.
+func SetLoggerLevel(name string, level Level) {
+	if proxy != nil {
+		proxy.SetLoggerLevel(name, level)
+	}
+}
+
+// SetModuleLevel set output limit to specified module which overrides global level.
+func SetModuleLevel(module string, level Level) {
+	if proxy != nil {
+		proxy.SetModuleLevel(module, level)
+	}
+}
+
+// SetModuleLevels set output limit to modules with spec like "net/tcp=trace, task=warn".
+func SetModuleLevels(spec string) error {
+	if proxy != nil {
+		return proxy.SetModuleLevels(spec)
+	}
+	return nil
+}
+
+// RemoveModuleLevel remove output limit of specified module from global logger proxy.
+func RemoveModuleLevel(module string) {
+	if proxy != nil {
+		proxy.RemoveModuleLevel(module)
+	}
+}
+
 // RemoveLogger will cancel the specified logger from global logger proxy.
 func RemoveLogger(name string) {
 	if proxy != nil {
@@ -151,3 +381,39 @@ func Warn(fmt string, args ...interface{}) {
 func Error(fmt string, args ...interface{}) {
 	proxy.Error(fmt, args...)
 }
+
+// writeLevel invoke method of logger for specified level.
+func writeLevel(logger Logger, level Level, format string, args ...interface{}) {
+	switch level {
+	case LTrace:
+		logger.Trace(format, args...)
+	case LDebug:
+		logger.Debug(format, args...)
+	case LInfo:
+		logger.Info(format, args...)
+	case LWarn:
+		logger.Warn(format, args...)
+	case LError:
+		logger.Error(format, args...)
+	}
+}
+
+// enabled returns true if specified level reaches threshold.
+func enabled(level, threshold Level) bool {
+	return level&threshold == threshold
+}
+
+// packageOf returns package path of specified function name.
+func packageOf(function string) string {
+	slash := strings.LastIndex(function, "/")
+	if dot := strings.Index(function[slash+1:], "."); dot >= 0 {
+		return function[:slash+1+dot]
+	}
+	return function
+}
+
+// matchModule returns true if package path belongs to module, which is matched by whole path segments.
+func matchModule(pkg, module string) bool {
+	return pkg == module || strings.HasSuffix(pkg, "/"+module) || strings.HasPrefix(pkg, module+"/") ||
+		strings.Contains(pkg, "/"+module+"/")
+}
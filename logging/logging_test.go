@@ -0,0 +1,249 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package logging_test
+
+import (
+	"fmt"
+	"github.com/mervinkid/matcha/logging"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordLogger struct {
+	lines []string
+	mutex sync.Mutex
+}
+
+func (l *recordLogger) record(level, format string, args ...interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.lines = append(l.lines, level+" "+fmt.Sprintf(format, args...))
+}
+
+func (l *recordLogger) records() []string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return append([]string(nil), l.lines...)
+}
+
+func (l *recordLogger) Trace(format string, args ...interface{}) { l.record("trace", format, args...) }
+func (l *recordLogger) Debug(format string, args ...interface{}) { l.record("debug", format, args...) }
+func (l *recordLogger) Info(format string, args ...interface{})  { l.record("info", format, args...) }
+func (l *recordLogger) Warn(format string, args ...interface{})  { l.record("warn", format, args...) }
+func (l *recordLogger) Error(format string, args ...interface{}) { l.record("error", format, args...) }
+
+func TestLevels(t *testing.T) {
+	verbose, brief := &recordLogger{}, &recordLogger{}
+	logging.AddLogger("verbose", verbose)
+	logging.AddLogger("brief", brief)
+	defer logging.RemoveLogger("verbose")
+	defer logging.RemoveLogger("brief")
+
+	// Logger level filters records passed global level
+	logging.SetLogLevel(logging.LDebug)
+	logging.SetLoggerLevel("brief", logging.LWarn)
+	logging.Trace("trace")
+	logging.Debug("debug")
+	logging.Warn("warn")
+	if len(verbose.records()) != 2 || len(brief.records()) != 1 || brief.records()[0] != "warn warn" {
+		t.Fatal("unexpected records", verbose.records(), brief.records())
+	}
+
+	// Module level overrides global level for packages of module
+	if err := logging.SetModuleLevels("net/tcp=trace, logging_test=error"); err != nil {
+		t.Fatal(err)
+	}
+	logging.Warn("warn")
+	logging.Error("error")
+	if len(verbose.records()) != 3 || verbose.records()[2] != "error error" {
+		t.Fatal("unexpected records", verbose.records())
+	}
+
+	if err := logging.SetModuleLevels("task=verbose"); err != logging.ErrInvalidLevelSpec {
+		t.Fatal("expect invalid level spec but got", err)
+	}
+	logging.SetModuleLevel("logging_test", logging.LTrace)
+	logging.Trace("trace")
+	if len(verbose.records()) != 4 {
+		t.Fatal("unexpected records", verbose.records())
+	}
+	logging.RemoveModuleLevel("net/tcp")
+	logging.RemoveModuleLevel("logging_test")
+	logging.Trace("trace")
+	if len(verbose.records()) != 4 {
+		t.Fatal("unexpected records", verbose.records())
+	}
+	logging.SetLogLevel(logging.LNone)
+}
+
+func TestConfigure(t *testing.T) {
+	if level, err := logging.ParseLevel(" Warning "); err != nil || level != logging.LWarn {
+		t.Fatal("unexpected level", level, err)
+	}
+	if _, err := logging.ParseLevel("verbose"); err != logging.ErrInvalidLevel {
+		t.Fatal("expect invalid level but got", err)
+	}
+	if logging.LDebug.String() != "debug" {
+		t.Fatal("unexpected name", logging.LDebug.String())
+	}
+
+	logger := &recordLogger{}
+	logging.AddLogger("configure", logger)
+	defer logging.RemoveLogger("configure")
+	if err := logging.Configure("info, logging_test=warn"); err != nil {
+		t.Fatal(err)
+	}
+	logging.Info("info")
+	logging.Warn("warn")
+	logging.RemoveModuleLevel("logging_test")
+	logging.Info("info")
+	logging.Debug("debug")
+	if len(logger.records()) != 2 || logger.records()[0] != "warn warn" {
+		t.Fatal("unexpected records", logger.records())
+	}
+	if err := logging.Configure("info, task=loud"); err != logging.ErrInvalidLevelSpec {
+		t.Fatal("expect invalid level spec but got", err)
+	}
+	logging.SetLogLevel(logging.LNone)
+}
+
+type blockingLogger struct {
+	recordLogger
+	enterC   chan uint8
+	releaseC chan uint8
+}
+
+func (l *blockingLogger) Info(format string, args ...interface{}) {
+	select {
+	case l.enterC <- 1:
+	default:
+	}
+	<-l.releaseC
+	l.record("info", format, args...)
+}
+
+func TestAsyncLogger(t *testing.T) {
+	target := &blockingLogger{enterC: make(chan uint8, 1), releaseC: make(chan uint8)}
+	logger := logging.NewAsyncLogger(target, logging.AsyncConfig{Capacity: 2})
+
+	// First record is taken by drain goroutine and blocked, queue holds two more
+	logger.Info("record 0")
+	<-target.enterC
+	for i := 1; i < 5; i++ {
+		logger.Info("record %d", i)
+	}
+	close(target.releaseC)
+	logger.Close()
+	if logger.Dropped() != 2 || len(target.records()) != 3 || target.records()[0] != "info record 0" {
+		t.Fatal("unexpected records", logger.Dropped(), target.records())
+	}
+
+	logger.Info("after close")
+	if logger.Dropped() != 3 {
+		t.Fatal("expect record dropped after close")
+	}
+}
+
+func TestSyslogLogger(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	logger, err := logging.NewSyslogLogger(logging.SyslogConfig{
+		Network:  "udp",
+		Address:  conn.LocalAddr().String(),
+		Facility: logging.FacilityLocal0,
+		AppName:  "demo app",
+		Hostname: "host",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	logger.Warn("disk %d%% full", 90)
+	buf := make([]byte, 1024)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := strings.SplitN(string(buf[:n]), " ", 8)
+	if len(fields) != 8 || fields[0] != "<132>1" || fields[2] != "host" || fields[3] != "demo_app" ||
+		fields[5] != "-" || fields[6] != "-" || fields[7] != "disk 90% full" {
+		t.Fatal("unexpected record", string(buf[:n]))
+	}
+}
+
+func TestSampledLogger(t *testing.T) {
+	target := &recordLogger{}
+	logger := logging.NewSampledLogger(target, logging.SampleConfig{
+		Interval:   50 * time.Millisecond,
+		Burst:      2,
+		Thereafter: 3,
+	})
+
+	for i := 0; i < 8; i++ {
+		logger.Error("decode from %s fail", "client")
+	}
+	logger.Info("other")
+	// Records 1, 2 in burst and 5, 8 sampled
+	if records := target.records(); len(records) != 5 || records[4] != "info other" {
+		t.Fatal("unexpected records", records)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	logger.Error("decode from %s fail", "client")
+	summary := "error Suppressed 4 records like \"decode from %s fail\" in 50ms."
+	if records := target.records(); len(records) != 7 || records[5] != summary {
+		t.Fatal("unexpected records", records)
+	}
+}
+
+type fakeChannel struct{}
+
+func (c *fakeChannel) Id() uint64 {
+	return 42
+}
+
+func (c *fakeChannel) Remote() net.Addr {
+	return &net.TCPAddr{IP: net.ParseIP("fe80::1"), Port: 9090, Zone: "eth0"}
+}
+
+func TestForChannel(t *testing.T) {
+	target := &recordLogger{}
+	logging.AddLogger("channel", target)
+	defer logging.RemoveLogger("channel")
+	logging.SetLogLevel(logging.LInfo)
+	defer logging.SetLogLevel(logging.LNone)
+
+	logging.ForChannel(&fakeChannel{}).Info("Read %d bytes.", 12)
+	if records := target.records(); len(records) != 1 ||
+		records[0] != "info [id: 0x0000002a, remote: [fe80::1%eth0]:9090] Read 12 bytes." {
+		t.Fatal("unexpected records", records)
+	}
+}
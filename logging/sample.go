@@ -0,0 +1,146 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package logging
+
+import (
+	"sync"
+	"time"
+)
+
+// Sample defaults
+const (
+	defaultSampleInterval = 1 * time.Second
+	defaultSampleBurst    = 10
+)
+
+// SampleConfig provide properties for sampled Logger creation. Records are grouped by level and
+// format, so records like "Decode from %s fail cause %s." count as one kind whatever args are.
+//  +---------------- interval ----------------+
+//  | burst records | every Nth record ...     | → summary of suppressed
+//  +------------------------------------------+
+type SampleConfig struct {
+	// Interval is the period of limiting. Default is 1 second.
+	Interval time.Duration
+	// Burst is the max number of records of the same kind written per interval. Default is 10.
+	Burst int
+	// Thereafter write every Nth record of the same kind beyond burst within interval. Zero means
+	// dropping all records beyond burst.
+	Thereafter int
+}
+
+type sampleKey struct {
+	level  Level
+	format string
+}
+
+type sampleState struct {
+	start      time.Time
+	count      int
+	suppressed int
+}
+
+// sampledLogger is the implementation of Logger which limit records of the same kind written to
+// the wrapped logger, and write a summary with the number of suppressed records after interval.
+type sampledLogger struct {
+	logger Logger
+	config SampleConfig
+	states map[sampleKey]*sampleState
+	mutex  sync.Mutex
+}
+
+func (l *sampledLogger) Trace(format string, args ...interface{}) {
+	l.sample(LTrace, format, args...)
+}
+
+func (l *sampledLogger) Debug(format string, args ...interface{}) {
+	l.sample(LDebug, format, args...)
+}
+
+func (l *sampledLogger) Info(format string, args ...interface{}) {
+	l.sample(LInfo, format, args...)
+}
+
+func (l *sampledLogger) Warn(format string, args ...interface{}) {
+	l.sample(LWarn, format, args...)
+}
+
+func (l *sampledLogger) Error(format string, args ...interface{}) {
+	l.sample(LError, format, args...)
+}
+
+func (l *sampledLogger) sample(level Level, format string, args ...interface{}) {
+	key := sampleKey{level: level, format: format}
+	now := time.Now()
+
+	l.mutex.Lock()
+	state := l.states[key]
+	if state == nil || now.Sub(state.start) >= l.config.Interval {
+		state = &sampleState{start: now}
+		l.states[key] = state
+	}
+	state.count++
+	beyond := state.count - l.config.Burst
+	allowed := beyond <= 0 || (l.config.Thereafter > 0 && beyond%l.config.Thereafter == 0)
+	if !allowed {
+		state.suppressed++
+		if state.suppressed == 1 {
+			time.AfterFunc(state.start.Add(l.config.Interval).Sub(now), func() {
+				l.summarize(key, state)
+			})
+		}
+	}
+	l.mutex.Unlock()
+
+	if allowed {
+		writeLevel(l.logger, level, format, args...)
+	}
+}
+
+// summarize write number of suppressed records of specified kind within the interval of state.
+func (l *sampledLogger) summarize(key sampleKey, state *sampleState) {
+	l.mutex.Lock()
+	suppressed := state.suppressed
+	if l.states[key] == state {
+		delete(l.states, key)
+	}
+	l.mutex.Unlock()
+
+	writeLevel(l.logger, key.level, "Suppressed %d records like \"%s\" in %s.",
+		suppressed, key.format, l.config.Interval.String())
+}
+
+// NewSampledLogger create a new Logger instance which limit repetitive records written to specified
+// logger with config.
+func NewSampledLogger(logger Logger, config SampleConfig) Logger {
+	if config.Interval <= 0 {
+		config.Interval = defaultSampleInterval
+	}
+	if config.Burst <= 0 {
+		config.Burst = defaultSampleBurst
+	}
+	return &sampledLogger{
+		logger: logger,
+		config: config,
+		states: make(map[sampleKey]*sampleState),
+	}
+}
@@ -0,0 +1,228 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const syslogTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+var ErrSyslogUnavailable = errors.New("syslog is unavailable")
+
+// syslogLocalAddresses is the unix sockets tried for local syslog.
+var syslogLocalAddresses = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// Facility is the facility of syslog records defined in RFC 5424.
+type Facility uint8
+
+const (
+	FacilityKern Facility = iota
+	FacilityUser
+	FacilityMail
+	FacilityDaemon
+	FacilityAuth
+	FacilitySyslog
+	FacilityLpr
+	FacilityNews
+	FacilityUucp
+	FacilityCron
+	FacilityAuthPriv
+	FacilityFtp
+	FacilityLocal0 Facility = iota + 4
+	FacilityLocal1
+	FacilityLocal2
+	FacilityLocal3
+	FacilityLocal4
+	FacilityLocal5
+	FacilityLocal6
+	FacilityLocal7
+)
+
+// Severities of syslog records defined in RFC 5424.
+const (
+	severityError   = 3
+	severityWarning = 4
+	severityInfo    = 6
+	severityDebug   = 7
+)
+
+// SyslogConfig provide properties for SyslogLogger creation.
+type SyslogConfig struct {
+	// Network is the network of remote syslog server such as "udp" or "tcp". Local syslog will be
+	// used through unix socket if it is empty.
+	Network string
+	// Address is the address of remote syslog server.
+	Address string
+	// Facility of records. FacilityKern is reserved for kernel, default is FacilityUser if it is zero.
+	Facility Facility
+	// AppName is the name of application in records. Default is name of executable.
+	AppName string
+	// Hostname is the name of host in records. Default is hostname reported by kernel.
+	Hostname string
+}
+
+// SyslogLogger is the interface of Logger which write records to syslog in RFC 5424 format.
+// Severity of records is mapped from level as Trace/Debug → debug, Info → informational,
+// Warn → warning and Error → error. Records are framed with octet counting over tcp, sent as
+// datagrams over udp and unixgram, and terminated by line feed over local unix stream socket.
+// Methods:
+//  Close disconnect from syslog. Records after close will be dropped.
+type SyslogLogger interface {
+	Logger
+	Close()
+}
+
+// connSyslogLogger is the default implementation of SyslogLogger interface which reconnect once
+// while writing fail.
+type connSyslogLogger struct {
+	config   SyslogConfig
+	procId   string
+	conn     net.Conn
+	counting bool
+	trailer  string
+	closed   bool
+	mutex    sync.Mutex
+}
+
+func (l *connSyslogLogger) Trace(format string, args ...interface{}) {
+	l.write(severityDebug, format, args...)
+}
+
+func (l *connSyslogLogger) Debug(format string, args ...interface{}) {
+	l.write(severityDebug, format, args...)
+}
+
+func (l *connSyslogLogger) Info(format string, args ...interface{}) {
+	l.write(severityInfo, format, args...)
+}
+
+func (l *connSyslogLogger) Warn(format string, args ...interface{}) {
+	l.write(severityWarning, format, args...)
+}
+
+func (l *connSyslogLogger) Error(format string, args ...interface{}) {
+	l.write(severityError, format, args...)
+}
+
+func (l *connSyslogLogger) Close() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.closed = true
+	if l.conn != nil {
+		l.conn.Close()
+		l.conn = nil
+	}
+}
+
+func (l *connSyslogLogger) write(severity int, format string, args ...interface{}) {
+	// <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+	message := fmt.Sprintf("<%d>1 %s %s %s %s - - %s",
+		int(l.config.Facility)*8+severity, time.Now().Format(syslogTimeFormat),
+		l.config.Hostname, l.config.AppName, l.procId, strings.TrimRight(fmt.Sprintf(format, args...), "\n"))
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.closed {
+		return
+	}
+	for retry := 0; retry < 2; retry++ {
+		if l.conn == nil {
+			if err := l.connect(); err != nil {
+				return
+			}
+		}
+		frame := message + l.trailer
+		if l.counting {
+			frame = strconv.Itoa(len(message)) + " " + message
+		}
+		if _, err := l.conn.Write([]byte(frame)); err == nil {
+			return
+		}
+		l.conn.Close()
+		l.conn = nil
+	}
+}
+
+// connect dial remote syslog server or local unix socket.
+func (l *connSyslogLogger) connect() error {
+	if l.config.Network != "" {
+		conn, err := net.Dial(l.config.Network, l.config.Address)
+		if err != nil {
+			return err
+		}
+		l.conn = conn
+		l.counting = strings.HasPrefix(l.config.Network, "tcp")
+		return nil
+	}
+	for _, network := range []string{"unixgram", "unix"} {
+		for _, address := range syslogLocalAddresses {
+			if conn, err := net.Dial(network, address); err == nil {
+				l.conn = conn
+				if network == "unix" {
+					l.trailer = "\n"
+				}
+				return nil
+			}
+		}
+	}
+	return ErrSyslogUnavailable
+}
+
+// NewSyslogLogger create a new SyslogLogger instance and connect to syslog with specified config.
+func NewSyslogLogger(config SyslogConfig) (SyslogLogger, error) {
+	if config.Facility == FacilityKern {
+		config.Facility = FacilityUser
+	}
+	if config.AppName == "" {
+		config.AppName = filepath.Base(os.Args[0])
+	}
+	if config.Hostname == "" {
+		config.Hostname, _ = os.Hostname()
+	}
+	config.AppName = syslogHeaderValue(config.AppName)
+	config.Hostname = syslogHeaderValue(config.Hostname)
+	logger := &connSyslogLogger{config: config, procId: strconv.Itoa(os.Getpid())}
+	if err := logger.connect(); err != nil {
+		return nil, err
+	}
+	return logger, nil
+}
+
+// syslogHeaderValue returns specified value without spaces for header field, or nil value "-" if
+// it is empty.
+func syslogHeaderValue(value string) string {
+	value = strings.Join(strings.Fields(value), "_")
+	if value == "" {
+		return "-"
+	}
+	return value
+}
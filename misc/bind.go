@@ -0,0 +1,297 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package misc
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidConfigTarget = errors.New("config target must be non-nil pointer to struct")
+	ErrUnsupportedConfig   = errors.New("unsupported config value")
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// stringParser is the interface of types parsed from string without error such as util.URL.
+type stringParser interface {
+	Parse(src string)
+}
+
+// UnmarshalConfig fill fields of struct pointed by target with values of specified config, which can
+// be properties loaded by LoadPropertyFile or config loaded by LoadJsonFile and LoadYmlFile.
+// Key of field is specified by tag like `config:"address"`, field name is used (case-insensitive)
+// if it is not tagged, and fields tagged with `config:"-"` are ignored. Fields of nested struct are
+// keyed by dotted path like "redis.address", which matches both flat property key and nested map.
+// Fields of embedded struct without tag share key prefix of parent.
+// Values are converted to type of field:
+//  string, bool, int*, uint*, float* ← scalar value or string
+//  time.Duration                    ← string like "1m30s", or number of seconds
+//  slice                            ← list, or comma separated string
+//  encoding.TextUnmarshaler         ← string, such as net.IP
+//  pointer                          ← allocated only if any value found for it
+// Fields without value in config are kept unchanged, so target can be filled with defaults first.
+func UnmarshalConfig(config interface{}, target interface{}) error {
+	value := reflect.ValueOf(target)
+	if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return ErrInvalidConfigTarget
+	}
+	_, err := bindStruct(config, "", value.Elem())
+	return err
+}
+
+// bindStruct fill fields of struct with values under prefix, returns true if any value found.
+func bindStruct(config interface{}, prefix string, target reflect.Value) (bool, error) {
+	found := false
+	targetType := target.Type()
+	for i := 0; i < targetType.NumField(); i++ {
+		field := targetType.Field(i)
+		tag := field.Tag.Get("config")
+		if tag == "-" || (field.PkgPath != "" && !field.Anonymous) {
+			continue
+		}
+		var fieldFound bool
+		var err error
+		if field.Anonymous && tag == "" {
+			if field.Type.Kind() != reflect.Struct {
+				continue
+			}
+			fieldFound, err = bindStruct(config, prefix, target.Field(i))
+		} else {
+			key := tag
+			if key == "" {
+				key = field.Name
+			}
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			fieldFound, err = bindValue(config, key, target.Field(i))
+		}
+		if err != nil {
+			return false, err
+		}
+		found = found || fieldFound
+	}
+	return found, nil
+}
+
+// bindValue fill target with value of key, returns true if value found.
+func bindValue(config interface{}, key string, target reflect.Value) (bool, error) {
+	switch {
+	case target.Kind() == reflect.Ptr:
+		elem := reflect.New(target.Type().Elem())
+		found, err := bindValue(config, key, elem.Elem())
+		if found && err == nil {
+			target.Set(elem)
+		}
+		return found, err
+	case target.Kind() == reflect.Struct && !isTextValue(target):
+		return bindStruct(config, key, target)
+	}
+
+	raw, found := lookupConfig(config, key)
+	if !found {
+		return false, nil
+	}
+	if err := convertValue(raw, target); err != nil {
+		return true, fmt.Errorf("invalid config %s cause %v", key, err)
+	}
+	return true, nil
+}
+
+// isTextValue returns true if target is assigned from string as a whole.
+func isTextValue(target reflect.Value) bool {
+	if !target.CanAddr() {
+		return false
+	}
+	switch target.Addr().Interface().(type) {
+	case encoding.TextUnmarshaler, stringParser:
+		return true
+	}
+	return false
+}
+
+// convertValue convert raw config value to type of target and set it.
+func convertValue(raw interface{}, target reflect.Value) error {
+	if isTextValue(target) {
+		text, ok := scalarString(raw)
+		if !ok {
+			return ErrUnsupportedConfig
+		}
+		switch v := target.Addr().Interface().(type) {
+		case encoding.TextUnmarshaler:
+			return v.UnmarshalText([]byte(text))
+		case stringParser:
+			v.Parse(text)
+		}
+		return nil
+	}
+
+	if target.Kind() == reflect.Slice {
+		var items []interface{}
+		switch v := raw.(type) {
+		case []interface{}:
+			items = v
+		case string:
+			for _, item := range strings.Split(v, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+		default:
+			return ErrUnsupportedConfig
+		}
+		slice := reflect.MakeSlice(target.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := convertValue(item, slice.Index(i)); err != nil {
+				return err
+			}
+		}
+		target.Set(slice)
+		return nil
+	}
+
+	text, ok := scalarString(raw)
+	if !ok {
+		return ErrUnsupportedConfig
+	}
+	text = strings.TrimSpace(text)
+	if target.Type() == durationType {
+		if seconds, err := strconv.ParseFloat(text, 64); err == nil {
+			target.SetInt(int64(seconds * float64(time.Second)))
+			return nil
+		}
+		duration, err := time.ParseDuration(text)
+		if err != nil {
+			return err
+		}
+		target.SetInt(int64(duration))
+		return nil
+	}
+	switch target.Kind() {
+	case reflect.String:
+		target.SetString(text)
+	case reflect.Bool:
+		value, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		target.SetBool(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value, err := strconv.ParseInt(text, 10, target.Type().Bits())
+		if err != nil {
+			return err
+		}
+		target.SetInt(value)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value, err := strconv.ParseUint(text, 10, target.Type().Bits())
+		if err != nil {
+			return err
+		}
+		target.SetUint(value)
+	case reflect.Float32, reflect.Float64:
+		value, err := strconv.ParseFloat(text, target.Type().Bits())
+		if err != nil {
+			return err
+		}
+		target.SetFloat(value)
+	default:
+		return ErrUnsupportedConfig
+	}
+	return nil
+}
+
+// scalarString returns string form of scalar config value.
+func scalarString(raw interface{}) (string, bool) {
+	switch v := raw.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), true
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(v), true
+	}
+	return "", false
+}
+
+// lookupConfig returns value of dotted path in config. Path matches flat key like "redis.address"
+// in properties as well as nested maps loaded from json or yml file.
+func lookupConfig(config interface{}, path string) (interface{}, bool) {
+	if value, ok := configEntry(config, path); ok {
+		return value, true
+	}
+	for i := 0; i < len(path); i++ {
+		if path[i] != '.' {
+			continue
+		}
+		if sub, ok := configEntry(config, path[:i]); ok {
+			if value, ok := lookupConfig(sub, path[i+1:]); ok {
+				return value, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// configEntry returns value of key in config map. Exactly matched key is preferred to
+// case-insensitive one.
+func configEntry(config interface{}, key string) (interface{}, bool) {
+	switch m := config.(type) {
+	case map[string]string:
+		if value, ok := m[key]; ok {
+			return value, true
+		}
+		for k, value := range m {
+			if strings.EqualFold(k, key) {
+				return value, true
+			}
+		}
+	case map[string]interface{}:
+		if value, ok := m[key]; ok {
+			return value, true
+		}
+		for k, value := range m {
+			if strings.EqualFold(k, key) {
+				return value, true
+			}
+		}
+	case map[interface{}]interface{}:
+		if value, ok := m[key]; ok {
+			return value, true
+		}
+		for k, value := range m {
+			if strings.EqualFold(fmt.Sprint(k), key) {
+				return value, true
+			}
+		}
+	}
+	return nil, false
+}
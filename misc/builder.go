@@ -0,0 +1,267 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package misc
+
+import (
+	"flag"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Names of sources added by ConfigBuilder.
+const (
+	SourceEnv   = "env"
+	SourceFlags = "flags"
+)
+
+// Config is the read only view of config with dotted keys like "redis.address", which remembers
+// the source of each value.
+type Config struct {
+	values  map[string]interface{}
+	sources map[string]string
+}
+
+// Get returns value of specified key.
+func (c *Config) Get(key string) (interface{}, bool) {
+	value, ok := c.values[key]
+	return value, ok
+}
+
+// GetWithSource returns value of specified key and name of the source which provided it.
+func (c *Config) GetWithSource(key string) (value interface{}, source string, ok bool) {
+	value, ok = c.values[key]
+	return value, c.sources[key], ok
+}
+
+// Keys returns all keys in order.
+func (c *Config) Keys() []string {
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Map returns a copy of values with dotted keys.
+func (c *Config) Map() map[string]interface{} {
+	values := make(map[string]interface{}, len(c.values))
+	for key, value := range c.values {
+		values[key] = value
+	}
+	return values
+}
+
+// GetString returns value of specified key as string, or default value if it is absent.
+func (c *Config) GetString(key string, defaultValue string) string {
+	var value string
+	if c.convert(key, &value) {
+		return value
+	}
+	return defaultValue
+}
+
+// GetInt returns value of specified key as int, or default value if it is absent or invalid.
+func (c *Config) GetInt(key string, defaultValue int) int {
+	var value int
+	if c.convert(key, &value) {
+		return value
+	}
+	return defaultValue
+}
+
+// GetBool returns value of specified key as bool, or default value if it is absent or invalid.
+func (c *Config) GetBool(key string, defaultValue bool) bool {
+	var value bool
+	if c.convert(key, &value) {
+		return value
+	}
+	return defaultValue
+}
+
+// GetDuration returns value of specified key as duration, or default value if it is absent or
+// invalid. Value can be string like "1m30s" or number of seconds.
+func (c *Config) GetDuration(key string, defaultValue time.Duration) time.Duration {
+	var value time.Duration
+	if c.convert(key, &value) {
+		return value
+	}
+	return defaultValue
+}
+
+// GetStringSlice returns value of specified key as string slice, or default value if it is absent
+// or invalid. Value can be list or comma separated string.
+func (c *Config) GetStringSlice(key string, defaultValue []string) []string {
+	var value []string
+	if c.convert(key, &value) {
+		return value
+	}
+	return defaultValue
+}
+
+// convert convert value of key to type of value pointed by target with rules of UnmarshalConfig,
+// returns false if key is absent or value is invalid.
+func (c *Config) convert(key string, target interface{}) bool {
+	raw, ok := c.values[key]
+	if !ok {
+		return false
+	}
+	return convertValue(raw, reflect.ValueOf(target).Elem()) == nil
+}
+
+// Unmarshal fill fields of struct pointed by target with values. See UnmarshalConfig.
+func (c *Config) Unmarshal(target interface{}) error {
+	return UnmarshalConfig(c.values, target)
+}
+
+// NewConfig create a new Config instance with specified config loaded from json or yml file, and
+// values of nested maps can be accessed with dotted keys like "redis.address".
+func NewConfig(config map[string]interface{}) *Config {
+	values := FlattenConfig(config)
+	sources := make(map[string]string, len(values))
+	for key := range values {
+		sources[key] = ""
+	}
+	return &Config{values: values, sources: sources}
+}
+
+// configSource load values of a source, which may override values loaded from previous sources.
+type configSource struct {
+	name string
+	load func(values map[string]interface{}) (map[string]interface{}, error)
+}
+
+// ConfigBuilder merge config from multiple sources into one Config. Sources added later take
+// precedence over earlier ones, so sources should be added in order like:
+//  +----------+     +------+     +-----+     +-------+
+//  | defaults | ← ← | file | ← ← | env | ← ← | flags |
+//  +----------+     +------+     +-----+     +-------+
+// Defaults registered by SetDefault are always the first source.
+type ConfigBuilder struct {
+	sources []configSource
+	mutex   sync.Mutex
+}
+
+// AddMap add config map as source with specified name. Nested maps are flattened into dotted keys.
+func (b *ConfigBuilder) AddMap(name string, config map[string]interface{}) *ConfigBuilder {
+	return b.add(name, func(_ map[string]interface{}) (map[string]interface{}, error) {
+		return FlattenConfig(config), nil
+	})
+}
+
+// AddProperties add properties as source with specified name.
+func (b *ConfigBuilder) AddProperties(name string, properties map[string]string) *ConfigBuilder {
+	return b.add(name, func(_ map[string]interface{}) (map[string]interface{}, error) {
+		values := make(map[string]interface{}, len(properties))
+		for key, value := range properties {
+			values[key] = value
+		}
+		return values, nil
+	})
+}
+
+// AddFile add config file loaded by LoadConfigFile as source named with path of file. Error of
+// loading is returned by Build.
+func (b *ConfigBuilder) AddFile(path string) *ConfigBuilder {
+	return b.AddLoader(path, FileConfigLoader(path))
+}
+
+// AddLoader add config loaded by specified loader as source with specified name, such as
+// HttpConfigLoader for remote config. Error of loading is returned by Build.
+func (b *ConfigBuilder) AddLoader(name string, loader ConfigLoader) *ConfigBuilder {
+	return b.add(name, func(_ map[string]interface{}) (map[string]interface{}, error) {
+		config, err := loader()
+		if err != nil {
+			return nil, err
+		}
+		return FlattenConfig(config), nil
+	})
+}
+
+// AddEnv add environment variables as source named SourceEnv. Keys provided by previous sources
+// are overridden by environment variables named by EnvName with prefix.
+func (b *ConfigBuilder) AddEnv(prefix string) *ConfigBuilder {
+	return b.add(SourceEnv, func(values map[string]interface{}) (map[string]interface{}, error) {
+		overrides := make(map[string]interface{})
+		for key := range values {
+			if env, ok := os.LookupEnv(EnvName(prefix, key)); ok {
+				overrides[key] = env
+			}
+		}
+		return overrides, nil
+	})
+}
+
+// AddFlags add flags which set in command line as source named SourceFlags. Name of flag is used
+// as key, such as -redis.address=127.0.0.1:6379. Flag set should be parsed before Build.
+func (b *ConfigBuilder) AddFlags(flagSet *flag.FlagSet) *ConfigBuilder {
+	return b.add(SourceFlags, func(_ map[string]interface{}) (map[string]interface{}, error) {
+		values := make(map[string]interface{})
+		flagSet.Visit(func(f *flag.Flag) {
+			values[f.Name] = f.Value.String()
+		})
+		return values, nil
+	})
+}
+
+func (b *ConfigBuilder) add(name string, load func(map[string]interface{}) (map[string]interface{}, error)) *ConfigBuilder {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.sources = append(b.sources, configSource{name: name, load: load})
+	return b
+}
+
+// Build load all sources in order and merge them into a new Config.
+func (b *ConfigBuilder) Build() (*Config, error) {
+	b.mutex.Lock()
+	sources := append([]configSource(nil), b.sources...)
+	b.mutex.Unlock()
+
+	config := &Config{
+		values:  make(map[string]interface{}),
+		sources: make(map[string]string),
+	}
+	for _, source := range sources {
+		values, err := source.load(config.values)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range values {
+			config.values[key] = value
+			config.sources[key] = source.name
+		}
+	}
+	return config, nil
+}
+
+// NewConfigBuilder create a new ConfigBuilder instance with defaults registered by SetDefault as
+// the first source, which are taken while building.
+func NewConfigBuilder() *ConfigBuilder {
+	builder := &ConfigBuilder{}
+	return builder.add(SourceDefaults, func(_ map[string]interface{}) (map[string]interface{}, error) {
+		return FlattenConfig(Defaults()), nil
+	})
+}
@@ -24,29 +24,238 @@ package misc
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
+	"path/filepath"
 	"regexp"
 	"strings"
 )
 
+var (
+	ErrUnsupportedConfigFile = errors.New("unsupported config file")
+	ErrUnsupportedInclude    = errors.New("include directive is only supported by property file")
+)
+
 var (
 	regexpPropertyComment = regexp.MustCompile("#(\\w|\\W)*?(\n)")
 	regexpPropertyLine    = regexp.MustCompile("^(\\w|.|-|_)+=(\\w|\\W)*")
 )
 
-// LoadPropertyFile try load configuration properties from specified property file.
+const includeDirective = "@include "
+
+// Formats of config content.
+const (
+	FormatProperties = "properties"
+	FormatJson       = "json"
+	FormatYml        = "yml"
+	FormatIni        = "ini"
+)
+
+// LoadPropertyFile try load configuration properties from specified property file. Placeholders
+// like ${NAME:default} in values are replaced with environment variables, and values like ENC(...)
+// are decrypted with DecryptValue.
+// Other property files can be included with directive lines like below, which are resolved
+// relative to directory of the including file. Files matched by glob pattern are included in
+// lexical order, and properties after a directive override the included ones.
+//  @include shared.properties
+//  @include conf.d/*.properties
 func LoadPropertyFile(path string) (map[string]string, error) {
+	config := make(map[string]string)
+	if err := loadPropertyFile(path, config, make(map[string]bool)); err != nil {
+		return nil, err
+	}
+	ExpandProperties(config)
+	if err := DecryptProperties(config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// loadPropertyFile parse properties of specified file and files included by it into config.
+// Loading records absolute paths of files being loaded for detecting cyclic include.
+func loadPropertyFile(path string, config map[string]string, loading map[string]bool) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if loading[absPath] {
+		return fmt.Errorf("cyclic include of property file %s", path)
+	}
+	loading[absPath] = true
+	defer delete(loading, absPath)
+
+	fileContent, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return parsePropertiesInto(fileContent, config, func(pattern string) error {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		}
+		if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			// Included file without glob pattern must exist.
+			matches = []string{pattern}
+		}
+		for _, match := range matches {
+			if err := loadPropertyFile(match, config, loading); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// LoadIniFile try load configuration properties from specified ini file. Keys in sections are
+// flattened with section name like "server.port", and keys before any section are kept as is.
+// Lines start with ';' or '#' are comments, and quotes around values are removed. Placeholders
+// like ${NAME:default} in values are replaced with environment variables, and values like ENC(...)
+// are decrypted with DecryptValue.
+//  [server]
+//  port = 9090     → server.port=9090
+func LoadIniFile(path string) (map[string]string, error) {
 	fileContent, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
-	cleanContent := regexpPropertyComment.ReplaceAllString(string(fileContent), "\n")
-	lines := strings.Split(cleanContent, "\n")
+	config, err := parseIni(fileContent)
+	if err != nil {
+		return nil, err
+	}
+	ExpandProperties(config)
+	if err := DecryptProperties(config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// LoadJsonFile try load configuration from specified json file. Placeholders like ${NAME:default}
+// in string values are replaced with environment variables, and values like ENC(...) are
+// decrypted with DecryptValue.
+func LoadJsonFile(path string) (map[string]interface{}, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfig(bytes, FormatJson)
+}
 
+// LoadYmlFile try load configuration from specified yml file. Placeholders like ${NAME:default}
+// in string values are replaced with environment variables, and values like ENC(...) are
+// decrypted with DecryptValue.
+func LoadYmlFile(path string) (map[string]interface{}, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfig(bytes, FormatYml)
+}
+
+// ParseConfig parse configuration from content in specified format. Properties are parsed as config
+// with string values, and ErrUnsupportedInclude is returned for include directives since there is
+// no file to resolve them against. Placeholders like ${NAME:default} in string values are replaced
+// with environment variables, and values like ENC(...) are decrypted with DecryptValue.
+func ParseConfig(data []byte, format string) (map[string]interface{}, error) {
+	var config map[string]interface{}
+	switch format {
+	case FormatProperties:
+		properties, err := parseProperties(data)
+		if err != nil {
+			return nil, err
+		}
+		config = propertiesConfig(properties)
+	case FormatIni:
+		properties, err := parseIni(data)
+		if err != nil {
+			return nil, err
+		}
+		config = propertiesConfig(properties)
+	case FormatJson:
+		if err := json.Unmarshal(data, &config); err != nil {
+			return nil, err
+		}
+	case FormatYml:
+		if err := yaml.Unmarshal(data, &config); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrUnsupportedConfigFile
+	}
+	return resolveConfig(config)
+}
+
+// propertiesConfig returns config with string values of properties.
+func propertiesConfig(properties map[string]string) map[string]interface{} {
+	config := make(map[string]interface{}, len(properties))
+	for key, value := range properties {
+		config[key] = value
+	}
+	return config
+}
+
+// resolveConfig replace placeholders and decrypt values in config.
+func resolveConfig(config map[string]interface{}) (map[string]interface{}, error) {
+	if config == nil {
+		config = make(map[string]interface{})
+	}
+	ExpandConfig(config)
+	if err := DecryptConfig(config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// FormatOf returns format of config file by extension, or empty string if it is unknown.
+//  .properties .conf → FormatProperties
+//  .json             → FormatJson
+//  .yml .yaml        → FormatYml
+//  .ini              → FormatIni
+func FormatOf(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".properties", ".conf":
+		return FormatProperties
+	case ".json":
+		return FormatJson
+	case ".yml", ".yaml":
+		return FormatYml
+	case ".ini":
+		return FormatIni
+	}
+	return ""
+}
+
+// parseProperties parse lines like "key=value" from content of property file. Returns
+// ErrUnsupportedInclude if content has include directives.
+func parseProperties(content []byte) (map[string]string, error) {
 	config := make(map[string]string)
+	err := parsePropertiesInto(content, config, func(pattern string) error {
+		return ErrUnsupportedInclude
+	})
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// parsePropertiesInto parse lines like "key=value" from content of property file into config, and
+// invoke include with pattern of include directive lines.
+func parsePropertiesInto(content []byte, config map[string]string, include func(pattern string) error) error {
+	cleanContent := regexpPropertyComment.ReplaceAllString(string(content), "\n")
+	lines := strings.Split(cleanContent, "\n")
+
 	for _, line := range lines {
 		trimLine := strings.Trim(line, " ")
+		if strings.HasPrefix(trimLine, includeDirective) {
+			if err := include(strings.TrimSpace(trimLine[len(includeDirective):])); err != nil {
+				return err
+			}
+			continue
+		}
 		if !regexpPropertyLine.MatchString(trimLine) {
 			continue
 		}
@@ -58,31 +267,84 @@ func LoadPropertyFile(path string) (map[string]string, error) {
 		}
 		config[propertyKey] = propertyValue
 	}
-	return config, nil
+	return nil
 }
 
-// LoadJsonFile try load configuration from specified json file.
-func LoadJsonFile(path string) (map[string]interface{}, error) {
-	bytes, err := ioutil.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
-	var config map[string]interface{}
-	if err := json.Unmarshal(bytes, &config); err != nil {
-		return nil, err
+// parseIni parse sections and lines like "key = value" or "key: value" from content of ini file.
+func parseIni(content []byte) (map[string]string, error) {
+	config := make(map[string]string)
+	section := ""
+	for number, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+		if line[0] == '[' {
+			if line[len(line)-1] != ']' {
+				return nil, fmt.Errorf("invalid ini section at line %d", number+1)
+			}
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		separator := strings.IndexAny(line, "=:")
+		if separator <= 0 {
+			return nil, fmt.Errorf("invalid ini property at line %d", number+1)
+		}
+		key := strings.TrimSpace(line[:separator])
+		value := strings.TrimSpace(line[separator+1:])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		if section != "" {
+			key = section + "." + key
+		}
+		config[key] = value
 	}
 	return config, nil
 }
 
-// LoadYmlFile try load configuration from specified yml file.
-func LoadYmlFile(path string) (map[string]interface{}, error) {
+// LoadConfigFile try load configuration from specified file in format chosen by FormatOf. Property
+// file is loaded with files included by it like LoadPropertyFile.
+func LoadConfigFile(path string) (map[string]interface{}, error) {
+	format := FormatOf(path)
+	if format == "" {
+		return nil, ErrUnsupportedConfigFile
+	}
+	if format == FormatProperties {
+		properties := make(map[string]string)
+		if err := loadPropertyFile(path, properties, make(map[string]bool)); err != nil {
+			return nil, err
+		}
+		return resolveConfig(propertiesConfig(properties))
+	}
 	bytes, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
-	var config map[string]interface{}
-	if err := yaml.Unmarshal(bytes, &config); err != nil {
-		return nil, err
+	return ParseConfig(bytes, format)
+}
+
+// FlattenConfig returns config with values of nested maps flattened into dotted keys like
+// "redis.address". Lists are kept as values.
+func FlattenConfig(config map[string]interface{}) map[string]interface{} {
+	flat := make(map[string]interface{})
+	for key, value := range config {
+		flattenValue(flat, key, value)
+	}
+	return flat
+}
+
+func flattenValue(flat map[string]interface{}, path string, value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			flattenValue(flat, path+"."+key, item)
+		}
+	case map[interface{}]interface{}:
+		for key, item := range v {
+			flattenValue(flat, path+"."+fmt.Sprint(key), item)
+		}
+	default:
+		flat[path] = value
 	}
-	return config, nil
 }
@@ -0,0 +1,425 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package misc_test
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"github.com/mervinkid/matcha/misc"
+	"github.com/mervinkid/matcha/util"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	dir, err := ioutil.TempDir("", "matcha-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestEnv(t *testing.T) {
+	os.Setenv("MATCHA_TEST_HOST", "10.0.0.1")
+	os.Setenv("MATCHA_TEST_REDIS_PASSWORD", "secret")
+	os.Unsetenv("MATCHA_TEST_PORT")
+	defer os.Unsetenv("MATCHA_TEST_HOST")
+	defer os.Unsetenv("MATCHA_TEST_REDIS_PASSWORD")
+
+	if value := misc.ExpandEnv("${MATCHA_TEST_HOST:127.0.0.1}:${MATCHA_TEST_PORT:6379}"); value != "10.0.0.1:6379" {
+		t.Fatal("unexpected value", value)
+	}
+
+	path := writeConfigFile(t, "app.properties", "address=${MATCHA_TEST_HOST}\nredis.password=plain\n")
+	defer os.RemoveAll(filepath.Dir(path))
+	properties, err := misc.LoadPropertyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	misc.OverridePropertiesWithEnv(properties, "MATCHA_TEST_")
+	if properties["address"] != "10.0.0.1" || properties["redis.password"] != "secret" {
+		t.Fatal("unexpected properties", properties)
+	}
+
+	path = writeConfigFile(t, "app.yml", "redis:\n  password: plain\n  port: ${MATCHA_TEST_PORT:6379}\n")
+	defer os.RemoveAll(filepath.Dir(path))
+	config, err := misc.LoadYmlFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	misc.OverrideConfigWithEnv(config, "MATCHA_TEST_")
+	redis := config["redis"].(map[interface{}]interface{})
+	if redis["password"] != "secret" || redis["port"] != "6379" {
+		t.Fatal("unexpected config", config)
+	}
+}
+
+type redisConfig struct {
+	Address  string
+	Password string `config:"password"`
+}
+
+type tcpConfig struct {
+	Port int `config:"port"`
+}
+
+type appConfig struct {
+	tcpConfig
+	IP       net.IP        `config:"ip"`
+	Timeout  time.Duration `config:"timeout"`
+	Debug    bool          `config:"debug"`
+	Tags     []string      `config:"tags"`
+	Url      util.URL      `config:"url"`
+	Redis    redisConfig   `config:"redis"`
+	Backup   *redisConfig  `config:"backup"`
+	Ignored  string        `config:"-"`
+	Fallback int           `config:"fallback"`
+}
+
+func TestUnmarshalConfig(t *testing.T) {
+	properties := map[string]string{
+		"port":           "9090",
+		"ip":             "10.0.0.1",
+		"timeout":        "1m30s",
+		"debug":          "true",
+		"tags":           "a, b",
+		"url":            "redis://127.0.0.1:6379",
+		"redis.address":  "127.0.0.1:6379",
+		"redis.password": "secret",
+		"Ignored":        "value",
+	}
+	config := appConfig{Fallback: 3}
+	if err := misc.UnmarshalConfig(properties, &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Port != 9090 || !config.IP.Equal(net.ParseIP("10.0.0.1")) || config.Timeout != 90*time.Second ||
+		!config.Debug || len(config.Tags) != 2 || config.Tags[1] != "b" || config.Url.Port != 6379 ||
+		config.Redis.Address != "127.0.0.1:6379" || config.Redis.Password != "secret" ||
+		config.Backup != nil || config.Ignored != "" || config.Fallback != 3 {
+		t.Fatalf("unexpected config %+v", config)
+	}
+
+	nested := map[string]interface{}{
+		"timeout": float64(2),
+		"tags":    []interface{}{"x"},
+		"backup":  map[interface{}]interface{}{"address": "10.0.0.2:6379"},
+	}
+	if err := misc.UnmarshalConfig(nested, &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Timeout != 2*time.Second || len(config.Tags) != 1 || config.Backup == nil ||
+		config.Backup.Address != "10.0.0.2:6379" {
+		t.Fatalf("unexpected config %+v", config)
+	}
+
+	if err := misc.UnmarshalConfig(map[string]string{"port": "http"}, &config); err == nil {
+		t.Fatal("expect error of invalid port")
+	}
+	if err := misc.UnmarshalConfig(properties, config); err != misc.ErrInvalidConfigTarget {
+		t.Fatal("expect invalid target but got", err)
+	}
+}
+
+func TestConfigWatcher(t *testing.T) {
+	path := writeConfigFile(t, "app.yml", "log:\n  level: info\nredis:\n  address: 127.0.0.1:6379\n")
+	defer os.RemoveAll(filepath.Dir(path))
+
+	watcher := misc.NewConfigWatcher(path, 10*time.Millisecond)
+	if err := watcher.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Stop()
+	if watcher.Config()["log.level"] != "info" {
+		t.Fatal("unexpected config", watcher.Config())
+	}
+
+	changeC := make(chan string, 4)
+	watcher.OnChange("log.level", func(key string, value interface{}) {
+		changeC <- key + "=" + fmt.Sprint(value)
+	})
+	watcher.OnChange("", func(key string, value interface{}) {
+		changeC <- "*" + key + "=" + fmt.Sprint(value)
+	})
+	if err := ioutil.WriteFile(path, []byte("log:\n  level: debug\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changes := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		select {
+		case change := <-changeC:
+			changes[change] = true
+		case <-time.After(time.Second):
+			t.Fatal("expect change but got", changes)
+		}
+	}
+	if !changes["log.level=debug"] || !changes["*log.level=debug"] || !changes["*redis.address=<nil>"] {
+		t.Fatal("unexpected changes", changes)
+	}
+}
+
+func TestConfigBuilder(t *testing.T) {
+	path := writeConfigFile(t, "app.json", `{"redis": {"address": "10.0.0.1:6379", "password": "plain"}}`)
+	defer os.RemoveAll(filepath.Dir(path))
+	os.Setenv("MATCHA_TEST_REDIS_PASSWORD", "secret")
+	defer os.Unsetenv("MATCHA_TEST_REDIS_PASSWORD")
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	flagSet.String("log.level", "info", "")
+	flagSet.String("redis.address", "", "")
+	if err := flagSet.Parse([]string{"-log.level=debug"}); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := misc.NewConfigBuilder().
+		AddMap("defaults", map[string]interface{}{"redis": map[string]interface{}{"address": "127.0.0.1:6379"}, "log.level": "warn"}).
+		AddFile(path).
+		AddEnv("MATCHA_TEST_").
+		AddFlags(flagSet).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][2]string{
+		"redis.address":  {"10.0.0.1:6379", path},
+		"redis.password": {"secret", misc.SourceEnv},
+		"log.level":      {"debug", misc.SourceFlags},
+	}
+	for key, expect := range expected {
+		value, source, ok := config.GetWithSource(key)
+		if !ok || value != expect[0] || source != expect[1] {
+			t.Fatal("unexpected value of", key, value, source)
+		}
+	}
+	if len(config.Keys()) != 3 {
+		t.Fatal("unexpected keys", config.Keys())
+	}
+
+	if _, err := misc.NewConfigBuilder().AddFile(path + ".missing").Build(); err == nil {
+		t.Fatal("expect error of missing file")
+	}
+}
+
+func TestConfigGetters(t *testing.T) {
+	config := misc.NewConfig(map[string]interface{}{
+		"server": map[interface{}]interface{}{
+			"port":    float64(9090),
+			"tls":     "true",
+			"timeout": "1m",
+			"hosts":   []interface{}{"a", "b"},
+		},
+		"tags": "x, y",
+	})
+	if config.GetString("server.port", "") != "9090" || config.GetInt("server.port", 0) != 9090 ||
+		!config.GetBool("server.tls", false) || config.GetDuration("server.timeout", 0) != time.Minute ||
+		len(config.GetStringSlice("server.hosts", nil)) != 2 || len(config.GetStringSlice("tags", nil)) != 2 {
+		t.Fatal("unexpected config", config.Map())
+	}
+	if config.GetInt("server.tls", 7) != 7 || config.GetString("missing", "default") != "default" {
+		t.Fatal("expect default values")
+	}
+	var app struct {
+		Server struct {
+			Port int
+		}
+	}
+	if err := config.Unmarshal(&app); err != nil || app.Server.Port != 9090 {
+		t.Fatal("unexpected app", app, err)
+	}
+}
+
+func TestHttpConfigLoader(t *testing.T) {
+	var level atomic.Value
+	level.Store("info")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"log": {"level": "%s"}}`, level.Load())
+	}))
+	defer server.Close()
+
+	watcher := misc.NewPollingConfigWatcher(server.URL, misc.HttpConfigLoader(server.URL, nil), 10*time.Millisecond)
+	if err := watcher.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Stop()
+	if watcher.Config()["log.level"] != "info" {
+		t.Fatal("unexpected config", watcher.Config())
+	}
+	changeC := make(chan interface{}, 1)
+	watcher.OnChange("log.level", func(key string, value interface{}) {
+		changeC <- value
+	})
+	level.Store("debug")
+	select {
+	case value := <-changeC:
+		if value != "debug" {
+			t.Fatal("unexpected value", value)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expect change")
+	}
+
+	if _, err := misc.HttpConfigLoader(server.URL+"/missing", nil)(); err == nil {
+		t.Fatal("expect error of missing config")
+	}
+}
+
+func TestLoadIniFile(t *testing.T) {
+	path := writeConfigFile(t, "app.ini", "; comment\nname = app\n\n[server]\nport = 9090\n# comment\n[redis]\naddress: \"10.0.0.1:6379\"\n")
+	defer os.RemoveAll(filepath.Dir(path))
+	properties, err := misc.LoadIniFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(properties) != 3 || properties["name"] != "app" || properties["server.port"] != "9090" ||
+		properties["redis.address"] != "10.0.0.1:6379" {
+		t.Fatal("unexpected properties", properties)
+	}
+	config, err := misc.LoadConfigFile(path)
+	if err != nil || config["server.port"] != "9090" {
+		t.Fatal("unexpected config", config, err)
+	}
+
+	path = writeConfigFile(t, "bad.ini", "[server\nport = 9090\n")
+	defer os.RemoveAll(filepath.Dir(path))
+	if _, err := misc.LoadIniFile(path); err == nil {
+		t.Fatal("expect error of invalid section")
+	}
+}
+
+func TestEncryptedConfig(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	encrypted, err := misc.EncryptValue(key, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := writeConfigFile(t, "app.yml", "redis:\n  password: "+encrypted+"\n")
+	defer os.RemoveAll(filepath.Dir(path))
+
+	os.Unsetenv(misc.ConfigKeyEnv)
+	if _, err := misc.LoadYmlFile(path); err == nil {
+		t.Fatal("expect error without decrypter")
+	}
+
+	os.Setenv(misc.ConfigKeyEnv, base64.StdEncoding.EncodeToString(key))
+	defer os.Unsetenv(misc.ConfigKeyEnv)
+	config, err := misc.LoadYmlFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if password := config["redis"].(map[interface{}]interface{})["password"]; password != "secret" {
+		t.Fatal("unexpected password", password)
+	}
+
+	misc.SetDecrypter(func(text string) (string, error) {
+		return strings.ToUpper(text), nil
+	})
+	defer misc.SetDecrypter(nil)
+	if value, err := misc.DecryptValue("ENC(kms)"); err != nil || value != "KMS" {
+		t.Fatal("unexpected value", value, err)
+	}
+}
+
+func TestPropertyInclude(t *testing.T) {
+	path := writeConfigFile(t, "app.properties", "name=app\n@include shared.properties\n@include conf.d/*.properties\nport=9091\n")
+	dir := filepath.Dir(path)
+	defer os.RemoveAll(dir)
+	os.Mkdir(filepath.Join(dir, "conf.d"), 0755)
+	files := map[string]string{
+		"shared.properties":         "name=shared\nport=9090\ntimeout=3s\n",
+		"conf.d/a-redis.properties": "redis.address=127.0.0.1:6379\n",
+		"conf.d/b-redis.properties": "redis.address=10.0.0.1:6379\n",
+		"cycle.properties":          "@include app.properties\n",
+		"missing.properties":        "@include absent.properties\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	properties, err := misc.LoadPropertyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if properties["name"] != "shared" || properties["port"] != "9091" || properties["timeout"] != "3s" ||
+		properties["redis.address"] != "10.0.0.1:6379" {
+		t.Fatal("unexpected properties", properties)
+	}
+	config, err := misc.LoadConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config["name"] != "shared" || config["redis.address"] != "10.0.0.1:6379" {
+		t.Fatal("unexpected config", config)
+	}
+	if _, err := misc.ParseConfig([]byte("@include shared.properties\n"), misc.FormatProperties); err != misc.ErrUnsupportedInclude {
+		t.Fatal("expect unsupported include but got", err)
+	}
+
+	ioutil.WriteFile(path, []byte("@include cycle.properties\n"), 0644)
+	if _, err := misc.LoadPropertyFile(path); err == nil {
+		t.Fatal("expect error of cyclic include")
+	}
+	if _, err := misc.LoadPropertyFile(filepath.Join(dir, "missing.properties")); err == nil {
+		t.Fatal("expect error of missing include")
+	}
+}
+
+func TestSetDefault(t *testing.T) {
+	misc.SetDefault("pipeline.queue-size", 64)
+	misc.SetDefault("client.timeout", "3s")
+	defer misc.RemoveDefault("pipeline.queue-size")
+	defer misc.RemoveDefault("client.timeout")
+	if defaults := misc.Defaults(); len(defaults) != 2 || defaults["pipeline.queue-size"] != 64 {
+		t.Fatal("unexpected defaults", defaults)
+	}
+
+	config, err := misc.NewConfigBuilder().
+		AddProperties("file", map[string]string{"client.timeout": "5s"}).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size, source, _ := config.GetWithSource("pipeline.queue-size"); size != 64 || source != misc.SourceDefaults {
+		t.Fatal("unexpected queue size", size, source)
+	}
+	if config.GetDuration("client.timeout", 0) != 5*time.Second {
+		t.Fatal("unexpected timeout", config.GetDuration("client.timeout", 0))
+	}
+}
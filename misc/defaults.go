@@ -0,0 +1,60 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package misc
+
+import "sync"
+
+// SourceDefaults is the name of source of defaults registered by SetDefault.
+const SourceDefaults = "defaults"
+
+var (
+	defaults      = make(map[string]interface{})
+	defaultsMutex sync.RWMutex
+)
+
+// SetDefault register default value of specified config key, so components can publish their
+// defaults which can be inspected with Defaults and overridden by other sources. Defaults are
+// applied as the first source of ConfigBuilder created by NewConfigBuilder.
+func SetDefault(key string, value interface{}) {
+	defaultsMutex.Lock()
+	defer defaultsMutex.Unlock()
+	defaults[key] = value
+}
+
+// RemoveDefault remove default value of specified config key.
+func RemoveDefault(key string) {
+	defaultsMutex.Lock()
+	defer defaultsMutex.Unlock()
+	delete(defaults, key)
+}
+
+// Defaults returns a copy of registered default values.
+func Defaults() map[string]interface{} {
+	defaultsMutex.RLock()
+	defer defaultsMutex.RUnlock()
+	values := make(map[string]interface{}, len(defaults))
+	for key, value := range defaults {
+		values[key] = value
+	}
+	return values
+}
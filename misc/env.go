@@ -0,0 +1,130 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package misc
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// regexpEnvPlaceholder matches placeholders like ${NAME} and ${NAME:default}.
+var regexpEnvPlaceholder = regexp.MustCompile("\\$\\{([A-Za-z_][A-Za-z0-9_]*)(:([^}]*))?\\}")
+
+// ExpandEnv replace placeholders like ${NAME:default} in specified value with environment variables.
+// Default value is used if variable is unset or empty, and placeholder without default is replaced
+// with empty string in that case.
+func ExpandEnv(value string) string {
+	if !strings.Contains(value, "${") {
+		return value
+	}
+	return regexpEnvPlaceholder.ReplaceAllStringFunc(value, func(placeholder string) string {
+		match := regexpEnvPlaceholder.FindStringSubmatch(placeholder)
+		if env := os.Getenv(match[1]); env != "" {
+			return env
+		}
+		return match[3]
+	})
+}
+
+// ExpandProperties replace placeholders in all values of specified properties with environment variables.
+func ExpandProperties(config map[string]string) {
+	for key, value := range config {
+		config[key] = ExpandEnv(value)
+	}
+}
+
+// ExpandConfig replace placeholders in all string values of specified config loaded from json or
+// yml file with environment variables, including values in nested maps and slices.
+func ExpandConfig(config map[string]interface{}) {
+	for key, value := range config {
+		config[key] = expandValue(value)
+	}
+}
+
+func expandValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return ExpandEnv(v)
+	case map[string]interface{}:
+		ExpandConfig(v)
+	case map[interface{}]interface{}:
+		for key, item := range v {
+			v[key] = expandValue(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = expandValue(item)
+		}
+	}
+	return value
+}
+
+// EnvName returns name of environment variable which overrides specified config key, which is the
+// key with prefix in upper case and separators replaced by underscore, such as:
+//  prefix: MATCHA_, key: redis.max-idle → MATCHA_REDIS_MAX_IDLE
+func EnvName(prefix, key string) string {
+	return strings.ToUpper(prefix + strings.NewReplacer(".", "_", "-", "_").Replace(key))
+}
+
+// OverridePropertiesWithEnv replace values of specified properties with environment variables named by
+// EnvName with prefix. Only existing keys will be overridden.
+func OverridePropertiesWithEnv(config map[string]string, prefix string) {
+	for key := range config {
+		if env, ok := os.LookupEnv(EnvName(prefix, key)); ok {
+			config[key] = env
+		}
+	}
+}
+
+// OverrideConfigWithEnv replace values of specified config loaded from json or yml file with
+// environment variables named by EnvName with prefix. Key of value in nested map is the dotted path
+// such as "redis.address". Only existing scalar values will be overridden, and they are replaced
+// with string values.
+func OverrideConfigWithEnv(config map[string]interface{}, prefix string) {
+	for key, value := range config {
+		config[key] = overrideValue(value, prefix, key)
+	}
+}
+
+func overrideValue(value interface{}, prefix, path string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = overrideValue(item, prefix, path+"."+key)
+		}
+		return value
+	case map[interface{}]interface{}:
+		for key, item := range v {
+			v[key] = overrideValue(item, prefix, path+"."+fmt.Sprint(key))
+		}
+		return value
+	case []interface{}:
+		return value
+	}
+	if env, ok := os.LookupEnv(EnvName(prefix, path)); ok {
+		return env
+	}
+	return value
+}
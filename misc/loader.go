@@ -0,0 +1,88 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package misc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const defaultHttpConfigTimeout = 10 * time.Second
+
+// ConfigLoader is the method which load config from a source such as file or remote endpoint.
+type ConfigLoader func() (map[string]interface{}, error)
+
+// FileConfigLoader returns ConfigLoader which load specified file with LoadConfigFile.
+func FileConfigLoader(path string) ConfigLoader {
+	return func() (map[string]interface{}, error) {
+		return LoadConfigFile(path)
+	}
+}
+
+// HttpConfigLoader returns ConfigLoader which load config from specified HTTP(S) endpoint with GET
+// request. Format of response is chosen by Content-Type, or by extension of url path with FormatOf
+// if Content-Type is unknown, and it is FormatYml by default. Client with timeout of 10 seconds is
+// used if client is nil.
+func HttpConfigLoader(endpoint string, client *http.Client) ConfigLoader {
+	if client == nil {
+		client = &http.Client{Timeout: defaultHttpConfigTimeout}
+	}
+	return func() (map[string]interface{}, error) {
+		resp, err := client.Get(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("load config from %s fail with status %d", endpoint, resp.StatusCode)
+		}
+		return ParseConfig(body, httpConfigFormat(endpoint, resp.Header.Get("Content-Type")))
+	}
+}
+
+// httpConfigFormat returns format of config by content type or url path.
+func httpConfigFormat(endpoint, contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/json":
+		return FormatJson
+	case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+		return FormatYml
+	case "text/x-java-properties":
+		return FormatProperties
+	}
+	if u, err := url.Parse(endpoint); err == nil {
+		if format := FormatOf(u.Path); format != "" {
+			return format
+		}
+	}
+	return FormatYml
+}
@@ -0,0 +1,241 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package misc
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mervinkid/matcha/logging"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+var (
+	ErrManagerRunning    = errors.New("lifecycle manager is running")
+	ErrDuplicateName     = errors.New("duplicate component name")
+	ErrCyclicDependency  = errors.New("cyclic dependency of components")
+	ErrUnknownDependency = errors.New("unknown dependency of component")
+)
+
+// LifecycleErrors is the aggregated errors of components.
+type LifecycleErrors []error
+
+func (e LifecycleErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// LifecycleManager is the interface of Lifecycle which start registered components in order of
+// dependencies and stop them in reverse order. Components without dependency between them are
+// started in order of registration. Components already started will be stopped in reverse order
+// if one of components fail to start.
+// Methods:
+//  Register add component with unique name and names of components it depends on before start.
+//  Sync block invoker until manager stopped or one of signals received, then stop all components.
+//
+// Model:
+//  +----------+     +----------+     +------------+
+//  | registry | ← ← |  server  | ← ← | schedulers |   Start → → →
+//  +----------+     +----------+     +------------+   ← ← ← Stop
+type LifecycleManager interface {
+	Lifecycle
+	Sync
+	Register(name string, lifecycle Lifecycle, dependsOn ...string) error
+}
+
+type managedComponent struct {
+	name      string
+	lifecycle Lifecycle
+	dependsOn []string
+}
+
+// orderedLifecycleManager is the default implementation of LifecycleManager interface.
+type orderedLifecycleManager struct {
+	signals    []os.Signal
+	components []managedComponent
+	started    []managedComponent
+	running    bool
+	stopC      chan uint8
+	mutex      sync.Mutex
+}
+
+func (m *orderedLifecycleManager) Register(name string, lifecycle Lifecycle, dependsOn ...string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.running {
+		return ErrManagerRunning
+	}
+	if lifecycle == nil {
+		return errors.New("lifecycle is nil")
+	}
+	for _, component := range m.components {
+		if component.name == name {
+			return fmt.Errorf("%v: %s", ErrDuplicateName, name)
+		}
+	}
+	m.components = append(m.components, managedComponent{name: name, lifecycle: lifecycle, dependsOn: dependsOn})
+	return nil
+}
+
+func (m *orderedLifecycleManager) Start() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.running {
+		return nil
+	}
+	ordered, err := m.order()
+	if err != nil {
+		return err
+	}
+	for _, component := range ordered {
+		if err := component.lifecycle.Start(); err != nil {
+			errs := LifecycleErrors{fmt.Errorf("start %s fail cause %v", component.name, err)}
+			errs = append(errs, m.stopStarted()...)
+			if len(errs) == 1 {
+				return errs[0]
+			}
+			return errs
+		}
+		logging.Debug("Component %s started.", component.name)
+		m.started = append(m.started, component)
+	}
+	m.running = true
+	m.stopC = make(chan uint8)
+	return nil
+}
+
+func (m *orderedLifecycleManager) Stop() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if !m.running {
+		return
+	}
+	if errs := m.stopStarted(); len(errs) > 0 {
+		logging.Error("Stop components fail cause %s.", errs.Error())
+	}
+	m.running = false
+	close(m.stopC)
+}
+
+func (m *orderedLifecycleManager) IsRunning() bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.running
+}
+
+func (m *orderedLifecycleManager) Sync() {
+	m.mutex.Lock()
+	if !m.running {
+		m.mutex.Unlock()
+		return
+	}
+	stopC := m.stopC
+	m.mutex.Unlock()
+
+	signalC := make(chan os.Signal, 1)
+	signal.Notify(signalC, m.signals...)
+	defer signal.Stop(signalC)
+	select {
+	case <-stopC:
+	case sig := <-signalC:
+		logging.Info("Stop components cause received signal %s.", sig.String())
+		m.Stop()
+	}
+}
+
+// stopStarted stop started components in reverse order, returns errors of panic while stopping.
+// Should be invoked with lock.
+func (m *orderedLifecycleManager) stopStarted() LifecycleErrors {
+	var errs LifecycleErrors
+	for i := len(m.started) - 1; i >= 0; i-- {
+		component := m.started[i]
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					errs = append(errs, fmt.Errorf("stop %s panic cause %v", component.name, r))
+				}
+			}()
+			component.lifecycle.Stop()
+			logging.Debug("Component %s stopped.", component.name)
+		}()
+	}
+	m.started = nil
+	return errs
+}
+
+// order returns components sorted by dependencies. Should be invoked with lock.
+func (m *orderedLifecycleManager) order() ([]managedComponent, error) {
+	index := make(map[string]managedComponent, len(m.components))
+	for _, component := range m.components {
+		index[component.name] = component
+	}
+	// 0: unvisited, 1: visiting, 2: visited
+	states := make(map[string]uint8, len(m.components))
+	ordered := make([]managedComponent, 0, len(m.components))
+	var visit func(component managedComponent) error
+	visit = func(component managedComponent) error {
+		switch states[component.name] {
+		case 1:
+			return fmt.Errorf("%v: %s", ErrCyclicDependency, component.name)
+		case 2:
+			return nil
+		}
+		states[component.name] = 1
+		for _, name := range component.dependsOn {
+			dependency, ok := index[name]
+			if !ok {
+				return fmt.Errorf("%v: %s depends on %s", ErrUnknownDependency, component.name, name)
+			}
+			if err := visit(dependency); err != nil {
+				return err
+			}
+		}
+		states[component.name] = 2
+		ordered = append(ordered, component)
+		return nil
+	}
+	for _, component := range m.components {
+		if err := visit(component); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// NewLifecycleManager create a new LifecycleManager instance which stop components while one of
+// specified signals received in Sync, SIGTERM and SIGINT by default.
+func NewLifecycleManager(signals ...os.Signal) LifecycleManager {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGTERM, os.Interrupt}
+	}
+	return &orderedLifecycleManager{signals: signals}
+}
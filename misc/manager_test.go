@@ -0,0 +1,113 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package misc_test
+
+import (
+	"errors"
+	"github.com/mervinkid/matcha/misc"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordComponent struct {
+	name    string
+	err     error
+	events  *[]string
+	mutex   *sync.Mutex
+	running bool
+}
+
+func (c *recordComponent) record(event string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	*c.events = append(*c.events, event+" "+c.name)
+}
+
+func (c *recordComponent) Start() error {
+	if c.err != nil {
+		return c.err
+	}
+	c.record("start")
+	c.running = true
+	return nil
+}
+
+func (c *recordComponent) Stop() {
+	c.record("stop")
+	c.running = false
+}
+
+func (c *recordComponent) IsRunning() bool {
+	return c.running
+}
+
+func TestLifecycleManager(t *testing.T) {
+	var events []string
+	var mutex sync.Mutex
+	component := func(name string, err error) *recordComponent {
+		return &recordComponent{name: name, err: err, events: &events, mutex: &mutex}
+	}
+
+	manager := misc.NewLifecycleManager()
+	manager.Register("scheduler", component("scheduler", nil), "server", "registry")
+	manager.Register("server", component("server", nil), "registry")
+	manager.Register("registry", component("registry", nil))
+	if err := manager.Register("server", component("server", nil)); err == nil {
+		t.Fatal("expect error of duplicate name")
+	}
+	if err := manager.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Register("other", component("other", nil)); err != misc.ErrManagerRunning {
+		t.Fatal("expect manager running but got", err)
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		manager.Stop()
+	}()
+	manager.Sync()
+	expected := "start registry,start server,start scheduler,stop scheduler,stop server,stop registry"
+	if strings.Join(events, ",") != expected {
+		t.Fatal("unexpected events", events)
+	}
+
+	events = nil
+	manager = misc.NewLifecycleManager()
+	manager.Register("registry", component("registry", nil))
+	manager.Register("server", component("server", errors.New("port in use")), "registry")
+	if err := manager.Start(); err == nil || !strings.Contains(err.Error(), "port in use") {
+		t.Fatal("expect start error but got", err)
+	}
+	if manager.IsRunning() || strings.Join(events, ",") != "start registry,stop registry" {
+		t.Fatal("unexpected events", events)
+	}
+
+	manager = misc.NewLifecycleManager()
+	manager.Register("a", component("a", nil), "b")
+	manager.Register("b", component("b", nil), "a")
+	if err := manager.Start(); err == nil || !strings.Contains(err.Error(), misc.ErrCyclicDependency.Error()) {
+		t.Fatal("expect cyclic dependency but got", err)
+	}
+}
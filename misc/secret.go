@@ -0,0 +1,198 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package misc
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ConfigKeyEnv is the environment variable of base64 encoded AES key used for decrypting config
+// values while no Decrypter is set.
+const ConfigKeyEnv = "MATCHA_CONFIG_KEY"
+
+var (
+	ErrNoDecrypter      = errors.New("no decrypter for encrypted config")
+	ErrInvalidSecretKey = errors.New("secret key must be 16, 24 or 32 bytes")
+	ErrInvalidSecret    = errors.New("invalid encrypted config")
+)
+
+// regexpEncryptedValue matches encrypted values like ENC(...).
+var regexpEncryptedValue = regexp.MustCompile("^ENC\\((.*)\\)$")
+
+// Decrypter is the method which decrypt text wrapped in ENC(...), such as a callback of KMS.
+type Decrypter func(text string) (string, error)
+
+var (
+	decrypter      Decrypter
+	decrypterMutex sync.RWMutex
+)
+
+// SetDecrypter set Decrypter used for values like ENC(...) while loading config. AES decrypter with
+// key in environment variable MATCHA_CONFIG_KEY is used if it is not set.
+func SetDecrypter(d Decrypter) {
+	decrypterMutex.Lock()
+	defer decrypterMutex.Unlock()
+	decrypter = d
+}
+
+// currentDecrypter returns Decrypter set by SetDecrypter, or AES decrypter with key in environment
+// variable.
+func currentDecrypter() (Decrypter, error) {
+	decrypterMutex.RLock()
+	d := decrypter
+	decrypterMutex.RUnlock()
+	if d != nil {
+		return d, nil
+	}
+	encodedKey := os.Getenv(ConfigKeyEnv)
+	if encodedKey == "" {
+		return nil, ErrNoDecrypter
+	}
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, ErrInvalidSecretKey
+	}
+	return NewAesDecrypter(key)
+}
+
+// DecryptValue returns decrypted value if specified value is wrapped like ENC(...), or value itself.
+func DecryptValue(value string) (string, error) {
+	match := regexpEncryptedValue.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return value, nil
+	}
+	d, err := currentDecrypter()
+	if err != nil {
+		return "", err
+	}
+	return d(match[1])
+}
+
+// DecryptProperties decrypt values like ENC(...) of specified properties.
+func DecryptProperties(config map[string]string) error {
+	for key, value := range config {
+		decrypted, err := DecryptValue(value)
+		if err != nil {
+			return fmt.Errorf("decrypt config %s fail cause %v", key, err)
+		}
+		config[key] = decrypted
+	}
+	return nil
+}
+
+// DecryptConfig decrypt string values like ENC(...) of specified config loaded from json or yml
+// file, including values in nested maps and slices.
+func DecryptConfig(config map[string]interface{}) error {
+	for key, value := range config {
+		decrypted, err := decryptValue(value)
+		if err != nil {
+			return fmt.Errorf("decrypt config %s fail cause %v", key, err)
+		}
+		config[key] = decrypted
+	}
+	return nil
+}
+
+func decryptValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return DecryptValue(v)
+	case map[string]interface{}:
+		return value, DecryptConfig(v)
+	case map[interface{}]interface{}:
+		for key, item := range v {
+			decrypted, err := decryptValue(item)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = decrypted
+		}
+	case []interface{}:
+		for i, item := range v {
+			decrypted, err := decryptValue(item)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = decrypted
+		}
+	}
+	return value, nil
+}
+
+// NewAesDecrypter create a Decrypter which decrypt base64 encoded nonce and ciphertext produced by
+// EncryptValue with AES-GCM and specified key.
+func NewAesDecrypter(key []byte) (Decrypter, error) {
+	gcm, err := newGcm(key)
+	if err != nil {
+		return nil, err
+	}
+	return func(text string) (string, error) {
+		data, err := base64.StdEncoding.DecodeString(text)
+		if err != nil || len(data) < gcm.NonceSize() {
+			return "", ErrInvalidSecret
+		}
+		plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+		if err != nil {
+			return "", ErrInvalidSecret
+		}
+		return string(plaintext), nil
+	}, nil
+}
+
+// EncryptValue encrypt plaintext with AES-GCM and specified key, and returns value like ENC(...)
+// which can be written into config file.
+func EncryptValue(key []byte, plaintext string) (string, error) {
+	gcm, err := newGcm(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	data := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return "ENC(" + base64.StdEncoding.EncodeToString(data) + ")", nil
+}
+
+func newGcm(key []byte) (cipher.AEAD, error) {
+	switch len(key) {
+	case 16, 24, 32:
+	default:
+		return nil, ErrInvalidSecretKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
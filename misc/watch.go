@@ -0,0 +1,221 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package misc
+
+import (
+	"github.com/mervinkid/matcha/logging"
+	"github.com/mervinkid/matcha/parallel"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+)
+
+const defaultWatchInterval = 5 * time.Second
+
+// ConfigChangeCallback is the callback method invoked with key and new value of changed config.
+// Value is nil if key has been removed.
+type ConfigChangeCallback func(key string, value interface{})
+
+// ConfigWatcher is the interface of Lifecycle which load config from a source, check modification
+// of source with interval and reload it while source changed. Config is flattened into
+// dotted keys like "redis.address", and callbacks of keys which added, removed or modified are
+// invoked after reloading. Previous config is kept if reloading fail.
+// Methods:
+//  Config returns a copy of the latest loaded config with dotted keys.
+//  OnChange register callback for specified key, or for all keys if key is empty.
+//
+// State:
+//  +-----+           +---------+          +--------+
+//  | NEW | → Start → | RUNNING | → Stop → | FINISH |
+//  +-----+           +---------+          +--------+
+type ConfigWatcher interface {
+	Lifecycle
+	Config() map[string]interface{}
+	OnChange(key string, callback ConfigChangeCallback)
+}
+
+// pollingConfigWatcher is the default implementation of ConfigWatcher interface based on polling.
+// Config is reloaded with interval if modified is nil.
+type pollingConfigWatcher struct {
+	name     string
+	load     ConfigLoader
+	modified func() bool
+	interval time.Duration
+
+	config    map[string]interface{}
+	callbacks map[string][]ConfigChangeCallback
+	mutex     sync.RWMutex
+
+	running    bool
+	stateMutex sync.Mutex
+	ticker     parallel.CancelableGoroutine
+}
+
+func (w *pollingConfigWatcher) Start() error {
+	w.stateMutex.Lock()
+	defer w.stateMutex.Unlock()
+
+	if w.running {
+		return nil
+	}
+	if err := w.reload(); err != nil {
+		return err
+	}
+	w.ticker = parallel.Every(w.interval, w.checkReload)
+	w.ticker.Start()
+	w.running = true
+	return nil
+}
+
+func (w *pollingConfigWatcher) Stop() {
+	w.stateMutex.Lock()
+	defer w.stateMutex.Unlock()
+
+	if !w.running {
+		return
+	}
+	w.ticker.Cancel()
+	w.ticker.Join()
+	w.ticker = nil
+	w.running = false
+}
+
+func (w *pollingConfigWatcher) IsRunning() bool {
+	w.stateMutex.Lock()
+	defer w.stateMutex.Unlock()
+	return w.running
+}
+
+func (w *pollingConfigWatcher) Config() map[string]interface{} {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	config := make(map[string]interface{}, len(w.config))
+	for key, value := range w.config {
+		config[key] = value
+	}
+	return config
+}
+
+func (w *pollingConfigWatcher) OnChange(key string, callback ConfigChangeCallback) {
+	if callback == nil {
+		return
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.callbacks[key] = append(w.callbacks[key], callback)
+}
+
+// checkReload reload config if source has been modified since last loading.
+func (w *pollingConfigWatcher) checkReload() {
+	if w.modified != nil && !w.modified() {
+		return
+	}
+	if err := w.reload(); err != nil {
+		// Keep using previous config.
+		logging.Warn("Reload config from %s fail cause %s.", w.name, err.Error())
+	}
+}
+
+// reload load config and invoke callbacks of changed keys.
+func (w *pollingConfigWatcher) reload() error {
+	loaded, err := w.load()
+	if err != nil {
+		return err
+	}
+	config := FlattenConfig(loaded)
+
+	w.mutex.Lock()
+	previous := w.config
+	w.config = config
+	type change struct {
+		key       string
+		value     interface{}
+		callbacks []ConfigChangeCallback
+	}
+	var changes []change
+	if previous != nil {
+		for key, value := range config {
+			if old, ok := previous[key]; !ok || !reflect.DeepEqual(old, value) {
+				changes = append(changes, change{key, value, w.callbacksOf(key)})
+			}
+		}
+		for key := range previous {
+			if _, ok := config[key]; !ok {
+				changes = append(changes, change{key, nil, w.callbacksOf(key)})
+			}
+		}
+	}
+	w.mutex.Unlock()
+
+	for _, c := range changes {
+		for _, callback := range c.callbacks {
+			callback(c.key, c.value)
+		}
+	}
+	return nil
+}
+
+// callbacksOf returns callbacks registered for key and for all keys. Should be invoked with lock.
+func (w *pollingConfigWatcher) callbacksOf(key string) []ConfigChangeCallback {
+	callbacks := append([]ConfigChangeCallback(nil), w.callbacks[key]...)
+	return append(callbacks, w.callbacks[""]...)
+}
+
+// NewConfigWatcher create a new ConfigWatcher instance which load file with LoadConfigFile, and
+// reload it while modification time or size of file changed. Default interval is 5 seconds.
+func NewConfigWatcher(path string, interval time.Duration) ConfigWatcher {
+	var modTime time.Time
+	var size int64 = -1
+	watcher := newPollingConfigWatcher(path, FileConfigLoader(path), interval)
+	watcher.modified = func() bool {
+		info, err := os.Stat(path)
+		if err != nil {
+			logging.Warn("Check config file %s fail cause %s.", path, err.Error())
+			return false
+		}
+		modified := !info.ModTime().Equal(modTime) || info.Size() != size
+		modTime, size = info.ModTime(), info.Size()
+		return modified
+	}
+	return watcher
+}
+
+// NewPollingConfigWatcher create a new ConfigWatcher instance which reload config with specified
+// loader with interval, such as HttpConfigLoader for centrally managed config. Callbacks are only
+// invoked while config changed. Default interval is 5 seconds.
+func NewPollingConfigWatcher(name string, loader ConfigLoader, interval time.Duration) ConfigWatcher {
+	return newPollingConfigWatcher(name, loader, interval)
+}
+
+func newPollingConfigWatcher(name string, loader ConfigLoader, interval time.Duration) *pollingConfigWatcher {
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	return &pollingConfigWatcher{
+		name:      name,
+		load:      loader,
+		interval:  interval,
+		callbacks: make(map[string][]ConfigChangeCallback),
+	}
+}
@@ -24,6 +24,7 @@ package bind
 
 import (
 	"errors"
+	"fmt"
 	"net"
 	"sync"
 
@@ -87,7 +88,8 @@ func (pa *parallelAcceptor) Start() error {
 
 	for i := uint8(0); i < pa.prop.Parallelism; i++ {
 		workerIndex := i
-		workerCoroutine := parallel.NewGoroutine(func() {
+		workerName := fmt.Sprintf("AcceptWorker-%d-%s", workerIndex, pa.prop.Listener.Addr().String())
+		workerCoroutine := parallel.NewNamedGoroutine(workerName, func() {
 
 			logging.Trace("AcceptWorker-%d for %s start.", workerIndex, pa.prop.Listener.Addr().String())
 
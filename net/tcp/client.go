@@ -106,13 +106,14 @@ func (c *pipelineClient) Start() error {
 }
 
 func (c *pipelineClient) startPipelineWatcher(pipeline peer.Pipeline) {
-	parallel.NewGoroutine(func() {
-		logging.Trace("PipelineWatcher for remote %s start.\n", pipeline.Remote().String())
+	logger := logging.ForChannel(pipeline.GetChannel())
+	parallel.NewNamedGoroutine("PipelineWatcher-"+pipeline.Remote().String(), func() {
+		logger.Trace("PipelineWatcher start.")
 		pipeline.Sync()
 		if misc.LifecycleCheckRun(c) {
 			misc.LifecycleStop(c)
 		}
-		logging.Trace("PipelineWatcher for remote %s stop.\n", pipeline.Remote().String())
+		logger.Trace("PipelineWatcher stop.")
 	}).Start()
 }
 
@@ -83,7 +83,7 @@ func TestClient(t *testing.T) {
 		}
 	})
 	sender.Start()
-	sender.Sync()
+	sender.Join()
 
 	client.Stop()
 }
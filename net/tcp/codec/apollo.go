@@ -24,41 +24,271 @@ package codec
 
 import (
 	"encoding/binary"
+	"fmt"
+	"reflect"
+	"sync"
 
 	"github.com/mervinkid/matcha/buffer"
 	"github.com/vmihailenco/msgpack"
 )
 
+// ApolloHandshakeTypeCode is the type code reserved for handshake frame of version negotiation.
+const ApolloHandshakeTypeCode uint16 = 0xFFFF
+
 type ApolloEntity interface {
 	TypeCode() uint16
 }
 
+// ApolloExtendedEntity is the ApolloEntity with 32-bit type code, which is used instead of TypeCode
+// if the type is not registered in namespace. Type code larger than 0xFFFF requires
+// ExtendedTypeCode of config.
+type ApolloExtendedEntity interface {
+	ApolloEntity
+	ExtendedTypeCode() uint32
+}
+
+// ApolloTypeCode returns 32-bit type code of entity with specified 16-bit type code in namespace.
+// Namespace 0 is the default namespace which is compatible with 16-bit type codes.
+//  +-------------+-------------+
+//  |  namespace  |  type code  |
+//  |  (2 bytes)  |  (2 bytes)  |
+//  +-------------+-------------+
+func ApolloTypeCode(namespace uint16, typeCode uint16) uint32 {
+	return uint32(namespace)<<16 | uint32(typeCode)
+}
+
+// ApolloConfig is the configuration of ApolloFrameDecoder and ApolloFrameEncoder.
+// Fields:
+//  Version is the highest protocol version supported. Frames are unversioned if it is 0, which is
+//  compatible with old peers.
+//  MinVersion is the lowest protocol version supported, 1 by default.
+//  ExtendedTypeCode enables 4 bytes type code on wire for namespaced and 32-bit type codes. Frames
+//  have 2 bytes type code if it is not set, which is compatible with old peers.
+// Versioned peers negotiate the highest common version with handshake frame sent before the first
+// message. Messages are encoded with MinVersion before handshake of peer is received, and with
+// negotiated version after that if encoder and decoder are created together by NewApolloFrameCodec.
+// Peer whose first frame is not handshake is detected as unversioned, then its frames are decoded
+// without version, and messages are encoded without version and handshake by NewApolloFrameCodec.
+// Messages encoded before the first frame of unversioned peer is received can not be decoded by it,
+// so versioned node should let unversioned peer send first, such as server of request and response.
 type ApolloConfig struct {
 	TLVConfig
-	entityConstructors map[uint16]func() ApolloEntity
+	Version             uint8
+	MinVersion          uint8
+	ExtendedTypeCode    bool
+	entityConstructors  map[uint32]func() ApolloEntity
+	versionConstructors map[uint8]map[uint32]func() ApolloEntity
+	typeCodes           map[reflect.Type]uint32
 }
 
 func (c *ApolloConfig) RegisterEntity(constructor func() ApolloEntity) {
 	c.initConfig()
 	if constructor != nil {
 		if testEntity := constructor(); testEntity != nil {
-			c.entityConstructors[testEntity.TypeCode()] = constructor
+			c.entityConstructors[c.typeCodeOf(testEntity)] = constructor
+		}
+	}
+}
+
+// RegisterNamespaceEntity register constructor of entity whose TypeCode is unique in specified
+// namespace, and the entity is encoded with type code of ApolloTypeCode(namespace, TypeCode()).
+func (c *ApolloConfig) RegisterNamespaceEntity(namespace uint16, constructor func() ApolloEntity) {
+	c.initConfig()
+	if constructor != nil {
+		if testEntity := constructor(); testEntity != nil {
+			typeCode := ApolloTypeCode(namespace, testEntity.TypeCode())
+			c.typeCodes[reflect.TypeOf(testEntity)] = typeCode
+			c.entityConstructors[typeCode] = constructor
+		}
+	}
+}
+
+// RegisterNamespace register types of specified sample entities in namespace with constructors
+// derived by reflection like RegisterType.
+func (c *ApolloConfig) RegisterNamespace(namespace uint16, samples ...ApolloEntity) {
+	for _, sample := range samples {
+		if constructor := entityConstructorOf(sample); constructor != nil {
+			c.RegisterNamespaceEntity(namespace, constructor)
 		}
 	}
 }
 
-func (c *ApolloConfig) createEntity(typeCode uint16) ApolloEntity {
+// RegisterType register constructor derived from type of specified sample entity by reflection,
+// which creates new zero value entity of the same type. Sample should be pointer of struct like
+// &User{}, or struct whose pointer implements ApolloEntity.
+func (c *ApolloConfig) RegisterType(sample ApolloEntity) {
+	if constructor := entityConstructorOf(sample); constructor != nil {
+		c.RegisterEntity(constructor)
+	}
+}
+
+// RegisterAll register types of specified sample entities with RegisterType.
+func (c *ApolloConfig) RegisterAll(samples ...ApolloEntity) {
+	for _, sample := range samples {
+		c.RegisterType(sample)
+	}
+}
+
+// RegisterVersionEntity register constructor of entity used for frames of specified protocol
+// version, which takes precedence over the one registered by RegisterEntity. Type of entity should
+// be registered in namespace before if it is namespaced.
+func (c *ApolloConfig) RegisterVersionEntity(version uint8, constructor func() ApolloEntity) {
 	c.initConfig()
+	if constructor != nil {
+		if testEntity := constructor(); testEntity != nil {
+			if c.versionConstructors[version] == nil {
+				c.versionConstructors[version] = make(map[uint32]func() ApolloEntity)
+			}
+			c.versionConstructors[version][c.typeCodeOf(testEntity)] = constructor
+		}
+	}
+}
+
+// entityConstructorOf returns constructor of entity with the same type as specified sample, or nil
+// if new entity of the type can not be unmarshaled into.
+func entityConstructorOf(sample ApolloEntity) func() ApolloEntity {
+	if sample == nil {
+		return nil
+	}
+	entityType := reflect.TypeOf(sample)
+	if entityType.Kind() == reflect.Ptr {
+		elemType := entityType.Elem()
+		return func() ApolloEntity {
+			return reflect.New(elemType).Interface().(ApolloEntity)
+		}
+	}
+	if _, ok := reflect.New(entityType).Interface().(ApolloEntity); ok {
+		return func() ApolloEntity {
+			return reflect.New(entityType).Interface().(ApolloEntity)
+		}
+	}
+	return nil
+}
+
+// typeCodeOf returns 32-bit type code of entity, which is the one registered in namespace, or
+// ExtendedTypeCode of ApolloExtendedEntity, or TypeCode in default namespace.
+func (c *ApolloConfig) typeCodeOf(entity ApolloEntity) uint32 {
+	if typeCode, ok := c.typeCodes[reflect.TypeOf(entity)]; ok {
+		return typeCode
+	}
+	if extendedEntity, ok := entity.(ApolloExtendedEntity); ok {
+		return extendedEntity.ExtendedTypeCode()
+	}
+	return uint32(entity.TypeCode())
+}
+
+// typeCodeSize returns size of type code on wire.
+func (c *ApolloConfig) typeCodeSize() int {
+	if c.ExtendedTypeCode {
+		return 4
+	}
+	return 2
+}
+
+func (c *ApolloConfig) createEntity(version uint8, typeCode uint32) ApolloEntity {
+	c.initConfig()
+	if constructor := c.versionConstructors[version][typeCode]; constructor != nil {
+		return constructor()
+	}
 	if constructor := c.entityConstructors[typeCode]; constructor != nil {
 		return constructor()
 	}
 	return nil
 }
 
+// versionRange returns the lowest and highest protocol version supported.
+func (c *ApolloConfig) versionRange() (uint8, uint8) {
+	minVersion := c.MinVersion
+	if minVersion == 0 {
+		minVersion = 1
+	}
+	return minVersion, c.Version
+}
+
 func (c *ApolloConfig) initConfig() {
 	if c.entityConstructors == nil {
-		c.entityConstructors = make(map[uint16]func() ApolloEntity)
+		c.entityConstructors = make(map[uint32]func() ApolloEntity)
 	}
+	if c.versionConstructors == nil {
+		c.versionConstructors = make(map[uint8]map[uint32]func() ApolloEntity)
+	}
+	if c.typeCodes == nil {
+		c.typeCodes = make(map[reflect.Type]uint32)
+	}
+}
+
+// apolloNegotiation is the state of version negotiation shared by decoder and encoder of a
+// connection.
+type apolloNegotiation struct {
+	handshakeSent bool
+	version       uint8
+	detected      bool
+	unversioned   bool
+	mutex         sync.Mutex
+}
+
+// detectVersioned returns true if frames of peer are versioned, which is detected by the first
+// frame since versioned peer always sends handshake frame first.
+func (n *apolloNegotiation) detectVersioned(payload []byte, typeCodeSize int) bool {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if !n.detected {
+		n.detected = true
+		n.unversioned = !isApolloHandshake(payload, typeCodeSize)
+	}
+	return !n.unversioned
+}
+
+// isApolloHandshake returns true if payload of versioned frame has type code of handshake.
+func isApolloHandshake(payload []byte, typeCodeSize int) bool {
+	if len(payload) < 1+typeCodeSize {
+		return false
+	}
+	if typeCodeSize == 4 {
+		return binary.BigEndian.Uint32(payload[1:]) == uint32(ApolloHandshakeTypeCode)
+	}
+	return binary.BigEndian.Uint16(payload[1:]) == ApolloHandshakeTypeCode
+}
+
+// negotiate returns the highest common version of local and peer version ranges.
+func (n *apolloNegotiation) negotiate(config *ApolloConfig, peerMin, peerMax uint8) (uint8, error) {
+	minVersion, maxVersion := config.versionRange()
+	if peerMin > minVersion {
+		minVersion = peerMin
+	}
+	if peerMax < maxVersion {
+		maxVersion = peerMax
+	}
+	if minVersion > maxVersion {
+		return 0, fmt.Errorf("no common version with peer supports %d~%d", peerMin, peerMax)
+	}
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.version = maxVersion
+	return maxVersion, nil
+}
+
+// encodeVersion returns version for encoding and whether handshake should be sent before message.
+// Version is 0 for unversioned peer.
+func (n *apolloNegotiation) encodeVersion(config *ApolloConfig) (version uint8, handshake bool) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if n.unversioned {
+		return 0, false
+	}
+	handshake = !n.handshakeSent
+	n.handshakeSent = true
+	if n.version != 0 {
+		return n.version, handshake
+	}
+	version, _ = config.versionRange()
+	return version, handshake
+}
+
+func (n *apolloNegotiation) negotiatedVersion() (uint8, bool) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return n.version, n.version != 0 || n.unversioned
 }
 
 // ApolloFrameDecoder is a bytes to ApolloEntity decode implementation of FrameDecode based on TLVFrameDecoder
@@ -68,11 +298,20 @@ func (c *ApolloConfig) initConfig() {
 //  | (1 byte) | (4 bytes) |   2 bytes   | serialized  |
 //  |          |           |  type code  |    data     |
 //  +----------+-----------+---------------------------+
+// Value starts with 1 byte version if Version of config is set. Value of handshake frame is type
+// code 0xFFFF followed by the lowest and highest version supported by peer. Type code is 4 bytes
+// if ExtendedTypeCode of config is set.
+//  +----------+-----------+---------------------------+
+//  |    TAG   |  LENGTH   |           VALUE           |
+//  | (1 byte) | (4 bytes) | 1 byte  | 2 bytes   | ... |
+//  |          |           | version | type code |     |
+//  +----------+-----------+---------------------------+
 // Decode:
 //  []byte → ApolloEntity(*pointer)
 type ApolloFrameDecoder struct {
-	Config     ApolloConfig
-	tlvDecoder FrameDecoder
+	Config      ApolloConfig
+	tlvDecoder  FrameDecoder
+	negotiation *apolloNegotiation
 }
 
 func (d *ApolloFrameDecoder) Decode(in buffer.ByteBuf) (interface{}, error) {
@@ -95,16 +334,50 @@ func (d *ApolloFrameDecoder) Decode(in buffer.ByteBuf) (interface{}, error) {
 	tlvPayloadByteBuffer := buffer.NewElasticUnsafeByteBuf(len(tlvPayload.([]byte)))
 	tlvPayloadByteBuffer.WriteBytes(tlvPayload.([]byte))
 
-	// Parse 2 bytes of message type code.
-	if tlvPayloadByteBuffer.ReadableBytes() < 2 {
+	// Parse 1 byte of version, which is absent in frames of unversioned peer.
+	var version uint8
+	versioned := d.Config.Version > 0
+	if versioned {
+		d.initNegotiation()
+		versioned = d.negotiation.detectVersioned(tlvPayload.([]byte), d.Config.typeCodeSize())
+	}
+	if versioned {
+		if tlvPayloadByteBuffer.ReadableBytes() < 1 {
+			return d.decodeFailure("illegal payload")
+		}
+		version = tlvPayloadByteBuffer.ReadBytes(1)[0]
+	}
+
+	// Parse 2 or 4 bytes of message type code.
+	typeCodeSize := d.Config.typeCodeSize()
+	if tlvPayloadByteBuffer.ReadableBytes() < typeCodeSize {
 		return d.decodeFailure("illegal payload")
 	}
-	var typeCode uint16
-	binary.Read(tlvPayloadByteBuffer, binary.BigEndian, &typeCode)
+	var typeCode uint32
+	if typeCodeSize == 4 {
+		typeCode = binary.BigEndian.Uint32(tlvPayloadByteBuffer.ReadBytes(typeCodeSize))
+	} else {
+		typeCode = uint32(binary.BigEndian.Uint16(tlvPayloadByteBuffer.ReadBytes(typeCodeSize)))
+	}
 
 	// Parse reset bytes for serialized data.
 	serializedBytes := tlvPayloadByteBuffer.ReadBytes(tlvPayloadByteBuffer.ReadableBytes())
-	if entity := d.Config.createEntity(typeCode); entity != nil {
+	if versioned && typeCode == uint32(ApolloHandshakeTypeCode) {
+		if len(serializedBytes) < 2 {
+			return d.decodeFailure("illegal handshake")
+		}
+		if _, err := d.negotiation.negotiate(&d.Config, serializedBytes[0], serializedBytes[1]); err != nil {
+			return d.decodeFailure(err.Error())
+		}
+		// Handshake is not passed to handler, continue decoding following frame.
+		return d.Decode(in)
+	}
+	if versioned {
+		if minVersion, maxVersion := d.Config.versionRange(); version < minVersion || version > maxVersion {
+			return d.decodeFailure(fmt.Sprintf("unsupported version %d", version))
+		}
+	}
+	if entity := d.Config.createEntity(version, typeCode); entity != nil {
 		if unmarshalErr := msgpack.Unmarshal(serializedBytes, entity); unmarshalErr != nil {
 			return d.decodeFailure(unmarshalErr.Error())
 		} else {
@@ -116,7 +389,13 @@ func (d *ApolloFrameDecoder) Decode(in buffer.ByteBuf) (interface{}, error) {
 
 func (d *ApolloFrameDecoder) initTLVDecoder() {
 	if d.tlvDecoder == nil {
-		d.tlvDecoder = NewTLVFrameDecoder(d.Config.TLVConfig)
+		d.tlvDecoder = NewTLVFrameDecoder(d.Config.TLVConfig.wholeValue())
+	}
+}
+
+func (d *ApolloFrameDecoder) initNegotiation() {
+	if d.negotiation == nil {
+		d.negotiation = &apolloNegotiation{}
 	}
 }
 
@@ -144,11 +423,14 @@ func NewApolloFrameDecoder(config ApolloConfig) FrameDecoder {
 //  | (1 byte) | (4 bytes) |   2 bytes   | serialized  |
 //  |          |           |  type code  |    data     |
 //  +----------+-----------+---------------------------+
+// Value starts with 1 byte version if Version of config is set, and handshake frame is sent before
+// the first message. Type code is 4 bytes if ExtendedTypeCode of config is set.
 // Encode:
 //  ApolloEntity(*pointer) → []byte
 type ApolloFrameEncoder struct {
-	Config     ApolloConfig
-	tlvEncoder FrameEncoder
+	Config      ApolloConfig
+	tlvEncoder  FrameEncoder
+	negotiation *apolloNegotiation
 }
 
 func (e *ApolloFrameEncoder) Encode(msg interface{}) ([]byte, error) {
@@ -163,24 +445,54 @@ func (e *ApolloFrameEncoder) Encode(msg interface{}) ([]byte, error) {
 	}
 
 	// Marshal entity to bytes.
-	typeCode := entity.TypeCode()
+	typeCode := e.Config.typeCodeOf(entity)
 	marshaledBytes, marshalErr := msgpack.Marshal(entity)
 	if marshalErr != nil {
 		return e.encodeFailure(marshalErr.Error())
 	}
-	// Build frame payload with marshaled bytes and type code.
-	payloadByteBuffer := buffer.NewElasticUnsafeByteBuf(2 + len(marshaledBytes))
-	binary.Write(payloadByteBuffer, binary.BigEndian, typeCode)
-	binary.Write(payloadByteBuffer, binary.BigEndian, marshaledBytes)
+	// Prepend handshake frame before the first versioned message.
+	var frameBytes []byte
+	var version uint8
+	if e.Config.Version > 0 {
+		e.initNegotiation()
+		var handshake bool
+		version, handshake = e.negotiation.encodeVersion(&e.Config)
+		if handshake {
+			minVersion, maxVersion := e.Config.versionRange()
+			handshakeBytes, err := e.encodeFrame(version, uint32(ApolloHandshakeTypeCode), []byte{minVersion, maxVersion})
+			if err != nil {
+				return e.encodeFailure(err.Error())
+			}
+			frameBytes = handshakeBytes
+		}
+	}
 
-	// Encode with TLVEncoder
-	e.initTLVEncoder()
-	frameBytes, encodeErr := e.tlvEncoder.Encode(payloadByteBuffer.ReadBytes(payloadByteBuffer.ReadableBytes()))
+	messageBytes, encodeErr := e.encodeFrame(version, typeCode, marshaledBytes)
 	if encodeErr != nil {
 		return e.encodeFailure(encodeErr.Error())
 	}
 
-	return e.encodeSuccess(frameBytes)
+	return e.encodeSuccess(append(frameBytes, messageBytes...))
+}
+
+// encodeFrame build frame payload with version, type code and marshaled bytes, and encode it with
+// TLVEncoder. Frame is unversioned if version is 0.
+func (e *ApolloFrameEncoder) encodeFrame(version uint8, typeCode uint32, marshaledBytes []byte) ([]byte, error) {
+	payloadByteBuffer := buffer.NewElasticUnsafeByteBuf(5 + len(marshaledBytes))
+	if version > 0 {
+		binary.Write(payloadByteBuffer, binary.BigEndian, version)
+	}
+	if e.Config.ExtendedTypeCode {
+		binary.Write(payloadByteBuffer, binary.BigEndian, typeCode)
+	} else if typeCode <= 0xFFFF {
+		binary.Write(payloadByteBuffer, binary.BigEndian, uint16(typeCode))
+	} else {
+		return nil, fmt.Errorf("type code 0x%x requires extended type code", typeCode)
+	}
+	binary.Write(payloadByteBuffer, binary.BigEndian, marshaledBytes)
+
+	e.initTLVEncoder()
+	return e.tlvEncoder.Encode(payloadByteBuffer.ReadBytes(payloadByteBuffer.ReadableBytes()))
 }
 
 func (e *ApolloFrameEncoder) initTLVEncoder() {
@@ -189,6 +501,12 @@ func (e *ApolloFrameEncoder) initTLVEncoder() {
 	}
 }
 
+func (e *ApolloFrameEncoder) initNegotiation() {
+	if e.negotiation == nil {
+		e.negotiation = &apolloNegotiation{}
+	}
+}
+
 func (e *ApolloFrameEncoder) encodeSuccess(result []byte) ([]byte, error) {
 	return result, nil
 }
@@ -201,3 +519,29 @@ func (e *ApolloFrameEncoder) encodeFailure(cause string) ([]byte, error) {
 func NewApolloFrameEncoder(config ApolloConfig) FrameEncoder {
 	return &ApolloFrameEncoder{Config: config}
 }
+
+// ApolloFrameCodec is the implementation of FrameCodec interface with ApolloFrameDecoder and
+// ApolloFrameEncoder sharing state of version negotiation, which should be created for each
+// connection and used as both decoder and encoder of pipeline.
+type ApolloFrameCodec struct {
+	ApolloFrameDecoder
+	ApolloFrameEncoder
+}
+
+// Version returns negotiated version and true if handshake of peer has been received. Version is 0
+// with true if peer is detected as unversioned.
+func (c *ApolloFrameCodec) Version() (uint8, bool) {
+	if c.ApolloFrameDecoder.negotiation == nil {
+		return 0, false
+	}
+	return c.ApolloFrameDecoder.negotiation.negotiatedVersion()
+}
+
+// NewApolloFrameCodec create a new ApolloFrameCodec instance with configuration.
+func NewApolloFrameCodec(config ApolloConfig) *ApolloFrameCodec {
+	negotiation := &apolloNegotiation{}
+	return &ApolloFrameCodec{
+		ApolloFrameDecoder: ApolloFrameDecoder{Config: config, negotiation: negotiation},
+		ApolloFrameEncoder: ApolloFrameEncoder{Config: config, negotiation: negotiation},
+	}
+}
@@ -24,6 +24,7 @@ package codec
 
 import (
 	"github.com/mervinkid/matcha/buffer"
+	"github.com/vmihailenco/msgpack"
 	"testing"
 )
 
@@ -165,3 +166,212 @@ func BenchmarkApolloFrameDecoder_Decode(b *testing.B) {
 	}
 	b.StopTimer()
 }
+
+type _tUserV2 struct {
+	Id       int64
+	Name     string
+	Nickname string
+}
+
+func (u *_tUserV2) TypeCode() uint16 {
+	return 1
+}
+
+func TestApolloFrameCodec_Negotiation(t *testing.T) {
+
+	// Prepare codecs of peers supporting version 1~2 and version 1.
+	newConfig := func(version uint8) ApolloConfig {
+		config := ApolloConfig{Version: version}
+		config.RegisterEntity(func() ApolloEntity {
+			return &_tUser{}
+		})
+		config.RegisterVersionEntity(2, func() ApolloEntity {
+			return &_tUserV2{}
+		})
+		return config
+	}
+	transfer := func(encoder FrameEncoder, decoder FrameDecoder, msg interface{}) interface{} {
+		encodeResult, err := encoder.Encode(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		byteBuffer := buffer.NewElasticUnsafeByteBuf(len(encodeResult))
+		byteBuffer.WriteBytes(encodeResult)
+		decodeResult, err := decoder.Decode(byteBuffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return decodeResult
+	}
+	newCodec, oldCodec := NewApolloFrameCodec(newConfig(2)), NewApolloFrameCodec(newConfig(1))
+	user := &_tUser{Id: 1, Name: "Mervin"}
+
+	// Peers encode with lowest version before handshake received.
+	if _, ok := transfer(newCodec, oldCodec, user).(*_tUser); !ok {
+		t.Fatal("expect entity of version 1")
+	}
+	if version, ok := oldCodec.Version(); !ok || version != 1 {
+		t.Fatal("unexpected negotiated version", version)
+	}
+	if _, ok := transfer(oldCodec, newCodec, user).(*_tUser); !ok {
+		t.Fatal("expect entity of version 1")
+	}
+	if version, ok := newCodec.Version(); !ok || version != 1 {
+		t.Fatal("unexpected negotiated version", version)
+	}
+
+	// Peers both supporting version 2 negotiate version 2.
+	newCodec, otherCodec := NewApolloFrameCodec(newConfig(2)), NewApolloFrameCodec(newConfig(2))
+	transfer(newCodec, otherCodec, user)
+	if decoded, ok := transfer(otherCodec, newCodec, user).(*_tUserV2); !ok || decoded.Name != "Mervin" {
+		t.Fatal("expect entity of version 2")
+	}
+	if version, ok := newCodec.Version(); !ok || version != 2 {
+		t.Fatal("unexpected negotiated version", version)
+	}
+
+	// Peers without common version fail on handshake.
+	strictConfig := newConfig(3)
+	strictConfig.MinVersion = 3
+	byteBuffer := buffer.NewElasticUnsafeByteBuf(64)
+	encodeResult, _ := NewApolloFrameCodec(strictConfig).Encode(user)
+	byteBuffer.WriteBytes(encodeResult)
+	if _, err := NewApolloFrameCodec(newConfig(2)).Decode(byteBuffer); err == nil {
+		t.Fatal("expect negotiation fail")
+	}
+
+	// Peer without version is detected by its first frame.
+	newCodec, legacyCodec := NewApolloFrameCodec(newConfig(2)), NewApolloFrameCodec(newConfig(0))
+	for i := 0; i < 2; i++ {
+		if decoded, ok := transfer(legacyCodec, newCodec, user).(*_tUser); !ok || decoded.Name != "Mervin" {
+			t.Fatal("expect entity from unversioned peer", decoded)
+		}
+	}
+	if version, ok := newCodec.Version(); !ok || version != 0 {
+		t.Fatal("expect unversioned peer detected but got", version, ok)
+	}
+	if decoded, ok := transfer(newCodec, legacyCodec, user).(*_tUser); !ok || decoded.Name != "Mervin" {
+		t.Fatal("expect entity encoded without version for unversioned peer", decoded)
+	}
+
+	// Version of zero value codec is unknown.
+	if version, ok := (&ApolloFrameCodec{}).Version(); ok || version != 0 {
+		t.Fatal("unexpected version of zero value codec", version, ok)
+	}
+}
+
+func TestApolloConfig_RegisterType(t *testing.T) {
+
+	config := ApolloConfig{}
+	config.RegisterAll(&_tUser{}, &_tGroup{})
+
+	encoder := NewApolloFrameEncoder(config)
+	decoder := NewApolloFrameDecoder(config)
+
+	user := &_tUser{Id: 1, Name: "Mervin", Group: _tGroup{Id: 2, Name: "Matcha"}}
+	encoded, err := encoder.Encode(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byteBuffer := buffer.NewElasticUnsafeByteBuf(len(encoded))
+	byteBuffer.WriteBytes(encoded)
+	result, err := decoder.Decode(byteBuffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, ok := result.(*_tUser)
+	if !ok || decoded == user || *decoded != *user {
+		t.Fatal("unexpected decode result", result)
+	}
+
+	// Entities created by constructor are not shared.
+	if config.createEntity(0, 2) == config.createEntity(0, 2) {
+		t.Fatal("expect new entity created")
+	}
+}
+
+type _tOrder struct {
+	Id int64
+}
+
+func (o *_tOrder) TypeCode() uint16 {
+	return 1
+}
+
+type _tEvent struct {
+	Id int64
+}
+
+func (e *_tEvent) TypeCode() uint16 {
+	return 0
+}
+
+func (e *_tEvent) ExtendedTypeCode() uint32 {
+	return 0x12345678
+}
+
+func TestApolloFrameCodec_ExtendedTypeCode(t *testing.T) {
+
+	// Type codes of _tUser and _tOrder collide without namespace.
+	config := ApolloConfig{ExtendedTypeCode: true}
+	config.RegisterAll(&_tUser{}, &_tGroup{}, &_tEvent{})
+	config.RegisterNamespace(1, &_tOrder{})
+	encoder := NewApolloFrameEncoder(config)
+	decoder := NewApolloFrameDecoder(config)
+
+	byteBuffer := buffer.NewElasticUnsafeByteBuf(1024)
+	for _, entity := range []ApolloEntity{&_tUser{Id: 1}, &_tOrder{Id: 2}, &_tEvent{Id: 3}} {
+		encoded, err := encoder.Encode(entity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		byteBuffer.WriteBytes(encoded)
+	}
+	if result, err := decoder.Decode(byteBuffer); err != nil || *result.(*_tUser) != (_tUser{Id: 1}) {
+		t.Fatal("unexpected decode result", result, err)
+	}
+	if result, err := decoder.Decode(byteBuffer); err != nil || *result.(*_tOrder) != (_tOrder{Id: 2}) {
+		t.Fatal("unexpected decode result", result, err)
+	}
+	if result, err := decoder.Decode(byteBuffer); err != nil || *result.(*_tEvent) != (_tEvent{Id: 3}) {
+		t.Fatal("unexpected decode result", result, err)
+	}
+
+	// Namespaced type code requires extended type code on wire.
+	config.ExtendedTypeCode = false
+	encoder = NewApolloFrameEncoder(config)
+	if _, err := encoder.Encode(&_tOrder{Id: 2}); err == nil {
+		t.Fatal("expect extended type code required")
+	}
+	if encoded, err := encoder.Encode(&_tUser{Id: 1}); err != nil || len(encoded) != TagSize+LengthSize+2+len(mustMarshal(t, &_tUser{Id: 1})) {
+		t.Fatal("unexpected encode result", encoded, err)
+	}
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	data, err := msgpack.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestApolloFrameCodec_ValueView(t *testing.T) {
+
+	config := ApolloConfig{}
+	config.ValueView = true
+	config.StreamThreshold = 1
+	config.RegisterAll(&_tUser{})
+	encoder := NewApolloFrameEncoder(config)
+	decoder := NewApolloFrameDecoder(config)
+
+	user := &_tUser{Id: 1, Name: "Mervin"}
+	frame, err := encoder.Encode(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := decoder.Decode(buffer.WrapElasticUnsafeByteBuf(frame))
+	if decoded, ok := result.(*_tUser); err != nil || !ok || *decoded != *user {
+		t.Fatal("unexpected decode result", result, err)
+	}
+}
@@ -0,0 +1,191 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package codec
+
+import (
+	"encoding/base64"
+	"github.com/mervinkid/matcha/buffer"
+)
+
+// Base64Config is a data struct provide configuration properties for both Base64FrameDecoder and
+// Base64FrameEncoder.
+// Fields:
+//  Encoding is the base64 encoding of lines, base64.StdEncoding by default.
+//  MaxLength limits length of encoded line excluding delimiter, 0 means no limit.
+type Base64Config struct {
+	Encoding  *base64.Encoding
+	MaxLength int
+}
+
+func (c Base64Config) encoding() *base64.Encoding {
+	if c.Encoding == nil {
+		return base64.StdEncoding
+	}
+	return c.Encoding
+}
+
+// Base64FrameDecoder is a decoder implementation of FrameDecoder which decode base64 encoded lines
+// and decode result with wrapped decoder, or returns decoded bytes if Decoder is nil. It is used for
+// transport over text-only channels.
+//  +------------------------------+-------------+
+//  |     base64(frame of Decoder) |  "\n" or    |
+//  |                              |  "\r\n"     |
+//  +------------------------------+-------------+
+// Notes:
+//  []byte → result of Decoder
+type Base64FrameDecoder struct {
+	Config      Base64Config
+	Decoder     FrameDecoder
+	lineDecoder FrameDecoder
+}
+
+func (d *Base64FrameDecoder) Decode(in buffer.ByteBuf) (interface{}, error) {
+
+	// Decode inbound with LineFrameDecoder
+	d.initLineDecoder()
+	line, lineErr := d.lineDecoder.Decode(in)
+	if line == nil && lineErr == nil {
+		return d.decodeNothing()
+	}
+	if lineErr != nil {
+		return d.decodeFailure(lineErr.Error())
+	}
+
+	data, err := d.Config.encoding().DecodeString(line.(string))
+	if err != nil {
+		return d.decodeFailure(err.Error())
+	}
+	if d.Decoder == nil {
+		return d.decodeSuccess(data)
+	}
+
+	// Decode frame with wrapped decoder.
+	result, err := d.Decoder.Decode(buffer.WrapElasticUnsafeByteBuf(data))
+	if err != nil {
+		return d.decodeFailure(err.Error())
+	}
+	if result == nil {
+		return d.decodeFailure("incomplete frame of wrapped decoder")
+	}
+	return d.decodeSuccess(result)
+}
+
+func (d *Base64FrameDecoder) initLineDecoder() {
+	if d.lineDecoder == nil {
+		d.lineDecoder = NewLineFrameDecoder(LineConfig{MaxLength: d.Config.MaxLength, StripDelimiter: true})
+	}
+}
+
+func (d *Base64FrameDecoder) decodeNothing() (interface{}, error) {
+	return d.decodeSuccess(nil)
+}
+
+func (d *Base64FrameDecoder) decodeSuccess(result interface{}) (interface{}, error) {
+	return result, nil
+}
+
+func (d *Base64FrameDecoder) decodeFailure(cause string) (interface{}, error) {
+	return nil, NewDecodeError("Base64FrameDecoder", cause)
+}
+
+// NewBase64FrameDecoder create a new Base64FrameDecoder instance with configuration which decode
+// base64 decoded frame with specified decoder.
+func NewBase64FrameDecoder(config Base64Config, decoder FrameDecoder) FrameDecoder {
+	return &Base64FrameDecoder{Config: config, Decoder: decoder}
+}
+
+// Base64FrameEncoder is a encoder implementation of FrameEncoder which encode message with wrapped
+// encoder, or takes message as bytes if Encoder is nil, and encode result as base64 line ended
+// with "\n".
+//  +------------------------------+-------------+
+//  |     base64(frame of Encoder) |     "\n"    |
+//  +------------------------------+-------------+
+// Notes:
+//  message of Encoder → []byte
+type Base64FrameEncoder struct {
+	Config  Base64Config
+	Encoder FrameEncoder
+}
+
+func (e *Base64FrameEncoder) Encode(msg interface{}) ([]byte, error) {
+
+	// Encode message with wrapped encoder.
+	var data []byte
+	if e.Encoder != nil {
+		encoded, err := e.Encoder.Encode(msg)
+		if err != nil {
+			return e.encodeFailure(err.Error())
+		}
+		data = encoded
+	} else if payload, ok := msg.([]byte); ok {
+		data = payload
+	} else {
+		return e.encodeFailure("can not transform input to []byte")
+	}
+
+	encoding := e.Config.encoding()
+	length := encoding.EncodedLen(len(data))
+	if e.Config.MaxLength > 0 && length > e.Config.MaxLength {
+		return e.encodeFailure("line length larger than limit")
+	}
+	line := make([]byte, length+1)
+	encoding.Encode(line, data)
+	line[length] = '\n'
+	return e.encodeSuccess(line)
+}
+
+func (e *Base64FrameEncoder) encodeSuccess(result []byte) ([]byte, error) {
+	return result, nil
+}
+
+func (e *Base64FrameEncoder) encodeFailure(cause string) ([]byte, error) {
+	return nil, NewEncodeError("Base64FrameEncoder", cause)
+}
+
+// NewBase64FrameEncoder create a new Base64FrameEncoder instance with configuration which encode
+// frame encoded by specified encoder as base64 line.
+func NewBase64FrameEncoder(config Base64Config, encoder FrameEncoder) FrameEncoder {
+	return &Base64FrameEncoder{Config: config, Encoder: encoder}
+}
+
+// Base64Codec is the implementation of FrameCodec interface with Base64FrameDecoder and
+// Base64FrameEncoder wrapping both sides of another codec, which is also a FrameCodec so that it
+// can be wrapped again.
+type Base64Codec struct {
+	Base64FrameDecoder
+	Base64FrameEncoder
+}
+
+// NewBase64Codec create a new Base64Codec instance with configuration which wraps specified codec,
+// or transforms raw bytes if codec is nil.
+func NewBase64Codec(config Base64Config, codec FrameCodec) *Base64Codec {
+	result := &Base64Codec{
+		Base64FrameDecoder: Base64FrameDecoder{Config: config},
+		Base64FrameEncoder: Base64FrameEncoder{Config: config},
+	}
+	if codec != nil {
+		result.Base64FrameDecoder.Decoder = codec
+		result.Base64FrameEncoder.Encoder = codec
+	}
+	return result
+}
@@ -0,0 +1,83 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package codec
+
+import (
+	"bytes"
+	"github.com/mervinkid/matcha/buffer"
+	"testing"
+)
+
+func TestBase64Codec(t *testing.T) {
+
+	config := ApolloConfig{}
+	config.RegisterAll(&_tUser{}, &_tGroup{})
+	codec := NewBase64Codec(Base64Config{}, NewApolloFrameCodec(config))
+
+	user := &_tUser{Id: 1, Name: "Mervin", Group: _tGroup{Id: 2, Name: "Matcha"}}
+	frame, err := codec.Encode(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame[len(frame)-1] != '\n' || bytes.IndexByte(frame, '\n') != len(frame)-1 {
+		t.Fatal("expect single line", string(frame))
+	}
+
+	byteBuffer := buffer.NewElasticUnsafeByteBuf(1024)
+	byteBuffer.WriteBytes(frame[:5])
+	if result, err := codec.Decode(byteBuffer); result != nil || err != nil {
+		t.Fatal("unexpected result of partial frame", result, err)
+	}
+	byteBuffer.WriteBytes(frame[5:])
+	result, err := codec.Decode(byteBuffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded, ok := result.(*_tUser); !ok || *decoded != *user {
+		t.Fatal("unexpected decode result", result)
+	}
+
+	// Illegal line fails and following frame is decoded.
+	byteBuffer.WriteBytes([]byte("!!!\r\n"))
+	byteBuffer.WriteBytes(frame)
+	if _, err := codec.Decode(byteBuffer); err == nil {
+		t.Fatal("expect illegal base64 data")
+	}
+	if result, err := codec.Decode(byteBuffer); err != nil || result == nil {
+		t.Fatal("unexpected decode result", result, err)
+	}
+}
+
+func TestBase64Codec_Wrapped(t *testing.T) {
+
+	codec := NewBase64Codec(Base64Config{}, NewBase64Codec(Base64Config{}, nil))
+
+	frame, err := codec.Encode([]byte("Hello World."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := codec.Decode(buffer.WrapElasticUnsafeByteBuf(frame))
+	if err != nil || string(result.([]byte)) != "Hello World." {
+		t.Fatal("unexpected decode result", result, err)
+	}
+}
@@ -0,0 +1,319 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package codec
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/mervinkid/matcha/buffer"
+)
+
+// Compression is the algorithm of payload compression.
+type Compression uint8
+
+const (
+	CompressionNone Compression = iota
+	CompressionGzip
+	CompressionSnappy
+	CompressionZstd
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionGzip:
+		return "gzip"
+	case CompressionSnappy:
+		return "snappy"
+	case CompressionZstd:
+		return "zstd"
+	}
+	return fmt.Sprintf("compression(%d)", uint8(c))
+}
+
+// CompressionConfig is a data struct provide configuration properties for both
+// CompressionFrameDecoder and CompressionFrameEncoder.
+// Fields:
+//  Compression is the algorithm used by encoder. Decoder accepts all algorithms.
+//  Threshold is the minimal size of payload to compress, smaller payload is sent uncompressed.
+//  Level is the level of gzip or zstd, 0 means default level.
+//  FrameLimit of TLVConfig limits size of both frame and decompressed payload.
+type CompressionConfig struct {
+	TLVConfig
+	Compression Compression
+	Threshold   int
+	Level       int
+}
+
+// CompressionFrameDecoder is a decoder implementation of FrameDecoder which decompress payload of
+// TLV frame and decode it with wrapped decoder, or returns decompressed bytes if Decoder is nil.
+//  +----------+-----------+-----------------------------------+
+//  |    TAG   |  LENGTH   |               VALUE               |
+//  | (1 byte) | (4 bytes) |   1 byte    |     compressed      |
+//  |          |           | compression | frame of Decoder    |
+//  +----------+-----------+-----------------------------------+
+// Decode:
+//  []byte → result of Decoder
+type CompressionFrameDecoder struct {
+	Config      CompressionConfig
+	Decoder     FrameDecoder
+	tlvDecoder  FrameDecoder
+	zstdDecoder *zstd.Decoder
+}
+
+func (d *CompressionFrameDecoder) Decode(in buffer.ByteBuf) (interface{}, error) {
+
+	if in.ReadableBytes() == 0 {
+		return d.decodeNothing()
+	}
+
+	// Decode inbound with TLVFrameDecoder
+	d.initTLVDecoder()
+	tlvPayload, tlvErr := d.tlvDecoder.Decode(in)
+	if tlvPayload == nil && tlvErr == nil {
+		return d.decodeNothing()
+	}
+	if tlvErr != nil {
+		return d.decodeFailure(tlvErr.Error())
+	}
+
+	// Parse 1 byte of compression and decompress rest bytes.
+	payload := tlvPayload.([]byte)
+	if len(payload) < 1 {
+		return d.decodeFailure("illegal payload")
+	}
+	data, err := d.decompress(Compression(payload[0]), payload[1:])
+	if err != nil {
+		return d.decodeFailure(err.Error())
+	}
+	if d.Decoder == nil {
+		return d.decodeSuccess(data)
+	}
+
+	// Decode decompressed frame with wrapped decoder.
+	dataByteBuffer := buffer.NewElasticUnsafeByteBuf(len(data))
+	dataByteBuffer.WriteBytes(data)
+	result, err := d.Decoder.Decode(dataByteBuffer)
+	if err != nil {
+		return d.decodeFailure(err.Error())
+	}
+	if result == nil {
+		return d.decodeFailure("incomplete frame of wrapped decoder")
+	}
+	return d.decodeSuccess(result)
+}
+
+func (d *CompressionFrameDecoder) decompress(compression Compression, data []byte) ([]byte, error) {
+	limit := int(d.Config.FrameLimit)
+	switch compression {
+	case CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		var source io.Reader = reader
+		if limit > 0 {
+			source = io.LimitReader(reader, int64(limit)+1)
+		}
+		result, err := ioutil.ReadAll(source)
+		if err != nil {
+			return nil, err
+		}
+		if limit > 0 && len(result) > limit {
+			return nil, fmt.Errorf("decompressed size larger than limit %d", limit)
+		}
+		return result, nil
+	case CompressionSnappy:
+		size, err := snappy.DecodedLen(data)
+		if err != nil {
+			return nil, err
+		}
+		if limit > 0 && size > limit {
+			return nil, fmt.Errorf("decompressed size %d larger than limit %d", size, limit)
+		}
+		return snappy.Decode(nil, data)
+	case CompressionZstd:
+		if d.zstdDecoder == nil {
+			options := []zstd.DOption{zstd.WithDecoderConcurrency(1)}
+			if limit > 0 {
+				options = append(options, zstd.WithDecoderMaxMemory(uint64(limit)))
+			}
+			decoder, err := zstd.NewReader(nil, options...)
+			if err != nil {
+				return nil, err
+			}
+			d.zstdDecoder = decoder
+		}
+		return d.zstdDecoder.DecodeAll(data, nil)
+	}
+	return nil, fmt.Errorf("unsupported compression %s", compression)
+}
+
+func (d *CompressionFrameDecoder) initTLVDecoder() {
+	if d.tlvDecoder == nil {
+		d.tlvDecoder = NewTLVFrameDecoder(d.Config.TLVConfig.wholeValue())
+	}
+}
+
+func (d *CompressionFrameDecoder) decodeNothing() (interface{}, error) {
+	return d.decodeSuccess(nil)
+}
+
+func (d *CompressionFrameDecoder) decodeSuccess(result interface{}) (interface{}, error) {
+	return result, nil
+}
+
+func (d *CompressionFrameDecoder) decodeFailure(cause string) (interface{}, error) {
+	return nil, NewDecodeError("CompressionFrameDecoder", cause)
+}
+
+// NewCompressionFrameDecoder create a new CompressionFrameDecoder instance with configuration
+// which decode decompressed frame with specified decoder, such as ApolloFrameDecoder.
+func NewCompressionFrameDecoder(config CompressionConfig, decoder FrameDecoder) FrameDecoder {
+	return &CompressionFrameDecoder{Config: config, Decoder: decoder}
+}
+
+// CompressionFrameEncoder is a encoder implementation of FrameEncoder which encode message with
+// wrapped encoder, or takes message as bytes if Encoder is nil, and compress result as payload of
+// TLV frame.
+//  +----------+-----------+-----------------------------------+
+//  |    TAG   |  LENGTH   |               VALUE               |
+//  | (1 byte) | (4 bytes) |   1 byte    |     compressed      |
+//  |          |           | compression | frame of Encoder    |
+//  +----------+-----------+-----------------------------------+
+// Encode:
+//  message of Encoder → []byte
+type CompressionFrameEncoder struct {
+	Config      CompressionConfig
+	Encoder     FrameEncoder
+	tlvEncoder  FrameEncoder
+	zstdEncoder *zstd.Encoder
+}
+
+func (e *CompressionFrameEncoder) Encode(msg interface{}) ([]byte, error) {
+
+	// Encode message with wrapped encoder.
+	var data []byte
+	if e.Encoder != nil {
+		encoded, err := e.Encoder.Encode(msg)
+		if err != nil {
+			return e.encodeFailure(err.Error())
+		}
+		data = encoded
+	} else if payload, ok := msg.([]byte); ok {
+		data = payload
+	} else {
+		return e.encodeFailure("can not transform input to []byte")
+	}
+
+	// Compress data which is not smaller than threshold.
+	compression := e.Config.Compression
+	if len(data) < e.Config.Threshold {
+		compression = CompressionNone
+	}
+	compressed, err := e.compress(compression, data)
+	if err != nil {
+		return e.encodeFailure(err.Error())
+	}
+	payload := make([]byte, 1+len(compressed))
+	payload[0] = byte(compression)
+	copy(payload[1:], compressed)
+
+	// Encode with TLVEncoder
+	e.initTLVEncoder()
+	frameBytes, encodeErr := e.tlvEncoder.Encode(payload)
+	if encodeErr != nil {
+		return e.encodeFailure(encodeErr.Error())
+	}
+	return e.encodeSuccess(frameBytes)
+}
+
+func (e *CompressionFrameEncoder) compress(compression Compression, data []byte) ([]byte, error) {
+	switch compression {
+	case CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		level := e.Config.Level
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		var result bytes.Buffer
+		writer, err := gzip.NewWriterLevel(&result, level)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := writer.Write(data); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		return result.Bytes(), nil
+	case CompressionSnappy:
+		return snappy.Encode(nil, data), nil
+	case CompressionZstd:
+		if e.zstdEncoder == nil {
+			options := []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+			if e.Config.Level > 0 {
+				options = append(options, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(e.Config.Level)))
+			}
+			encoder, err := zstd.NewWriter(nil, options...)
+			if err != nil {
+				return nil, err
+			}
+			e.zstdEncoder = encoder
+		}
+		return e.zstdEncoder.EncodeAll(data, nil), nil
+	}
+	return nil, fmt.Errorf("unsupported compression %s", compression)
+}
+
+func (e *CompressionFrameEncoder) initTLVEncoder() {
+	if e.tlvEncoder == nil {
+		e.tlvEncoder = NewTLVFrameEncoder(e.Config.TLVConfig)
+	}
+}
+
+func (e *CompressionFrameEncoder) encodeSuccess(result []byte) ([]byte, error) {
+	return result, nil
+}
+
+func (e *CompressionFrameEncoder) encodeFailure(cause string) ([]byte, error) {
+	return nil, NewEncodeError("CompressionFrameEncoder", cause)
+}
+
+// NewCompressionFrameEncoder create a new CompressionFrameEncoder instance with configuration
+// which compress frame encoded by specified encoder, such as ApolloFrameEncoder.
+func NewCompressionFrameEncoder(config CompressionConfig, encoder FrameEncoder) FrameEncoder {
+	return &CompressionFrameEncoder{Config: config, Encoder: encoder}
+}
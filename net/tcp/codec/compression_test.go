@@ -0,0 +1,102 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package codec
+
+import (
+	"github.com/mervinkid/matcha/buffer"
+	"strings"
+	"testing"
+)
+
+func TestCompressionFrameCodec(t *testing.T) {
+
+	// Prepare wrapped apollo codec
+	apolloConfig := ApolloConfig{}
+	apolloConfig.RegisterEntity(func() ApolloEntity {
+		return &_tUser{}
+	})
+	user := &_tUser{Id: 1, Name: strings.Repeat("Mervin", 100), Gender: "M"}
+
+	for _, compression := range []Compression{CompressionNone, CompressionGzip, CompressionSnappy, CompressionZstd} {
+		config := CompressionConfig{Compression: compression}
+		config.TagValue = 170
+		config.FrameLimit = 1024 * 1024
+		encoder := NewCompressionFrameEncoder(config, NewApolloFrameEncoder(apolloConfig))
+		decoder := NewCompressionFrameDecoder(config, NewApolloFrameDecoder(apolloConfig))
+
+		encodeResult, err := encoder.Encode(user)
+		if err != nil {
+			t.Fatal(compression, err)
+		}
+		if compression != CompressionNone && len(encodeResult) > len(user.Name)/2 {
+			t.Fatal(compression, "payload is not compressed", len(encodeResult))
+		}
+		byteBuffer := buffer.NewElasticUnsafeByteBuf(len(encodeResult))
+		byteBuffer.WriteBytes(encodeResult)
+		decodeResult, err := decoder.Decode(byteBuffer)
+		if err != nil {
+			t.Fatal(compression, err)
+		}
+		if decoded, ok := decodeResult.(*_tUser); !ok || decoded.Name != user.Name {
+			t.Fatal(compression, "unexpected decode result", decodeResult)
+		}
+	}
+}
+
+func TestCompressionFrameCodec_Threshold(t *testing.T) {
+
+	config := CompressionConfig{Compression: CompressionGzip, Threshold: 16}
+	encoder := NewCompressionFrameEncoder(config, nil)
+	decoder := NewCompressionFrameDecoder(config, nil)
+
+	encodeResult, err := encoder.Encode([]byte("small"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Compression(encodeResult[TagSize+LengthSize]) != CompressionNone {
+		t.Fatal("expect small payload not compressed")
+	}
+	byteBuffer := buffer.NewElasticUnsafeByteBuf(len(encodeResult))
+	byteBuffer.WriteBytes(encodeResult)
+	if decodeResult, err := decoder.Decode(byteBuffer); err != nil || string(decodeResult.([]byte)) != "small" {
+		t.Fatal("unexpected decode result", decodeResult, err)
+	}
+}
+
+func TestCompressionFrameCodec_ValueView(t *testing.T) {
+
+	config := CompressionConfig{Compression: CompressionGzip}
+	config.ValueView = true
+	config.StreamThreshold = 1
+	encoder := NewCompressionFrameEncoder(config, nil)
+	decoder := NewCompressionFrameDecoder(config, nil)
+
+	frame, err := encoder.Encode([]byte("Hello World."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := decoder.Decode(buffer.WrapElasticUnsafeByteBuf(frame))
+	if err != nil || string(result.([]byte)) != "Hello World." {
+		t.Fatal("unexpected decode result", result, err)
+	}
+}
@@ -0,0 +1,274 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package codec
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/mervinkid/matcha/buffer"
+)
+
+// NonceScheme is the scheme of generating nonce for each encrypted frame.
+type NonceScheme uint8
+
+const (
+	// NonceRandom generate 12 random bytes for each frame.
+	NonceRandom NonceScheme = iota
+	// NonceCounter generate 4 random bytes once per encoder followed by 8 bytes counter, which is
+	// safe for more frames than random nonce under the same key. Decoder pins the prefix of the
+	// first frame and rejects frames with other prefix or whose counter does not increase as replayed.
+	NonceCounter
+)
+
+const nonceSize = 12
+
+// EncryptionConfig is a data struct provide configuration properties for both
+// EncryptionFrameDecoder and EncryptionFrameEncoder.
+// Fields:
+//  Key is the AES key of 16, 24 or 32 bytes shared by both sides.
+//  Nonce is the scheme of nonce used by encoder. Decoder takes nonce from frame.
+type EncryptionConfig struct {
+	TLVConfig
+	Key   []byte
+	Nonce NonceScheme
+}
+
+func (c *EncryptionConfig) newGcm() (cipher.AEAD, error) {
+	switch len(c.Key) {
+	case 16, 24, 32:
+	default:
+		return nil, fmt.Errorf("invalid key size %d", len(c.Key))
+	}
+	block, err := aes.NewCipher(c.Key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptionFrameDecoder is a decoder implementation of FrameDecoder which decrypt payload of TLV
+// frame with AES-GCM and decode it with wrapped decoder, or returns decrypted bytes if Decoder is
+// nil.
+//  +----------+-----------+--------------------------------+
+//  |    TAG   |  LENGTH   |             VALUE              |
+//  | (1 byte) | (4 bytes) |  12 bytes  |    encrypted      |
+//  |          |           |   nonce    | frame of Decoder  |
+//  +----------+-----------+--------------------------------+
+// Decode:
+//  []byte → result of Decoder
+type EncryptionFrameDecoder struct {
+	Config     EncryptionConfig
+	Decoder    FrameDecoder
+	tlvDecoder FrameDecoder
+	gcm        cipher.AEAD
+	lastNonce  []byte
+}
+
+func (d *EncryptionFrameDecoder) Decode(in buffer.ByteBuf) (interface{}, error) {
+
+	if in.ReadableBytes() == 0 {
+		return d.decodeNothing()
+	}
+
+	// Decode inbound with TLVFrameDecoder
+	d.initTLVDecoder()
+	tlvPayload, tlvErr := d.tlvDecoder.Decode(in)
+	if tlvPayload == nil && tlvErr == nil {
+		return d.decodeNothing()
+	}
+	if tlvErr != nil {
+		return d.decodeFailure(tlvErr.Error())
+	}
+
+	// Decrypt payload with nonce in frame.
+	if d.gcm == nil {
+		gcm, err := d.Config.newGcm()
+		if err != nil {
+			return d.decodeFailure(err.Error())
+		}
+		d.gcm = gcm
+	}
+	payload := tlvPayload.([]byte)
+	if len(payload) < nonceSize+d.gcm.Overhead() {
+		return d.decodeFailure("illegal payload")
+	}
+	nonce := payload[:nonceSize]
+	data, err := d.gcm.Open(nil, nonce, payload[nonceSize:], nil)
+	if err != nil {
+		return d.decodeFailure("decrypt fail")
+	}
+	if d.Config.Nonce == NonceCounter {
+		// Prefix is pinned by the first frame, since frames with another prefix could be replayed
+		// from other encoders or previous connections under the same key.
+		if d.lastNonce != nil && !bytes.Equal(nonce[:4], d.lastNonce[:4]) {
+			return d.decodeFailure("nonce prefix changed")
+		}
+		if d.lastNonce != nil && binary.BigEndian.Uint64(nonce[4:]) <= binary.BigEndian.Uint64(d.lastNonce[4:]) {
+			return d.decodeFailure("replayed frame")
+		}
+		d.lastNonce = append(d.lastNonce[:0], nonce...)
+	}
+	if d.Decoder == nil {
+		return d.decodeSuccess(data)
+	}
+
+	// Decode decrypted frame with wrapped decoder.
+	dataByteBuffer := buffer.NewElasticUnsafeByteBuf(len(data))
+	dataByteBuffer.WriteBytes(data)
+	result, err := d.Decoder.Decode(dataByteBuffer)
+	if err != nil {
+		return d.decodeFailure(err.Error())
+	}
+	if result == nil {
+		return d.decodeFailure("incomplete frame of wrapped decoder")
+	}
+	return d.decodeSuccess(result)
+}
+
+func (d *EncryptionFrameDecoder) initTLVDecoder() {
+	if d.tlvDecoder == nil {
+		d.tlvDecoder = NewTLVFrameDecoder(d.Config.TLVConfig.wholeValue())
+	}
+}
+
+func (d *EncryptionFrameDecoder) decodeNothing() (interface{}, error) {
+	return d.decodeSuccess(nil)
+}
+
+func (d *EncryptionFrameDecoder) decodeSuccess(result interface{}) (interface{}, error) {
+	return result, nil
+}
+
+func (d *EncryptionFrameDecoder) decodeFailure(cause string) (interface{}, error) {
+	return nil, NewDecodeError("EncryptionFrameDecoder", cause)
+}
+
+// NewEncryptionFrameDecoder create a new EncryptionFrameDecoder instance with configuration which
+// decode decrypted frame with specified decoder, such as ApolloFrameDecoder.
+func NewEncryptionFrameDecoder(config EncryptionConfig, decoder FrameDecoder) FrameDecoder {
+	return &EncryptionFrameDecoder{Config: config, Decoder: decoder}
+}
+
+// EncryptionFrameEncoder is a encoder implementation of FrameEncoder which encode message with
+// wrapped encoder, or takes message as bytes if Encoder is nil, and encrypt result with AES-GCM as
+// payload of TLV frame.
+//  +----------+-----------+--------------------------------+
+//  |    TAG   |  LENGTH   |             VALUE              |
+//  | (1 byte) | (4 bytes) |  12 bytes  |    encrypted      |
+//  |          |           |   nonce    | frame of Encoder  |
+//  +----------+-----------+--------------------------------+
+// Encode:
+//  message of Encoder → []byte
+type EncryptionFrameEncoder struct {
+	Config     EncryptionConfig
+	Encoder    FrameEncoder
+	tlvEncoder FrameEncoder
+	gcm        cipher.AEAD
+	nonce      []byte
+}
+
+func (e *EncryptionFrameEncoder) Encode(msg interface{}) ([]byte, error) {
+
+	// Encode message with wrapped encoder.
+	var data []byte
+	if e.Encoder != nil {
+		encoded, err := e.Encoder.Encode(msg)
+		if err != nil {
+			return e.encodeFailure(err.Error())
+		}
+		data = encoded
+	} else if payload, ok := msg.([]byte); ok {
+		data = payload
+	} else {
+		return e.encodeFailure("can not transform input to []byte")
+	}
+
+	// Encrypt data with next nonce.
+	if e.gcm == nil {
+		gcm, err := e.Config.newGcm()
+		if err != nil {
+			return e.encodeFailure(err.Error())
+		}
+		e.gcm = gcm
+	}
+	nonce, err := e.nextNonce()
+	if err != nil {
+		return e.encodeFailure(err.Error())
+	}
+	payload := make([]byte, nonceSize, nonceSize+len(data)+e.gcm.Overhead())
+	copy(payload, nonce)
+	payload = e.gcm.Seal(payload, nonce, data, nil)
+
+	// Encode with TLVEncoder
+	e.initTLVEncoder()
+	frameBytes, encodeErr := e.tlvEncoder.Encode(payload)
+	if encodeErr != nil {
+		return e.encodeFailure(encodeErr.Error())
+	}
+	return e.encodeSuccess(frameBytes)
+}
+
+// nextNonce returns nonce for next frame by scheme of config.
+func (e *EncryptionFrameEncoder) nextNonce() ([]byte, error) {
+	if e.Config.Nonce == NonceCounter {
+		if e.nonce == nil {
+			e.nonce = make([]byte, nonceSize)
+			if _, err := io.ReadFull(rand.Reader, e.nonce[:4]); err != nil {
+				return nil, err
+			}
+		}
+		binary.BigEndian.PutUint64(e.nonce[4:], binary.BigEndian.Uint64(e.nonce[4:])+1)
+		return e.nonce, nil
+	}
+	nonce := make([]byte, nonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return nonce, nil
+}
+
+func (e *EncryptionFrameEncoder) initTLVEncoder() {
+	if e.tlvEncoder == nil {
+		e.tlvEncoder = NewTLVFrameEncoder(e.Config.TLVConfig)
+	}
+}
+
+func (e *EncryptionFrameEncoder) encodeSuccess(result []byte) ([]byte, error) {
+	return result, nil
+}
+
+func (e *EncryptionFrameEncoder) encodeFailure(cause string) ([]byte, error) {
+	return nil, NewEncodeError("EncryptionFrameEncoder", cause)
+}
+
+// NewEncryptionFrameEncoder create a new EncryptionFrameEncoder instance with configuration which
+// encrypt frame encoded by specified encoder, such as ApolloFrameEncoder.
+func NewEncryptionFrameEncoder(config EncryptionConfig, encoder FrameEncoder) FrameEncoder {
+	return &EncryptionFrameEncoder{Config: config, Encoder: encoder}
+}
@@ -0,0 +1,126 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package codec
+
+import (
+	"bytes"
+	"github.com/mervinkid/matcha/buffer"
+	"testing"
+)
+
+func TestEncryptionFrameCodec(t *testing.T) {
+
+	// Prepare wrapped apollo codec
+	apolloConfig := ApolloConfig{}
+	apolloConfig.RegisterEntity(func() ApolloEntity {
+		return &_tUser{}
+	})
+	user := &_tUser{Id: 1, Name: "Mervin", Gender: "M"}
+
+	for _, scheme := range []NonceScheme{NonceRandom, NonceCounter} {
+		config := EncryptionConfig{Key: bytes.Repeat([]byte{7}, 32), Nonce: scheme}
+		config.TagValue = 170
+		encoder := NewEncryptionFrameEncoder(config, NewApolloFrameEncoder(apolloConfig))
+		decoder := NewEncryptionFrameDecoder(config, NewApolloFrameDecoder(apolloConfig))
+
+		first, err := encoder.Encode(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := encoder.Encode(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(first, second) || bytes.Contains(first, []byte("Mervin")) {
+			t.Fatal("expect payload encrypted with different nonce")
+		}
+		byteBuffer := buffer.NewElasticUnsafeByteBuf(len(first) + len(second))
+		byteBuffer.WriteBytes(first)
+		byteBuffer.WriteBytes(second)
+		for i := 0; i < 2; i++ {
+			decodeResult, err := decoder.Decode(byteBuffer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded, ok := decodeResult.(*_tUser); !ok || decoded.Name != user.Name {
+				t.Fatal("unexpected decode result", decodeResult)
+			}
+		}
+
+		// Replayed frame is rejected with counter nonce.
+		byteBuffer.WriteBytes(first)
+		if _, err := decoder.Decode(byteBuffer); (err != nil) != (scheme == NonceCounter) {
+			t.Fatal("unexpected result of replayed frame", scheme, err)
+		}
+
+		// Frame from another encoder is rejected with counter nonce even if its counter is larger.
+		otherEncoder := NewEncryptionFrameEncoder(config, NewApolloFrameEncoder(apolloConfig))
+		var other []byte
+		for i := 0; i < 3; i++ {
+			if other, err = otherEncoder.Encode(user); err != nil {
+				t.Fatal(err)
+			}
+		}
+		byteBuffer.WriteBytes(other)
+		if _, err := decoder.Decode(byteBuffer); (err != nil) != (scheme == NonceCounter) {
+			t.Fatal("unexpected result of frame from another encoder", scheme, err)
+		}
+	}
+}
+
+func TestEncryptionFrameCodec_WrongKey(t *testing.T) {
+
+	encoder := NewEncryptionFrameEncoder(EncryptionConfig{Key: bytes.Repeat([]byte{1}, 16)}, nil)
+	decoder := NewEncryptionFrameDecoder(EncryptionConfig{Key: bytes.Repeat([]byte{2}, 16)}, nil)
+
+	frame, err := encoder.Encode([]byte("Hello World."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	byteBuffer := buffer.NewElasticUnsafeByteBuf(len(frame))
+	byteBuffer.WriteBytes(frame)
+	if _, err := decoder.Decode(byteBuffer); err == nil {
+		t.Fatal("expect decrypt fail with wrong key")
+	}
+	if _, err := NewEncryptionFrameEncoder(EncryptionConfig{Key: []byte("short")}, nil).Encode([]byte{}); err == nil {
+		t.Fatal("expect error with invalid key")
+	}
+}
+
+func TestEncryptionFrameCodec_ValueView(t *testing.T) {
+
+	config := EncryptionConfig{Key: bytes.Repeat([]byte{7}, 16)}
+	config.ValueView = true
+	config.StreamThreshold = 1
+	encoder := NewEncryptionFrameEncoder(config, nil)
+	decoder := NewEncryptionFrameDecoder(config, nil)
+
+	frame, err := encoder.Encode([]byte("Hello World."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := decoder.Decode(buffer.WrapElasticUnsafeByteBuf(frame))
+	if err != nil || string(result.([]byte)) != "Hello World." {
+		t.Fatal("unexpected decode result", result, err)
+	}
+}
@@ -0,0 +1,416 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/mervinkid/matcha/buffer"
+)
+
+const (
+	defaultHttpHeaderLimit  = 1 << 20
+	defaultHttpChunkedLimit = 1 << 24
+)
+
+// Decode states of chunked body.
+const (
+	httpChunkSize = iota
+	httpChunkData
+	httpChunkEnd
+	httpChunkTrailer
+)
+
+// HttpConfig is a data struct provide configuration properties for both HttpFrameDecoder and
+// HttpFrameEncoder.
+// Fields:
+//  Client make decoder parse responses instead of requests, used by client side of pipeline.
+//  HeaderLimit limits size of request line or status line and headers, 1MB by default.
+//  FrameLimit limits size of whole message including body, 0 means no limit for message
+//  delimited by Content-Length and 16MB for chunked message.
+type HttpConfig struct {
+	Client      bool
+	HeaderLimit int
+	FrameLimit  uint32
+}
+
+// HttpFrameDecoder is a bytes to *http.Request or *http.Response decoder implementation of
+// FrameDecoder with HTTP/1.1 format, which let pipeline serve or speak HTTP. Body is fully read
+// and delimited by Content-Length or chunked transfer encoding. Response delimited by closing
+// connection is not supported.
+//  +--------------------------+
+//  | GET /path HTTP/1.1       |
+//  | Host: example.com        |
+//  | Content-Length: 5        |
+//  |                          |
+//  | hello                    |
+//  +--------------------------+
+// Notes:
+//  Decode []byte → *http.Request (server) or *http.Response (client).
+type HttpFrameDecoder struct {
+	Config HttpConfig
+	// Decode buffer
+	data []byte
+	// Decode state of message whose headers have been parsed.
+	message       interface{}
+	headerSize    int
+	contentLength int64
+	body          []byte
+	bodySize      int
+	chunkState    int
+	chunkRemain   int64
+}
+
+func (d *HttpFrameDecoder) Decode(in buffer.ByteBuf) (interface{}, error) {
+
+	if in.ReadableBytes() > 0 {
+		d.data = append(d.data, in.ReadBytes(in.ReadableBytes())...)
+	}
+
+	// Wait for end of headers and parse them once, then only body bytes are kept in buffer.
+	if d.message == nil {
+		if len(d.data) == 0 {
+			return d.decodeNothing()
+		}
+		if !hasHttpHeaderEnd(d.data) {
+			return d.checkLimit()
+		}
+		if err := d.parseHeader(); err != nil {
+			d.resetBuffer()
+			return d.decodeFailure(err.Error())
+		}
+	}
+
+	// Read body which continues from last decode.
+	var complete bool
+	if d.contentLength >= 0 {
+		complete = d.readFixedBody()
+	} else {
+		var err error
+		if complete, err = d.readChunkedBody(); err != nil {
+			d.resetBuffer()
+			return d.decodeFailure(err.Error())
+		}
+	}
+	if limit := d.frameLimit(); limit > 0 && d.frameSize(complete) > limit {
+		d.resetBuffer()
+		return d.decodeFailure("frame size larger than limit")
+	}
+	if !complete {
+		return d.decodeNothing()
+	}
+
+	result := d.message
+	switch message := result.(type) {
+	case *http.Request:
+		message.Body = ioutil.NopCloser(bytes.NewReader(d.body))
+	case *http.Response:
+		message.Body = ioutil.NopCloser(bytes.NewReader(d.body))
+	}
+	d.resetMessage()
+	return d.decodeSuccess(result)
+}
+
+// parseHeader parse request or response with headers from buffer and remove them from buffer.
+func (d *HttpFrameDecoder) parseHeader() error {
+	dataReader := bytes.NewReader(d.data)
+	reader := bufio.NewReader(dataReader)
+	message, contentLength, err := d.readHeader(reader)
+	if err != nil {
+		return err
+	}
+	d.message = message
+	d.contentLength = contentLength
+	d.headerSize = len(d.data) - dataReader.Len() - reader.Buffered()
+	d.data = d.data[d.headerSize:]
+	return nil
+}
+
+// readHeader read request or response with headers from reader, returns message and length of
+// its body, which is -1 for chunked body.
+func (d *HttpFrameDecoder) readHeader(reader *bufio.Reader) (interface{}, int64, error) {
+	if d.Config.Client {
+		resp, err := http.ReadResponse(reader, nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(resp.TransferEncoding) > 0 {
+			return resp, -1, nil
+		}
+		if resp.ContentLength < 0 {
+			return nil, 0, fmt.Errorf("response without content length is not supported")
+		}
+		return resp, resp.ContentLength, nil
+	}
+	req, err := http.ReadRequest(reader)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(req.TransferEncoding) > 0 {
+		return req, -1, nil
+	}
+	return req, req.ContentLength, nil
+}
+
+// readFixedBody read body delimited by Content-Length, returns true if body is complete.
+func (d *HttpFrameDecoder) readFixedBody() bool {
+	if int64(len(d.data)) < d.contentLength {
+		return false
+	}
+	d.body = make([]byte, d.contentLength)
+	copy(d.body, d.data)
+	d.consume(len(d.body))
+	return true
+}
+
+// readChunkedBody read chunks from buffer and remove them from buffer, returns true if body
+// and trailers are complete.
+func (d *HttpFrameDecoder) readChunkedBody() (bool, error) {
+	for {
+		if d.chunkState == httpChunkData {
+			if len(d.data) == 0 {
+				return false, nil
+			}
+			size := d.chunkRemain
+			if size > int64(len(d.data)) {
+				size = int64(len(d.data))
+			}
+			d.body = append(d.body, d.data[:size]...)
+			d.consume(int(size))
+			if d.chunkRemain -= size; d.chunkRemain == 0 {
+				d.chunkState = httpChunkEnd
+			}
+			continue
+		}
+		line, ok := d.readLine()
+		if !ok {
+			return false, nil
+		}
+		switch d.chunkState {
+		case httpChunkSize:
+			if i := strings.IndexByte(line, ';'); i >= 0 {
+				line = line[:i]
+			}
+			size, err := strconv.ParseInt(strings.TrimSpace(line), 16, 64)
+			if err != nil || size < 0 {
+				return false, fmt.Errorf("invalid chunk size")
+			}
+			if size == 0 {
+				d.chunkState = httpChunkTrailer
+			} else {
+				d.chunkState, d.chunkRemain = httpChunkData, size
+			}
+		case httpChunkEnd:
+			if len(line) > 0 {
+				return false, fmt.Errorf("malformed chunked encoding")
+			}
+			d.chunkState = httpChunkSize
+		case httpChunkTrailer:
+			if len(line) == 0 {
+				return true, nil
+			}
+			if err := d.addTrailer(line); err != nil {
+				return false, err
+			}
+		}
+	}
+}
+
+// readLine read line without line ending from buffer, returns false if line is incomplete.
+func (d *HttpFrameDecoder) readLine() (string, bool) {
+	end := bytes.IndexByte(d.data, '\n')
+	if end < 0 {
+		return "", false
+	}
+	line := strings.TrimSuffix(string(d.data[:end]), "\r")
+	d.consume(end + 1)
+	return line, true
+}
+
+// addTrailer add trailer line after chunked body to trailer of message.
+func (d *HttpFrameDecoder) addTrailer(line string) error {
+	i := strings.IndexByte(line, ':')
+	if i <= 0 {
+		return fmt.Errorf("malformed trailer")
+	}
+	key := textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(line[:i]))
+	value := strings.TrimSpace(line[i+1:])
+	var trailer *http.Header
+	switch message := d.message.(type) {
+	case *http.Request:
+		trailer = &message.Trailer
+	case *http.Response:
+		trailer = &message.Trailer
+	}
+	if *trailer == nil {
+		*trailer = make(http.Header)
+	}
+	trailer.Add(key, value)
+	return nil
+}
+
+// consume remove bytes of body from buffer.
+func (d *HttpFrameDecoder) consume(size int) {
+	d.data = d.data[size:]
+	d.bodySize += size
+	if len(d.data) == 0 {
+		d.data = nil
+	}
+}
+
+// frameLimit returns limit of frame size for message being decoded, 0 means no limit.
+func (d *HttpFrameDecoder) frameLimit() uint64 {
+	if d.Config.FrameLimit > 0 {
+		return uint64(d.Config.FrameLimit)
+	}
+	if d.contentLength < 0 {
+		return defaultHttpChunkedLimit
+	}
+	return 0
+}
+
+// frameSize returns size of message being decoded. Size of message delimited by Content-Length
+// is known once headers are parsed, and size of incomplete chunked message includes buffered bytes.
+func (d *HttpFrameDecoder) frameSize(complete bool) uint64 {
+	if d.contentLength >= 0 {
+		return uint64(d.headerSize) + uint64(d.contentLength)
+	}
+	size := uint64(d.headerSize) + uint64(d.bodySize)
+	if !complete {
+		size += uint64(len(d.data))
+	}
+	return size
+}
+
+// checkLimit returns failure if incomplete headers in buffer are larger than limit.
+func (d *HttpFrameDecoder) checkLimit() (interface{}, error) {
+	headerLimit := d.Config.HeaderLimit
+	if headerLimit <= 0 {
+		headerLimit = defaultHttpHeaderLimit
+	}
+	if len(d.data) > headerLimit {
+		d.resetBuffer()
+		return d.decodeFailure("header size larger than limit")
+	}
+	if d.Config.FrameLimit > 0 && uint64(len(d.data)) > uint64(d.Config.FrameLimit) {
+		d.resetBuffer()
+		return d.decodeFailure("frame size larger than limit")
+	}
+	return d.decodeNothing()
+}
+
+// hasHttpHeaderEnd returns true if data contains empty line which ends headers.
+func hasHttpHeaderEnd(data []byte) bool {
+	return bytes.Contains(data, []byte("\r\n\r\n")) || bytes.Contains(data, []byte("\n\n"))
+}
+
+// resetMessage reset decode state of message after it is decoded.
+func (d *HttpFrameDecoder) resetMessage() {
+	d.message = nil
+	d.headerSize = 0
+	d.contentLength = 0
+	d.body = nil
+	d.bodySize = 0
+	d.chunkState = httpChunkSize
+	d.chunkRemain = 0
+}
+
+// resetBuffer reset all buffer data inside HttpFrameDecoder.
+func (d *HttpFrameDecoder) resetBuffer() {
+	d.data = nil
+	d.resetMessage()
+}
+
+func (d *HttpFrameDecoder) decodeNothing() (interface{}, error) {
+	return d.decodeSuccess(nil)
+}
+
+func (d *HttpFrameDecoder) decodeSuccess(result interface{}) (interface{}, error) {
+	return result, nil
+}
+
+func (d *HttpFrameDecoder) decodeFailure(cause string) (interface{}, error) {
+	return nil, NewDecodeError("HttpFrameDecoder", cause)
+}
+
+// NewHttpFrameDecoder create instance of HttpFrameDecoder with specified configuration.
+func NewHttpFrameDecoder(config HttpConfig) FrameDecoder {
+	return &HttpFrameDecoder{Config: config}
+}
+
+// HttpFrameEncoder is a *http.Request or *http.Response to bytes encoder implementation of
+// FrameEncoder with HTTP/1.1 format. Protocol version is HTTP/1.1 if it is not set, and
+// Content-Length should be set for body of response to keep connection alive.
+// Notes:
+//  Encode *http.Request or *http.Response → []byte.
+type HttpFrameEncoder struct {
+	Config HttpConfig
+}
+
+func (e *HttpFrameEncoder) Encode(msg interface{}) ([]byte, error) {
+
+	var frame bytes.Buffer
+	switch message := msg.(type) {
+	case *http.Request:
+		if err := message.Write(&frame); err != nil {
+			return e.encodeFailure(err.Error())
+		}
+	case *http.Response:
+		resp := *message
+		if resp.ProtoMajor == 0 {
+			resp.Proto, resp.ProtoMajor, resp.ProtoMinor = "HTTP/1.1", 1, 1
+		}
+		if err := resp.Write(&frame); err != nil {
+			return e.encodeFailure(err.Error())
+		}
+	default:
+		return e.encodeFailure("message is not *http.Request or *http.Response")
+	}
+
+	// Validate frame size
+	if e.Config.FrameLimit > 0 && uint64(frame.Len()) > uint64(e.Config.FrameLimit) {
+		cause := fmt.Sprintf("frame size %d larger than limit %d", frame.Len(), e.Config.FrameLimit)
+		return e.encodeFailure(cause)
+	}
+	return e.encodeSuccess(frame.Bytes())
+}
+
+func (e *HttpFrameEncoder) encodeSuccess(result []byte) ([]byte, error) {
+	return result, nil
+}
+
+func (e *HttpFrameEncoder) encodeFailure(cause string) ([]byte, error) {
+	return nil, NewEncodeError("HttpFrameEncoder", cause)
+}
+
+// NewHttpFrameEncoder create instance of HttpFrameEncoder with specified configuration.
+func NewHttpFrameEncoder(config HttpConfig) FrameEncoder {
+	return &HttpFrameEncoder{Config: config}
+}
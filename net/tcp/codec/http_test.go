@@ -0,0 +1,171 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package codec
+
+import (
+	"bytes"
+	"github.com/mervinkid/matcha/buffer"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHttpFrameCodec_Request(t *testing.T) {
+
+	cfg := HttpConfig{}
+	encoder := NewHttpFrameEncoder(cfg)
+	decoder := NewHttpFrameDecoder(cfg)
+
+	req, _ := http.NewRequest("POST", "http://example.com/echo?a=1", strings.NewReader("hello"))
+	frame, err := encoder.Encode(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunked := "GET /chunked HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"5\r\nhello\r\n6\r\n world\r\n0\r\n\r\n"
+
+	// Feed pipelined requests byte by byte to decode across partial reads.
+	var results []interface{}
+	byteBuffer := buffer.NewElasticUnsafeByteBuf(len(frame))
+	for _, b := range append(frame, chunked...) {
+		byteBuffer.WriteBytes([]byte{b})
+		for {
+			result, err := decoder.Decode(byteBuffer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result == nil {
+				break
+			}
+			results = append(results, result)
+		}
+	}
+	if len(results) != 2 {
+		t.Fatal("unexpected count of requests", len(results))
+	}
+	first := results[0].(*http.Request)
+	if body, _ := ioutil.ReadAll(first.Body); first.Method != "POST" || first.URL.Path != "/echo" ||
+		first.URL.Query().Get("a") != "1" || first.Host != "example.com" || string(body) != "hello" {
+		t.Fatal("unexpected request", first)
+	}
+	second := results[1].(*http.Request)
+	if body, _ := ioutil.ReadAll(second.Body); second.URL.Path != "/chunked" || string(body) != "hello world" {
+		t.Fatal("unexpected request", second)
+	}
+
+	// Malformed request
+	byteBuffer.WriteBytes([]byte("NOT HTTP\r\n\r\n"))
+	if _, err := decoder.Decode(byteBuffer); err == nil {
+		t.Fatal("expect error for malformed request")
+	}
+}
+
+func TestHttpFrameCodec_Response(t *testing.T) {
+
+	cfg := HttpConfig{Client: true}
+	encoder := NewHttpFrameEncoder(cfg)
+	decoder := NewHttpFrameDecoder(cfg)
+
+	resp := &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        http.Header{"Content-Type": []string{"text/plain"}},
+		Body:          ioutil.NopCloser(strings.NewReader("pong")),
+		ContentLength: 4,
+	}
+	frame, err := encoder.Encode(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(frame, []byte("HTTP/1.1 200 OK\r\n")) {
+		t.Fatal("unexpected frame", string(frame))
+	}
+	byteBuffer := buffer.NewElasticUnsafeByteBuf(len(frame))
+	byteBuffer.WriteBytes(frame)
+	result, err := decoder.Decode(byteBuffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := result.(*http.Response)
+	if body, _ := ioutil.ReadAll(decoded.Body); decoded.StatusCode != http.StatusOK ||
+		decoded.Header.Get("Content-Type") != "text/plain" || string(body) != "pong" {
+		t.Fatal("unexpected response", decoded)
+	}
+}
+
+func TestHttpFrameCodec_FrameLimit(t *testing.T) {
+
+	decoder := NewHttpFrameDecoder(HttpConfig{FrameLimit: 64})
+	byteBuffer := buffer.NewElasticUnsafeByteBuf(128)
+
+	// Complete message larger than limit
+	byteBuffer.WriteBytes([]byte("POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 40\r\n\r\n" + strings.Repeat("a", 40)))
+	if _, err := decoder.Decode(byteBuffer); err == nil {
+		t.Fatal("expect error for complete message larger than limit")
+	}
+
+	// Chunked message larger than limit
+	byteBuffer.WriteBytes([]byte("POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n"))
+	if result, err := decoder.Decode(byteBuffer); result != nil || err != nil {
+		t.Fatal("expect nothing decoded but got", result, err)
+	}
+	byteBuffer.WriteBytes([]byte("10\r\n" + strings.Repeat("a", 16) + "\r\n"))
+	if _, err := decoder.Decode(byteBuffer); err == nil {
+		t.Fatal("expect error for chunked message larger than limit")
+	}
+
+	// Chunked message is limited by default when frame limit is not set.
+	decoder = NewHttpFrameDecoder(HttpConfig{})
+	byteBuffer.WriteBytes([]byte("POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n"))
+	chunk := []byte("100000\r\n" + strings.Repeat("a", 1<<20) + "\r\n")
+	var err error
+	for i := 0; i <= defaultHttpChunkedLimit>>20 && err == nil; i++ {
+		byteBuffer.WriteBytes(chunk)
+		_, err = decoder.Decode(byteBuffer)
+	}
+	if err == nil {
+		t.Fatal("expect error for chunked message larger than default limit")
+	}
+}
+
+func TestHttpFrameCodec_Trailer(t *testing.T) {
+
+	decoder := NewHttpFrameDecoder(HttpConfig{})
+	byteBuffer := buffer.NewElasticUnsafeByteBuf(128)
+	byteBuffer.WriteBytes([]byte("POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\nTrailer: X-Sum\r\n\r\n" +
+		"3;ext=1\r\nabc\r\n0\r\nx-sum: 3\r\n\r\n"))
+	result, err := decoder.Decode(byteBuffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := result.(*http.Request)
+	if body, _ := ioutil.ReadAll(req.Body); string(body) != "abc" || req.Trailer.Get("X-Sum") != "3" {
+		t.Fatal("unexpected request", req)
+	}
+
+	// Malformed chunk
+	byteBuffer.WriteBytes([]byte("POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabcd\r\n"))
+	if _, err := decoder.Decode(byteBuffer); err == nil {
+		t.Fatal("expect error for malformed chunk")
+	}
+}
@@ -0,0 +1,198 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package codec
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/mervinkid/matcha/buffer"
+)
+
+// LengthFieldConfig is a data struct provide configuration properties for
+// LengthFieldBasedFrameDecoder, which describes where the length field is and how the frame
+// length is calculated from it.
+//  +----------+----------------+-------------------+
+//  |  HEADER  |  LENGTH FIELD  |  REST OF FRAME    |
+//  |          |                |                   |
+//  +----------+----------------+-------------------+
+//  ↑          ↑                ↑
+//  0    LengthFieldOffset   + LengthFieldLength
+//
+//  frame length = LengthFieldOffset + LengthFieldLength + length value + LengthAdjustment
+// Fields:
+//  MaxFrameLength is the limit of frame length before stripping, 0 means no limit.
+//  LengthFieldLength is the size of length field, which is 1, 2, 3, 4 or 8.
+//  LengthAdjustment is the value added to length value, such as negative header size if length
+//  value includes the whole frame.
+//  InitialBytesToStrip is the number of bytes stripped from the beginning of decoded frame.
+//  LittleEndian make length field read in little endian instead of big endian.
+type LengthFieldConfig struct {
+	MaxFrameLength      uint32
+	LengthFieldOffset   int
+	LengthFieldLength   int
+	LengthAdjustment    int
+	InitialBytesToStrip int
+	LittleEndian        bool
+}
+
+// LengthFieldBasedFrameDecoder is a bytes to bytes decoder implementation of FrameDecoder which
+// split frames by value of length field at any offset, for interoperation with existing wire
+// protocols. TLVFrameDecoder works like it with offset 1 and length field size 4.
+// Frame larger than MaxFrameLength is discarded with an error.
+//
+// Example of LengthFieldOffset 2, LengthFieldLength 2, LengthAdjustment 1 and InitialBytesToStrip 4:
+//  +--------+--------+------+---------------+            +------+---------------+
+//  | 0xCAFE | 0x000B | 0x01 | "Hello World" | → decode → | 0x01 | "Hello World" |
+//  +--------+--------+------+---------------+            +------+---------------+
+// Notes:
+//  Decode []byte → []byte.
+type LengthFieldBasedFrameDecoder struct {
+	Config LengthFieldConfig
+	// Decode buffer
+	frame       []byte
+	frameLength int
+	discarding  int
+}
+
+func (d *LengthFieldBasedFrameDecoder) Decode(in buffer.ByteBuf) (interface{}, error) {
+
+	// Discard rest bytes of frame which is too large.
+	if d.discarding > 0 {
+		discard := d.discarding
+		if discard > in.ReadableBytes() {
+			discard = in.ReadableBytes()
+		}
+		in.ReadBytes(discard)
+		d.discarding -= discard
+		if d.discarding > 0 {
+			return d.decodeNothing()
+		}
+	}
+
+	// Parse header and length field.
+	headerLength := d.Config.LengthFieldOffset + d.Config.LengthFieldLength
+	if d.frameLength == 0 {
+		if !d.read(in, headerLength) {
+			// No enough bytes to parse.
+			return d.decodeNothing()
+		}
+		frameLength, err := d.parseFrameLength()
+		if err != nil {
+			d.resetBuffer()
+			return d.decodeFailure(err.Error())
+		}
+		if d.Config.MaxFrameLength > 0 && uint64(frameLength) > uint64(d.Config.MaxFrameLength) {
+			d.discarding = frameLength - headerLength
+			d.resetBuffer()
+			cause := fmt.Sprintf("frame size %d larger than limit %d", frameLength, d.Config.MaxFrameLength)
+			return d.decodeFailure(cause)
+		}
+		d.frameLength = frameLength
+	}
+
+	// Parse rest of frame.
+	if !d.read(in, d.frameLength) {
+		// No enough bytes to parse.
+		return d.decodeNothing()
+	}
+	if d.Config.InitialBytesToStrip > len(d.frame) {
+		d.resetBuffer()
+		return d.decodeFailure("frame size less than initial bytes to strip")
+	}
+	return d.decodeSuccess(d.frame[d.Config.InitialBytesToStrip:])
+}
+
+// read read bytes from inbound into frame buffer until it has specified length, returns true if
+// frame buffer is filled.
+func (d *LengthFieldBasedFrameDecoder) read(in buffer.ByteBuf, length int) bool {
+	if missing := length - len(d.frame); missing > 0 {
+		if missing > in.ReadableBytes() {
+			missing = in.ReadableBytes()
+		}
+		if missing > 0 {
+			d.frame = append(d.frame, in.ReadBytes(missing)...)
+		}
+	}
+	return len(d.frame) >= length
+}
+
+// parseFrameLength returns length of whole frame calculated with length field in frame buffer.
+func (d *LengthFieldBasedFrameDecoder) parseFrameLength() (int, error) {
+	var order binary.ByteOrder = binary.BigEndian
+	if d.Config.LittleEndian {
+		order = binary.LittleEndian
+	}
+	field := d.frame[d.Config.LengthFieldOffset:]
+	var length uint64
+	switch d.Config.LengthFieldLength {
+	case 1:
+		length = uint64(field[0])
+	case 2:
+		length = uint64(order.Uint16(field))
+	case 3:
+		if d.Config.LittleEndian {
+			length = uint64(field[0]) | uint64(field[1])<<8 | uint64(field[2])<<16
+		} else {
+			length = uint64(field[0])<<16 | uint64(field[1])<<8 | uint64(field[2])
+		}
+	case 4:
+		length = uint64(order.Uint32(field))
+	case 8:
+		length = order.Uint64(field)
+	default:
+		return 0, fmt.Errorf("unsupported length field length %d", d.Config.LengthFieldLength)
+	}
+	headerLength := d.Config.LengthFieldOffset + d.Config.LengthFieldLength
+	frameLength := int64(headerLength) + int64(d.Config.LengthAdjustment) + int64(length)
+	if length > 1<<62 || frameLength < int64(headerLength) || int64(int(frameLength)) != frameLength {
+		return 0, fmt.Errorf("illegal length field value %d", length)
+	}
+	return int(frameLength), nil
+}
+
+// resetBuffer reset all buffer data inside LengthFieldBasedFrameDecoder.
+func (d *LengthFieldBasedFrameDecoder) resetBuffer() {
+	d.frame = nil
+	d.frameLength = 0
+}
+
+func (d *LengthFieldBasedFrameDecoder) decodeNothing() (interface{}, error) {
+	return d.decodeSuccess(nil)
+}
+
+func (d *LengthFieldBasedFrameDecoder) decodeSuccess(result interface{}) (interface{}, error) {
+	if result != nil {
+		d.resetBuffer()
+	}
+	return result, nil
+}
+
+func (d *LengthFieldBasedFrameDecoder) decodeFailure(cause string) (interface{}, error) {
+	return nil, NewDecodeError("LengthFieldBasedFrameDecoder", cause)
+}
+
+// NewLengthFieldBasedFrameDecoder create instance of LengthFieldBasedFrameDecoder with specified
+// configuration.
+func NewLengthFieldBasedFrameDecoder(config LengthFieldConfig) FrameDecoder {
+	return &LengthFieldBasedFrameDecoder{Config: config}
+}
@@ -0,0 +1,90 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package codec
+
+import (
+	"bytes"
+	"github.com/mervinkid/matcha/buffer"
+	"testing"
+)
+
+func TestLengthFieldBasedFrameDecoder(t *testing.T) {
+
+	cfg := LengthFieldConfig{
+		MaxFrameLength:      64,
+		LengthFieldOffset:   2,
+		LengthFieldLength:   2,
+		LengthAdjustment:    1,
+		InitialBytesToStrip: 4,
+	}
+	decoder := NewLengthFieldBasedFrameDecoder(cfg)
+	frame := append([]byte{0xCA, 0xFE, 0x00, 0x0B, 0x01}, "Hello World"...)
+
+	// Feed frame byte by byte to decode across partial reads.
+	byteBuffer := buffer.NewElasticUnsafeByteBuf(len(frame))
+	var result interface{}
+	for i, b := range frame {
+		byteBuffer.WriteBytes([]byte{b})
+		decodeResult, err := decoder.Decode(byteBuffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decodeResult != nil && i != len(frame)-1 {
+			t.Fatal("unexpected result before frame completed", i)
+		}
+		result = decodeResult
+	}
+	if expected := append([]byte{0x01}, "Hello World"...); !bytes.Equal(result.([]byte), expected) {
+		t.Fatal("unexpected decode result", result)
+	}
+
+	// Frame larger than limit is discarded and following frame is decoded.
+	large := append([]byte{0xCA, 0xFE, 0x00, 0x63, 0x01}, make([]byte, 99)...)
+	byteBuffer.WriteBytes(large)
+	byteBuffer.WriteBytes(frame)
+	if _, err := decoder.Decode(byteBuffer); err == nil {
+		t.Fatal("expect error for large frame")
+	}
+	if decodeResult, err := decoder.Decode(byteBuffer); err != nil || decodeResult == nil {
+		t.Fatal("expect frame decoded after discarding", decodeResult, err)
+	}
+}
+
+func TestLengthFieldBasedFrameDecoder_LittleEndian(t *testing.T) {
+
+	cfg := LengthFieldConfig{
+		LengthFieldLength: 3,
+		LengthAdjustment:  -3,
+		LittleEndian:      true,
+	}
+	decoder := NewLengthFieldBasedFrameDecoder(cfg)
+	byteBuffer := buffer.NewElasticUnsafeByteBuf(16)
+	byteBuffer.WriteBytes(append([]byte{0x08, 0x00, 0x00}, "Hello"...))
+	result, err := decoder.Decode(byteBuffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := append([]byte{0x08, 0x00, 0x00}, "Hello"...); !bytes.Equal(result.([]byte), expected) {
+		t.Fatal("unexpected decode result", result)
+	}
+}
@@ -0,0 +1,115 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package codec
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mervinkid/matcha/buffer"
+)
+
+// LineConfig is a data struct provide configuration properties for LineFrameDecoder.
+// Fields:
+//  MaxLength limits length of line excluding delimiter, 0 means no limit.
+//  StripDelimiter strips "\n" or "\r\n" from the end of decoded line if set.
+type LineConfig struct {
+	MaxLength      int
+	StripDelimiter bool
+}
+
+// LineFrameDecoder is a bytes to string decoder implementation of FrameDecoder which splits inbound
+// data into lines ended with "\n" or "\r\n".
+//
+// Example:
+//  +----------------------------------------+            +----------+  +------------+
+//  |0x48|0x69|0x0d|0x0a|0x4d|0x61|0x74|0x0a| → decode → | "Hi\r\n" |, | "Mat\n"    |
+//  +----------------------------------------+            +----------+  +------------+
+//
+// Notes:
+//  Decode []byte → string.
+//  Line longer than MaxLength is discarded until the next delimiter with a failure returned.
+type LineFrameDecoder struct {
+	Config LineConfig
+	// Decode buffer
+	pending    []byte
+	discarding bool
+}
+
+func (d *LineFrameDecoder) Decode(in buffer.ByteBuf) (interface{}, error) {
+
+	if in.ReadableBytes() > 0 {
+		d.pending = append(d.pending, in.ReadSlice(in.ReadableBytes())...)
+	}
+
+	index := bytes.IndexByte(d.pending, '\n')
+	if index < 0 {
+		// Discard bytes of line longer than limit.
+		if d.Config.MaxLength > 0 && len(d.pending) > d.Config.MaxLength+1 {
+			length := len(d.pending)
+			d.pending = d.pending[:0]
+			if !d.discarding {
+				d.discarding = true
+				return d.decodeFailure(fmt.Sprintf("line length %d larger than limit %d", length, d.Config.MaxLength))
+			}
+		}
+		// No enough bytes to parse.
+		return d.decodeNothing()
+	}
+
+	line := string(d.pending[:index+1])
+	d.pending = append(d.pending[:0], d.pending[index+1:]...)
+	if d.discarding {
+		// End of discarded line.
+		d.discarding = false
+		return d.Decode(in)
+	}
+
+	delimiterSize := 1
+	if index > 0 && line[index-1] == '\r' {
+		delimiterSize = 2
+	}
+	if length := len(line) - delimiterSize; d.Config.MaxLength > 0 && length > d.Config.MaxLength {
+		return d.decodeFailure(fmt.Sprintf("line length %d larger than limit %d", length, d.Config.MaxLength))
+	}
+	if d.Config.StripDelimiter {
+		line = line[:len(line)-delimiterSize]
+	}
+	return d.decodeSuccess(line)
+}
+
+func (d *LineFrameDecoder) decodeNothing() (interface{}, error) {
+	return d.decodeSuccess(nil)
+}
+
+func (d *LineFrameDecoder) decodeSuccess(result interface{}) (interface{}, error) {
+	return result, nil
+}
+
+func (d *LineFrameDecoder) decodeFailure(cause string) (interface{}, error) {
+	return nil, NewDecodeError("LineFrameDecoder", cause)
+}
+
+// NewLineFrameDecoder create a new LineFrameDecoder instance with specified configuration.
+func NewLineFrameDecoder(config LineConfig) FrameDecoder {
+	return &LineFrameDecoder{Config: config}
+}
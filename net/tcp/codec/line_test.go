@@ -0,0 +1,79 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package codec
+
+import (
+	"github.com/mervinkid/matcha/buffer"
+	"testing"
+)
+
+func TestLineFrameDecoder(t *testing.T) {
+
+	decoder := NewLineFrameDecoder(LineConfig{MaxLength: 8})
+	byteBuffer := buffer.NewElasticUnsafeByteBuf(1024)
+
+	byteBuffer.WriteBytes([]byte("Hello\r\nWor"))
+	if result, err := decoder.Decode(byteBuffer); err != nil || result != "Hello\r\n" {
+		t.Fatal("unexpected decode result", result, err)
+	}
+	if result, err := decoder.Decode(byteBuffer); result != nil || err != nil {
+		t.Fatal("unexpected result of partial line", result, err)
+	}
+	byteBuffer.WriteBytes([]byte("ld.\n"))
+	if result, err := decoder.Decode(byteBuffer); err != nil || result != "World.\n" {
+		t.Fatal("unexpected decode result", result, err)
+	}
+
+	// Line longer than limit is discarded with one failure.
+	byteBuffer.WriteBytes([]byte("The quick brown "))
+	if _, err := decoder.Decode(byteBuffer); err == nil {
+		t.Fatal("expect line length larger than limit")
+	}
+	byteBuffer.WriteBytes([]byte("fox jumps over the lazy dog.\nMatcha\n"))
+	if result, err := decoder.Decode(byteBuffer); err != nil || result != "Matcha\n" {
+		t.Fatal("unexpected decode result", result, err)
+	}
+	byteBuffer.WriteBytes([]byte("Too long line.\nMatcha\n"))
+	if _, err := decoder.Decode(byteBuffer); err == nil {
+		t.Fatal("expect line length larger than limit")
+	}
+	if result, err := decoder.Decode(byteBuffer); err != nil || result != "Matcha\n" {
+		t.Fatal("unexpected decode result", result, err)
+	}
+}
+
+func TestLineFrameDecoder_StripDelimiter(t *testing.T) {
+
+	decoder := NewLineFrameDecoder(LineConfig{StripDelimiter: true})
+	byteBuffer := buffer.NewElasticUnsafeByteBuf(1024)
+	byteBuffer.WriteBytes([]byte("Hello\r\n\nWorld.\n"))
+
+	for _, expected := range []string{"Hello", "", "World."} {
+		if result, err := decoder.Decode(byteBuffer); err != nil || result != expected {
+			t.Fatal("unexpected decode result", result, err)
+		}
+	}
+	if result, err := decoder.Decode(byteBuffer); result != nil || err != nil {
+		t.Fatal("unexpected decode result", result, err)
+	}
+}
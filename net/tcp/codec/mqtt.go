@@ -0,0 +1,637 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/mervinkid/matcha/buffer"
+)
+
+// Types of MQTT control packet.
+const (
+	MqttConnectType     uint8 = 1
+	MqttConnackType     uint8 = 2
+	MqttPublishType     uint8 = 3
+	MqttPubackType      uint8 = 4
+	MqttPubrecType      uint8 = 5
+	MqttPubrelType      uint8 = 6
+	MqttPubcompType     uint8 = 7
+	MqttSubscribeType   uint8 = 8
+	MqttSubackType      uint8 = 9
+	MqttUnsubscribeType uint8 = 10
+	MqttUnsubackType    uint8 = 11
+	MqttPingreqType     uint8 = 12
+	MqttPingrespType    uint8 = 13
+	MqttDisconnectType  uint8 = 14
+)
+
+// maxMqttRemainingLength is the maximal value of remaining length in 4 bytes.
+const maxMqttRemainingLength = 268435455
+
+var errMalformedMqttPacket = errors.New("malformed packet")
+
+// MqttPacket is the interface of MQTT 3.1.1 control packet.
+type MqttPacket interface {
+	PacketType() uint8
+}
+
+// MqttConnect is the CONNECT packet. Will message is sent if WillTopic is set, username and
+// password are sent if they are not empty.
+type MqttConnect struct {
+	ProtocolName  string
+	ProtocolLevel uint8
+	CleanSession  bool
+	KeepAlive     uint16
+	ClientId      string
+	WillTopic     string
+	WillMessage   []byte
+	WillQos       uint8
+	WillRetain    bool
+	Username      string
+	Password      []byte
+}
+
+func (p *MqttConnect) PacketType() uint8 {
+	return MqttConnectType
+}
+
+// MqttConnack is the CONNACK packet.
+type MqttConnack struct {
+	SessionPresent bool
+	ReturnCode     uint8
+}
+
+func (p *MqttConnack) PacketType() uint8 {
+	return MqttConnackType
+}
+
+// MqttPublish is the PUBLISH packet. PacketId is only present while Qos is greater than 0.
+type MqttPublish struct {
+	Dup      bool
+	Qos      uint8
+	Retain   bool
+	Topic    string
+	PacketId uint16
+	Payload  []byte
+}
+
+func (p *MqttPublish) PacketType() uint8 {
+	return MqttPublishType
+}
+
+// MqttPuback is the PUBACK packet.
+type MqttPuback struct {
+	PacketId uint16
+}
+
+func (p *MqttPuback) PacketType() uint8 {
+	return MqttPubackType
+}
+
+// MqttPubrec is the PUBREC packet.
+type MqttPubrec struct {
+	PacketId uint16
+}
+
+func (p *MqttPubrec) PacketType() uint8 {
+	return MqttPubrecType
+}
+
+// MqttPubrel is the PUBREL packet.
+type MqttPubrel struct {
+	PacketId uint16
+}
+
+func (p *MqttPubrel) PacketType() uint8 {
+	return MqttPubrelType
+}
+
+// MqttPubcomp is the PUBCOMP packet.
+type MqttPubcomp struct {
+	PacketId uint16
+}
+
+func (p *MqttPubcomp) PacketType() uint8 {
+	return MqttPubcompType
+}
+
+// MqttSubscription is the topic filter and requested qos of SUBSCRIBE packet.
+type MqttSubscription struct {
+	Topic string
+	Qos   uint8
+}
+
+// MqttSubscribe is the SUBSCRIBE packet.
+type MqttSubscribe struct {
+	PacketId      uint16
+	Subscriptions []MqttSubscription
+}
+
+func (p *MqttSubscribe) PacketType() uint8 {
+	return MqttSubscribeType
+}
+
+// MqttSuback is the SUBACK packet.
+type MqttSuback struct {
+	PacketId    uint16
+	ReturnCodes []uint8
+}
+
+func (p *MqttSuback) PacketType() uint8 {
+	return MqttSubackType
+}
+
+// MqttUnsubscribe is the UNSUBSCRIBE packet.
+type MqttUnsubscribe struct {
+	PacketId uint16
+	Topics   []string
+}
+
+func (p *MqttUnsubscribe) PacketType() uint8 {
+	return MqttUnsubscribeType
+}
+
+// MqttUnsuback is the UNSUBACK packet.
+type MqttUnsuback struct {
+	PacketId uint16
+}
+
+func (p *MqttUnsuback) PacketType() uint8 {
+	return MqttUnsubackType
+}
+
+// MqttPingreq is the PINGREQ packet.
+type MqttPingreq struct{}
+
+func (p *MqttPingreq) PacketType() uint8 {
+	return MqttPingreqType
+}
+
+// MqttPingresp is the PINGRESP packet.
+type MqttPingresp struct{}
+
+func (p *MqttPingresp) PacketType() uint8 {
+	return MqttPingrespType
+}
+
+// MqttDisconnect is the DISCONNECT packet.
+type MqttDisconnect struct{}
+
+func (p *MqttDisconnect) PacketType() uint8 {
+	return MqttDisconnectType
+}
+
+// MqttConfig is a data struct provide configuration properties for both MqttFrameDecoder and
+// MqttFrameEncoder. FrameLimit limits size of packet, 0 means no limit.
+type MqttConfig struct {
+	FrameLimit uint32
+}
+
+// MqttFrameDecoder is a bytes to MqttPacket decoder implementation of FrameDecoder with MQTT 3.1.1
+// format.
+//  +-----------+-------------+------------------+-----------+
+//  |   TYPE    |    FLAGS    | REMAINING LENGTH |  PAYLOAD  |
+//  | (4 bits)  |  (4 bits)   | (1~4 bytes)      |           |
+//  +-----------+-------------+------------------+-----------+
+// Decode:
+//  []byte → MqttPacket(*pointer)
+type MqttFrameDecoder struct {
+	Config MqttConfig
+	// Decode buffer
+	hasHeader   bool
+	hasLength   bool
+	header      uint8
+	lengthBytes []byte
+	lengthValue int
+}
+
+func (d *MqttFrameDecoder) Decode(in buffer.ByteBuf) (interface{}, error) {
+
+	// Parse fixed header
+	if !d.hasHeader {
+		if in.ReadableBytes() < 1 {
+			// No enough bytes to parse.
+			return d.decodeNothing()
+		}
+		d.header = in.ReadBytes(1)[0]
+		d.hasHeader = true
+	}
+
+	// Parse remaining length byte by byte, which may be split across reads.
+	for !d.hasLength {
+		if in.ReadableBytes() < 1 {
+			// No enough bytes to parse.
+			return d.decodeNothing()
+		}
+		b := in.ReadBytes(1)[0]
+		d.lengthBytes = append(d.lengthBytes, b)
+		if b&0x80 != 0 {
+			if len(d.lengthBytes) >= 4 {
+				d.resetBuffer()
+				return d.decodeFailure("illegal remaining length")
+			}
+			continue
+		}
+		length, _ := binary.Uvarint(d.lengthBytes)
+		// Validate frame size
+		if d.Config.FrameLimit > 0 && uint64(1+len(d.lengthBytes))+length > uint64(d.Config.FrameLimit) {
+			d.resetBuffer()
+			return d.decodeFailure("frame size larger than limit")
+		}
+		d.lengthValue = int(length)
+		d.hasLength = true
+	}
+
+	// Parse variable header and payload
+	if in.ReadableBytes() < d.lengthValue {
+		// No enough bytes to parse.
+		return d.decodeNothing()
+	}
+	var body []byte
+	if d.lengthValue > 0 {
+		body = in.ReadBytes(d.lengthValue)
+	}
+	header := d.header
+	d.resetBuffer()
+	packet, err := parseMqttPacket(header>>4, header&0x0F, body)
+	if err != nil {
+		return d.decodeFailure(err.Error())
+	}
+	return d.decodeSuccess(packet)
+}
+
+// resetBuffer reset all buffer data inside MqttFrameDecoder.
+func (d *MqttFrameDecoder) resetBuffer() {
+	d.hasHeader = false
+	d.hasLength = false
+	d.header = 0
+	d.lengthBytes = d.lengthBytes[:0]
+	d.lengthValue = 0
+}
+
+func (d *MqttFrameDecoder) decodeNothing() (interface{}, error) {
+	return d.decodeSuccess(nil)
+}
+
+func (d *MqttFrameDecoder) decodeSuccess(result interface{}) (interface{}, error) {
+	return result, nil
+}
+
+func (d *MqttFrameDecoder) decodeFailure(cause string) (interface{}, error) {
+	return nil, NewDecodeError("MqttFrameDecoder", cause)
+}
+
+// NewMqttFrameDecoder create instance of MqttFrameDecoder with specified configuration.
+func NewMqttFrameDecoder(config MqttConfig) FrameDecoder {
+	return &MqttFrameDecoder{Config: config}
+}
+
+// parseMqttPacket parse packet of specified type from flags and body.
+func parseMqttPacket(packetType, flags uint8, body []byte) (MqttPacket, error) {
+	// Flags are reserved except PUBLISH, and must be 0010 for PUBREL, SUBSCRIBE and UNSUBSCRIBE.
+	switch packetType {
+	case MqttPublishType:
+	case MqttPubrelType, MqttSubscribeType, MqttUnsubscribeType:
+		if flags != 0x02 {
+			return nil, fmt.Errorf("illegal flags %#x of packet type %d", flags, packetType)
+		}
+	default:
+		if flags != 0 {
+			return nil, fmt.Errorf("illegal flags %#x of packet type %d", flags, packetType)
+		}
+	}
+
+	r := &mqttReader{data: body}
+	var packet MqttPacket
+	switch packetType {
+	case MqttConnectType:
+		p := &MqttConnect{}
+		p.ProtocolName = r.readString()
+		p.ProtocolLevel = r.readByte()
+		connectFlags := r.readByte()
+		p.KeepAlive = r.readUint16()
+		p.ClientId = r.readString()
+		if connectFlags&0x01 != 0 {
+			return nil, errMalformedMqttPacket
+		}
+		p.CleanSession = connectFlags&0x02 != 0
+		if connectFlags&0x04 != 0 {
+			p.WillQos = connectFlags >> 3 & 0x03
+			p.WillRetain = connectFlags&0x20 != 0
+			p.WillTopic = r.readString()
+			p.WillMessage = r.readBytes()
+		}
+		if connectFlags&0x80 != 0 {
+			p.Username = r.readString()
+		}
+		if connectFlags&0x40 != 0 {
+			p.Password = r.readBytes()
+		}
+		packet = p
+	case MqttConnackType:
+		p := &MqttConnack{}
+		p.SessionPresent = r.readByte()&0x01 != 0
+		p.ReturnCode = r.readByte()
+		packet = p
+	case MqttPublishType:
+		p := &MqttPublish{Dup: flags&0x08 != 0, Qos: flags >> 1 & 0x03, Retain: flags&0x01 != 0}
+		if p.Qos > 2 {
+			return nil, fmt.Errorf("illegal qos %d", p.Qos)
+		}
+		p.Topic = r.readString()
+		if p.Qos > 0 {
+			p.PacketId = r.readUint16()
+		}
+		p.Payload = r.readRest()
+		packet = p
+	case MqttPubackType:
+		packet = &MqttPuback{PacketId: r.readUint16()}
+	case MqttPubrecType:
+		packet = &MqttPubrec{PacketId: r.readUint16()}
+	case MqttPubrelType:
+		packet = &MqttPubrel{PacketId: r.readUint16()}
+	case MqttPubcompType:
+		packet = &MqttPubcomp{PacketId: r.readUint16()}
+	case MqttSubscribeType:
+		p := &MqttSubscribe{PacketId: r.readUint16()}
+		for r.err == nil && len(r.data) > 0 {
+			p.Subscriptions = append(p.Subscriptions, MqttSubscription{Topic: r.readString(), Qos: r.readByte()})
+		}
+		if len(p.Subscriptions) == 0 {
+			return nil, errMalformedMqttPacket
+		}
+		packet = p
+	case MqttSubackType:
+		packet = &MqttSuback{PacketId: r.readUint16(), ReturnCodes: r.readRest()}
+	case MqttUnsubscribeType:
+		p := &MqttUnsubscribe{PacketId: r.readUint16()}
+		for r.err == nil && len(r.data) > 0 {
+			p.Topics = append(p.Topics, r.readString())
+		}
+		if len(p.Topics) == 0 {
+			return nil, errMalformedMqttPacket
+		}
+		packet = p
+	case MqttUnsubackType:
+		packet = &MqttUnsuback{PacketId: r.readUint16()}
+	case MqttPingreqType:
+		packet = &MqttPingreq{}
+	case MqttPingrespType:
+		packet = &MqttPingresp{}
+	case MqttDisconnectType:
+		packet = &MqttDisconnect{}
+	default:
+		return nil, fmt.Errorf("unsupported packet type %d", packetType)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(r.data) > 0 {
+		return nil, errMalformedMqttPacket
+	}
+	return packet, nil
+}
+
+// mqttReader read fields of packet body and remember the first error.
+type mqttReader struct {
+	data []byte
+	err  error
+}
+
+func (r *mqttReader) read(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) < n {
+		r.err = errMalformedMqttPacket
+		return nil
+	}
+	result := r.data[:n]
+	r.data = r.data[n:]
+	return result
+}
+
+func (r *mqttReader) readByte() uint8 {
+	if b := r.read(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *mqttReader) readUint16() uint16 {
+	if b := r.read(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *mqttReader) readBytes() []byte {
+	length := r.readUint16()
+	if r.err != nil {
+		return nil
+	}
+	return append([]byte{}, r.read(int(length))...)
+}
+
+func (r *mqttReader) readString() string {
+	return string(r.readBytes())
+}
+
+func (r *mqttReader) readRest() []byte {
+	return append([]byte{}, r.read(len(r.data))...)
+}
+
+// MqttFrameEncoder is a MqttPacket to bytes encoder implementation of FrameEncoder with MQTT 3.1.1
+// format.
+//  +-----------+-------------+------------------+-----------+
+//  |   TYPE    |    FLAGS    | REMAINING LENGTH |  PAYLOAD  |
+//  | (4 bits)  |  (4 bits)   | (1~4 bytes)      |           |
+//  +-----------+-------------+------------------+-----------+
+// Encode:
+//  MqttPacket(*pointer) → []byte
+type MqttFrameEncoder struct {
+	Config MqttConfig
+}
+
+func (e *MqttFrameEncoder) Encode(msg interface{}) ([]byte, error) {
+
+	// Message must be an implementation of MqttPacket interface.
+	packet, ok := msg.(MqttPacket)
+	if !ok {
+		return e.encodeFailure("message is not valid implementation of MqttPacket interface")
+	}
+
+	// Build variable header and payload.
+	w := &mqttWriter{}
+	var flags uint8
+	switch p := packet.(type) {
+	case *MqttConnect:
+		protocolName, protocolLevel := p.ProtocolName, p.ProtocolLevel
+		if protocolName == "" {
+			protocolName, protocolLevel = "MQTT", 4
+		}
+		var connectFlags uint8
+		if p.CleanSession {
+			connectFlags |= 0x02
+		}
+		if p.WillTopic != "" {
+			connectFlags |= 0x04 | (p.WillQos&0x03)<<3
+			if p.WillRetain {
+				connectFlags |= 0x20
+			}
+		}
+		if p.Password != nil {
+			connectFlags |= 0x40
+		}
+		if p.Username != "" {
+			connectFlags |= 0x80
+		}
+		w.writeString(protocolName)
+		w.WriteByte(protocolLevel)
+		w.WriteByte(connectFlags)
+		w.writeUint16(p.KeepAlive)
+		w.writeString(p.ClientId)
+		if p.WillTopic != "" {
+			w.writeString(p.WillTopic)
+			w.writeBytes(p.WillMessage)
+		}
+		if p.Username != "" {
+			w.writeString(p.Username)
+		}
+		if p.Password != nil {
+			w.writeBytes(p.Password)
+		}
+	case *MqttConnack:
+		if p.SessionPresent {
+			w.WriteByte(0x01)
+		} else {
+			w.WriteByte(0x00)
+		}
+		w.WriteByte(p.ReturnCode)
+	case *MqttPublish:
+		if p.Qos > 2 {
+			return e.encodeFailure(fmt.Sprintf("illegal qos %d", p.Qos))
+		}
+		flags = p.Qos << 1
+		if p.Dup {
+			flags |= 0x08
+		}
+		if p.Retain {
+			flags |= 0x01
+		}
+		w.writeString(p.Topic)
+		if p.Qos > 0 {
+			w.writeUint16(p.PacketId)
+		}
+		w.Write(p.Payload)
+	case *MqttPuback:
+		w.writeUint16(p.PacketId)
+	case *MqttPubrec:
+		w.writeUint16(p.PacketId)
+	case *MqttPubrel:
+		flags = 0x02
+		w.writeUint16(p.PacketId)
+	case *MqttPubcomp:
+		w.writeUint16(p.PacketId)
+	case *MqttSubscribe:
+		flags = 0x02
+		w.writeUint16(p.PacketId)
+		for _, subscription := range p.Subscriptions {
+			w.writeString(subscription.Topic)
+			w.WriteByte(subscription.Qos)
+		}
+	case *MqttSuback:
+		w.writeUint16(p.PacketId)
+		w.Write(p.ReturnCodes)
+	case *MqttUnsubscribe:
+		flags = 0x02
+		w.writeUint16(p.PacketId)
+		for _, topic := range p.Topics {
+			w.writeString(topic)
+		}
+	case *MqttUnsuback:
+		w.writeUint16(p.PacketId)
+	case *MqttPingreq, *MqttPingresp, *MqttDisconnect:
+	default:
+		return e.encodeFailure(fmt.Sprintf("unsupported packet type %d", packet.PacketType()))
+	}
+	if w.err != nil {
+		return e.encodeFailure(w.err.Error())
+	}
+	if w.Len() > maxMqttRemainingLength {
+		return e.encodeFailure("remaining length larger than limit")
+	}
+
+	// Assemble fixed header, remaining length and body.
+	frame := make([]byte, 1+binary.MaxVarintLen32, 1+binary.MaxVarintLen32+w.Len())
+	frame[0] = packet.PacketType()<<4 | flags
+	n := binary.PutUvarint(frame[1:], uint64(w.Len()))
+	frame = append(frame[:1+n], w.Bytes()...)
+
+	// Validate frame size
+	if e.Config.FrameLimit > 0 && uint64(len(frame)) > uint64(e.Config.FrameLimit) {
+		cause := fmt.Sprintf("frame size %d larger than limit %d", len(frame), e.Config.FrameLimit)
+		return e.encodeFailure(cause)
+	}
+	return e.encodeSuccess(frame)
+}
+
+func (e *MqttFrameEncoder) encodeSuccess(result []byte) ([]byte, error) {
+	return result, nil
+}
+
+func (e *MqttFrameEncoder) encodeFailure(cause string) ([]byte, error) {
+	return nil, NewEncodeError("MqttFrameEncoder", cause)
+}
+
+// NewMqttFrameEncoder create instance of MqttFrameEncoder with specified configuration.
+func NewMqttFrameEncoder(config MqttConfig) FrameEncoder {
+	return &MqttFrameEncoder{Config: config}
+}
+
+// mqttWriter write fields of packet body and remember the first error.
+type mqttWriter struct {
+	bytes.Buffer
+	err error
+}
+
+func (w *mqttWriter) writeUint16(value uint16) {
+	w.WriteByte(byte(value >> 8))
+	w.WriteByte(byte(value))
+}
+
+func (w *mqttWriter) writeBytes(data []byte) {
+	if len(data) > 0xFFFF {
+		w.err = errors.New("field larger than 65535 bytes")
+		return
+	}
+	w.writeUint16(uint16(len(data)))
+	w.Write(data)
+}
+
+func (w *mqttWriter) writeString(s string) {
+	w.writeBytes([]byte(s))
+}
@@ -0,0 +1,117 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package codec
+
+import (
+	"bytes"
+	"github.com/mervinkid/matcha/buffer"
+	"reflect"
+	"testing"
+)
+
+func TestMqttFrameCodec(t *testing.T) {
+
+	encoder := NewMqttFrameEncoder(MqttConfig{})
+	decoder := NewMqttFrameDecoder(MqttConfig{})
+
+	packets := []MqttPacket{
+		&MqttConnect{ProtocolName: "MQTT", ProtocolLevel: 4, CleanSession: true, KeepAlive: 60,
+			ClientId: "client-1", WillTopic: "status", WillMessage: []byte("offline"), WillQos: 1,
+			Username: "user", Password: []byte("pwd")},
+		&MqttConnack{SessionPresent: true},
+		&MqttPublish{Qos: 1, Retain: true, Topic: "a/b", PacketId: 7, Payload: bytes.Repeat([]byte("x"), 200)},
+		&MqttPublish{Topic: "a/b", Payload: []byte{}},
+		&MqttPuback{PacketId: 7},
+		&MqttPubrec{PacketId: 8},
+		&MqttPubrel{PacketId: 8},
+		&MqttPubcomp{PacketId: 8},
+		&MqttSubscribe{PacketId: 9, Subscriptions: []MqttSubscription{{Topic: "a/#", Qos: 1}, {Topic: "b/+", Qos: 2}}},
+		&MqttSuback{PacketId: 9, ReturnCodes: []uint8{1, 0x80}},
+		&MqttUnsubscribe{PacketId: 10, Topics: []string{"a/#"}},
+		&MqttUnsuback{PacketId: 10},
+		&MqttPingreq{},
+		&MqttPingresp{},
+		&MqttDisconnect{},
+	}
+
+	// Encode all packets and feed them byte by byte.
+	var stream []byte
+	for _, packet := range packets {
+		frame, err := encoder.Encode(packet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream = append(stream, frame...)
+	}
+	var results []interface{}
+	byteBuffer := buffer.NewElasticUnsafeByteBuf(len(stream))
+	for _, b := range stream {
+		byteBuffer.WriteBytes([]byte{b})
+		for {
+			result, err := decoder.Decode(byteBuffer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result == nil {
+				break
+			}
+			results = append(results, result)
+		}
+	}
+	if len(results) != len(packets) {
+		t.Fatal("unexpected count of packets", len(results))
+	}
+	for i, packet := range packets {
+		if !reflect.DeepEqual(results[i], packet) {
+			t.Fatalf("expected %+v but got %+v", packet, results[i])
+		}
+	}
+}
+
+func TestMqttFrameDecoder_Malformed(t *testing.T) {
+
+	decoder := NewMqttFrameDecoder(MqttConfig{FrameLimit: 16})
+	byteBuffer := buffer.NewElasticUnsafeByteBuf(16)
+
+	// PINGREQ with reserved flags set
+	byteBuffer.WriteBytes([]byte{0xC1, 0x00})
+	if _, err := decoder.Decode(byteBuffer); err == nil {
+		t.Fatal("expect error for illegal flags")
+	}
+	// PUBACK without packet id
+	byteBuffer.WriteBytes([]byte{0x40, 0x01, 0x00})
+	if _, err := decoder.Decode(byteBuffer); err == nil {
+		t.Fatal("expect error for malformed packet")
+	}
+	// Packet larger than limit
+	byteBuffer.WriteBytes([]byte{0x30, 0x7F})
+	if _, err := decoder.Decode(byteBuffer); err == nil {
+		t.Fatal("expect error for large packet")
+	}
+	// Valid packet after errors
+	byteBuffer.Reset()
+	byteBuffer.WriteBytes([]byte{0xC0, 0x00})
+	if result, err := decoder.Decode(byteBuffer); err != nil || !reflect.DeepEqual(result, &MqttPingreq{}) {
+		t.Fatal("unexpected decode result", result, err)
+	}
+}
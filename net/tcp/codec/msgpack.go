@@ -0,0 +1,247 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package codec
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/mervinkid/matcha/buffer"
+	"github.com/vmihailenco/msgpack"
+)
+
+// MsgpackConfig is a data struct provide configuration properties for both MsgpackFrameDecoder and
+// MsgpackFrameEncoder.
+// Fields:
+//  FrameLimit limits size of each msgpack object, 0 means no limit.
+//  Constructor creates value which decoded object is unmarshaled into, object is unmarshaled into
+//  interface{} if it is nil.
+type MsgpackConfig struct {
+	FrameLimit  uint32
+	Constructor func() interface{}
+}
+
+// MsgpackFrameDecoder is a decoder implementation of FrameDecoder which decode msgpack objects
+// written back-to-back without envelope. Boundary of object is found with length information of
+// msgpack format.
+//  +-------------------+-------------------+-----
+//  |  msgpack object   |  msgpack object   | ...
+//  +-------------------+-------------------+-----
+// Notes:
+//  Decode []byte → value created by Constructor, or interface{}.
+//  Stream can not be recovered after illegal format found, so all pending bytes are discarded.
+type MsgpackFrameDecoder struct {
+	Config MsgpackConfig
+	// Decode buffer
+	pending []byte
+}
+
+func (d *MsgpackFrameDecoder) Decode(in buffer.ByteBuf) (interface{}, error) {
+
+	if in.ReadableBytes() > 0 {
+		d.pending = append(d.pending, in.ReadSlice(in.ReadableBytes())...)
+	}
+	if len(d.pending) == 0 {
+		return d.decodeNothing()
+	}
+
+	size, err := msgpackObjectSize(d.pending, d.Config.FrameLimit)
+	if err != nil {
+		d.pending = nil
+		return d.decodeFailure(err.Error())
+	}
+	if size == 0 {
+		// No enough bytes to parse.
+		return d.decodeNothing()
+	}
+
+	data := d.pending[:size]
+	var result interface{}
+	if d.Config.Constructor != nil {
+		result = d.Config.Constructor()
+		err = msgpack.Unmarshal(data, result)
+	} else {
+		err = msgpack.Unmarshal(data, &result)
+	}
+	d.pending = append(d.pending[:0], d.pending[size:]...)
+	if err != nil {
+		return d.decodeFailure(err.Error())
+	}
+	return d.decodeSuccess(result)
+}
+
+func (d *MsgpackFrameDecoder) decodeNothing() (interface{}, error) {
+	return d.decodeSuccess(nil)
+}
+
+func (d *MsgpackFrameDecoder) decodeSuccess(result interface{}) (interface{}, error) {
+	return result, nil
+}
+
+func (d *MsgpackFrameDecoder) decodeFailure(cause string) (interface{}, error) {
+	return nil, NewDecodeError("MsgpackFrameDecoder", cause)
+}
+
+// NewMsgpackFrameDecoder create a new MsgpackFrameDecoder instance with configuration.
+func NewMsgpackFrameDecoder(config MsgpackConfig) FrameDecoder {
+	return &MsgpackFrameDecoder{Config: config}
+}
+
+// msgpackObjectSize returns size of the first complete msgpack object in data, or 0 if data is
+// incomplete.
+func msgpackObjectSize(data []byte, limit uint32) (int, error) {
+	offset := uint64(0)
+	// Number of objects left to complete the first one, including elements of array and map.
+	remain := uint64(1)
+	for remain > 0 {
+		if limit > 0 && offset > uint64(limit) {
+			return 0, fmt.Errorf("object size larger than limit %d", limit)
+		}
+		if offset >= uint64(len(data)) {
+			return 0, nil
+		}
+		remain--
+		code := data[offset]
+		headerSize, length, elements := uint64(1), uint64(0), uint64(0)
+		switch {
+		case code <= 0x7f || code >= 0xe0 || code == 0xc0 || code == 0xc2 || code == 0xc3:
+			// positive fixint, negative fixint, nil, false, true
+		case code <= 0x8f:
+			// fixmap
+			elements = uint64(code&0x0f) * 2
+		case code <= 0x9f:
+			// fixarray
+			elements = uint64(code & 0x0f)
+		case code <= 0xbf:
+			// fixstr
+			length = uint64(code & 0x1f)
+		case code == 0xc4 || code == 0xd9:
+			// bin 8, str 8
+			headerSize = 2
+		case code == 0xc5 || code == 0xda:
+			// bin 16, str 16
+			headerSize = 3
+		case code == 0xc6 || code == 0xdb:
+			// bin 32, str 32
+			headerSize = 5
+		case code == 0xc7:
+			// ext 8
+			headerSize = 3
+		case code == 0xc8:
+			// ext 16
+			headerSize = 4
+		case code == 0xc9:
+			// ext 32
+			headerSize = 6
+		case code == 0xca || code == 0xce || code == 0xd2:
+			// float 32, uint 32, int 32
+			length = 4
+		case code == 0xcb || code == 0xcf || code == 0xd3:
+			// float 64, uint 64, int 64
+			length = 8
+		case code == 0xcc || code == 0xd0:
+			// uint 8, int 8
+			length = 1
+		case code == 0xcd || code == 0xd1:
+			// uint 16, int 16
+			length = 2
+		case code >= 0xd4 && code <= 0xd8:
+			// fixext 1, 2, 4, 8, 16
+			length = 1 + 1<<(code-0xd4)
+		case code == 0xdc || code == 0xde:
+			// array 16, map 16
+			headerSize = 3
+		case code == 0xdd || code == 0xdf:
+			// array 32, map 32
+			headerSize = 5
+		default:
+			return 0, fmt.Errorf("illegal format code 0x%x", code)
+		}
+		if offset+headerSize > uint64(len(data)) {
+			return 0, nil
+		}
+		header := data[offset+1 : offset+headerSize]
+		switch code {
+		case 0xc4, 0xd9, 0xc7:
+			length = uint64(header[0])
+		case 0xc5, 0xda, 0xc8:
+			length = uint64(binary.BigEndian.Uint16(header))
+		case 0xc6, 0xdb, 0xc9:
+			length = uint64(binary.BigEndian.Uint32(header))
+		case 0xdc:
+			elements = uint64(binary.BigEndian.Uint16(header))
+		case 0xdd:
+			elements = uint64(binary.BigEndian.Uint32(header))
+		case 0xde:
+			elements = uint64(binary.BigEndian.Uint16(header)) * 2
+		case 0xdf:
+			elements = uint64(binary.BigEndian.Uint32(header)) * 2
+		}
+		if code == 0xc7 || code == 0xc8 || code == 0xc9 {
+			// Type of ext
+			length++
+		}
+		offset += headerSize + length
+		remain += elements
+	}
+	if limit > 0 && offset > uint64(limit) {
+		return 0, fmt.Errorf("object size larger than limit %d", limit)
+	}
+	if offset > uint64(len(data)) {
+		return 0, nil
+	}
+	return int(offset), nil
+}
+
+// MsgpackFrameEncoder is a encoder implementation of FrameEncoder which encode message as msgpack
+// object without envelope.
+// Notes:
+//  Encode interface{} → []byte.
+type MsgpackFrameEncoder struct {
+	Config MsgpackConfig
+}
+
+func (e *MsgpackFrameEncoder) Encode(msg interface{}) ([]byte, error) {
+
+	data, err := msgpack.Marshal(msg)
+	if err != nil {
+		return e.encodeFailure(err.Error())
+	}
+	if e.Config.FrameLimit > 0 && uint64(len(data)) > uint64(e.Config.FrameLimit) {
+		cause := fmt.Sprintf("object size %d larger than limit %d", len(data), e.Config.FrameLimit)
+		return e.encodeFailure(cause)
+	}
+	return e.encodeSuccess(data)
+}
+
+func (e *MsgpackFrameEncoder) encodeSuccess(result []byte) ([]byte, error) {
+	return result, nil
+}
+
+func (e *MsgpackFrameEncoder) encodeFailure(cause string) ([]byte, error) {
+	return nil, NewEncodeError("MsgpackFrameEncoder", cause)
+}
+
+// NewMsgpackFrameEncoder create a new MsgpackFrameEncoder instance with configuration.
+func NewMsgpackFrameEncoder(config MsgpackConfig) FrameEncoder {
+	return &MsgpackFrameEncoder{Config: config}
+}
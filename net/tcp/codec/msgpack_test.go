@@ -0,0 +1,98 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package codec
+
+import (
+	"github.com/mervinkid/matcha/buffer"
+	"github.com/vmihailenco/msgpack"
+	"testing"
+	"time"
+)
+
+func TestMsgpackFrameCodec(t *testing.T) {
+
+	config := MsgpackConfig{Constructor: func() interface{} {
+		return &_tUser{}
+	}}
+	encoder := NewMsgpackFrameEncoder(config)
+	decoder := NewMsgpackFrameDecoder(config)
+
+	user := &_tUser{Id: 1, Name: "Mervin", Group: _tGroup{Id: 2, Name: "Matcha"}}
+	frame, err := encoder.Encode(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Feed objects back-to-back byte by byte.
+	stream := append(append([]byte{}, frame...), frame...)
+	byteBuffer := buffer.NewElasticUnsafeByteBuf(len(stream))
+	var results []interface{}
+	for i := range stream {
+		byteBuffer.WriteBytes(stream[i : i+1])
+		result, err := decoder.Decode(byteBuffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != nil {
+			if i != len(frame)-1 && i != len(stream)-1 {
+				t.Fatal("object decoded at unexpected offset", i)
+			}
+			results = append(results, result)
+		}
+	}
+	if len(results) != 2 || *results[0].(*_tUser) != *user || *results[1].(*_tUser) != *user {
+		t.Fatal("unexpected decode results", results)
+	}
+}
+
+func TestMsgpackObjectSize(t *testing.T) {
+
+	objects := []interface{}{
+		nil, true, 1, -1, 200, -200, 70000, 1 << 40, 1.5, float32(1.5),
+		"", "Hello World.", string(make([]byte, 300)), string(make([]byte, 70000)),
+		[]byte("Hello World."), make([]byte, 300),
+		[]interface{}{1, "a", []interface{}{nil}}, make([]int, 20),
+		map[string]interface{}{"a": 1, "b": map[string]interface{}{"c": []int{1, 2}}},
+		time.Unix(1514764800, 0),
+	}
+	for _, object := range objects {
+		data, err := msgpack.Marshal(object)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size, err := msgpackObjectSize(data, 0); err != nil || size != len(data) {
+			t.Fatal("unexpected size of", object, size, len(data), err)
+		}
+		if size, err := msgpackObjectSize(data[:len(data)-1], 0); err != nil || size != 0 {
+			t.Fatal("unexpected size of incomplete", object, size, err)
+		}
+	}
+
+	if _, err := msgpackObjectSize([]byte{0xc1}, 0); err == nil {
+		t.Fatal("expect illegal format code")
+	}
+	data, _ := msgpack.Marshal(make([]byte, 300))
+	if _, err := msgpackObjectSize(data, 100); err == nil {
+		t.Fatal("expect object size larger than limit")
+	}
+}
@@ -0,0 +1,210 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package codec
+
+import (
+	"encoding/binary"
+	"reflect"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/mervinkid/matcha/buffer"
+)
+
+// ProtobufConfig is the configuration of ProtobufFrameDecoder and ProtobufFrameEncoder with TLV
+// framing and registry of message types. Codecs created with the same config share the registry.
+type ProtobufConfig struct {
+	TLVConfig
+	messageConstructors map[uint16]func() proto.Message
+	typeCodes           map[reflect.Type]uint16
+}
+
+// RegisterMessage register constructor of protocol buffers message with type code which is written
+// into frame for decoding. Type code of message type registered before is replaced.
+func (c *ProtobufConfig) RegisterMessage(typeCode uint16, constructor func() proto.Message) {
+	c.initConfig()
+	if constructor != nil {
+		if testMessage := constructor(); testMessage != nil {
+			c.messageConstructors[typeCode] = constructor
+			c.typeCodes[reflect.TypeOf(testMessage)] = typeCode
+		}
+	}
+}
+
+func (c *ProtobufConfig) createMessage(typeCode uint16) proto.Message {
+	c.initConfig()
+	if constructor := c.messageConstructors[typeCode]; constructor != nil {
+		return constructor()
+	}
+	return nil
+}
+
+func (c *ProtobufConfig) typeCodeOf(message proto.Message) (uint16, bool) {
+	c.initConfig()
+	typeCode, ok := c.typeCodes[reflect.TypeOf(message)]
+	return typeCode, ok
+}
+
+func (c *ProtobufConfig) initConfig() {
+	if c.messageConstructors == nil {
+		c.messageConstructors = make(map[uint16]func() proto.Message)
+	}
+	if c.typeCodes == nil {
+		c.typeCodes = make(map[reflect.Type]uint16)
+	}
+}
+
+// ProtobufFrameDecoder is a bytes to proto.Message decode implementation of FrameDecode based on
+// TLVFrameDecoder using protocol buffers for payload data deserialization.
+//  +----------+-----------+---------------------------+
+//  |    TAG   |  LENGTH   |           VALUE           |
+//  | (1 byte) | (4 bytes) |   2 bytes   | serialized  |
+//  |          |           |  type code  |    data     |
+//  +----------+-----------+---------------------------+
+// Decode:
+//  []byte → proto.Message(*pointer)
+type ProtobufFrameDecoder struct {
+	Config     ProtobufConfig
+	tlvDecoder FrameDecoder
+}
+
+func (d *ProtobufFrameDecoder) Decode(in buffer.ByteBuf) (interface{}, error) {
+
+	if in.ReadableBytes() == 0 {
+		return d.decodeNothing()
+	}
+
+	// Decode inbound with TLVFrameDecoder
+	d.initTLVDecoder()
+	tlvPayload, tlvErr := d.tlvDecoder.Decode(in)
+	if tlvPayload == nil && tlvErr == nil {
+		return d.decodeNothing()
+	}
+	if tlvErr != nil {
+		return d.decodeFailure(tlvErr.Error())
+	}
+
+	// Parse 2 bytes of message type code.
+	payload := tlvPayload.([]byte)
+	if len(payload) < 2 {
+		return d.decodeFailure("illegal payload")
+	}
+	typeCode := binary.BigEndian.Uint16(payload)
+
+	// Parse reset bytes for serialized data.
+	if message := d.Config.createMessage(typeCode); message != nil {
+		if unmarshalErr := proto.Unmarshal(payload[2:], message); unmarshalErr != nil {
+			return d.decodeFailure(unmarshalErr.Error())
+		}
+		return d.decodeSuccess(message)
+	}
+	return d.decodeNothing()
+}
+
+func (d *ProtobufFrameDecoder) initTLVDecoder() {
+	if d.tlvDecoder == nil {
+		d.tlvDecoder = NewTLVFrameDecoder(d.Config.TLVConfig.wholeValue())
+	}
+}
+
+func (d *ProtobufFrameDecoder) decodeNothing() (interface{}, error) {
+	return d.decodeSuccess(nil)
+}
+
+func (d *ProtobufFrameDecoder) decodeSuccess(result interface{}) (interface{}, error) {
+	return result, nil
+}
+
+func (d *ProtobufFrameDecoder) decodeFailure(cause string) (interface{}, error) {
+	return nil, NewDecodeError("ProtobufFrameDecoder", cause)
+}
+
+// NewProtobufFrameDecoder create a new ProtobufFrameDecoder instance with configuration.
+func NewProtobufFrameDecoder(config ProtobufConfig) FrameDecoder {
+	return &ProtobufFrameDecoder{Config: config}
+}
+
+// ProtobufFrameEncoder is a proto.Message to bytes encoder implementation of FrameEncode based on
+// TLVFrameEncoder using protocol buffers for payload data serialization. Type of message must be
+// registered in config.
+//  +----------+-----------+---------------------------+
+//  |    TAG   |  LENGTH   |           VALUE           |
+//  | (1 byte) | (4 bytes) |   2 bytes   | serialized  |
+//  |          |           |  type code  |    data     |
+//  +----------+-----------+---------------------------+
+// Encode:
+//  proto.Message(*pointer) → []byte
+type ProtobufFrameEncoder struct {
+	Config     ProtobufConfig
+	tlvEncoder FrameEncoder
+}
+
+func (e *ProtobufFrameEncoder) Encode(msg interface{}) ([]byte, error) {
+
+	// Message must be a registered protocol buffers message.
+	message, ok := msg.(proto.Message)
+	if !ok {
+		return e.encodeFailure("message is not valid implementation of proto.Message interface")
+	}
+	typeCode, ok := e.Config.typeCodeOf(message)
+	if !ok {
+		return e.encodeFailure("type of message is not registered")
+	}
+
+	// Marshal message to bytes.
+	marshaledBytes, marshalErr := proto.Marshal(message)
+	if marshalErr != nil {
+		return e.encodeFailure(marshalErr.Error())
+	}
+	// Build frame payload with marshaled bytes and type code.
+	payload := make([]byte, 2+len(marshaledBytes))
+	binary.BigEndian.PutUint16(payload, typeCode)
+	copy(payload[2:], marshaledBytes)
+
+	// Encode with TLVEncoder
+	e.initTLVEncoder()
+	frameBytes, encodeErr := e.tlvEncoder.Encode(payload)
+	if encodeErr != nil {
+		return e.encodeFailure(encodeErr.Error())
+	}
+
+	return e.encodeSuccess(frameBytes)
+}
+
+func (e *ProtobufFrameEncoder) initTLVEncoder() {
+	if e.tlvEncoder == nil {
+		e.tlvEncoder = NewTLVFrameEncoder(e.Config.TLVConfig)
+	}
+}
+
+func (e *ProtobufFrameEncoder) encodeSuccess(result []byte) ([]byte, error) {
+	return result, nil
+}
+
+func (e *ProtobufFrameEncoder) encodeFailure(cause string) ([]byte, error) {
+	return nil, NewEncodeError("ProtobufFrameEncoder", cause)
+}
+
+// NewProtobufFrameEncoder create a new ProtobufFrameEncoder instance with configuration.
+func NewProtobufFrameEncoder(config ProtobufConfig) FrameEncoder {
+	return &ProtobufFrameEncoder{Config: config}
+}
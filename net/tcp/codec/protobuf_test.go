@@ -0,0 +1,86 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package codec
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/mervinkid/matcha/buffer"
+)
+
+func TestProtobufFrameCodec(t *testing.T) {
+
+	// Prepare codec
+	config := ProtobufConfig{}
+	config.RegisterMessage(1, func() proto.Message {
+		return &wrappers.StringValue{}
+	})
+	config.RegisterMessage(2, func() proto.Message {
+		return &wrappers.Int64Value{}
+	})
+	encoder := NewProtobufFrameEncoder(config)
+	decoder := NewProtobufFrameDecoder(config)
+
+	// Encode
+	encodeResult, encodeError := encoder.Encode(&wrappers.Int64Value{Value: 42})
+	if encodeError != nil {
+		t.Fatal(encodeError)
+	}
+	if _, err := encoder.Encode(&wrappers.BoolValue{Value: true}); err == nil {
+		t.Fatal("expect error for unregistered message type")
+	}
+
+	// Decode
+	byteBuffer := buffer.NewElasticUnsafeByteBuf(len(encodeResult))
+	byteBuffer.WriteBytes(encodeResult)
+	decodeResult, decodeError := decoder.Decode(byteBuffer)
+	if decodeError != nil {
+		t.Fatal(decodeError)
+	}
+	if value, ok := decodeResult.(*wrappers.Int64Value); !ok || value.Value != 42 {
+		t.Fatal("unexpected decode result", decodeResult)
+	}
+}
+
+func TestProtobufFrameCodec_ValueView(t *testing.T) {
+
+	config := ProtobufConfig{}
+	config.ValueView = true
+	config.StreamThreshold = 1
+	config.RegisterMessage(1, func() proto.Message {
+		return &wrappers.StringValue{}
+	})
+	encoder := NewProtobufFrameEncoder(config)
+	decoder := NewProtobufFrameDecoder(config)
+
+	frame, err := encoder.Encode(&wrappers.StringValue{Value: "Hello World."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := decoder.Decode(buffer.WrapElasticUnsafeByteBuf(frame))
+	if value, ok := result.(*wrappers.StringValue); err != nil || !ok || value.Value != "Hello World." {
+		t.Fatal("unexpected decode result", result, err)
+	}
+}
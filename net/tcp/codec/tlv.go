@@ -27,13 +27,57 @@ import (
 	"encoding/binary"
 	"fmt"
 	"github.com/mervinkid/matcha/buffer"
+	"hash"
+	"hash/adler32"
+	"hash/crc32"
 )
 
 const (
-	TagSize    = 1
-	LengthSize = 4
+	TagSize      = 1
+	LengthSize   = 4
+	ChecksumSize = 4
 )
 
+// Checksum is the algorithm of checksum appended to TLV frame.
+type Checksum uint8
+
+const (
+	ChecksumNone Checksum = iota
+	ChecksumCRC32
+	ChecksumAdler32
+)
+
+// size returns size of checksum field in frame.
+func (c Checksum) size() int {
+	if c == ChecksumNone {
+		return 0
+	}
+	return ChecksumSize
+}
+
+// sum returns checksum of specified parts of frame.
+func (c Checksum) sum(parts ...[]byte) uint32 {
+	h := c.hash()
+	if h == nil {
+		return 0
+	}
+	for _, part := range parts {
+		h.Write(part)
+	}
+	return h.Sum32()
+}
+
+// hash returns a new hash of checksum, or nil for ChecksumNone.
+func (c Checksum) hash() hash.Hash32 {
+	switch c {
+	case ChecksumCRC32:
+		return crc32.NewIEEE()
+	case ChecksumAdler32:
+		return adler32.New()
+	}
+	return nil
+}
+
 // TLVConfig is a data struct provide configuration properties for both
 // TLVFrameDecoder and TLVFrameEncoder.
 //  +----------+-----------+-----------+
@@ -43,9 +87,47 @@ const (
 //       ↑
 //    TagValue
 //
+// Checksum of tag, length and value is appended to frame if Checksum is set, which is verified
+// while decoding. Length does not include checksum.
+//  +----------+-----------+-----------+-----------+
+//  |    TAG   |  LENGTH   |   VALUE   | CHECKSUM  |
+//  | (1 byte) | (4 bytes) | (payload) | (4 bytes) |
+//  +----------+-----------+-----------+-----------+
+//
+// Decoder emits value as buffer.ByteBuf which shares memory with inbound buffer instead of copied
+// []byte if ValueView is set. Value longer than StreamThreshold is emitted incrementally as TLVChunk
+// while bytes arrive if StreamThreshold is set, so that large value is not buffered entirely. Both
+// of them are ignored by codecs based on TLV frame such as ApolloFrameDecoder.
+//
+// Decoder scans forward for the next byte equals to TagValue after illegal tag found if Resync is
+// set, and bytes before it are skipped with only one failure returned. Tag followed by length larger
+// than FrameLimit is dropped too, and scanning resumes at the byte next to it. Checksum is
+// recommended with Resync since skipped bytes may contain byte equals to TagValue.
 type TLVConfig struct {
-	TagValue   uint8
-	FrameLimit uint32
+	TagValue        uint8
+	FrameLimit      uint32
+	Checksum        Checksum
+	ValueView       bool
+	StreamThreshold uint32
+	Resync          bool
+}
+
+// wholeValue returns copy of config for decoders which take value of TLV frame as []byte, with
+// ValueView and StreamThreshold cleared.
+func (c TLVConfig) wholeValue() TLVConfig {
+	c.ValueView = false
+	c.StreamThreshold = 0
+	return c
+}
+
+// TLVChunk is a part of large value emitted by TLVFrameDecoder in order while streaming.
+// Value shares memory with inbound buffer if ValueView is set. Checksum of frame is verified before
+// the last chunk is emitted, value of the last chunk may be empty.
+type TLVChunk struct {
+	Value  []byte
+	Offset uint32
+	Length uint32
+	Last   bool
 }
 
 // TLVFrameDecoder is a bytes to bytes decoder implementation of FrameDecoder with TLV format.
@@ -58,6 +140,8 @@ type TLVConfig struct {
 //
 // Notes:
 //  Decode []byte → []byte.
+//  Decode []byte → buffer.ByteBuf if ValueView is set.
+//  Decode []byte → TLVChunk if length of value is larger than StreamThreshold.
 type TLVFrameDecoder struct {
 	Config TLVConfig
 	// Decode buffer
@@ -65,10 +149,31 @@ type TLVFrameDecoder struct {
 	hasLength   bool
 	tagValue    uint8
 	lengthValue uint32
+	skipping    bool
+	pending     []byte // Length bytes of dropped tag to be scanned again.
+	// Stream buffer
+	streaming    bool
+	discarding   bool
+	streamOffset uint32
+	streamHash   hash.Hash32
 }
 
 func (c *TLVFrameDecoder) Decode(in buffer.ByteBuf) (interface{}, error) {
 
+	// Skip bytes until next tag found
+	if c.Config.Resync && !c.hasTag {
+		skipped := c.skipIllegal(in)
+		wasSkipping := c.skipping
+		c.skipping = !c.hasTag
+		if skipped > 0 && !wasSkipping {
+			return c.decodeFailure(fmt.Sprintf("illegal tag found, %d bytes skipped", skipped))
+		}
+		if !c.hasTag {
+			// No enough bytes to parse.
+			return c.decodeNothing()
+		}
+	}
+
 	// Parse T(tag)
 	if !c.hasTag {
 		if in.ReadableBytes() < TagSize {
@@ -91,11 +196,12 @@ func (c *TLVFrameDecoder) Decode(in buffer.ByteBuf) (interface{}, error) {
 
 	// Parse L(length)
 	if c.hasTag && !c.hasLength {
-		if in.ReadableBytes() < LengthSize {
+		if len(c.pending)+in.ReadableBytes() < LengthSize {
 			// No enough bytes to parse.
 			return nil, nil
 		}
-		tmpBytes := in.ReadBytes(LengthSize)
+		tmpBytes := append(c.pending, in.ReadBytes(LengthSize-len(c.pending))...)
+		c.pending = nil
 		reader := bytes.NewReader(tmpBytes)
 		var length uint32
 		err := binary.Read(reader, binary.BigEndian, &length)
@@ -104,18 +210,48 @@ func (c *TLVFrameDecoder) Decode(in buffer.ByteBuf) (interface{}, error) {
 		}
 		c.lengthValue = length
 		c.hasLength = true
+		// Validate frame size
+		if c.exceedLimit() {
+			if c.Config.Resync {
+				// Drop the tag and scan again from the byte next to it.
+				c.resetBuffer()
+				c.pending = tmpBytes
+				c.skipping = true
+				return c.decodeFailure("frame size larger than limit")
+			}
+			// Discard value while it arrives instead of buffering it.
+			c.startStream()
+		} else if c.Config.StreamThreshold > 0 && length > c.Config.StreamThreshold {
+			c.startStream()
+		}
+	}
+
+	// Stream V(value) and checksum
+	if c.streaming {
+		return c.decodeStream(in)
 	}
 
-	// Parse V(value)
+	// Parse V(value) and checksum
 	if c.hasTag && c.hasLength {
-		if in.ReadableBytes() < int(c.lengthValue) {
+		checksumSize := c.Config.Checksum.size()
+		if in.ReadableBytes() < int(c.lengthValue)+checksumSize {
 			// No enough bytes to parse.
 			return nil, nil
 		}
-		tmpBytes := in.ReadBytes(int(c.lengthValue))
-		// Validate frame size
-		if c.Config.FrameLimit > 0 && uint64(TagSize+LengthSize)+uint64(len(tmpBytes)) > uint64(c.Config.FrameLimit) {
-			return c.decodeFailure("frame size larger than limit")
+		tmpBytes := c.readValue(in, int(c.lengthValue))
+		// Validate checksum
+		if checksumSize > 0 {
+			checksum := binary.BigEndian.Uint32(in.ReadBytes(checksumSize))
+			header := make([]byte, TagSize+LengthSize)
+			header[0] = c.tagValue
+			binary.BigEndian.PutUint32(header[TagSize:], c.lengthValue)
+			if c.Config.Checksum.sum(header, tmpBytes) != checksum {
+				c.resetBuffer()
+				return c.decodeFailure("checksum mismatch")
+			}
+		}
+		if c.Config.ValueView {
+			return c.decodeSuccess(buffer.WrapElasticUnsafeByteBuf(tmpBytes))
 		}
 		return c.decodeSuccess(tmpBytes)
 	}
@@ -123,12 +259,123 @@ func (c *TLVFrameDecoder) Decode(in buffer.ByteBuf) (interface{}, error) {
 	return c.decodeNothing()
 }
 
+// skipIllegal skip pending and readable bytes before the next byte equals to TagValue and parse it
+// as tag, returns number of bytes skipped.
+func (c *TLVFrameDecoder) skipIllegal(in buffer.ByteBuf) int {
+	skipped := 0
+	for len(c.pending) > 0 {
+		tag := c.pending[0]
+		c.pending = c.pending[1:]
+		if tag == c.Config.TagValue {
+			c.tagValue = tag
+			c.hasTag = true
+			return skipped
+		}
+		skipped++
+	}
+	for in.ReadableBytes() > 0 {
+		tag := in.ReadSlice(TagSize)
+		if tag[0] == c.Config.TagValue {
+			c.tagValue = tag[0]
+			c.hasTag = true
+			break
+		}
+		skipped++
+	}
+	return skipped
+}
+
+// exceedLimit returns true if frame of parsed length is larger than FrameLimit.
+func (c *TLVFrameDecoder) exceedLimit() bool {
+	checksumSize := c.Config.Checksum.size()
+	return c.Config.FrameLimit > 0 &&
+		uint64(TagSize+LengthSize+checksumSize)+uint64(c.lengthValue) > uint64(c.Config.FrameLimit)
+}
+
+// startStream prepare stream buffer for value of parsed length. Value of frame larger than limit
+// is discarded while streaming and failure is returned at the end of frame.
+func (c *TLVFrameDecoder) startStream() {
+	c.streaming = true
+	c.discarding = c.exceedLimit()
+	c.streamOffset = 0
+	c.streamHash = c.Config.Checksum.hash()
+	if c.streamHash != nil {
+		header := make([]byte, TagSize+LengthSize)
+		header[0] = c.tagValue
+		binary.BigEndian.PutUint32(header[TagSize:], c.lengthValue)
+		c.streamHash.Write(header)
+	}
+}
+
+// decodeStream emits readable bytes of value as TLVChunk until the whole value and checksum are
+// consumed.
+func (c *TLVFrameDecoder) decodeStream(in buffer.ByteBuf) (interface{}, error) {
+
+	var chunk []byte
+	offset := c.streamOffset
+	if remain := c.lengthValue - c.streamOffset; remain > 0 {
+		size := int(remain)
+		if in.ReadableBytes() < size {
+			size = in.ReadableBytes()
+		}
+		if size == 0 {
+			// No enough bytes to parse.
+			return c.decodeNothing()
+		}
+		chunk = c.readValue(in, size)
+		if c.streamHash != nil {
+			c.streamHash.Write(chunk)
+		}
+		c.streamOffset += uint32(size)
+	}
+
+	// Emit chunk until the end of value is reached with checksum.
+	checksumSize := c.Config.Checksum.size()
+	if c.streamOffset < c.lengthValue || in.ReadableBytes() < checksumSize {
+		if c.discarding || chunk == nil {
+			return c.decodeNothing()
+		}
+		return TLVChunk{Value: chunk, Offset: offset, Length: c.lengthValue}, nil
+	}
+
+	// Validate frame size and checksum
+	if c.discarding {
+		in.ReadBytes(checksumSize)
+		c.resetBuffer()
+		return c.decodeFailure("frame size larger than limit")
+	}
+	if checksumSize > 0 {
+		checksum := binary.BigEndian.Uint32(in.ReadBytes(checksumSize))
+		if c.streamHash.Sum32() != checksum {
+			c.resetBuffer()
+			return c.decodeFailure("checksum mismatch")
+		}
+	}
+	if chunk == nil {
+		chunk = []byte{}
+	}
+	return c.decodeSuccess(TLVChunk{Value: chunk, Offset: offset, Length: c.lengthValue, Last: true})
+}
+
+// readValue reads bytes of value from inbound buffer, which shares memory with inbound buffer if
+// ValueView is set.
+func (c *TLVFrameDecoder) readValue(in buffer.ByteBuf, length int) []byte {
+	if c.Config.ValueView {
+		return in.ReadSlice(length)
+	}
+	return in.ReadBytes(length)
+}
+
 // resetBuffer reset all buffer data inside TLVFrameDecoder.
 func (c *TLVFrameDecoder) resetBuffer() {
 	c.hasTag = false
 	c.hasLength = false
 	c.tagValue = 0
 	c.lengthValue = 0
+	c.streaming = false
+	c.discarding = false
+	c.streamOffset = 0
+	c.streamHash = nil
 }
 
 func (c *TLVFrameDecoder) decodeNothing() (interface{}, error) {
@@ -174,9 +421,10 @@ func (c *TLVFrameEncoder) Encode(msg interface{}) ([]byte, error) {
 	}
 
 	payloadLength := uint32(len(payload))
+	checksumSize := c.Config.Checksum.size()
 
 	// Validate frame size
-	frameSize := uint64(payloadLength + LengthSize + TagSize)
+	frameSize := uint64(payloadLength) + uint64(LengthSize+TagSize+checksumSize)
 	if c.Config.FrameLimit > 0 && frameSize > uint64(c.Config.FrameLimit) {
 		cause := fmt.Sprintf("frame size %d larger than limit %d", frameSize, c.Config.FrameLimit)
 		return c.encodeFailure(cause)
@@ -187,6 +435,12 @@ func (c *TLVFrameEncoder) Encode(msg interface{}) ([]byte, error) {
 	binary.Write(frameByteBuf, binary.BigEndian, c.Config.TagValue)
 	binary.Write(frameByteBuf, binary.BigEndian, payloadLength)
 	frameByteBuf.WriteBytes(payload)
+	if checksumSize > 0 {
+		header := make([]byte, TagSize+LengthSize)
+		header[0] = c.Config.TagValue
+		binary.BigEndian.PutUint32(header[TagSize:], payloadLength)
+		binary.Write(frameByteBuf, binary.BigEndian, c.Config.Checksum.sum(header, payload))
+	}
 
 	// Validate result
 	if frameSize != uint64(frameByteBuf.ReadableBytes()) {
@@ -68,3 +68,219 @@ func TestTLVCodec(t *testing.T) {
 	}
 
 }
+
+func TestTLVCodec_Checksum(t *testing.T) {
+
+	for _, checksum := range []Checksum{ChecksumCRC32, ChecksumAdler32} {
+		cfg := TLVConfig{TagValue: 170, Checksum: checksum}
+		encoder := NewTLVFrameEncoder(cfg)
+		decoder := NewTLVFrameDecoder(cfg)
+
+		frame, err := encoder.Encode([]byte("Hello World."))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(frame) != TagSize+LengthSize+len("Hello World.")+ChecksumSize {
+			t.Fatal("unexpected frame size", len(frame))
+		}
+
+		// Decode partial frame then the rest.
+		byteBuffer := buffer.NewElasticUnsafeByteBuf(len(frame))
+		byteBuffer.WriteBytes(frame[:len(frame)-2])
+		if result, err := decoder.Decode(byteBuffer); result != nil || err != nil {
+			t.Fatal("unexpected result of partial frame", result, err)
+		}
+		byteBuffer.WriteBytes(frame[len(frame)-2:])
+		if result, err := decoder.Decode(byteBuffer); err != nil || string(result.([]byte)) != "Hello World." {
+			t.Fatal("unexpected decode result", result, err)
+		}
+
+		// Corrupted frame fails checksum and following frame is decoded.
+		corrupted := append([]byte{}, frame...)
+		corrupted[TagSize+LengthSize] ^= 0xFF
+		byteBuffer.WriteBytes(corrupted)
+		byteBuffer.WriteBytes(frame)
+		if _, err := decoder.Decode(byteBuffer); err == nil {
+			t.Fatal("expect checksum mismatch")
+		}
+		if result, err := decoder.Decode(byteBuffer); err != nil || result == nil {
+			t.Fatal("expect frame decoded after corrupted one", result, err)
+		}
+
+		// Frame larger than limit is consumed with checksum and following frame is decoded.
+		limited := NewTLVFrameDecoder(TLVConfig{TagValue: 170, Checksum: checksum, FrameLimit: uint32(len(frame) - 1)})
+		small, _ := encoder.Encode([]byte("Hi"))
+		byteBuffer.WriteBytes(frame)
+		byteBuffer.WriteBytes(small)
+		if _, err := limited.Decode(byteBuffer); err == nil {
+			t.Fatal("expect frame size larger than limit")
+		}
+		if result, err := limited.Decode(byteBuffer); err != nil || result == nil || string(result.([]byte)) != "Hi" {
+			t.Fatal("expect frame decoded after one larger than limit", result, err)
+		}
+	}
+}
+
+func TestTLVCodec_ValueView(t *testing.T) {
+
+	cfg := TLVConfig{TagValue: 170, ValueView: true}
+	encoder := NewTLVFrameEncoder(cfg)
+	decoder := NewTLVFrameDecoder(cfg)
+
+	frame, err := encoder.Encode([]byte("Hello World."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	byteBuffer := buffer.NewElasticUnsafeByteBuf(len(frame))
+	byteBuffer.WriteBytes(frame)
+	result, err := decoder.Decode(byteBuffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	view, ok := result.(buffer.ByteBuf)
+	if !ok {
+		t.Fatal("expect ByteBuf but", result)
+	}
+	byteBuffer.Release()
+	if value := view.ReadBytes(view.ReadableBytes()); string(value) != "Hello World." {
+		t.Fatal("unexpected decode result", string(value))
+	}
+}
+
+func TestTLVCodec_Stream(t *testing.T) {
+
+	cfg := TLVConfig{TagValue: 170, Checksum: ChecksumCRC32, StreamThreshold: 16}
+	encoder := NewTLVFrameEncoder(cfg)
+	decoder := NewTLVFrameDecoder(cfg)
+
+	source := []byte("The quick brown fox jumps over the lazy dog.")
+	frame, err := encoder.Encode(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	small, err := encoder.Encode([]byte("Hello World."))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Feed frame in pieces and collect chunks.
+	byteBuffer := buffer.NewElasticUnsafeByteBuf(len(frame))
+	var value []byte
+	var last bool
+	for i := 0; i < len(frame); i += 10 {
+		end := i + 10
+		if end > len(frame) {
+			end = len(frame)
+		}
+		byteBuffer.WriteBytes(frame[i:end])
+		for {
+			result, err := decoder.Decode(byteBuffer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result == nil {
+				break
+			}
+			chunk := result.(TLVChunk)
+			if int(chunk.Offset) != len(value) || int(chunk.Length) != len(source) || last {
+				t.Fatal("unexpected chunk", chunk)
+			}
+			value = append(value, chunk.Value...)
+			last = chunk.Last
+		}
+		byteBuffer.Release()
+	}
+	if !last || string(value) != string(source) {
+		t.Fatal("unexpected stream result", string(value), last)
+	}
+
+	// Small value is not streamed.
+	byteBuffer.WriteBytes(small)
+	if result, err := decoder.Decode(byteBuffer); err != nil || string(result.([]byte)) != "Hello World." {
+		t.Fatal("unexpected decode result", result, err)
+	}
+
+	// Frame larger than limit is discarded.
+	decoder = NewTLVFrameDecoder(TLVConfig{TagValue: 170, Checksum: ChecksumCRC32, StreamThreshold: 16, FrameLimit: 32})
+	byteBuffer.WriteBytes(frame)
+	byteBuffer.WriteBytes(small)
+	if result, err := decoder.Decode(byteBuffer); err == nil {
+		t.Fatal("expect frame size larger than limit", result)
+	}
+	if result, err := decoder.Decode(byteBuffer); err != nil || string(result.([]byte)) != "Hello World." {
+		t.Fatal("unexpected decode result", result, err)
+	}
+}
+
+func TestTLVCodec_Resync(t *testing.T) {
+
+	cfg := TLVConfig{TagValue: 170, Checksum: ChecksumCRC32, Resync: true}
+	encoder := NewTLVFrameEncoder(cfg)
+	decoder := NewTLVFrameDecoder(cfg)
+
+	frame, err := encoder.Encode([]byte("Hello World."))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byteBuffer := buffer.NewElasticUnsafeByteBuf(1024)
+	byteBuffer.WriteBytes([]byte{1, 2, 3})
+	if _, err := decoder.Decode(byteBuffer); err == nil {
+		t.Fatal("expect illegal tag found")
+	}
+	// Garbage continues in following read without another failure.
+	byteBuffer.WriteBytes([]byte{4, 5})
+	byteBuffer.WriteBytes(frame)
+	byteBuffer.WriteBytes([]byte{6})
+	byteBuffer.WriteBytes(frame)
+	if result, err := decoder.Decode(byteBuffer); err != nil || string(result.([]byte)) != "Hello World." {
+		t.Fatal("unexpected decode result", result, err)
+	}
+	if _, err := decoder.Decode(byteBuffer); err == nil {
+		t.Fatal("expect illegal tag found")
+	}
+	if result, err := decoder.Decode(byteBuffer); err != nil || string(result.([]byte)) != "Hello World." {
+		t.Fatal("unexpected decode result", result, err)
+	}
+	if result, err := decoder.Decode(byteBuffer); result != nil || err != nil {
+		t.Fatal("unexpected decode result", result, err)
+	}
+}
+
+func TestTLVCodec_ResyncFrameLimit(t *testing.T) {
+
+	cfg := TLVConfig{TagValue: 0xAA, FrameLimit: 1024, Resync: true}
+	encoder := NewTLVFrameEncoder(cfg)
+	decoder := NewTLVFrameDecoder(cfg)
+
+	byteBuffer := buffer.NewElasticUnsafeByteBuf(1024)
+	byteBuffer.WriteBytes([]byte{0x01, 0xAA, 0x7F, 0xFF, 0xFF, 0xFF})
+	for _, value := range []string{"Hello", "World"} {
+		frame, err := encoder.Encode([]byte(value))
+		if err != nil {
+			t.Fatal(err)
+		}
+		byteBuffer.WriteBytes(frame)
+	}
+
+	// Tag followed by length larger than limit is dropped instead of waiting for its value.
+	var values []string
+	failures := 0
+	for i := 0; i < 8; i++ {
+		result, err := decoder.Decode(byteBuffer)
+		if err != nil {
+			failures++
+			continue
+		}
+		if result == nil {
+			break
+		}
+		values = append(values, string(result.([]byte)))
+	}
+	if len(values) != 2 || values[0] != "Hello" || values[1] != "World" {
+		t.Fatal("expect all frames emitted but got", values)
+	}
+	if failures != 2 {
+		t.Fatal("expect failures of illegal tag and frame limit but got", failures)
+	}
+}
@@ -0,0 +1,166 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package codec
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/mervinkid/matcha/buffer"
+)
+
+// VarintConfig is a data struct provide configuration properties for both VarintFrameDecoder and
+// VarintFrameEncoder. FrameLimit limits size of frame including length prefix, 0 means no limit.
+type VarintConfig struct {
+	FrameLimit uint32
+}
+
+// VarintFrameDecoder is a bytes to bytes decoder implementation of FrameDecoder with protobuf style
+// varint length prefix, which is compatible with delimited protobuf streams.
+//  +-------------+-----------+
+//  |   LENGTH    |   VALUE   |
+//  | (1~10 bytes | (payload) |
+//  |   varint)   |           |
+//  +-------------+-----------+
+// Notes:
+//  Decode []byte → []byte.
+type VarintFrameDecoder struct {
+	Config VarintConfig
+	// Decode buffer
+	lengthBytes []byte
+	hasLength   bool
+	lengthValue uint64
+}
+
+func (d *VarintFrameDecoder) Decode(in buffer.ByteBuf) (interface{}, error) {
+
+	// Parse varint length byte by byte, which may be split across reads.
+	for !d.hasLength {
+		if in.ReadableBytes() < 1 {
+			// No enough bytes to parse.
+			return d.decodeNothing()
+		}
+		b := in.ReadBytes(1)[0]
+		d.lengthBytes = append(d.lengthBytes, b)
+		if b&0x80 != 0 {
+			if len(d.lengthBytes) >= binary.MaxVarintLen64 {
+				d.resetBuffer()
+				return d.decodeFailure("illegal varint length")
+			}
+			continue
+		}
+		length, n := binary.Uvarint(d.lengthBytes)
+		if n <= 0 {
+			d.resetBuffer()
+			return d.decodeFailure("illegal varint length")
+		}
+		// Validate frame size
+		if d.Config.FrameLimit > 0 && uint64(len(d.lengthBytes))+length > uint64(d.Config.FrameLimit) {
+			d.resetBuffer()
+			return d.decodeFailure("frame size larger than limit")
+		}
+		d.lengthValue = length
+		d.hasLength = true
+	}
+
+	// Parse value
+	if uint64(in.ReadableBytes()) < d.lengthValue {
+		// No enough bytes to parse.
+		return d.decodeNothing()
+	}
+	return d.decodeSuccess(in.ReadBytes(int(d.lengthValue)))
+}
+
+// resetBuffer reset all buffer data inside VarintFrameDecoder.
+func (d *VarintFrameDecoder) resetBuffer() {
+	d.lengthBytes = d.lengthBytes[:0]
+	d.hasLength = false
+	d.lengthValue = 0
+}
+
+func (d *VarintFrameDecoder) decodeNothing() (interface{}, error) {
+	return d.decodeSuccess(nil)
+}
+
+func (d *VarintFrameDecoder) decodeSuccess(result interface{}) (interface{}, error) {
+	if result != nil {
+		d.resetBuffer()
+	}
+	return result, nil
+}
+
+func (d *VarintFrameDecoder) decodeFailure(cause string) (interface{}, error) {
+	return nil, NewDecodeError("VarintFrameDecoder", cause)
+}
+
+// NewVarintFrameDecoder create instance of VarintFrameDecoder with specified configuration.
+func NewVarintFrameDecoder(config VarintConfig) FrameDecoder {
+	return &VarintFrameDecoder{Config: config}
+}
+
+// VarintFrameEncoder is a bytes to bytes encoder implementation of FrameEncoder with protobuf style
+// varint length prefix.
+//  +-------------+-----------+
+//  |   LENGTH    |   VALUE   |
+//  | (1~10 bytes | (payload) |
+//  |   varint)   |           |
+//  +-------------+-----------+
+// Notes:
+//  Encode []byte → []byte.
+type VarintFrameEncoder struct {
+	Config VarintConfig
+}
+
+func (e *VarintFrameEncoder) Encode(msg interface{}) ([]byte, error) {
+
+	// Inbound type must be []byte
+	payload, payloadTransform := msg.([]byte)
+	if !payloadTransform {
+		return e.encodeFailure("can not transform input to []byte")
+	}
+
+	// Assemble
+	frame := make([]byte, binary.MaxVarintLen64+len(payload))
+	n := binary.PutUvarint(frame, uint64(len(payload)))
+	frame = append(frame[:n], payload...)
+
+	// Validate frame size
+	if e.Config.FrameLimit > 0 && uint64(len(frame)) > uint64(e.Config.FrameLimit) {
+		cause := fmt.Sprintf("frame size %d larger than limit %d", len(frame), e.Config.FrameLimit)
+		return e.encodeFailure(cause)
+	}
+
+	return e.encodeSuccess(frame)
+}
+
+func (e *VarintFrameEncoder) encodeSuccess(result []byte) ([]byte, error) {
+	return result, nil
+}
+
+func (e *VarintFrameEncoder) encodeFailure(cause string) ([]byte, error) {
+	return nil, NewEncodeError("VarintFrameEncoder", cause)
+}
+
+// NewVarintFrameEncoder create instance of VarintFrameEncoder with specified configuration.
+func NewVarintFrameEncoder(config VarintConfig) FrameEncoder {
+	return &VarintFrameEncoder{Config: config}
+}
@@ -0,0 +1,78 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package codec
+
+import (
+	"bytes"
+	"github.com/mervinkid/matcha/buffer"
+	"testing"
+)
+
+func TestVarintCodec(t *testing.T) {
+
+	cfg := VarintConfig{FrameLimit: 1024}
+	encoder := NewVarintFrameEncoder(cfg)
+	decoder := NewVarintFrameDecoder(cfg)
+
+	// Payload of 300 bytes has 2 bytes varint length.
+	payload := bytes.Repeat([]byte("a"), 300)
+	frame, err := encoder.Encode(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(frame[:2], []byte{0xAC, 0x02}) || len(frame) != 302 {
+		t.Fatal("unexpected frame", frame[:2], len(frame))
+	}
+
+	// Feed frame byte by byte to decode across partial varint and value.
+	byteBuffer := buffer.NewElasticUnsafeByteBuf(len(frame))
+	var result interface{}
+	for _, b := range frame {
+		byteBuffer.WriteBytes([]byte{b})
+		if result != nil {
+			t.Fatal("unexpected result before frame completed")
+		}
+		if result, err = decoder.Decode(byteBuffer); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(result.([]byte), payload) {
+		t.Fatal("unexpected decode result")
+	}
+
+	// Empty payload
+	frame, _ = encoder.Encode([]byte{})
+	byteBuffer.WriteBytes(frame)
+	if result, err := decoder.Decode(byteBuffer); err != nil || len(result.([]byte)) != 0 {
+		t.Fatal("unexpected decode result of empty payload", result, err)
+	}
+
+	// Frame larger than limit
+	if _, err := encoder.Encode(make([]byte, 1024)); err == nil {
+		t.Fatal("expect error for large frame")
+	}
+	byteBuffer.WriteBytes([]byte{0x80, 0x10})
+	if _, err := decoder.Decode(byteBuffer); err == nil {
+		t.Fatal("expect error for large frame")
+	}
+}
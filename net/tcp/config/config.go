@@ -23,6 +23,7 @@
 package config
 
 import (
+	"crypto/tls"
 	"net"
 	"time"
 )
@@ -38,6 +39,23 @@ type TCPConfig struct {
 type ServerConfig struct {
 	TCPConfig
 	AcceptorSize uint8
+	// ShutdownTimeout is the max duration waiting for channels to drain while server stopping.
+	// Channels still connected after it will be force closed. Zero means force close immediately.
+	ShutdownTimeout time.Duration
+	// TLS enable TLS for accepted connections if provided.
+	TLS *TLSConfig
+}
+
+// TLSConfig provide properties for TLS configuration
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	// ReloadInterval is the interval for checking modification of certificate and key files.
+	// The certificate will be reloaded without restarting server while files changed.
+	// Zero means never reload.
+	ReloadInterval time.Duration
+	// GetCertificate will be used instead of certificate files if provided.
+	GetCertificate func(hello *tls.ClientHelloInfo) (*tls.Certificate, error)
 }
 
 // ClientConfig provide properties for client configuration
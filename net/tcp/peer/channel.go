@@ -25,6 +25,7 @@ package peer
 import (
 	"errors"
 	"net"
+	"sync/atomic"
 
 	"github.com/mervinkid/matcha/misc"
 )
@@ -37,14 +38,19 @@ var (
 	ErrInvalidChannel = errors.New("invalid channel")
 )
 
+// lastChannelId is the id of latest created channel.
+var lastChannelId uint64
+
 type SendMessage interface {
 	Send(data interface{}) error
 	SendFuture(data interface{}, callback func(err error))
 }
 
+// Channel is the interface of network channel bind with pipeline. Id is unique within process.
 type Channel interface {
 	SendMessage
 	misc.Close
+	Id() uint64
 	Remote() net.Addr
 	IsConnected() bool
 	GetContext(key string) interface{}
@@ -52,16 +58,34 @@ type Channel interface {
 	DelContext(key string)
 }
 
+// GracefulClose is the interface that wraps CloseGracefully method of channel. CloseGracefully
+// close the channel after messages queued for sending have been written, and returns false if
+// the close can not be scheduled.
+type GracefulClose interface {
+	CloseGracefully() bool
+}
+
+// flushCloser is implemented by pipelines which are able to stop after outbound data flushed.
+type flushCloser interface {
+	closeAfterFlush() bool
+}
+
 // PipelineChannel is a implementation of Channel interface created and bind with pipeline.
 // It contact with pipeline by using a data chan.
 // +------------+          +------------+
 // |  Pipeline  | ← chan ← |  Channel   |
 // +------------+          +------------+
 type pipelineChannel struct {
+	id         uint64
 	pipeline   Pipeline
 	contextMap map[string]interface{}
 }
 
+// Id returns id of channel.
+func (c *pipelineChannel) Id() uint64 {
+	return c.id
+}
+
 // Remote returns remote address.
 func (c *pipelineChannel) Remote() net.Addr {
 	if c.pipeline != nil {
@@ -98,6 +122,15 @@ func (c *pipelineChannel) Close() {
 	}
 }
 
+// CloseGracefully close the network connection after messages queued for sending have been written.
+// Returns false if pipeline is not running or its outbound data queue is full.
+func (c *pipelineChannel) CloseGracefully() bool {
+	if closer, ok := c.pipeline.(flushCloser); ok {
+		return closer.closeAfterFlush()
+	}
+	return false
+}
+
 // IsConnected returns true if connection is valid.
 func (c *pipelineChannel) IsConnected() bool {
 	return c.pipeline != nil && c.pipeline.IsRunning()
@@ -128,6 +161,7 @@ func (c *pipelineChannel) DelContext(key string) {
 func NewChannel(pipeline Pipeline) Channel {
 
 	return &pipelineChannel{
+		id:         atomic.AddUint64(&lastChannelId, 1),
 		pipeline:   pipeline,
 		contextMap: make(map[string]interface{}),
 	}
@@ -33,6 +33,8 @@ import (
 type ChannelGroup interface {
 	Add(channel Channel)
 	Remove(channel Channel)
+	Range(f func(channel Channel) bool)
+	Size() int
 	CloseAll()
 }
 
@@ -56,6 +58,30 @@ func (cg *hashSafeChannelGroup) Remove(channel Channel) {
 	}
 }
 
+// Range calls f sequentially for each channel in channel group.
+// If f returns false, range stops the iteration.
+func (cg *hashSafeChannelGroup) Range(f func(channel Channel) bool) {
+	if f == nil {
+		return
+	}
+	cg.channelMap.Range(func(key, value interface{}) bool {
+		if channel, ok := key.(Channel); ok {
+			return f(channel)
+		}
+		return true
+	})
+}
+
+// Size returns the number of channels in channel group.
+func (cg *hashSafeChannelGroup) Size() int {
+	size := 0
+	cg.channelMap.Range(func(key, value interface{}) bool {
+		size++
+		return true
+	})
+	return size
+}
+
 // CloseAll will close all channel which management by channel group and remove
 // all channel from channel group.
 func (cg *hashSafeChannelGroup) CloseAll() {
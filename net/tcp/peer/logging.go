@@ -0,0 +1,143 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package peer
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"github.com/mervinkid/matcha/logging"
+)
+
+// LoggingHandler is a public implementation of ChannelHandler interface which log channel events
+// with Level before passing them to Handler, as debugging tool for wire protocols. Messages of []byte
+// are logged with hex dump. Writes through the channel given to Handler are logged too. Events are
+// only logged if Handler is nil, and LDebug is used if Level is not a valid level.
+//  +---------------------------------------+
+//  | LoggingHandler  (ACTIVE READ WRITE    |
+//  |                  INACTIVE EXCEPTION)  |
+//  |  +---------------------------------+  |
+//  |  |         ChannelHandler          |  |
+//  |  +---------------------------------+  |
+//  +---------------------------------------+
+type LoggingHandler struct {
+	Handler  ChannelHandler
+	Level    logging.Level
+	channels sync.Map
+}
+
+func (h *LoggingHandler) ChannelActivate(channel Channel) error {
+	wrapped := h.wrap(channel)
+	wrapped.log("ACTIVE")
+	if h.Handler != nil {
+		return h.Handler.ChannelActivate(wrapped)
+	}
+	return nil
+}
+
+func (h *LoggingHandler) ChannelInactivate(channel Channel) error {
+	wrapped := h.wrap(channel)
+	wrapped.log("INACTIVE")
+	h.channels.Delete(channel)
+	if h.Handler != nil {
+		return h.Handler.ChannelInactivate(wrapped)
+	}
+	return nil
+}
+
+func (h *LoggingHandler) ChannelRead(channel Channel, in interface{}) error {
+	wrapped := h.wrap(channel)
+	wrapped.log("READ: %s", messageDump{in})
+	if h.Handler != nil {
+		return h.Handler.ChannelRead(wrapped, in)
+	}
+	return nil
+}
+
+func (h *LoggingHandler) ChannelError(channel Channel, channelErr error) {
+	wrapped := h.wrap(channel)
+	wrapped.log("EXCEPTION: %v", channelErr)
+	if h.Handler != nil {
+		h.Handler.ChannelError(wrapped, channelErr)
+	}
+}
+
+// wrap returns logging channel of specified channel. The same logging channel will be returned for
+// a channel until it inactivated, so wrapped handler can use it as key.
+func (h *LoggingHandler) wrap(channel Channel) *loggingChannel {
+	if wrapped, ok := h.channels.Load(channel); ok {
+		return wrapped.(*loggingChannel)
+	}
+	wrapped, _ := h.channels.LoadOrStore(channel, &loggingChannel{
+		Channel: channel,
+		level:   h.Level,
+		logger:  logging.ForChannel(channel),
+	})
+	return wrapped.(*loggingChannel)
+}
+
+// loggingChannel is the Channel given to handler wrapped by LoggingHandler which log writes.
+type loggingChannel struct {
+	Channel
+	level  logging.Level
+	logger logging.Logger
+}
+
+func (c *loggingChannel) Send(data interface{}) error {
+	c.log("WRITE: %s", messageDump{data})
+	return c.Channel.Send(data)
+}
+
+func (c *loggingChannel) SendFuture(data interface{}, callback func(err error)) {
+	c.log("WRITE: %s", messageDump{data})
+	c.Channel.SendFuture(data, callback)
+}
+
+func (c *loggingChannel) log(format string, args ...interface{}) {
+	switch c.level {
+	case logging.LTrace:
+		c.logger.Trace(format, args...)
+	case logging.LInfo:
+		c.logger.Info(format, args...)
+	case logging.LWarn:
+		c.logger.Warn(format, args...)
+	case logging.LError:
+		c.logger.Error(format, args...)
+	default:
+		c.logger.Debug(format, args...)
+	}
+}
+
+// messageDump is the readable string of message, hex dump for []byte. It is formatted lazily only
+// if the record will be written.
+type messageDump struct {
+	msg interface{}
+}
+
+func (d messageDump) String() string {
+	if data, ok := d.msg.([]byte); ok {
+		return fmt.Sprintf("%dB\n%s", len(data), hex.Dump(data))
+	}
+	return fmt.Sprintf("%+v", d.msg)
+}
@@ -0,0 +1,154 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package peer
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mervinkid/matcha/logging"
+)
+
+type recordLogger struct {
+	lines []string
+	mutex sync.Mutex
+}
+
+func (l *recordLogger) record(level, format string, args ...interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.lines = append(l.lines, level+" "+fmt.Sprintf(format, args...))
+}
+
+func (l *recordLogger) records() []string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return append([]string(nil), l.lines...)
+}
+
+func (l *recordLogger) Trace(format string, args ...interface{}) { l.record("trace", format, args...) }
+func (l *recordLogger) Debug(format string, args ...interface{}) { l.record("debug", format, args...) }
+func (l *recordLogger) Info(format string, args ...interface{})  { l.record("info", format, args...) }
+func (l *recordLogger) Warn(format string, args ...interface{})  { l.record("warn", format, args...) }
+func (l *recordLogger) Error(format string, args ...interface{}) { l.record("error", format, args...) }
+
+// recordChannel is a Channel which records sent messages.
+type recordChannel struct {
+	sent []interface{}
+}
+
+func (c *recordChannel) Send(data interface{}) error {
+	c.sent = append(c.sent, data)
+	return nil
+}
+
+func (c *recordChannel) SendFuture(data interface{}, callback func(err error)) {
+	c.sent = append(c.sent, data)
+	callback(nil)
+}
+
+func (c *recordChannel) Close() {}
+
+func (c *recordChannel) Id() uint64 {
+	return 42
+}
+
+func (c *recordChannel) Remote() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9090}
+}
+
+func (c *recordChannel) IsConnected() bool {
+	return true
+}
+
+func (c *recordChannel) GetContext(key string) interface{} {
+	return nil
+}
+
+func (c *recordChannel) AddContext(key string, val interface{}) {}
+
+func (c *recordChannel) DelContext(key string) {}
+
+func TestLoggingHandler(t *testing.T) {
+	target := &recordLogger{}
+	logging.AddLogger("peer", target)
+	defer logging.RemoveLogger("peer")
+	logging.SetLogLevel(logging.LTrace)
+	defer logging.SetLogLevel(logging.LNone)
+
+	// Wrapped handler echoes read messages through the logging channel
+	var wrappedChannels []Channel
+	handler := &LoggingHandler{
+		Level: logging.LInfo,
+		Handler: &FunctionalChannelHandler{
+			HandleRead: func(channel Channel, in interface{}) error {
+				wrappedChannels = append(wrappedChannels, channel)
+				return channel.Send(in)
+			},
+		},
+	}
+	channel := &recordChannel{}
+	payload := []byte("Hello, matcha!\x00\x01\xff")
+	handler.ChannelActivate(channel)
+	handler.ChannelRead(channel, payload)
+	handler.ChannelRead(channel, "text")
+	handler.ChannelError(channel, errors.New("broken"))
+	handler.ChannelInactivate(channel)
+
+	prefix := "info [id: 0x0000002a, remote: 127.0.0.1:9090] "
+	dump := fmt.Sprintf("%dB\n%s", len(payload), hex.Dump(payload))
+	expected := []string{
+		prefix + "ACTIVE",
+		prefix + "READ: " + dump,
+		prefix + "WRITE: " + dump,
+		prefix + "READ: text",
+		prefix + "WRITE: text",
+		prefix + "EXCEPTION: broken",
+		prefix + "INACTIVE",
+	}
+	records := target.records()
+	if len(records) != len(expected) {
+		t.Fatal("unexpected records", records)
+	}
+	for i := range expected {
+		if records[i] != expected[i] {
+			t.Fatalf("expect record %q but got %q", expected[i], records[i])
+		}
+	}
+	if !strings.Contains(records[1], "00000000  48 65 6c 6c 6f 2c 20 6d  61 74 63 68 61 21 00 01  |Hello, matcha!..|") {
+		t.Fatal("expect hex dump of bytes but got", records[1])
+	}
+
+	// Writes pass through and the same logging channel is given for a channel
+	if len(channel.sent) != 2 || string(channel.sent[0].([]byte)) != string(payload) || channel.sent[1] != "text" {
+		t.Fatal("unexpected sent messages", channel.sent)
+	}
+	if len(wrappedChannels) != 2 || wrappedChannels[0] != wrappedChannels[1] || wrappedChannels[0] == Channel(channel) {
+		t.Fatal("expect the same logging channel given to handler")
+	}
+}
@@ -32,6 +32,7 @@ import (
 	"github.com/mervinkid/matcha/logging"
 	"net"
 	"sync"
+	"time"
 )
 
 // Chan buffer
@@ -48,6 +49,13 @@ const (
 	stateShutdown
 )
 
+// Timeout of waiting handler termination while stopping
+const handlerJoinTimeout = 5 * time.Second
+
+// closeMarker is queued into outbound data queue by closeAfterFlush. Outbound handler stops
+// pipeline while it reaches the marker.
+type closeMarker struct{}
+
 // Buffer size
 const (
 	readBufferSize = 1024
@@ -132,8 +140,9 @@ type duplexPipeline struct {
 	handler ChannelHandler
 
 	// Props
-	conn    net.Conn // Setup while construct.
-	channel Channel  // Setup after init.
+	conn    net.Conn       // Setup while construct.
+	channel Channel        // Setup after init.
+	logger  logging.Logger // Setup after init.
 
 	// State
 	state          uint8
@@ -154,7 +163,8 @@ type duplexPipeline struct {
 	outboundHandler parallel.Goroutine
 }
 
-// InitPipeline create and init pipeline with initializer.
+// InitPipeline create and init pipeline with initializer. If the initializer is also
+// a ConnSniffer, the actual initializer will be selected by sniffing the connection.
 func InitPipeline(conn net.Conn, initializer PipelineInitializer) (Pipeline, error) {
 
 	// Check arguments
@@ -165,6 +175,21 @@ func InitPipeline(conn net.Conn, initializer PipelineInitializer) (Pipeline, err
 		return nil, NilInitializerError
 	}
 
+	// Select initializer by inspecting initial inbound bytes if sniffer provided. Selected
+	// initializer may sniff the connection again such as TLSInitializer.
+	for {
+		sniffer, ok := initializer.(ConnSniffer)
+		if !ok {
+			break
+		}
+		sniffedConn, sniffedInitializer, err := sniffer.Sniff(conn)
+		if err != nil {
+			return nil, err
+		}
+		conn = sniffedConn
+		initializer = sniffedInitializer
+	}
+
 	// Init encoder, decoder and handler
 	decoder := initializer.InitDecoder()
 	logging.Trace("Init decoder for %s.\n", conn.RemoteAddr())
@@ -227,15 +252,15 @@ func (cp *duplexPipeline) Start() error {
 
 func (cp *duplexPipeline) startConnReadHandler() {
 
-	coroutine := parallel.NewGoroutine(cp.handleConnRead)
+	coroutine := parallel.NewNamedGoroutine("ConnReadHandler-"+cp.Remote().String(), cp.handleConnRead)
 	coroutine.Start()
 	cp.connReadHandler = coroutine
 }
 
 func (cp *duplexPipeline) handleConnRead() {
 
-	logging.Trace("ConnReadHandler for remote %s start.\n", cp.conn.RemoteAddr().String())
-	defer logging.Trace("ConnReadHandler for remote %s stop.\n", cp.conn.RemoteAddr().String())
+	cp.logger.Trace("ConnReadHandler start.")
+	defer cp.logger.Trace("ConnReadHandler stop.")
 
 	// Channel activate
 	if err := cp.handler.ChannelActivate(cp.channel); err != nil {
@@ -258,7 +283,7 @@ func (cp *duplexPipeline) handleConnRead() {
 			return
 		}
 
-		logging.Trace("ConnReadHandler read %d bytes from remote %s.\n", count, cp.conn.RemoteAddr().String())
+		cp.logger.Trace("ConnReadHandler read %d bytes.", count)
 
 		byteBuffer.WriteBytes(readBuffer[:count])
 		for {
@@ -278,17 +303,17 @@ func (cp *duplexPipeline) handleConnRead() {
 
 func (cp *duplexPipeline) startInboundHandler() {
 
-	coroutine := parallel.NewGoroutine(cp.handleInbound)
+	coroutine := parallel.NewNamedGoroutine("InboundHandler-"+cp.Remote().String(), cp.handleInbound)
 	coroutine.Start()
 	cp.inboundHandler = coroutine
 }
 
 func (cp *duplexPipeline) handleInbound() {
 
-	logging.Trace("InboundHandler for remote %s start.\n", cp.conn.RemoteAddr().String())
+	cp.logger.Trace("InboundHandler start.")
 
 	defer func() {
-		logging.Trace("InboundHandler for remote %s stop.\n", cp.conn.RemoteAddr().String())
+		cp.logger.Trace("InboundHandler stop.")
 	}()
 
 	for {
@@ -306,7 +331,7 @@ func (cp *duplexPipeline) handleInbound() {
 
 func (cp *duplexPipeline) startOutboundHandler() {
 
-	coroutine := parallel.NewGoroutine(cp.handleOutbound)
+	coroutine := parallel.NewNamedGoroutine("OutboundHandler-"+cp.Remote().String(), cp.handleOutbound)
 	coroutine.Start()
 	cp.outboundHandler = coroutine
 
@@ -314,10 +339,10 @@ func (cp *duplexPipeline) startOutboundHandler() {
 
 func (cp *duplexPipeline) handleOutbound() {
 
-	logging.Trace("OutboundHandler for remote %s start.", cp.conn.RemoteAddr().String())
+	cp.logger.Trace("OutboundHandler start.")
 
 	defer func() {
-		logging.Trace("OutboundHandler for remote %s stop.", cp.conn.RemoteAddr().String())
+		cp.logger.Trace("OutboundHandler stop.")
 	}()
 
 	for {
@@ -325,6 +350,12 @@ func (cp *duplexPipeline) handleOutbound() {
 		case outboundData := <-cp.outboundDataC:
 			data := outboundData.Data
 			callback := outboundData.Callback
+			if _, ok := data.(closeMarker); ok {
+				// Queued messages have been written. Stop out of handler which is joined by Stop.
+				cp.logger.Trace("OutboundHandler flushed, stop pipeline.")
+				parallel.NewGoroutine(cp.Stop).Start()
+				continue
+			}
 			// Encode
 			encodeResult, encodeErr := cp.encoder.Encode(data)
 			if encodeErr != nil {
@@ -341,8 +372,7 @@ func (cp *duplexPipeline) handleOutbound() {
 				// Invoke callback
 				callback(writeErr)
 				if writeErr == nil {
-					logging.Trace("OutboundHandler write %d bytes to remote %s.",
-						writeCount, cp.conn.RemoteAddr().String())
+					cp.logger.Trace("OutboundHandler write %d bytes.", writeCount)
 				}
 				continue
 			}
@@ -384,6 +414,7 @@ func (cp *duplexPipeline) Init() error {
 
 		// Init network channel and make it bind with current pipeline.
 		cp.channel = NewChannel(cp)
+		cp.logger = logging.ForChannel(cp.channel)
 
 		cp.state = stateReady
 	}
@@ -405,17 +436,21 @@ func (cp *duplexPipeline) Stop() {
 	// Send  stop cmd to handlers
 	close(cp.inboundHandlerStopC)
 	close(cp.outboundHandlerStopC)
-	// Await termination
-	cp.inboundHandler.Join()
-	cp.outboundHandler.Join()
+	// Await termination. Connection will be closed forcibly after timeout
+	// in order to release handlers which blocked on network I/O.
+	terminated := cp.joinHandler(cp.inboundHandler)
+	terminated = cp.joinHandler(cp.outboundHandler) && terminated
 
 	// Close reader and connection
 	cp.conn.Close()
-	cp.connReadHandler.Join()
+	terminated = cp.joinHandler(cp.connReadHandler) && terminated
 
-	// Close data channels
-	close(cp.inboundDataC)
-	close(cp.outboundDataC)
+	// Close data channels only if all handlers terminated, wedged handler
+	// may still write into them.
+	if terminated {
+		close(cp.inboundDataC)
+		close(cp.outboundDataC)
+	}
 
 	// Change state
 	cp.state = stateShutdown
@@ -476,6 +511,35 @@ func (cp *duplexPipeline) SendFuture(msg interface{}, callback func(err error))
 	}
 }
 
+// closeAfterFlush queue a close marker, and pipeline will be stopped after messages queued before
+// the marker have been written. Returns false if pipeline is not running or outbound data queue
+// is full.
+func (cp *duplexPipeline) closeAfterFlush() bool {
+
+	cp.stateMutex.RLock()
+	defer cp.stateMutex.RUnlock()
+
+	if cp.state != stateRunning {
+		return false
+	}
+	select {
+	case cp.outboundDataC <- OutboundEntity{Data: closeMarker{}}:
+		return true
+	default:
+		return false
+	}
+}
+
+// joinHandler wait for handler termination with timeout. Returns false if
+// handler is still running.
+func (cp *duplexPipeline) joinHandler(handler parallel.Goroutine) bool {
+	if handler.JoinTimeout(handlerJoinTimeout) {
+		return true
+	}
+	cp.logger.Warn("Pipeline handler %s not terminated in %s.", handler.GetName(), handlerJoinTimeout.String())
+	return false
+}
+
 // Sync block invoker goroutine until pipeline stop.
 func (cp *duplexPipeline) Sync() {
 	cp.stateWaitGroup.Wait()
@@ -0,0 +1,313 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package peer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mervinkid/matcha/logging"
+	"github.com/mervinkid/matcha/net/tcp/codec"
+)
+
+// Sniffer defaults
+const (
+	defaultSniffLimit   = 64
+	defaultSniffTimeout = 5 * time.Second
+)
+
+var (
+	ErrUnknownProtocol = errors.New("unknown protocol")
+)
+
+// SniffResult is the result of a ProtocolMatcher inspecting the first inbound bytes.
+type SniffResult uint8
+
+const (
+	SniffMismatch SniffResult = iota
+	SniffMatch
+	SniffNeedMore
+)
+
+// ProtocolMatcher inspects the initial inbound bytes of a connection and reports
+// whether they belong to the protocol. Returns SniffNeedMore if the bytes read so
+// far are not enough to decide.
+type ProtocolMatcher func(head []byte) SniffResult
+
+// SniffRule bind a ProtocolMatcher with the PipelineInitializer which will be used
+// for connections matched by it.
+type SniffRule struct {
+	Name        string
+	Matcher     ProtocolMatcher
+	Initializer PipelineInitializer
+}
+
+// ConnSniffer is the interface that wraps the method for selecting a PipelineInitializer
+// by inspecting the connection. The returned connection must be used instead of the
+// origin one since some bytes may have been consumed from it.
+type ConnSniffer interface {
+	Sniff(conn net.Conn) (net.Conn, PipelineInitializer, error)
+}
+
+// ProtocolSniffer is a implementation of PipelineInitializer and ConnSniffer interface
+// provide port unification support. It inspects the first inbound bytes of each
+// connection and selects the initializer of the first matched rule. Rules are
+// checked by registration order.
+//
+// Model:
+//                               +--------------------+
+//                          ┌──→ | TLV Initializer    |
+//  +------+   +---------+  |    +--------------------+
+//  | Conn | → | Sniffer | ─┼──→ | HTTP Initializer   |
+//  +------+   +---------+  |    +--------------------+
+//                          └──→ | Fallback           |
+//                               +--------------------+
+//
+// Notes:
+// Sniffed bytes will be replayed to the selected pipeline so the decoder receives
+// the complete stream. If no rule matched and Fallback is nil the connection will
+// be refused with ErrUnknownProtocol.
+type ProtocolSniffer struct {
+	// Fallback is the initializer for connections which matched none of rules.
+	Fallback PipelineInitializer
+	// Limit is the max number of bytes to inspect. Default is 64.
+	Limit int
+	// Timeout is the max duration waiting for the initial bytes. Default is 5 seconds.
+	Timeout time.Duration
+
+	rules      []SniffRule
+	rulesMutex sync.RWMutex
+}
+
+// AddRule register a new rule to sniffer.
+func (s *ProtocolSniffer) AddRule(name string, matcher ProtocolMatcher, initializer PipelineInitializer) {
+	if matcher == nil || initializer == nil {
+		return
+	}
+	s.rulesMutex.Lock()
+	defer s.rulesMutex.Unlock()
+	s.rules = append(s.rules, SniffRule{Name: name, Matcher: matcher, Initializer: initializer})
+}
+
+// Sniff read initial bytes from specified connection and select initializer with rules.
+func (s *ProtocolSniffer) Sniff(conn net.Conn) (net.Conn, PipelineInitializer, error) {
+
+	if conn == nil {
+		return nil, nil, NilConnError
+	}
+
+	limit := s.Limit
+	if limit <= 0 {
+		limit = defaultSniffLimit
+	}
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = defaultSniffTimeout
+	}
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	head := make([]byte, 0, limit)
+	readBuffer := make([]byte, limit)
+	for {
+		count, err := conn.Read(readBuffer[:limit-len(head)])
+		head = append(head, readBuffer[:count]...)
+
+		final := len(head) >= limit || err != nil
+		rule, pending := s.match(head, final)
+		if rule != nil {
+			logging.Trace("ProtocolSniffer select %s for remote %s.", rule.Name, conn.RemoteAddr().String())
+			return newSniffedConn(conn, head), rule.Initializer, nil
+		}
+		if !pending || final {
+			break
+		}
+	}
+
+	if s.Fallback != nil {
+		logging.Trace("ProtocolSniffer select fallback for remote %s.", conn.RemoteAddr().String())
+		return newSniffedConn(conn, head), s.Fallback, nil
+	}
+	return nil, nil, ErrUnknownProtocol
+}
+
+// match returns the first matched rule. The pending result will be true if there is
+// any rule need more bytes to decide. Undecided rules will be skipped if final is true.
+func (s *ProtocolSniffer) match(head []byte, final bool) (rule *SniffRule, pending bool) {
+	s.rulesMutex.RLock()
+	defer s.rulesMutex.RUnlock()
+	for i := range s.rules {
+		switch s.rules[i].Matcher(head) {
+		case SniffMatch:
+			if !pending || final {
+				return &s.rules[i], false
+			}
+			// A prior rule is still undecided, keep registration order.
+			return nil, true
+		case SniffNeedMore:
+			pending = true
+		}
+	}
+	return nil, pending
+}
+
+func (s *ProtocolSniffer) InitDecoder() codec.FrameDecoder {
+	if s.Fallback != nil {
+		return s.Fallback.InitDecoder()
+	}
+	return nil
+}
+
+func (s *ProtocolSniffer) InitEncoder() codec.FrameEncoder {
+	if s.Fallback != nil {
+		return s.Fallback.InitEncoder()
+	}
+	return nil
+}
+
+func (s *ProtocolSniffer) InitHandler() ChannelHandler {
+	if s.Fallback != nil {
+		return s.Fallback.InitHandler()
+	}
+	return nil
+}
+
+// NewProtocolSniffer create a new ProtocolSniffer instance with fallback initializer.
+func NewProtocolSniffer(fallback PipelineInitializer) *ProtocolSniffer {
+	return &ProtocolSniffer{Fallback: fallback}
+}
+
+// MatchPrefix returns a ProtocolMatcher which match connections start with specified prefix
+// such as "GET ".
+func MatchPrefix(prefix []byte) ProtocolMatcher {
+	return func(head []byte) SniffResult {
+		if len(head) < len(prefix) {
+			if bytes.HasPrefix(prefix, head) {
+				return SniffNeedMore
+			}
+			return SniffMismatch
+		}
+		if bytes.HasPrefix(head, prefix) {
+			return SniffMatch
+		}
+		return SniffMismatch
+	}
+}
+
+// MatchTLVTag returns a ProtocolMatcher which match frames of TLV format with specified tag.
+func MatchTLVTag(tag uint8) ProtocolMatcher {
+	return MatchPrefix([]byte{tag})
+}
+
+// MatchTLSClientHello returns a ProtocolMatcher which match the TLS handshake record of ClientHello.
+// Sniffed connections are not served with TLS, so the rule should be registered with TLSInitializer
+// which terminates TLS. Server with TLS config has terminated TLS before sniffing and never sees it.
+//  +------------------+-----------------+-----------+-----------------+
+//  | ContentType 0x16 | Version 0x03 XX |  Length   | HandshakeType 1 |
+//  |     (1 byte)     |    (2 bytes)    | (2 bytes) |    (1 byte)     |
+//  +------------------+-----------------+-----------+-----------------+
+func MatchTLSClientHello() ProtocolMatcher {
+	return func(head []byte) SniffResult {
+		if len(head) > 0 && head[0] != 0x16 {
+			return SniffMismatch
+		}
+		if len(head) > 1 && head[1] != 0x03 {
+			return SniffMismatch
+		}
+		if len(head) < 6 {
+			return SniffNeedMore
+		}
+		if head[5] == 0x01 {
+			return SniffMatch
+		}
+		return SniffMismatch
+	}
+}
+
+// sniffedConn is a wrapper of net.Conn which replays the sniffed bytes before reading
+// from the origin connection.
+type sniffedConn struct {
+	net.Conn
+	head []byte
+}
+
+func (c *sniffedConn) Read(p []byte) (int, error) {
+	if len(c.head) > 0 {
+		count := copy(p, c.head)
+		c.head = c.head[count:]
+		return count, nil
+	}
+	return c.Conn.Read(p)
+}
+
+func newSniffedConn(conn net.Conn, head []byte) net.Conn {
+	if len(head) == 0 {
+		return conn
+	}
+	return &sniffedConn{Conn: conn, head: head}
+}
+
+// TLSInitializer is a implementation of PipelineInitializer and ConnSniffer interface which serves
+// the connection with TLS of Config and initializes pipeline with Initializer over it. Initializer
+// can be a ConnSniffer such as ProtocolSniffer to select protocol inside TLS.
+//
+// Usage:
+//  sniffer.AddRule("tls", MatchTLSClientHello(), NewTLSInitializer(tlsConfig, initializer))
+type TLSInitializer struct {
+	Config      *tls.Config
+	Initializer PipelineInitializer
+}
+
+// Sniff wrap specified connection with TLS and select initializer of it.
+func (i *TLSInitializer) Sniff(conn net.Conn) (net.Conn, PipelineInitializer, error) {
+	if conn == nil {
+		return nil, nil, NilConnError
+	}
+	if i.Config == nil || i.Initializer == nil {
+		return nil, nil, NilInitializerError
+	}
+	return tls.Server(conn, i.Config), i.Initializer, nil
+}
+
+func (i *TLSInitializer) InitDecoder() codec.FrameDecoder {
+	return i.Initializer.InitDecoder()
+}
+
+func (i *TLSInitializer) InitEncoder() codec.FrameEncoder {
+	return i.Initializer.InitEncoder()
+}
+
+func (i *TLSInitializer) InitHandler() ChannelHandler {
+	return i.Initializer.InitHandler()
+}
+
+// NewTLSInitializer create a new TLSInitializer instance which initialize pipeline with specified
+// initializer over TLS.
+func NewTLSInitializer(config *tls.Config, initializer PipelineInitializer) *TLSInitializer {
+	return &TLSInitializer{Config: config, Initializer: initializer}
+}
@@ -0,0 +1,77 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package peer
+
+import (
+	"io/ioutil"
+	"net"
+	"testing"
+)
+
+func TestProtocolSniffer_Sniff(t *testing.T) {
+
+	tlvInitializer := &FunctionalPipelineInitializer{}
+	httpInitializer := &FunctionalPipelineInitializer{}
+
+	sniffer := NewProtocolSniffer(nil)
+	sniffer.AddRule("tlv", MatchTLVTag(170), tlvInitializer)
+	sniffer.AddRule("http", MatchPrefix([]byte("GET ")), httpInitializer)
+
+	samples := []struct {
+		payload     []byte
+		initializer PipelineInitializer
+	}{
+		{[]byte{170, 0, 0, 0, 1, 1}, tlvInitializer},
+		{[]byte("GET / HTTP/1.1\r\n\r\n"), httpInitializer},
+		{[]byte("PUT / HTTP/1.1\r\n\r\n"), nil},
+	}
+
+	for _, sample := range samples {
+		server, client := net.Pipe()
+		go func(payload []byte) {
+			client.Write(payload)
+			client.Close()
+		}(sample.payload)
+
+		conn, initializer, err := sniffer.Sniff(server)
+		if sample.initializer == nil {
+			if err != ErrUnknownProtocol {
+				t.Fatal("expect unknown protocol but got", err)
+			}
+			server.Close()
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if initializer != sample.initializer {
+			t.Fatal("wrong initializer selected for", string(sample.payload))
+		}
+		// Sniffed bytes must be replayed.
+		replayed, _ := ioutil.ReadAll(conn)
+		if string(replayed) != string(sample.payload) {
+			t.Fatal("expect", sample.payload, "but got", replayed)
+		}
+		conn.Close()
+	}
+}
@@ -23,8 +23,10 @@
 package tcp
 
 import (
+	"crypto/tls"
 	"net"
 	"sync"
+	"time"
 
 	"github.com/mervinkid/matcha/logging"
 	"github.com/mervinkid/matcha/misc"
@@ -34,12 +36,26 @@ import (
 	"github.com/mervinkid/matcha/parallel"
 )
 
+// Timeout of waiting force closed channels while shutdown
+const forceCloseTimeout = 3 * time.Second
+
 // Server is the interface that wraps the basic method to implement a tcp network server based on FSM.
 type Server interface {
 	misc.Lifecycle
 	misc.Sync
 }
 
+// GracefulServer is the interface of Server which supports graceful shutdown. Server created by
+// NewPipelineServer implements it.
+// Methods:
+//  Shutdown stop server gracefully. It stops accepting new connection and closes channels once
+//  their outbound queues are flushed. Channels still connected after timeout are force closed,
+//  and their remote addresses are returned.
+type GracefulServer interface {
+	Server
+	Shutdown(timeout time.Duration) (cutoff []net.Addr)
+}
+
 // PipelineServer is the default implementation of Server interface which using ParallelAcceptor for
 // connection parallel acceptance and using DuplexPipeline for ease connection handling.
 type pipelineServer struct {
@@ -49,12 +65,20 @@ type pipelineServer struct {
 	Initializer peer.PipelineInitializer
 
 	// State control
-	running    bool
-	acceptor   bind.Acceptor
-	stateMutex sync.RWMutex
-	waitGroup  sync.WaitGroup
+	running      bool
+	shuttingDown bool
+	acceptor     bind.Acceptor
+	stateMutex   sync.RWMutex
+	waitGroup    sync.WaitGroup
 	// Channel group
 	channelGroup peer.ChannelGroup
+	// Accepted connections whose pipeline is initializing, which are not in channel group yet.
+	pendingConns map[net.Conn]struct{}
+	closing      bool
+	drainedC     chan uint8 // Closed once drained while shutting down.
+	pendingMutex sync.Mutex
+	// TLS
+	tlsCertificate misc.Lifecycle
 }
 
 // Start will start server with specified address configuration.
@@ -69,11 +93,25 @@ func (s *pipelineServer) Start() error {
 		return nil
 	}
 
+	// Init TLS
+	var tlsConfig *tls.Config
+	if s.Config.TLS != nil {
+		var tlsCertificate misc.Lifecycle
+		tlsConfig, tlsCertificate = initTLS(s.Config.TLS)
+		if tlsCertificate != nil {
+			if err := tlsCertificate.Start(); err != nil {
+				return err
+			}
+		}
+		s.tlsCertificate = tlsCertificate
+	}
+
 	addr := new(net.TCPAddr)
 	addr.IP = s.Config.IP
 	addr.Port = s.Config.Port
 	listener, err := net.ListenTCP("tcp", addr)
 	if err != nil {
+		misc.LifecycleStop(s.tlsCertificate)
 		return err
 	}
 	s.waitGroup.Add(1)
@@ -81,12 +119,20 @@ func (s *pipelineServer) Start() error {
 	// Init channel group for channel management.
 	channelGroup := peer.NewHashSafeChannelGroup()
 	s.channelGroup = channelGroup
-
-	// Init and start acceptor
+	s.pendingMutex.Lock()
+	s.pendingConns = make(map[net.Conn]struct{})
+	s.closing = false
+	s.drainedC = nil
+	s.pendingMutex.Unlock()
+
+	// Init and start acceptor. TLS config is captured by accept callback so that connections are
+	// never served in plaintext on TLS port.
 	acceptorProp := bind.AcceptorProp{}
 	acceptorProp.Parallelism = s.Config.AcceptorSize
 	acceptorProp.Listener = listener
-	acceptorProp.AcceptCallback = s.handleAccept
+	acceptorProp.AcceptCallback = func(conn net.Conn) {
+		s.handleAccept(conn, tlsConfig, channelGroup)
+	}
 	acceptor := bind.NewParallelAcceptor(acceptorProp)
 
 	s.acceptor = acceptor
@@ -97,31 +143,184 @@ func (s *pipelineServer) Start() error {
 	return nil
 }
 
-// Stop will stop current server and release network resource.
+// Stop will stop current server and release network resource. The channels will be
+// drained within ShutdownTimeout of configuration.
 func (s *pipelineServer) Stop() {
+	s.Shutdown(s.Config.ShutdownTimeout)
+}
+
+// Shutdown will stop accepting new connection, close channels once their outbound queues are
+// flushed and wait for channels to drain until timeout. The channels still connected after timeout
+// and the connections whose pipeline is still initializing will be force closed, and the remote
+// addresses of channels will be returned.
+// State lock is released while draining, and Shutdown invoked while draining returns nil at once.
+func (s *pipelineServer) Shutdown(timeout time.Duration) []net.Addr {
 
 	// Mutex state
 	s.stateMutex.Lock()
-	defer s.stateMutex.Unlock()
-
-	if !s.running {
+	if !s.running || s.shuttingDown {
 		// Only work on running.
-		return
+		s.stateMutex.Unlock()
+		return nil
 	}
+	s.shuttingDown = true
 
 	// Close acceptor
 	if misc.LifecycleCheckRun(s.acceptor) {
 		misc.LifecycleStop(s.acceptor)
 	}
+	channelGroup := s.channelGroup
+	s.stateMutex.Unlock()
+
+	// Drain channels
+	drainedC := s.startDrain(channelGroup)
+	channelGroup.Range(func(channel peer.Channel) bool {
+		s.closeGracefully(channel)
+		return true
+	})
+	drainTimer := time.NewTimer(timeout)
+	select {
+	case <-drainedC:
+	case <-drainTimer.C:
+	}
+	drainTimer.Stop()
+
+	// Force close initializing connections and remaining channels
+	s.closePendingConns()
+	cutoff := s.forceCloseChannels(channelGroup)
 
-	// Close channels
-	s.channelGroup.CloseAll()
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+
+	// Stop certificate reloading
+	if misc.LifecycleCheckRun(s.tlsCertificate) {
+		misc.LifecycleStop(s.tlsCertificate)
+	}
 
 	// Update state
 	s.acceptor = nil
+	s.tlsCertificate = nil
 	s.running = false
+	s.shuttingDown = false
 	s.waitGroup.Done()
 
+	return cutoff
+}
+
+// trackConn add accepted connection to pending set until its channel is added to channel group.
+// Returns false if server is closing.
+func (s *pipelineServer) trackConn(conn net.Conn) bool {
+	s.pendingMutex.Lock()
+	defer s.pendingMutex.Unlock()
+	if s.closing {
+		return false
+	}
+	s.pendingConns[conn] = struct{}{}
+	return true
+}
+
+// untrackConn remove connection from pending set and add channel to channel group if channel is
+// not nil. Returns false if server is closing, then the channel should be closed by invoker.
+// The channel added while draining should be closed gracefully by invoker.
+func (s *pipelineServer) untrackConn(conn net.Conn, channelGroup peer.ChannelGroup, channel peer.Channel) (ok, draining bool) {
+	s.pendingMutex.Lock()
+	defer s.pendingMutex.Unlock()
+	delete(s.pendingConns, conn)
+	if s.closing {
+		return false, false
+	}
+	if channel != nil {
+		channelGroup.Add(channel)
+	}
+	s.checkDrained(channelGroup)
+	return true, s.drainedC != nil
+}
+
+// removeChannel remove channel from channel group after its pipeline stopped.
+func (s *pipelineServer) removeChannel(channelGroup peer.ChannelGroup, channel peer.Channel) {
+	s.pendingMutex.Lock()
+	defer s.pendingMutex.Unlock()
+	channelGroup.Remove(channel)
+	s.checkDrained(channelGroup)
+}
+
+// startDrain returns a channel which will be closed once there is neither channel nor initializing
+// connection.
+func (s *pipelineServer) startDrain(channelGroup peer.ChannelGroup) <-chan uint8 {
+	s.pendingMutex.Lock()
+	defer s.pendingMutex.Unlock()
+	drainedC := make(chan uint8)
+	s.drainedC = drainedC
+	s.checkDrained(channelGroup)
+	return drainedC
+}
+
+// checkDrained close drained channel while draining and there is neither channel nor initializing
+// connection. It should be invoked with pending mutex held.
+func (s *pipelineServer) checkDrained(channelGroup peer.ChannelGroup) {
+	if s.drainedC == nil || len(s.pendingConns) > 0 || channelGroup.Size() > 0 {
+		return
+	}
+	select {
+	case <-s.drainedC:
+	default:
+		close(s.drainedC)
+	}
+}
+
+// closeGracefully close channel once its outbound queue is flushed. Channel which is not able to
+// close gracefully will be force closed after drain timeout.
+func (s *pipelineServer) closeGracefully(channel peer.Channel) {
+	if graceful, ok := channel.(peer.GracefulClose); !ok || !graceful.CloseGracefully() {
+		logging.Trace("Channel of remote %s is not closed gracefully.\n", channel.Remote().String())
+	}
+}
+
+// closePendingConns refuse channels of connections accepted from now on and close connections
+// whose pipeline is initializing.
+func (s *pipelineServer) closePendingConns() {
+	s.pendingMutex.Lock()
+	defer s.pendingMutex.Unlock()
+	s.closing = true
+	s.drainedC = nil
+	for conn := range s.pendingConns {
+		logging.Warn("Force close initializing connection of remote %s.", conn.RemoteAddr().String())
+		conn.Close()
+	}
+	s.pendingConns = make(map[net.Conn]struct{})
+}
+
+// forceCloseChannels close all channels in channel group parallel and wait at most
+// forceCloseTimeout for them. Returns remote addresses of closed channels.
+func (s *pipelineServer) forceCloseChannels(channelGroup peer.ChannelGroup) []net.Addr {
+
+	var cutoff []net.Addr
+	closeWaitGroup := sync.WaitGroup{}
+	channelGroup.Range(func(channel peer.Channel) bool {
+		remote := channel.Remote()
+		cutoff = append(cutoff, remote)
+		logging.Warn("Force close channel of remote %s.", remote.String())
+		closeWaitGroup.Add(1)
+		parallel.NewGoroutine(func() {
+			defer closeWaitGroup.Done()
+			misc.TryClose(channel)
+		}).Start()
+		channelGroup.Remove(channel)
+		return true
+	})
+
+	closeDoneC := make(chan uint8)
+	parallel.NewGoroutine(func() {
+		closeWaitGroup.Wait()
+		close(closeDoneC)
+	}).Start()
+	select {
+	case <-closeDoneC:
+	case <-time.After(forceCloseTimeout):
+		logging.Warn("Force close channels not finished in %s.", forceCloseTimeout.String())
+	}
+
+	return cutoff
 }
 
 // Sync will block current goroutine until server stop.
@@ -136,37 +335,59 @@ func (s *pipelineServer) IsRunning() bool {
 	return s.running
 }
 
-// startConnAcceptor accept new connection with new goroutine.
-func (s *pipelineServer) handleAccept(conn net.Conn) {
+// handleAccept handle new connection with new goroutine, which is served with TLS if tlsConfig is not
+// nil and added to specified channel group.
+func (s *pipelineServer) handleAccept(conn net.Conn, tlsConfig *tls.Config, channelGroup peer.ChannelGroup) {
 
 	parallel.NewGoroutine(func() {
+		// Track connection until its channel is added to channel group.
+		rawConn := conn
+		if !s.trackConn(rawConn) {
+			s.closeConn(rawConn)
+			return
+		}
+
 		// Setup connection.
 		config.TryApplyTCPConfig(&s.Config.TCPConfig, conn.(*net.TCPConn))
+		if tlsConfig != nil {
+			conn = tls.Server(conn, tlsConfig)
+		}
 
 		logging.Trace("Accept connection from %s.\n", conn.RemoteAddr().String())
 
 		// Init and start pipeline.
 		if s.Initializer == nil {
 			logging.Trace("Close connection between %s cause initializer is nil.\n", conn.RemoteAddr().String())
+			s.untrackConn(rawConn, channelGroup, nil)
 			s.closeConn(conn)
 			return
 		}
 		pipeline, err := peer.InitPipeline(conn, s.Initializer)
 		if err != nil {
 			logging.Trace("Pipeline init failure cause %s\n.", err.Error())
+			s.untrackConn(rawConn, channelGroup, nil)
 			s.closeConn(conn)
 			return
 		}
 		if err := misc.LifecycleStart(pipeline); err != nil {
 			logging.Trace("Pipeline for remote %s start failure cause %s.\n", conn.RemoteAddr().String(), err.Error())
+			s.untrackConn(rawConn, channelGroup, nil)
 			s.closeConn(conn)
 			return
 		}
-		s.channelGroup.Add(pipeline.GetChannel())
+		ok, draining := s.untrackConn(rawConn, channelGroup, pipeline.GetChannel())
+		if !ok {
+			logging.Trace("Close channel of remote %s cause server is shutting down.\n", conn.RemoteAddr().String())
+			misc.TryClose(pipeline.GetChannel())
+			return
+		}
+		if draining {
+			s.closeGracefully(pipeline.GetChannel())
+		}
 
 		// Monitoring pipeline lifecycle.
 		pipeline.Sync()
-		s.channelGroup.Remove(pipeline.GetChannel())
+		s.removeChannel(channelGroup, pipeline.GetChannel())
 
 	}).Start()
 }
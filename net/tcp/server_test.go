@@ -23,9 +23,16 @@
 package tcp_test
 
 import (
+	"bytes"
 	"github.com/mervinkid/matcha/net/tcp"
+	"github.com/mervinkid/matcha/net/tcp/codec"
 	"github.com/mervinkid/matcha/net/tcp/config"
+	"github.com/mervinkid/matcha/net/tcp/peer"
+	"io"
+	"math/big"
+	"net"
 	"testing"
+	"time"
 )
 
 func TestServer(t *testing.T) {
@@ -37,3 +44,190 @@ func TestServer(t *testing.T) {
 	server.Start()
 	server.Sync()
 }
+
+func TestServer_Shutdown(t *testing.T) {
+
+	// Connections without TLV tag wait for sniffing. Echo of tag 170 is encoded slowly, and echo
+	// of tag 171 is blocked until released.
+	release := make(chan uint8)
+	sniffer := peer.NewProtocolSniffer(nil)
+	sniffer.AddRule("slow", peer.MatchTLVTag(170), initDelayEchoInitializer(170, func() {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	sniffer.AddRule("stuck", peer.MatchTLVTag(171), initDelayEchoInitializer(171, func() {
+		<-release
+	}))
+
+	serverConfig := config.ServerConfig{}
+	serverConfig.AcceptorSize = 1
+	serverConfig.IP = net.ParseIP("127.0.0.1")
+	serverConfig.Port = freePort(t)
+	server := tcp.NewPipelineServer(serverConfig, sniffer).(tcp.GracefulServer)
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	address := net.JoinHostPort("127.0.0.1", itoa(serverConfig.Port))
+
+	// Connection in sniffing.
+	pendingConn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pendingConn.Close()
+	// Connection whose echo is being encoded while shutdown.
+	slowConn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slowConn.Close()
+	slowFrame := writeFrame(t, slowConn, 170)
+	// Connection whose echo is never flushed.
+	stuckConn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stuckConn.Close()
+	writeFrame(t, stuckConn, 171)
+	time.Sleep(100 * time.Millisecond)
+
+	cutoffC := make(chan []net.Addr, 1)
+	start := time.Now()
+	go func() {
+		cutoffC <- server.Shutdown(500 * time.Millisecond)
+	}()
+
+	// State is not locked while draining.
+	time.Sleep(50 * time.Millisecond)
+	runningC := make(chan bool, 1)
+	go func() {
+		runningC <- server.IsRunning()
+	}()
+	select {
+	case <-runningC:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("expect IsRunning not blocked while draining")
+	}
+
+	// Slow channel is closed after its echo flushed.
+	slowConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	echoed := make([]byte, len(slowFrame))
+	if _, err := io.ReadFull(slowConn, echoed); err != nil || !bytes.Equal(echoed, slowFrame) {
+		t.Fatal("expect echo flushed before close but got", echoed, err)
+	}
+	if _, err := slowConn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatal("expect slow channel closed after flushed but got", err)
+	}
+
+	// Stuck channel is cut off after timeout.
+	time.AfterFunc(time.Second, func() {
+		close(release)
+	})
+	cutoff := <-cutoffC
+	if len(cutoff) != 1 || cutoff[0].String() != stuckConn.LocalAddr().String() {
+		t.Fatal("expect stuck channel cut off but got", cutoff)
+	}
+	if server.IsRunning() {
+		t.Fatal("expect server stopped")
+	}
+
+	// Connection in sniffing is closed without waiting for sniff timeout.
+	pendingConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := pendingConn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("expect pending connection closed")
+	} else if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		t.Fatal("expect pending connection closed but timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatal("expect shutdown without waiting for sniffing but took", elapsed)
+	}
+}
+
+// freePort returns a free TCP port of loopback address.
+func freePort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// initEchoInitializer returns initializer of pipelines which echo TLV frames.
+func initEchoInitializer() peer.PipelineInitializer {
+	tlvConfig := codec.TLVConfig{TagValue: 170}
+	initializer := peer.FunctionalPipelineInitializer{}
+	initializer.DecoderInit = func() codec.FrameDecoder {
+		return codec.NewTLVFrameDecoder(tlvConfig)
+	}
+	initializer.EncoderInit = func() codec.FrameEncoder {
+		return codec.NewTLVFrameEncoder(tlvConfig)
+	}
+	initializer.HandlerInit = func() peer.ChannelHandler {
+		handler := peer.FunctionalChannelHandler{}
+		handler.HandleRead = func(channel peer.Channel, in interface{}) error {
+			channel.Send(in)
+			return nil
+		}
+		return &handler
+	}
+	return &initializer
+}
+
+// initDelayEchoInitializer returns initializer of pipelines which echo TLV frames with specified
+// tag, and delay is invoked before encoding each frame.
+func initDelayEchoInitializer(tag uint8, delay func()) peer.PipelineInitializer {
+	tlvConfig := codec.TLVConfig{TagValue: tag}
+	initializer := peer.FunctionalPipelineInitializer{}
+	initializer.DecoderInit = func() codec.FrameDecoder {
+		return codec.NewTLVFrameDecoder(tlvConfig)
+	}
+	initializer.EncoderInit = func() codec.FrameEncoder {
+		return &delayEncoder{FrameEncoder: codec.NewTLVFrameEncoder(tlvConfig), delay: delay}
+	}
+	initializer.HandlerInit = func() peer.ChannelHandler {
+		handler := peer.FunctionalChannelHandler{}
+		handler.HandleRead = func(channel peer.Channel, in interface{}) error {
+			channel.SendFuture(in, nil)
+			return nil
+		}
+		return &handler
+	}
+	return &initializer
+}
+
+// delayEncoder invoke delay before encoding.
+type delayEncoder struct {
+	codec.FrameEncoder
+	delay func()
+}
+
+func (e *delayEncoder) Encode(msg interface{}) ([]byte, error) {
+	e.delay()
+	return e.FrameEncoder.Encode(msg)
+}
+
+// writeFrame write a TLV frame with specified tag through connection and returns the frame.
+func writeFrame(t *testing.T, conn net.Conn, tag uint8) []byte {
+	frame, _ := codec.NewTLVFrameEncoder(codec.TLVConfig{TagValue: tag}).Encode([]byte("Hello World."))
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+	return frame
+}
+
+// echo send a TLV frame through connection and check the echoed frame.
+func echo(t *testing.T, conn net.Conn) {
+	frame := writeFrame(t, conn, 170)
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	echoed := make([]byte, len(frame))
+	if _, err := io.ReadFull(conn, echoed); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(echoed, frame) {
+		t.Fatal("unexpected echoed frame", echoed)
+	}
+}
+
+func itoa(i int) string {
+	return big.NewInt(int64(i)).String()
+}
@@ -0,0 +1,188 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package tcp
+
+import (
+	"crypto/tls"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mervinkid/matcha/logging"
+	"github.com/mervinkid/matcha/misc"
+	"github.com/mervinkid/matcha/net/tcp/config"
+	"github.com/mervinkid/matcha/task"
+)
+
+// Errors
+var NoCertificateError = errors.New("no certificate")
+
+// CertificateReloader is a implementation of Lifecycle interface which load certificate from
+// files and reload it while files modified. It provides GetCertificate method for tls.Config
+// so new connections use the latest certificate without restarting server.
+//
+// State:
+//  +-----+           +---------+          +--------+
+//  | NEW | → Start → | RUNNING | → Stop → | FINISH |
+//  +-----+           +---------+          +--------+
+type CertificateReloader struct {
+	CertFile string
+	KeyFile  string
+	Interval time.Duration
+
+	certificate      *tls.Certificate
+	certModTime      time.Time
+	keyModTime       time.Time
+	certificateMutex sync.RWMutex
+
+	running    bool
+	stateMutex sync.RWMutex
+	scheduler  task.Scheduler
+}
+
+// Start load certificate and start checking files modification with interval.
+func (r *CertificateReloader) Start() error {
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+
+	if r.running {
+		return nil
+	}
+	if err := r.Reload(); err != nil {
+		return err
+	}
+	if r.Interval > 0 {
+		scheduler := task.NewFixedDelayScheduler(r.checkReload, r.Interval)
+		if err := misc.LifecycleStart(scheduler); err != nil {
+			return err
+		}
+		r.scheduler = scheduler
+	}
+	r.running = true
+	return nil
+}
+
+// Stop will stop checking files modification.
+func (r *CertificateReloader) Stop() {
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+
+	if !r.running {
+		return
+	}
+	if misc.LifecycleCheckRun(r.scheduler) {
+		misc.LifecycleStop(r.scheduler)
+	}
+	r.scheduler = nil
+	r.running = false
+}
+
+// IsRunning returns true if reloader is running.
+func (r *CertificateReloader) IsRunning() bool {
+	r.stateMutex.RLock()
+	defer r.stateMutex.RUnlock()
+	return r.running
+}
+
+// Reload load certificate from files immediately.
+func (r *CertificateReloader) Reload() error {
+	certModTime, keyModTime, err := r.modTimes()
+	if err != nil {
+		return err
+	}
+	certificate, err := tls.LoadX509KeyPair(r.CertFile, r.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	r.certificateMutex.Lock()
+	defer r.certificateMutex.Unlock()
+	r.certificate = &certificate
+	r.certModTime = certModTime
+	r.keyModTime = keyModTime
+	return nil
+}
+
+// GetCertificate returns the latest loaded certificate.
+func (r *CertificateReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.certificateMutex.RLock()
+	defer r.certificateMutex.RUnlock()
+	if r.certificate == nil {
+		return nil, NoCertificateError
+	}
+	return r.certificate, nil
+}
+
+// checkReload reload certificate if files have been modified since last loading.
+func (r *CertificateReloader) checkReload() {
+	certModTime, keyModTime, err := r.modTimes()
+	if err != nil {
+		logging.Warn("Check certificate files fail cause %s.", err.Error())
+		return
+	}
+
+	r.certificateMutex.RLock()
+	modified := !certModTime.Equal(r.certModTime) || !keyModTime.Equal(r.keyModTime)
+	r.certificateMutex.RUnlock()
+
+	if modified {
+		if err := r.Reload(); err != nil {
+			// Keep using previous certificate.
+			logging.Warn("Reload certificate fail cause %s.", err.Error())
+			return
+		}
+		logging.Info("Certificate %s reloaded.", r.CertFile)
+	}
+}
+
+func (r *CertificateReloader) modTimes() (certModTime, keyModTime time.Time, err error) {
+	certInfo, err := os.Stat(r.CertFile)
+	if err != nil {
+		return
+	}
+	keyInfo, err := os.Stat(r.KeyFile)
+	if err != nil {
+		return
+	}
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
+
+// NewCertificateReloader create a new CertificateReloader instance with specified files and interval.
+func NewCertificateReloader(certFile, keyFile string, interval time.Duration) *CertificateReloader {
+	return &CertificateReloader{
+		CertFile: certFile,
+		KeyFile:  keyFile,
+		Interval: interval,
+	}
+}
+
+// initTLS create tls.Config with specified configuration. The returned Lifecycle should be
+// started and stopped with server if it is not nil.
+func initTLS(cfg *config.TLSConfig) (*tls.Config, misc.Lifecycle) {
+	if cfg.GetCertificate != nil {
+		return &tls.Config{GetCertificate: cfg.GetCertificate}, nil
+	}
+	reloader := NewCertificateReloader(cfg.CertFile, cfg.KeyFile, cfg.ReloadInterval)
+	return &tls.Config{GetCertificate: reloader.GetCertificate}, reloader
+}
@@ -0,0 +1,241 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package tcp_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mervinkid/matcha/net/tcp"
+	"github.com/mervinkid/matcha/net/tcp/codec"
+	"github.com/mervinkid/matcha/net/tcp/config"
+	"github.com/mervinkid/matcha/net/tcp/peer"
+)
+
+// writeCertificate write a self-signed certificate with specified serial number and its key to files.
+func writeCertificate(t *testing.T, certFile, keyFile string, serial int64) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	if err := ioutil.WriteFile(certFile, certPem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, keyPem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	// Make sure modification is visible to reloader with coarse mod time.
+	modTime := time.Now().Add(time.Duration(serial) * time.Second)
+	os.Chtimes(certFile, modTime, modTime)
+	os.Chtimes(keyFile, modTime, modTime)
+}
+
+func dialTLS(t *testing.T, port int) (*tls.Conn, int64) {
+	conn, err := tls.Dial("tcp", net.JoinHostPort("127.0.0.1", itoa(port)), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+}
+
+func TestServer_TLS(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "matcha-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCertificate(t, certFile, keyFile, 1)
+
+	serverConfig := config.ServerConfig{}
+	serverConfig.IP = net.ParseIP("127.0.0.1")
+	serverConfig.AcceptorSize = 1
+	serverConfig.Port = freePort(t)
+	serverConfig.TLS = &config.TLSConfig{CertFile: certFile, KeyFile: keyFile, ReloadInterval: 50 * time.Millisecond}
+	server := tcp.NewPipelineServer(serverConfig, initEchoInitializer())
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	// Round trip over TLS.
+	conn, serial := dialTLS(t, serverConfig.Port)
+	if serial != 1 {
+		t.Fatal("unexpected certificate serial", serial)
+	}
+	echo(t, conn)
+	conn.Close()
+
+	// Plaintext is not served on TLS port.
+	plainConn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", itoa(serverConfig.Port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, _ := codec.NewTLVFrameEncoder(codec.TLVConfig{TagValue: 170}).Encode([]byte("Hello World."))
+	plainConn.Write(frame)
+	plainConn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	if response, _ := ioutil.ReadAll(plainConn); bytes.Equal(response, frame) {
+		t.Fatal("expect plaintext frame not echoed on TLS port")
+	}
+	plainConn.Close()
+
+	// New connections use reloaded certificate.
+	writeCertificate(t, certFile, keyFile, 2)
+	deadline := time.Now().Add(3 * time.Second)
+	for serial != 2 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+		conn, serial = dialTLS(t, serverConfig.Port)
+		conn.Close()
+	}
+	if serial != 2 {
+		t.Fatal("expect certificate reloaded but got serial", serial)
+	}
+	conn, _ = dialTLS(t, serverConfig.Port)
+	echo(t, conn)
+	conn.Close()
+}
+
+func TestServer_SniffTLS(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "matcha-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCertificate(t, certFile, keyFile, 1)
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// TLS and plaintext TLV are unified on the same port.
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{certificate}}
+	sniffer := peer.NewProtocolSniffer(nil)
+	sniffer.AddRule("tls", peer.MatchTLSClientHello(), peer.NewTLSInitializer(tlsConfig, initEchoInitializer()))
+	sniffer.AddRule("tlv", peer.MatchTLVTag(170), initEchoInitializer())
+
+	serverConfig := config.ServerConfig{}
+	serverConfig.IP = net.ParseIP("127.0.0.1")
+	serverConfig.AcceptorSize = 1
+	serverConfig.Port = freePort(t)
+	server := tcp.NewPipelineServer(serverConfig, sniffer)
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+
+	// Handshake completes through sniffer and frames are echoed over TLS.
+	conn, serial := dialTLS(t, serverConfig.Port)
+	if serial != 1 {
+		t.Fatal("unexpected certificate serial", serial)
+	}
+	echo(t, conn)
+	conn.Close()
+
+	plainConn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", itoa(serverConfig.Port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	echo(t, plainConn)
+	plainConn.Close()
+}
+
+func TestCertificateReloader(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "matcha-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	reloader := tcp.NewCertificateReloader(certFile, keyFile, 20*time.Millisecond)
+	if err := reloader.Start(); err == nil {
+		t.Fatal("expect start fail without certificate files")
+	}
+
+	writeCertificate(t, certFile, keyFile, 1)
+	if err := reloader.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer reloader.Stop()
+	serialOf := func() int64 {
+		certificate, err := reloader.GetCertificate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := x509.ParseCertificate(certificate.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed.SerialNumber.Int64()
+	}
+	if serial := serialOf(); serial != 1 {
+		t.Fatal("unexpected certificate serial", serial)
+	}
+
+	// Broken files keep previous certificate.
+	ioutil.WriteFile(keyFile, []byte("broken"), 0600)
+	time.Sleep(100 * time.Millisecond)
+	if serial := serialOf(); serial != 1 {
+		t.Fatal("expect previous certificate kept but got serial", serial)
+	}
+
+	writeCertificate(t, certFile, keyFile, 2)
+	time.Sleep(100 * time.Millisecond)
+	if serial := serialOf(); serial != 2 {
+		t.Fatal("expect certificate reloaded but got serial", serial)
+	}
+}
@@ -0,0 +1,101 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package parallel
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Dump states
+const (
+	DumpStateRunning = "RUNNING"
+	DumpStateBackoff = "BACKOFF"
+)
+
+// GoroutineInfo is a snapshot of a live goroutine created by this package.
+type GoroutineInfo struct {
+	Id        uint64
+	Name      string
+	StartTime time.Time
+	State     string
+	Restarts  int
+}
+
+func (i GoroutineInfo) String() string {
+	return fmt.Sprintf("GoroutineInfo{Id:%d, Name:%s, StartTime:%s, State:%s, Restarts:%d}",
+		i.Id, i.Name, i.StartTime.Format(time.RFC3339), i.State, i.Restarts)
+}
+
+// goroutineRegistry keeps track of live StatementGoroutine instances for runtime dump.
+type goroutineRegistry struct {
+	goroutineMap sync.Map
+}
+
+func (r *goroutineRegistry) add(goroutine *StatementGoroutine) {
+	r.goroutineMap.Store(goroutine, true)
+}
+
+func (r *goroutineRegistry) remove(goroutine *StatementGoroutine) {
+	r.goroutineMap.Delete(goroutine)
+}
+
+func (r *goroutineRegistry) dump() []GoroutineInfo {
+	var infos []GoroutineInfo
+	r.goroutineMap.Range(func(key, _ interface{}) bool {
+		if goroutine, ok := key.(*StatementGoroutine); ok {
+			infos = append(infos, goroutine.info())
+		}
+		return true
+	})
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].StartTime.Before(infos[j].StartTime)
+	})
+	return infos
+}
+
+var liveGoroutines = &goroutineRegistry{}
+
+// info returns snapshot of the goroutine.
+func (c *StatementGoroutine) info() GoroutineInfo {
+	c.stateMutex.RLock()
+	defer c.stateMutex.RUnlock()
+	state := DumpStateRunning
+	if c.backoff {
+		state = DumpStateBackoff
+	}
+	return GoroutineInfo{
+		Id:        c.gId,
+		Name:      c.config.Name,
+		StartTime: c.startTime,
+		State:     state,
+		Restarts:  c.restarts,
+	}
+}
+
+// Dump returns snapshots of all live goroutines created by this package ordered by start time.
+func Dump() []GoroutineInfo {
+	return liveGoroutines.dump()
+}
@@ -23,11 +23,13 @@
 package parallel
 
 import (
+	"bytes"
 	"errors"
+	"github.com/mervinkid/matcha/logging"
 	"runtime"
-	"strconv"
-	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // State constants
@@ -37,23 +39,66 @@ const (
 	stateFinish
 )
 
+// Restart backoff constants
+const (
+	defaultRestartDelay    = 1 * time.Second
+	defaultRestartDelayMax = 1 * time.Minute
+)
+
 // Errors
 var IllegalStackFragmentError = errors.New("illegal stack fragment")
 
+// RestartPolicy defines the behavior of Goroutine after statement panic.
+type RestartPolicy uint8
+
+const (
+	// RestartNever finish goroutine after statement panic.
+	RestartNever RestartPolicy = iota
+	// RestartAlways run statement again immediately after it panic.
+	RestartAlways
+	// RestartBackoff run statement again after a delay which doubled after each restart.
+	RestartBackoff
+)
+
+// GoroutineConfig provide properties for Goroutine creation.
+type GoroutineConfig struct {
+	// Name is used for identifying goroutine in runtime dump.
+	Name string
+	// OnPanic will be invoked with the recovered value while statement panic.
+	// The panic will be logged with error level if it is nil.
+	OnPanic func(r interface{})
+	// Restart is the policy applied after statement panic.
+	Restart RestartPolicy
+	// RestartDelay is the initial delay for RestartBackoff policy. Default is 1 second.
+	RestartDelay time.Duration
+	// RestartDelayMax is the cap of delay for RestartBackoff policy. Default is 1 minute.
+	RestartDelayMax time.Duration
+	// RestartLimit is the max number of restarts. Zero means unlimited.
+	RestartLimit int
+}
+
 // Goroutine is the interface made definition of coroutine.
 type Goroutine interface {
 	Start()
 	Join()
+	JoinTimeout(timeout time.Duration) bool
 	IsAlive() bool
 	GetId() uint64
+	GetName() string
 }
 
 type StatementGoroutine struct {
-	statement      func()
-	state          uint8
-	stateMutex     sync.RWMutex
-	stateWaitGroup sync.WaitGroup
-	gId            uint64
+	statement  func()
+	config     GoroutineConfig
+	state      uint8
+	stateMutex sync.RWMutex
+	doneC      chan uint8
+	gId        uint64
+	ctx        *goroutineContext // Id cached on start, only accessed by the goroutine itself.
+	startTime  time.Time
+	restarts   int
+	backoff    bool
+	inherited  map[interface{}]interface{}
 }
 
 // Start will start coroutine.
@@ -66,7 +111,10 @@ func (c *StatementGoroutine) Start() {
 		return
 	}
 
-	c.stateWaitGroup.Add(1)
+	c.doneC = make(chan uint8)
+	c.startTime = time.Now()
+	c.inherited = snapshotInheritableLocals()
+	liveGoroutines.add(c)
 	c.run()
 
 	c.state = stateRunning
@@ -79,13 +127,48 @@ func (c *StatementGoroutine) IsAlive() bool {
 	return c.state == stateRunning
 }
 
+// GetId returns id of the goroutine. Returns 0 if it has not been started.
 func (c *StatementGoroutine) GetId() uint64 {
+	c.stateMutex.RLock()
+	defer c.stateMutex.RUnlock()
 	return c.gId
 }
 
+// GetName returns name of the goroutine.
+func (c *StatementGoroutine) GetName() string {
+	return c.config.Name
+}
+
 // Sync block invoker goroutine until coroutine finish.
 func (c *StatementGoroutine) Join() {
-	c.stateWaitGroup.Wait()
+	if doneC := c.getDoneC(); doneC != nil {
+		<-doneC
+	}
+}
+
+// JoinTimeout block invoker goroutine until coroutine finish or timeout.
+// Returns false if coroutine is still running after timeout.
+func (c *StatementGoroutine) JoinTimeout(timeout time.Duration) bool {
+	doneC := c.getDoneC()
+	if doneC == nil {
+		return true
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-doneC:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// getDoneC returns the channel which will be closed after coroutine finish.
+// Returns nil if coroutine has not been started.
+func (c *StatementGoroutine) getDoneC() chan uint8 {
+	c.stateMutex.RLock()
+	defer c.stateMutex.RUnlock()
+	return c.doneC
 }
 
 // Run will execute statement. This method can be override with own logic when writing custom implementation.
@@ -99,19 +182,87 @@ func (c *StatementGoroutine) Run() {
 func (c *StatementGoroutine) run() {
 
 	go func() {
-		// Try get goroutine on start
-		c.gId, _ = GetGoroutineId()
+		// Try get goroutine on start, the id is cached in context for the rest of the goroutine
+		gId, _ := GetGoroutineId()
+		c.stateMutex.Lock()
+		c.gId = gId
+		c.stateMutex.Unlock()
+		c.ctx = &goroutineContext{gId: gId}
+		// Restore goroutine local values inherited from parent
+		for key, value := range c.inherited {
+			c.ctx.SetLocal(key, value)
+		}
+		c.inherited = nil
 		// Execute statement
-		c.Run()
+		c.runWithRestart()
 		// Change state to FINISH
 		c.stateMutex.Lock()
 		c.state = stateFinish
 		c.stateMutex.Unlock()
+		liveGoroutines.remove(c)
 		// Release sync wait.
-		c.stateWaitGroup.Done()
+		close(c.doneC)
 		// Cleanup goroutine context
-		globalGoroutineLocalRepo.cleanupContext(c.gId)
+		globalGoroutineLocalRepo.cleanupContext(c.ctx.gId)
+	}()
+}
+
+// runWithRestart execute statement and restart it with policy after panic.
+func (c *StatementGoroutine) runWithRestart() {
+	delay := c.config.RestartDelay
+	if delay <= 0 {
+		delay = defaultRestartDelay
+	}
+	delayMax := c.config.RestartDelayMax
+	if delayMax <= 0 {
+		delayMax = defaultRestartDelayMax
+	}
+
+	for restarts := 0; ; restarts++ {
+		if !c.runAndRecover() {
+			return
+		}
+		if c.config.RestartLimit > 0 && restarts >= c.config.RestartLimit {
+			return
+		}
+		switch c.config.Restart {
+		case RestartAlways:
+		case RestartBackoff:
+			c.setBackoff(true)
+			time.Sleep(delay)
+			c.setBackoff(false)
+			if delay *= 2; delay > delayMax {
+				delay = delayMax
+			}
+		default:
+			return
+		}
+		c.stateMutex.Lock()
+		c.restarts++
+		c.stateMutex.Unlock()
+	}
+}
+
+func (c *StatementGoroutine) setBackoff(backoff bool) {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
+	c.backoff = backoff
+}
+
+// runAndRecover execute statement once and returns true if it panic.
+func (c *StatementGoroutine) runAndRecover() (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicked = true
+			if c.config.OnPanic != nil {
+				c.config.OnPanic(r)
+			} else {
+				logging.Error("Goroutine %d(%s) panic cause %v.", c.ctx.gId, c.config.Name, r)
+			}
+		}
 	}()
+	c.Run()
+	return false
 }
 
 // Create a Goroutine instance with statement function.
@@ -119,33 +270,118 @@ func NewGoroutine(statement func()) Goroutine {
 	return &StatementGoroutine{statement: statement}
 }
 
+// NewNamedGoroutine create a Goroutine instance with name and statement function.
+func NewNamedGoroutine(name string, statement func()) Goroutine {
+	return &StatementGoroutine{statement: statement, config: GoroutineConfig{Name: name}}
+}
+
+// NewGoroutineWithConfig create a Goroutine instance with statement function and configuration.
+func NewGoroutineWithConfig(statement func(), config GoroutineConfig) Goroutine {
+	return &StatementGoroutine{statement: statement, config: config}
+}
+
+// GoroutineContext is the context bound with a Goroutine created by NewContextGoroutine.
+// The goroutine id is captured once while goroutine starting, so accessing goroutine local
+// through context does not need to parse stack like GetGoroutineLocal.
+type GoroutineContext interface {
+	GetId() uint64
+	GetLocal(key interface{}) interface{}
+	SetLocal(key, value interface{})
+}
+
+type goroutineContext struct {
+	gId uint64
+}
+
+// GetId returns id of the goroutine which context bound with.
+func (c *goroutineContext) GetId() uint64 {
+	return c.gId
+}
+
+// GetLocal get goroutine local data with specified key.
+func (c *goroutineContext) GetLocal(key interface{}) interface{} {
+	if key == nil {
+		return nil
+	}
+	return globalGoroutineLocalRepo.getGoroutineLocal(c.gId, key)
+}
+
+// SetLocal set goroutine local data with specified key.
+func (c *goroutineContext) SetLocal(key, value interface{}) {
+	if key == nil {
+		return
+	}
+	globalGoroutineLocalRepo.setGoroutineLocal(c.gId, key, value)
+}
+
+// NewContextGoroutine create a Goroutine instance with statement function which receives
+// the GoroutineContext of the goroutine.
+func NewContextGoroutine(statement func(ctx GoroutineContext), config GoroutineConfig) Goroutine {
+	goroutine := &StatementGoroutine{config: config}
+	if statement != nil {
+		goroutine.statement = func() {
+			statement(goroutine.ctx)
+		}
+	}
+	return goroutine
+}
+
+// Stack fragment constants
+const stackFragmentSize = 32
+
+var (
+	stackFragmentPrefix = []byte("goroutine ")
+	stackFragmentPool   = sync.Pool{
+		New: func() interface{} {
+			fragment := make([]byte, stackFragmentSize)
+			return &fragment
+		},
+	}
+)
+
 // GetGoroutineId returns id of invoker goroutine.
+// The id is parsed from the header of the stack fragment of invoker goroutine which formatted
+// as 'goroutine ID [STATE]:'. The read buffer is pooled and the id is parsed from bytes in place
+// to avoid allocation on hot paths.
 func GetGoroutineId() (uint64, error) {
 
-	// Init read buffer and read stack information fragment.
-	readBuffer := make([]byte, 64)
-	count := runtime.Stack(readBuffer, false)
-	stackFragment := string(readBuffer[:count])
+	// Read stack information fragment with pooled buffer.
+	readBuffer := stackFragmentPool.Get().(*[]byte)
+	count := runtime.Stack(*readBuffer, false)
+	goroutineId, err := parseGoroutineId((*readBuffer)[:count])
+	stackFragmentPool.Put(readBuffer)
 
-	// Split fragment string by space.
-	stackFragmentParts := strings.Split(stackFragment, " ")
+	return goroutineId, err
+}
 
-	// Check split result
-	if len(stackFragmentParts) < 2 {
+// parseGoroutineId parse goroutine id from the header of stack fragment.
+func parseGoroutineId(stackFragment []byte) (uint64, error) {
+
+	if !bytes.HasPrefix(stackFragment, stackFragmentPrefix) {
 		return 0, IllegalStackFragmentError
 	}
 
-	// Convert string value to int.
-	goroutineId, err := strconv.ParseUint(stackFragmentParts[1], 10, 64)
-
-	if err != nil {
-		return 0, err
+	var goroutineId uint64
+	digits := 0
+	for _, b := range stackFragment[len(stackFragmentPrefix):] {
+		if b < '0' || b > '9' {
+			break
+		}
+		goroutineId = goroutineId*10 + uint64(b-'0')
+		digits++
+	}
+	if digits == 0 {
+		return 0, IllegalStackFragmentError
 	}
 
 	return goroutineId, nil
 }
 
-// GoroutineLocalRepository implement a parallel-safe repository for goroutine context with RWMutex.
+// Number of shards in goroutine local repository.
+const goroutineLocalShards = 32
+
+// GoroutineLocalRepository implement a parallel-safe repository for goroutine context. The data
+// is sharded by goroutine id and each shard is guarded by its own RWMutex to reduce contention.
 //  +-----------------------------+
 //  |  GID  |      Context        |
 //  +-------+---------------------+
@@ -167,12 +403,28 @@ func GetGoroutineId() (uint64, error) {
 //  +-----------------------------+
 //  |  ...  |         ...         |
 //  +-----------------------------+
+//   Shard = GID % 32
+// Number of goroutines with context is counted, so that lookup is skipped without parsing id of
+// invoker goroutine while repository is empty.
 type goroutineLocalRepo struct {
+	contexts int64
+	shards   [goroutineLocalShards]goroutineLocalShard
+}
+
+type goroutineLocalShard struct {
+	mutex   sync.RWMutex
 	dataMap map[uint64]map[interface{}]interface{}
 }
 
+func (r *goroutineLocalRepo) shard(goroutineId uint64) *goroutineLocalShard {
+	return &r.shards[goroutineId%goroutineLocalShards]
+}
+
 func (r *goroutineLocalRepo) getGoroutineLocal(goroutineId uint64, key interface{}) interface{} {
-	entity := r.dataMap[goroutineId]
+	shard := r.shard(goroutineId)
+	shard.mutex.RLock()
+	defer shard.mutex.RUnlock()
+	entity := shard.dataMap[goroutineId]
 	if entity == nil {
 		return nil
 	}
@@ -180,21 +432,40 @@ func (r *goroutineLocalRepo) getGoroutineLocal(goroutineId uint64, key interface
 }
 
 func (r *goroutineLocalRepo) setGoroutineLocal(goroutineId uint64, key interface{}, value interface{}) {
-	entity := r.dataMap[goroutineId]
+	shard := r.shard(goroutineId)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	if shard.dataMap == nil {
+		shard.dataMap = make(map[uint64]map[interface{}]interface{})
+	}
+	entity := shard.dataMap[goroutineId]
 	if entity == nil {
 		entity = make(map[interface{}]interface{})
-		r.dataMap[goroutineId] = entity
+		shard.dataMap[goroutineId] = entity
+		atomic.AddInt64(&r.contexts, 1)
 	}
 	entity[key] = value
 }
 
 func (r *goroutineLocalRepo) cleanupContext(goroutineId uint64) {
-	delete(r.dataMap, goroutineId)
+	shard := r.shard(goroutineId)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	if _, ok := shard.dataMap[goroutineId]; ok {
+		delete(shard.dataMap, goroutineId)
+		atomic.AddInt64(&r.contexts, -1)
+	}
 }
 
-var globalGoroutineLocalRepo = &goroutineLocalRepo{dataMap: make(map[uint64]map[interface{}]interface{})}
+// isEmpty returns true if no goroutine has context in repository.
+func (r *goroutineLocalRepo) isEmpty() bool {
+	return atomic.LoadInt64(&r.contexts) == 0
+}
 
-// SetGoroutineContext set data to goroutine local .
+var globalGoroutineLocalRepo = &goroutineLocalRepo{}
+
+// SetGoroutineContext set data to goroutine local. Id of invoker goroutine is parsed from stack for
+// each invocation, use GoroutineContext of NewContextGoroutine with id cached on start in hot paths.
 func SetGoroutineLocal(key, value interface{}) {
 
 	if key == nil {
@@ -207,10 +478,12 @@ func SetGoroutineLocal(key, value interface{}) {
 	}
 }
 
-// GetGoroutineLocal get local context data of invoker goroutine.
+// GetGoroutineLocal get local context data of invoker goroutine. Id of invoker goroutine is parsed
+// from stack for each invocation unless no goroutine has local data, use GoroutineContext of
+// NewContextGoroutine with id cached on start in hot paths.
 func GetGoroutineLocal(key interface{}) interface{} {
 
-	if key == nil {
+	if key == nil || globalGoroutineLocalRepo.isEmpty() {
 		return nil
 	}
 
@@ -220,3 +493,52 @@ func GetGoroutineLocal(key interface{}) interface{} {
 	}
 	return nil
 }
+
+// inheritableKeys holds the keys of goroutine local values which will be inherited by child goroutines.
+var (
+	inheritableKeys      = make(map[interface{}]bool)
+	inheritableKeysMutex sync.RWMutex
+)
+
+// RegisterInheritableKey mark the goroutine local value of specified key inheritable. A Goroutine
+// created by this package will snapshot inheritable values of the invoker goroutine while starting
+// and set them to its own goroutine local, like InheritableThreadLocal in Java.
+func RegisterInheritableKey(key interface{}) {
+	if key == nil {
+		return
+	}
+	inheritableKeysMutex.Lock()
+	defer inheritableKeysMutex.Unlock()
+	inheritableKeys[key] = true
+}
+
+// UnregisterInheritableKey cancel the inheritable mark of specified key.
+func UnregisterInheritableKey(key interface{}) {
+	inheritableKeysMutex.Lock()
+	defer inheritableKeysMutex.Unlock()
+	delete(inheritableKeys, key)
+}
+
+// snapshotInheritableLocals returns inheritable goroutine local values of invoker goroutine.
+func snapshotInheritableLocals() map[interface{}]interface{} {
+	inheritableKeysMutex.RLock()
+	defer inheritableKeysMutex.RUnlock()
+
+	if len(inheritableKeys) == 0 || globalGoroutineLocalRepo.isEmpty() {
+		return nil
+	}
+	gId, err := GetGoroutineId()
+	if err != nil {
+		return nil
+	}
+	var snapshot map[interface{}]interface{}
+	for key := range inheritableKeys {
+		if value := globalGoroutineLocalRepo.getGoroutineLocal(gId, key); value != nil {
+			if snapshot == nil {
+				snapshot = make(map[interface{}]interface{})
+			}
+			snapshot[key] = value
+		}
+	}
+	return snapshot
+}
@@ -3,6 +3,7 @@ package parallel_test
 import (
 	"github.com/mervinkid/matcha/parallel"
 	"testing"
+	"time"
 )
 
 func TestNewGoroutine(t *testing.T) {
@@ -31,3 +32,180 @@ func TestNewGoroutine(t *testing.T) {
 		g.Join()
 	}
 }
+
+func TestGoroutineRestart(t *testing.T) {
+
+	runs := 0
+	panics := 0
+	config := parallel.GoroutineConfig{}
+	config.Restart = parallel.RestartAlways
+	config.RestartLimit = 3
+	config.OnPanic = func(r interface{}) {
+		panics++
+	}
+
+	goroutine := parallel.NewGoroutineWithConfig(func() {
+		runs++
+		panic("statement panic")
+	}, config)
+	goroutine.Start()
+	goroutine.Join()
+
+	if runs != 4 || panics != 4 {
+		t.Fatal("expect 4 runs and 4 panics but got", runs, panics)
+	}
+}
+
+func TestGoroutineJoinTimeout(t *testing.T) {
+
+	stopC := make(chan uint8)
+	goroutine := parallel.NewGoroutine(func() {
+		<-stopC
+	})
+
+	if !goroutine.JoinTimeout(time.Millisecond) {
+		t.Fatal("expect join success while goroutine not started")
+	}
+
+	goroutine.Start()
+	if goroutine.JoinTimeout(10 * time.Millisecond) {
+		t.Fatal("expect join timeout while goroutine is running")
+	}
+
+	close(stopC)
+	if !goroutine.JoinTimeout(time.Second) {
+		t.Fatal("expect join success after goroutine finish")
+	}
+}
+
+func TestDump(t *testing.T) {
+
+	stopC := make(chan uint8)
+	goroutine := parallel.NewNamedGoroutine("dump-test", func() {
+		<-stopC
+	})
+	goroutine.Start()
+
+	found := false
+	for _, info := range parallel.Dump() {
+		t.Log(info)
+		if info.Name == "dump-test" {
+			found = true
+		}
+	}
+	close(stopC)
+	goroutine.Join()
+
+	if !found {
+		t.Fatal("named goroutine not found in dump")
+	}
+}
+
+func TestGoroutineLocal(t *testing.T) {
+
+	parallelism := 100
+
+	goroutines := make([]parallel.Goroutine, parallelism)
+	failures := make(chan int, parallelism)
+
+	for i := 0; i < parallelism; i++ {
+		in := i
+		goroutines[i] = parallel.NewGoroutine(func() {
+			for j := 0; j < 100; j++ {
+				parallel.SetGoroutineLocal("key", in*j)
+				if parallel.GetGoroutineLocal("key") != in*j {
+					failures <- in
+					return
+				}
+			}
+		})
+	}
+
+	for _, g := range goroutines {
+		g.Start()
+	}
+	for _, g := range goroutines {
+		g.Join()
+	}
+
+	if len(failures) > 0 {
+		t.Fatal("goroutine local value mismatch in goroutine", <-failures)
+	}
+}
+
+func BenchmarkGetGoroutineLocal_Empty(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		parallel.GetGoroutineLocal("key")
+	}
+}
+
+func BenchmarkGoroutineLocal(b *testing.B) {
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			parallel.SetGoroutineLocal("key", "value")
+			parallel.GetGoroutineLocal("key")
+		}
+	})
+}
+
+func TestInheritableGoroutineLocal(t *testing.T) {
+
+	parallel.RegisterInheritableKey("traceId")
+	defer parallel.UnregisterInheritableKey("traceId")
+
+	var inherited, notInherited interface{}
+	parent := parallel.NewGoroutine(func() {
+		parallel.SetGoroutineLocal("traceId", "trace-1")
+		parallel.SetGoroutineLocal("userId", "user-1")
+		child := parallel.NewGoroutine(func() {
+			inherited = parallel.GetGoroutineLocal("traceId")
+			notInherited = parallel.GetGoroutineLocal("userId")
+		})
+		child.Start()
+		child.Join()
+	})
+	parent.Start()
+	parent.Join()
+
+	if inherited != "trace-1" || notInherited != nil {
+		t.Fatal("unexpected goroutine local values", inherited, notInherited)
+	}
+}
+
+func BenchmarkGetGoroutineId(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		parallel.GetGoroutineId()
+	}
+}
+
+// BenchmarkGoroutineLocalAccess compare goroutine local access inside a goroutine of this package
+// with id parsed from stack for each access and with id cached on start.
+func BenchmarkGoroutineLocalAccess(b *testing.B) {
+	access := map[string]func(ctx parallel.GoroutineContext){
+		"Stack": func(ctx parallel.GoroutineContext) {
+			parallel.SetGoroutineLocal("key", "value")
+			parallel.GetGoroutineLocal("key")
+		},
+		"Cached": func(ctx parallel.GoroutineContext) {
+			ctx.SetLocal("key", "value")
+			ctx.GetLocal("key")
+		},
+	}
+	for _, name := range []string{"Stack", "Cached"} {
+		accessLocal := access[name]
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			goroutine := parallel.NewContextGoroutine(func(ctx parallel.GoroutineContext) {
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					accessLocal(ctx)
+				}
+			}, parallel.GoroutineConfig{})
+			goroutine.Start()
+			goroutine.Join()
+		})
+	}
+}
@@ -0,0 +1,417 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package parallel
+
+import (
+	"errors"
+	"github.com/mervinkid/matcha/logging"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Default keep alive duration of elastic workers.
+const defaultKeepAlive = 60 * time.Second
+
+// Errors
+var (
+	NilTaskError       = errors.New("task is nil")
+	PoolShutdownError  = errors.New("worker pool is shutdown")
+	PoolQueueFullError = errors.New("worker pool queue is full")
+)
+
+// Priority is the level of task submitted to WorkerPool. Tasks with higher priority will be taken
+// by workers before the ones with lower priority.
+type Priority uint8
+
+const (
+	PriorityHigh Priority = iota
+	PriorityNormal
+	PriorityLow
+)
+
+const priorityLevels = int(PriorityLow) + 1
+
+// WorkerPool is the interface that wraps the basic method for executing tasks with bounded goroutines.
+// Methods:
+//  Submit put task into queue with normal priority and returns error if pool is shutdown or queue is full.
+//  SubmitWithPriority put task into queue of specified priority.
+//  Shutdown stop accepting new tasks and block invoker until queued tasks finish.
+//  IsShutdown returns true if pool has been shutdown.
+//  Size returns the number of workers.
+type WorkerPool interface {
+	Submit(task func()) error
+	SubmitWithPriority(task func(), priority Priority) error
+	Shutdown()
+	IsShutdown() bool
+	Size() int
+}
+
+// priorityTaskQueue is a set of bounded task queues, one for each priority level.
+// Notes:
+// Queues are served in strict priority order, tasks with low priority may starve while
+// tasks with higher priority keep coming.
+type priorityTaskQueue struct {
+	queues [priorityLevels]chan func()
+	closeC chan uint8
+}
+
+// offer put task into queue of specified priority without blocking. Returns false if queue is full.
+func (q *priorityTaskQueue) offer(task func(), priority Priority) bool {
+	if int(priority) >= priorityLevels {
+		priority = PriorityLow
+	}
+	select {
+	case q.queues[priority] <- task:
+		return true
+	default:
+		return false
+	}
+}
+
+// poll returns the task with highest priority without blocking. Returns nil if all queues are empty.
+func (q *priorityTaskQueue) poll() func() {
+	for _, queue := range q.queues {
+		select {
+		case task := <-queue:
+			return task
+		default:
+		}
+	}
+	return nil
+}
+
+// take block until a task is available, queue is closed or timeoutC fires. Returns nil task on
+// timeout, and nil task with closed flag after queue is closed and drained.
+func (q *priorityTaskQueue) take(timeoutC <-chan time.Time) (task func(), closed bool) {
+	if task = q.poll(); task != nil {
+		return task, false
+	}
+	select {
+	case task = <-q.queues[PriorityHigh]:
+	case task = <-q.queues[PriorityNormal]:
+	case task = <-q.queues[PriorityLow]:
+	case <-q.closeC:
+		task = q.poll()
+		return task, task == nil
+	case <-timeoutC:
+	}
+	return task, false
+}
+
+// size returns the number of queued tasks of all priorities.
+func (q *priorityTaskQueue) size() int {
+	size := 0
+	for _, queue := range q.queues {
+		size += len(queue)
+	}
+	return size
+}
+
+// close wake up all takers. Queued tasks can still be taken until queues are drained.
+func (q *priorityTaskQueue) close() {
+	close(q.closeC)
+}
+
+func newPriorityTaskQueue(queueCap int) *priorityTaskQueue {
+	queue := &priorityTaskQueue{closeC: make(chan uint8)}
+	for i := range queue.queues {
+		queue.queues[i] = make(chan func(), queueCap)
+	}
+	return queue
+}
+
+// fixedWorkerPool is a implementation of WorkerPool interface with fixed number of worker goroutines
+// consuming bounded priority task queues.
+//  +--------+     +-----------------------+     +----------+
+//  | Submit | → → | high   (queueCap)     | → → | worker 1 |
+//  +--------+     | normal (queueCap)     |  ↘  +----------+
+//                 | low    (queueCap)     |   → |   ...    |
+//                 +-----------------------+     +----------+
+// Notes:
+// A panic in task will be recovered and logged, the worker continue to consume queue.
+type fixedWorkerPool struct {
+	size       int
+	queue      *priorityTaskQueue
+	workers    []Goroutine
+	shutdown   bool
+	stateMutex sync.RWMutex
+}
+
+// Submit put task into queue with normal priority without blocking.
+func (p *fixedWorkerPool) Submit(task func()) error {
+	return p.SubmitWithPriority(task, PriorityNormal)
+}
+
+// SubmitWithPriority put task into queue of specified priority without blocking.
+func (p *fixedWorkerPool) SubmitWithPriority(task func(), priority Priority) error {
+	if task == nil {
+		return NilTaskError
+	}
+
+	p.stateMutex.RLock()
+	defer p.stateMutex.RUnlock()
+
+	if p.shutdown {
+		return PoolShutdownError
+	}
+	if !p.queue.offer(task, priority) {
+		return PoolQueueFullError
+	}
+	return nil
+}
+
+// Shutdown stop accepting new tasks and wait for workers to finish queued tasks.
+func (p *fixedWorkerPool) Shutdown() {
+	p.stateMutex.Lock()
+	if p.shutdown {
+		p.stateMutex.Unlock()
+		return
+	}
+	p.shutdown = true
+	p.queue.close()
+	p.stateMutex.Unlock()
+
+	for _, worker := range p.workers {
+		worker.Join()
+	}
+}
+
+// IsShutdown returns true if pool has been shutdown.
+func (p *fixedWorkerPool) IsShutdown() bool {
+	p.stateMutex.RLock()
+	defer p.stateMutex.RUnlock()
+	return p.shutdown
+}
+
+// Size returns the number of workers.
+func (p *fixedWorkerPool) Size() int {
+	return p.size
+}
+
+func (p *fixedWorkerPool) startWorkers() {
+	p.workers = make([]Goroutine, p.size)
+	for i := 0; i < p.size; i++ {
+		worker := NewGoroutine(func() {
+			for {
+				task, closed := p.queue.take(nil)
+				if closed {
+					return
+				}
+				runTask(task)
+			}
+		})
+		worker.Start()
+		p.workers[i] = worker
+	}
+}
+
+// runTask execute specified task and recover panic from it.
+func runTask(task func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			logging.Error("Task panic cause %v.", r)
+		}
+	}()
+	task()
+}
+
+// NewWorkerPool create a new WorkerPool instance with specified number of workers and queue capacity.
+// The number of CPUs will be used as size if specified size is not positive.
+func NewWorkerPool(size, queueCap int) WorkerPool {
+	if size <= 0 {
+		size = runtime.NumCPU()
+	}
+	if queueCap < 0 {
+		queueCap = 0
+	}
+	pool := &fixedWorkerPool{
+		size:  size,
+		queue: newPriorityTaskQueue(queueCap),
+	}
+	pool.startWorkers()
+	return pool
+}
+
+// elasticWorkerPool is a implementation of WorkerPool interface which keeps coreSize workers and
+// grows up to maxSize workers while the queue is full. Workers beyond coreSize will exit after
+// being idle for keepAlive.
+//  +--------+     +-------------------+     +--------------+     +-----------------+
+//  | Submit | → → | queues (queueCap) | → → | core workers | + + | elastic workers |
+//  +--------+     +-------------------+     +--------------+     +-----------------+
+//                          ↓(full)                                   ↑(spawn)
+//                          └─────────────────────────────────────────┘
+type elasticWorkerPool struct {
+	coreSize   int
+	maxSize    int
+	keepAlive  time.Duration
+	queue      *priorityTaskQueue
+	workers    int
+	shutdown   bool
+	stateMutex sync.Mutex
+	waitGroup  sync.WaitGroup
+}
+
+// Submit put task into queue with normal priority or spawn a new worker for it while queue is full.
+func (p *elasticWorkerPool) Submit(task func()) error {
+	return p.SubmitWithPriority(task, PriorityNormal)
+}
+
+// SubmitWithPriority put task into queue of specified priority or spawn a new worker for it while
+// queue is full.
+func (p *elasticWorkerPool) SubmitWithPriority(task func(), priority Priority) error {
+	if task == nil {
+		return NilTaskError
+	}
+
+	p.stateMutex.Lock()
+	defer p.stateMutex.Unlock()
+
+	if p.shutdown {
+		return PoolShutdownError
+	}
+	if p.workers < p.coreSize {
+		p.startWorker(task)
+		return nil
+	}
+	if p.queue.offer(task, priority) {
+		// Queued task needs a worker to take it while core size is 0.
+		if p.workers == 0 {
+			p.startWorker(nil)
+		}
+		return nil
+	}
+	if p.workers < p.maxSize {
+		p.startWorker(task)
+		return nil
+	}
+	return PoolQueueFullError
+}
+
+// Shutdown stop accepting new tasks and wait for workers to finish queued tasks.
+func (p *elasticWorkerPool) Shutdown() {
+	p.stateMutex.Lock()
+	if p.shutdown {
+		p.stateMutex.Unlock()
+		return
+	}
+	p.shutdown = true
+	p.queue.close()
+	p.stateMutex.Unlock()
+
+	p.waitGroup.Wait()
+}
+
+// IsShutdown returns true if pool has been shutdown.
+func (p *elasticWorkerPool) IsShutdown() bool {
+	p.stateMutex.Lock()
+	defer p.stateMutex.Unlock()
+	return p.shutdown
+}
+
+// Size returns the current number of workers.
+func (p *elasticWorkerPool) Size() int {
+	p.stateMutex.Lock()
+	defer p.stateMutex.Unlock()
+	return p.workers
+}
+
+// startWorker start a new worker with first task which may be nil. Must be invoked with state lock
+// held.
+func (p *elasticWorkerPool) startWorker(firstTask func()) {
+	p.workers++
+	p.waitGroup.Add(1)
+	NewNamedGoroutine("ElasticWorker", func() {
+		defer p.waitGroup.Done()
+		if firstTask != nil {
+			runTask(firstTask)
+		}
+		idleTimer := time.NewTimer(p.keepAlive)
+		defer idleTimer.Stop()
+		for {
+			task, closed := p.queue.take(idleTimer.C)
+			switch {
+			case closed:
+				p.stopWorker()
+				return
+			case task != nil:
+				runTask(task)
+			default:
+				if p.tryStopIdleWorker() {
+					return
+				}
+			}
+			if !idleTimer.Stop() {
+				select {
+				case <-idleTimer.C:
+				default:
+				}
+			}
+			idleTimer.Reset(p.keepAlive)
+		}
+	}).Start()
+}
+
+func (p *elasticWorkerPool) stopWorker() {
+	p.stateMutex.Lock()
+	defer p.stateMutex.Unlock()
+	p.workers--
+}
+
+// tryStopIdleWorker returns true if the idle worker should exit since pool has more workers than core size.
+// The last worker keeps running while there are queued tasks.
+func (p *elasticWorkerPool) tryStopIdleWorker() bool {
+	p.stateMutex.Lock()
+	defer p.stateMutex.Unlock()
+	if p.workers > p.coreSize && (p.workers > 1 || p.queue.size() == 0) {
+		p.workers--
+		return true
+	}
+	return false
+}
+
+// NewElasticWorkerPool create a new WorkerPool instance which keeps coreSize workers and grows up to
+// maxSize workers under queue pressure. Workers beyond coreSize exit after being idle for keepAlive.
+func NewElasticWorkerPool(coreSize, maxSize, queueCap int, keepAlive time.Duration) WorkerPool {
+	if coreSize < 0 {
+		coreSize = 0
+	}
+	if maxSize < coreSize || maxSize <= 0 {
+		maxSize = coreSize
+	}
+	if maxSize == 0 {
+		maxSize = runtime.NumCPU()
+	}
+	if queueCap < 0 {
+		queueCap = 0
+	}
+	if keepAlive <= 0 {
+		keepAlive = defaultKeepAlive
+	}
+	return &elasticWorkerPool{
+		coreSize:  coreSize,
+		maxSize:   maxSize,
+		keepAlive: keepAlive,
+		queue:     newPriorityTaskQueue(queueCap),
+	}
+}
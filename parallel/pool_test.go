@@ -0,0 +1,137 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package parallel_test
+
+import (
+	"github.com/mervinkid/matcha/parallel"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkerPool(t *testing.T) {
+
+	pool := parallel.NewWorkerPool(4, 100)
+
+	var counter int32
+	for i := 0; i < 100; i++ {
+		if i%10 == 0 {
+			// Panic must be isolated from workers.
+			if err := pool.Submit(func() { panic("task panic") }); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := pool.Submit(func() { atomic.AddInt32(&counter, 1) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pool.Shutdown()
+
+	if counter != 90 {
+		t.Fatal("expect 90 tasks executed but got", counter)
+	}
+	if err := pool.Submit(func() {}); err != parallel.PoolShutdownError {
+		t.Fatal("expect shutdown error but got", err)
+	}
+}
+
+func TestWorkerPoolPriority(t *testing.T) {
+
+	pool := parallel.NewWorkerPool(1, 10)
+
+	// Block the only worker until all tasks queued.
+	blockC := make(chan uint8)
+	startC := make(chan uint8)
+	pool.Submit(func() {
+		close(startC)
+		<-blockC
+	})
+	<-startC
+
+	var executed []parallel.Priority
+	for _, priority := range []parallel.Priority{parallel.PriorityLow, parallel.PriorityNormal, parallel.PriorityHigh} {
+		p := priority
+		if err := pool.SubmitWithPriority(func() { executed = append(executed, p) }, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(blockC)
+	pool.Shutdown()
+
+	expected := []parallel.Priority{parallel.PriorityHigh, parallel.PriorityNormal, parallel.PriorityLow}
+	for i := range expected {
+		if i >= len(executed) || executed[i] != expected[i] {
+			t.Fatal("expect execution order", expected, "but got", executed)
+		}
+	}
+}
+
+func TestElasticWorkerPool(t *testing.T) {
+
+	pool := parallel.NewElasticWorkerPool(1, 4, 0, 10*time.Millisecond)
+
+	blockC := make(chan uint8)
+	for i := 0; i < 4; i++ {
+		if err := pool.Submit(func() { <-blockC }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if pool.Size() != 4 {
+		t.Fatal("expect pool grow to 4 workers but got", pool.Size())
+	}
+	if err := pool.Submit(func() {}); err != parallel.PoolQueueFullError {
+		t.Fatal("expect queue full error but got", err)
+	}
+	close(blockC)
+
+	// Elastic workers exit after keep alive.
+	time.Sleep(100 * time.Millisecond)
+	if pool.Size() != 1 {
+		t.Fatal("expect pool shrink to 1 worker but got", pool.Size())
+	}
+	pool.Shutdown()
+}
+
+func TestElasticWorkerPool_ZeroCoreSize(t *testing.T) {
+
+	pool := parallel.NewElasticWorkerPool(0, 2, 4, 10*time.Millisecond)
+	defer pool.Shutdown()
+
+	for round := 0; round < 2; round++ {
+		doneC := make(chan uint8, 1)
+		if err := pool.Submit(func() { doneC <- 1 }); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-doneC:
+		case <-time.After(time.Second):
+			t.Fatal("expect queued task executed without core worker")
+		}
+		// Idle worker exits after keep alive.
+		time.Sleep(100 * time.Millisecond)
+		if pool.Size() != 0 {
+			t.Fatal("expect pool shrink to 0 worker but got", pool.Size())
+		}
+	}
+}
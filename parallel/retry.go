@@ -0,0 +1,129 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package parallel
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Retry defaults
+const (
+	defaultRetryDelay      = 100 * time.Millisecond
+	defaultRetryMultiplier = 2
+)
+
+// BackoffType defines how the delay between attempts grows.
+type BackoffType uint8
+
+const (
+	// BackoffFixed wait the same delay between attempts.
+	BackoffFixed BackoffType = iota
+	// BackoffExponential multiply the delay by Multiplier after each attempt.
+	BackoffExponential
+)
+
+// RetryPolicy provide properties for Retry.
+//  +-----------+  delay  +-----------+  delay*m  +-----------+
+//  | attempt 1 | ------→ | attempt 2 | --------→ | attempt 3 | ...
+//  +-----------+         +-----------+           +-----------+
+type RetryPolicy struct {
+	// MaxAttempts is the max number of attempts include the first one. Zero means unlimited.
+	MaxAttempts int
+	// Backoff is the type of delay growth.
+	Backoff BackoffType
+	// Delay is the initial delay between attempts. Default is 100 milliseconds.
+	Delay time.Duration
+	// MaxDelay is the cap of delay. Zero means no cap.
+	MaxDelay time.Duration
+	// Multiplier is the factor for BackoffExponential. Default is 2.
+	Multiplier float64
+	// Jitter randomize each delay within ±Jitter fraction of it, should be in [0, 1].
+	Jitter float64
+	// RetryOn returns true if the attempt should be retried for specified error.
+	// All errors will be retried if it is nil.
+	RetryOn func(err error) bool
+}
+
+var (
+	retryRandom      = rand.New(rand.NewSource(time.Now().UnixNano()))
+	retryRandomMutex sync.Mutex
+)
+
+// Retry invoke fn until it succeeds, the policy gives up or ctx is done. Returns nil on success,
+// the error of last attempt if the policy gives up, or the error of ctx if it is done.
+func Retry(ctx context.Context, policy RetryPolicy, fn func() error) error {
+
+	delay := policy.Delay
+	if delay <= 0 {
+		delay = defaultRetryDelay
+	}
+	multiplier := policy.Multiplier
+	if multiplier <= 0 {
+		multiplier = defaultRetryMultiplier
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if policy.RetryOn != nil && !policy.RetryOn(err) {
+			return err
+		}
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			return err
+		}
+
+		timer := time.NewTimer(jitterDelay(delay, policy.Jitter))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		if policy.Backoff == BackoffExponential {
+			delay = time.Duration(float64(delay) * multiplier)
+		}
+		if policy.MaxDelay > 0 && delay > policy.MaxDelay {
+			delay = policy.MaxDelay
+		}
+	}
+}
+
+// jitterDelay randomize specified delay within ±jitter fraction of it.
+func jitterDelay(delay time.Duration, jitter float64) time.Duration {
+	if jitter <= 0 {
+		return delay
+	}
+	if jitter > 1 {
+		jitter = 1
+	}
+	retryRandomMutex.Lock()
+	factor := 1 - jitter + retryRandom.Float64()*2*jitter
+	retryRandomMutex.Unlock()
+	return time.Duration(float64(delay) * factor)
+}
@@ -0,0 +1,73 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package parallel_test
+
+import (
+	"context"
+	"errors"
+	"github.com/mervinkid/matcha/parallel"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+
+	policy := parallel.RetryPolicy{}
+	policy.MaxAttempts = 3
+	policy.Backoff = parallel.BackoffExponential
+	policy.Delay = time.Millisecond
+
+	attempts := 0
+	attemptErr := errors.New("attempt fail")
+	err := parallel.Retry(context.Background(), policy, func() error {
+		attempts++
+		return attemptErr
+	})
+	if err != attemptErr || attempts != 3 {
+		t.Fatal("expect 3 failed attempts but got", attempts, err)
+	}
+
+	attempts = 0
+	err = parallel.Retry(context.Background(), policy, func() error {
+		if attempts++; attempts < 2 {
+			return attemptErr
+		}
+		return nil
+	})
+	if err != nil || attempts != 2 {
+		t.Fatal("expect success on attempt 2 but got", attempts, err)
+	}
+
+	// Non-retryable error
+	attempts = 0
+	policy.RetryOn = func(err error) bool {
+		return err != attemptErr
+	}
+	parallel.Retry(context.Background(), policy, func() error {
+		attempts++
+		return attemptErr
+	})
+	if attempts != 1 {
+		t.Fatal("expect 1 attempt but got", attempts)
+	}
+}
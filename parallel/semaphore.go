@@ -0,0 +1,142 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package parallel
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+)
+
+// Errors
+var (
+	SemaphoreOverflowError = errors.New("acquire more than semaphore size")
+)
+
+// Semaphore is the interface defined a counting semaphore for bounding concurrent operations.
+// Methods:
+//  Acquire block invoker until n permits are available or ctx is done.
+//  TryAcquire acquire n permits without blocking and returns true if success.
+//  Release return n permits to semaphore.
+type Semaphore interface {
+	Acquire(ctx context.Context, n int64) error
+	TryAcquire(n int64) bool
+	Release(n int64)
+}
+
+type semaphoreWaiter struct {
+	n      int64
+	readyC chan uint8
+}
+
+// fifoSemaphore is a implementation of Semaphore interface which serves waiters in FIFO order,
+// so a large acquisition will not be starved by small ones.
+type fifoSemaphore struct {
+	size    int64
+	cur     int64
+	waiters list.List
+	mutex   sync.Mutex
+}
+
+// Acquire block invoker until n permits are available or ctx is done.
+func (s *fifoSemaphore) Acquire(ctx context.Context, n int64) error {
+	if n > s.size {
+		return SemaphoreOverflowError
+	}
+
+	s.mutex.Lock()
+	if s.size-s.cur >= n && s.waiters.Len() == 0 {
+		s.cur += n
+		s.mutex.Unlock()
+		return nil
+	}
+	waiter := semaphoreWaiter{n: n, readyC: make(chan uint8)}
+	element := s.waiters.PushBack(waiter)
+	s.mutex.Unlock()
+
+	select {
+	case <-waiter.readyC:
+		return nil
+	case <-ctx.Done():
+		s.mutex.Lock()
+		select {
+		case <-waiter.readyC:
+			// Acquired after ctx done, give back permits.
+			s.cur -= n
+			s.notifyWaiters()
+		default:
+			isFront := s.waiters.Front() == element
+			s.waiters.Remove(element)
+			if isFront {
+				s.notifyWaiters()
+			}
+		}
+		s.mutex.Unlock()
+		return ctx.Err()
+	}
+}
+
+// TryAcquire acquire n permits without blocking and returns true if success.
+func (s *fifoSemaphore) TryAcquire(n int64) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.size-s.cur >= n && s.waiters.Len() == 0 {
+		s.cur += n
+		return true
+	}
+	return false
+}
+
+// Release return n permits to semaphore.
+func (s *fifoSemaphore) Release(n int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.cur -= n
+	if s.cur < 0 {
+		s.cur = 0
+	}
+	s.notifyWaiters()
+}
+
+// notifyWaiters wake waiters in order while permits are enough.
+func (s *fifoSemaphore) notifyWaiters() {
+	for {
+		front := s.waiters.Front()
+		if front == nil {
+			return
+		}
+		waiter := front.Value.(semaphoreWaiter)
+		if s.size-s.cur < waiter.n {
+			return
+		}
+		s.cur += waiter.n
+		s.waiters.Remove(front)
+		close(waiter.readyC)
+	}
+}
+
+// NewSemaphore create a new Semaphore instance with specified number of permits.
+func NewSemaphore(size int64) Semaphore {
+	return &fifoSemaphore{size: size}
+}
@@ -0,0 +1,63 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package parallel_test
+
+import (
+	"context"
+	"github.com/mervinkid/matcha/parallel"
+	"testing"
+	"time"
+)
+
+func TestSemaphore(t *testing.T) {
+
+	semaphore := parallel.NewSemaphore(2)
+
+	if err := semaphore.Acquire(context.Background(), 2); err != nil {
+		t.Fatal(err)
+	}
+	if semaphore.TryAcquire(1) {
+		t.Fatal("expect try acquire fail while semaphore is exhausted")
+	}
+
+	// Acquire with timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := semaphore.Acquire(ctx, 1); err != context.DeadlineExceeded {
+		t.Fatal("expect deadline exceeded but got", err)
+	}
+
+	// Waiter wake up after release
+	acquiredC := make(chan error)
+	go func() {
+		acquiredC <- semaphore.Acquire(context.Background(), 2)
+	}()
+	semaphore.Release(2)
+	if err := <-acquiredC; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := semaphore.Acquire(context.Background(), 3); err != parallel.SemaphoreOverflowError {
+		t.Fatal("expect overflow error but got", err)
+	}
+}
@@ -0,0 +1,104 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package parallel
+
+import (
+	"fmt"
+	"sync"
+)
+
+// SingleFlight is the interface provide duplicate call suppression. Concurrent calls with the
+// same key will be collapsed into one in-flight execution and share its result.
+// Methods:
+//  Do execute fn and returns its result. If there is a call with the same key in flight, the
+//  invoker will wait for it and receive the same result. The shared result is true if the result
+//  was given to more than one invoker.
+//  Forget make next Do with specified key execute fn rather than waiting for the in-flight one.
+type SingleFlight interface {
+	Do(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool)
+	Forget(key string)
+}
+
+type flightCall struct {
+	waitGroup sync.WaitGroup
+	val       interface{}
+	err       error
+	dups      int
+}
+
+// hashSingleFlight is the default implementation of SingleFlight interface based on hash-table.
+type hashSingleFlight struct {
+	calls map[string]*flightCall
+	mutex sync.Mutex
+}
+
+func (g *hashSingleFlight) Do(key string, fn func() (interface{}, error)) (interface{}, error, bool) {
+	g.mutex.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	if call, ok := g.calls[key]; ok {
+		call.dups++
+		g.mutex.Unlock()
+		call.waitGroup.Wait()
+		return call.val, call.err, true
+	}
+	call := new(flightCall)
+	call.waitGroup.Add(1)
+	g.calls[key] = call
+	g.mutex.Unlock()
+
+	g.doCall(call, key, fn)
+
+	g.mutex.Lock()
+	shared := call.dups > 0
+	g.mutex.Unlock()
+	return call.val, call.err, shared
+}
+
+// doCall execute fn and release waiters. A panic in fn will be returned to all invokers as error.
+func (g *hashSingleFlight) doCall(call *flightCall, key string, fn func() (interface{}, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			call.err = fmt.Errorf("single flight call %s panic cause %v", key, r)
+		}
+		g.mutex.Lock()
+		if g.calls[key] == call {
+			delete(g.calls, key)
+		}
+		g.mutex.Unlock()
+		call.waitGroup.Done()
+	}()
+	call.val, call.err = fn()
+}
+
+func (g *hashSingleFlight) Forget(key string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	delete(g.calls, key)
+}
+
+// NewSingleFlight create a new SingleFlight instance.
+func NewSingleFlight() SingleFlight {
+	return &hashSingleFlight{}
+}
@@ -0,0 +1,132 @@
+package parallel_test
+
+import (
+	"errors"
+	"github.com/mervinkid/matcha/parallel"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// doConcurrently invoke Do of group with key and fn from count goroutines after the first call
+// started, and returns results of all invokers.
+func doConcurrently(group parallel.SingleFlight, count int, fn func() (interface{}, error),
+	startedC, releaseC chan uint8) ([]interface{}, []error, []bool) {
+
+	values := make([]interface{}, count)
+	errs := make([]error, count)
+	shares := make([]bool, count)
+	waitGroup := sync.WaitGroup{}
+	waitGroup.Add(count)
+	for i := 0; i < count; i++ {
+		go func(i int) {
+			defer waitGroup.Done()
+			values[i], errs[i], shares[i] = group.Do("key", fn)
+		}(i)
+		if i == 0 {
+			<-startedC
+		}
+	}
+	// Wait for duplicate calls to join.
+	time.Sleep(50 * time.Millisecond)
+	close(releaseC)
+	waitGroup.Wait()
+	return values, errs, shares
+}
+
+func TestSingleFlight_Do(t *testing.T) {
+
+	var calls int32
+	startedC, releaseC := make(chan uint8), make(chan uint8)
+	group := parallel.NewSingleFlight()
+	values, errs, shares := doConcurrently(group, 10, func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		close(startedC)
+		<-releaseC
+		return "value", nil
+	}, startedC, releaseC)
+	if calls != 1 {
+		t.Fatal("expect fn executed once but got", calls)
+	}
+	for i := range values {
+		if values[i] != "value" || errs[i] != nil || !shares[i] {
+			t.Fatal("unexpected result", values[i], errs[i], shares[i])
+		}
+	}
+
+	// Call after finished executes fn again without sharing.
+	if v, err, shared := group.Do("key", func() (interface{}, error) {
+		return "again", nil
+	}); v != "again" || err != nil || shared {
+		t.Fatal("unexpected result", v, err, shared)
+	}
+}
+
+func TestSingleFlight_Error(t *testing.T) {
+
+	callErr := errors.New("call failed")
+	startedC, releaseC := make(chan uint8), make(chan uint8)
+	_, errs, _ := doConcurrently(parallel.NewSingleFlight(), 5, func() (interface{}, error) {
+		close(startedC)
+		<-releaseC
+		return nil, callErr
+	}, startedC, releaseC)
+	for _, err := range errs {
+		if err != callErr {
+			t.Fatal("expect error of call for all waiters but got", err)
+		}
+	}
+}
+
+func TestSingleFlight_Panic(t *testing.T) {
+
+	startedC, releaseC := make(chan uint8), make(chan uint8)
+	group := parallel.NewSingleFlight()
+	values, errs, _ := doConcurrently(group, 5, func() (interface{}, error) {
+		close(startedC)
+		<-releaseC
+		panic("boom")
+	}, startedC, releaseC)
+	for i, err := range errs {
+		if values[i] != nil || err == nil || !strings.Contains(err.Error(), "boom") {
+			t.Fatal("expect panic returned as error to all waiters but got", err)
+		}
+	}
+
+	// Key is released after panic.
+	if v, err, _ := group.Do("key", func() (interface{}, error) {
+		return "value", nil
+	}); v != "value" || err != nil {
+		t.Fatal("unexpected result after panic", v, err)
+	}
+}
+
+func TestSingleFlight_Forget(t *testing.T) {
+
+	startedC, releaseC := make(chan uint8), make(chan uint8)
+	group := parallel.NewSingleFlight()
+	resultC := make(chan interface{}, 1)
+	go func() {
+		v, _, _ := group.Do("key", func() (interface{}, error) {
+			close(startedC)
+			<-releaseC
+			return "first", nil
+		})
+		resultC <- v
+	}()
+	<-startedC
+
+	// Call after forget executes fn rather than waiting for the in-flight one.
+	group.Forget("key")
+	if v, err, shared := group.Do("key", func() (interface{}, error) {
+		return "second", nil
+	}); v != "second" || err != nil || shared {
+		t.Fatal("unexpected result after forget", v, err, shared)
+	}
+	close(releaseC)
+	if v := <-resultC; v != "first" {
+		t.Fatal("unexpected result of in-flight call", v)
+	}
+}
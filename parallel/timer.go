@@ -0,0 +1,100 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package parallel
+
+import (
+	"github.com/mervinkid/matcha/logging"
+	"sync"
+	"time"
+)
+
+// CancelableGoroutine is the interface of Goroutine which can be cancelled before statement
+// execution.
+// Methods:
+//  Cancel stop pending and further executions of statement. A running execution will not be interrupted.
+type CancelableGoroutine interface {
+	Goroutine
+	Cancel()
+}
+
+type timerGoroutine struct {
+	Goroutine
+	cancelC    chan uint8
+	cancelOnce sync.Once
+}
+
+// Cancel stop pending and further executions of statement.
+func (g *timerGoroutine) Cancel() {
+	g.cancelOnce.Do(func() {
+		close(g.cancelC)
+	})
+}
+
+// After create a CancelableGoroutine which execute statement once after delay since started.
+//  +-------+   delay   +-----------+
+//  | Start | --------→ | statement |
+//  +-------+           +-----------+
+func After(delay time.Duration, statement func()) CancelableGoroutine {
+	goroutine := &timerGoroutine{cancelC: make(chan uint8)}
+	goroutine.Goroutine = NewNamedGoroutine("After-"+delay.String(), func() {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-goroutine.cancelC:
+		case <-timer.C:
+			if statement != nil {
+				statement()
+			}
+		}
+	})
+	return goroutine
+}
+
+// Every create a CancelableGoroutine which execute statement repeatedly with interval since started
+// until cancelled. Ticks will be dropped while statement execution takes longer than interval.
+// Statement will never be executed if interval is not positive.
+//  +-------+ interval +-----------+ interval +-----------+
+//  | Start | -------→ | statement | -------→ | statement | ...
+//  +-------+          +-----------+          +-----------+
+func Every(interval time.Duration, statement func()) CancelableGoroutine {
+	goroutine := &timerGoroutine{cancelC: make(chan uint8)}
+	goroutine.Goroutine = NewNamedGoroutine("Every-"+interval.String(), func() {
+		if interval <= 0 {
+			logging.Warn("Every skip statement cause interval %s is not positive.", interval.String())
+			return
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-goroutine.cancelC:
+				return
+			case <-ticker.C:
+				if statement != nil {
+					statement()
+				}
+			}
+		}
+	})
+	return goroutine
+}
@@ -0,0 +1,68 @@
+package parallel_test
+
+import (
+	"github.com/mervinkid/matcha/parallel"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAfter(t *testing.T) {
+
+	firedC := make(chan time.Time, 1)
+	start := time.Now()
+	goroutine := parallel.After(20*time.Millisecond, func() {
+		firedC <- time.Now()
+	})
+	goroutine.Start()
+	if !goroutine.JoinTimeout(time.Second) {
+		t.Fatal("expect goroutine finished after delay")
+	}
+	if fired := <-firedC; fired.Sub(start) < 20*time.Millisecond {
+		t.Fatal("expect statement executed after delay")
+	}
+
+	// Cancelled before delay
+	var runs int32
+	goroutine = parallel.After(50*time.Millisecond, func() {
+		atomic.AddInt32(&runs, 1)
+	})
+	goroutine.Start()
+	goroutine.Cancel()
+	if !goroutine.JoinTimeout(time.Second) || atomic.LoadInt32(&runs) != 0 {
+		t.Fatal("expect goroutine finished without execution after cancelled")
+	}
+}
+
+func TestEvery(t *testing.T) {
+
+	var runs int32
+	goroutine := parallel.Every(10*time.Millisecond, func() {
+		atomic.AddInt32(&runs, 1)
+	})
+	goroutine.Start()
+	time.Sleep(55 * time.Millisecond)
+	goroutine.Cancel()
+	if !goroutine.JoinTimeout(time.Second) {
+		t.Fatal("expect goroutine finished after cancelled")
+	}
+	cancelled := atomic.LoadInt32(&runs)
+	if cancelled < 2 {
+		t.Fatal("expect repeated executions but got", cancelled)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if atomic.LoadInt32(&runs) != cancelled {
+		t.Fatal("expect no execution after cancelled")
+	}
+
+	// Non-positive interval
+	for _, interval := range []time.Duration{0, -time.Second} {
+		goroutine := parallel.Every(interval, func() {
+			atomic.AddInt32(&runs, 1)
+		})
+		goroutine.Start()
+		if !goroutine.JoinTimeout(time.Second) || atomic.LoadInt32(&runs) != cancelled {
+			t.Fatal("expect no execution with interval", interval)
+		}
+	}
+}
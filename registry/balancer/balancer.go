@@ -0,0 +1,69 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package balancer
+
+import (
+	"errors"
+	"github.com/mervinkid/matcha/registry"
+)
+
+var ErrNoInstance = errors.New("no available instance")
+
+// Instance is the target of outbound routing discovered by registry. Weight less than 1 will be
+// taken as 1.
+type Instance struct {
+	Id     string
+	Weight int
+}
+
+// Balancer is the interface of client-side load balancer which select instance for outbound routing.
+// Methods:
+//  Update replace instances of balancer with latest discovered ones.
+//  Select returns an instance for specified key, or ErrNoInstance if there is no instance. Key is
+//  only used by consistent-hash balancer.
+//
+// Model:
+//  +----------+  Update  +----------+  Select  +------------+
+//  | Registry | → → → →  | Balancer | → → → →  | ClientPool |
+//  +----------+  (Nodes) +----------+          +------------+
+type Balancer interface {
+	Update(instances []Instance)
+	Select(key string) (Instance, error)
+}
+
+// FromNodes returns instances with weight 1 for nodes discovered by registry.
+func FromNodes(nodes []registry.NodeInfo) []Instance {
+	instances := make([]Instance, len(nodes))
+	for i, node := range nodes {
+		instances[i] = Instance{Id: node.Id, Weight: 1}
+	}
+	return instances
+}
+
+// weightOf returns weight of instance which is at least 1.
+func weightOf(instance Instance) int {
+	if instance.Weight < 1 {
+		return 1
+	}
+	return instance.Weight
+}
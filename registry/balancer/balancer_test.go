@@ -0,0 +1,93 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package balancer_test
+
+import (
+	"github.com/mervinkid/matcha/registry/balancer"
+	"strconv"
+	"testing"
+)
+
+func TestRoundRobin(t *testing.T) {
+	b := balancer.NewRoundRobin()
+	if _, err := b.Select(""); err != balancer.ErrNoInstance {
+		t.Fatal("expect no instance but got", err)
+	}
+	b.Update([]balancer.Instance{{Id: "a"}, {Id: "b"}, {Id: "c"}})
+	for i, expect := range []string{"a", "b", "c", "a"} {
+		if instance, _ := b.Select(""); instance.Id != expect {
+			t.Fatal("unexpected instance at", i, instance.Id)
+		}
+	}
+}
+
+func TestWeighted(t *testing.T) {
+	b := balancer.NewWeighted()
+	b.Update([]balancer.Instance{{Id: "a", Weight: 5}, {Id: "b", Weight: 1}, {Id: "c", Weight: 1}})
+	counts := make(map[string]int)
+	sequence := ""
+	for i := 0; i < 7; i++ {
+		instance, err := b.Select("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[instance.Id]++
+		sequence += instance.Id
+	}
+	if counts["a"] != 5 || counts["b"] != 1 || counts["c"] != 1 {
+		t.Fatal("unexpected counts", counts)
+	}
+	// Smooth weighted round-robin interleave instances
+	if sequence != "aabacaa" {
+		t.Fatal("unexpected sequence", sequence)
+	}
+}
+
+func TestConsistentHash(t *testing.T) {
+	b := balancer.NewConsistentHash(0)
+	b.Update([]balancer.Instance{{Id: "a"}, {Id: "b"}, {Id: "c"}})
+	routes := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		key := "key-" + strconv.Itoa(i)
+		instance, err := b.Select(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again, _ := b.Select(key); again.Id != instance.Id {
+			t.Fatal("expect the same instance for key", key)
+		}
+		routes[key] = instance.Id
+	}
+
+	// Only keys of removed instance are remapped
+	b.Update([]balancer.Instance{{Id: "a"}, {Id: "b"}})
+	for key, id := range routes {
+		instance, _ := b.Select(key)
+		if id != "c" && instance.Id != id {
+			t.Fatal("unexpected remap of key", key)
+		}
+		if instance.Id == "c" {
+			t.Fatal("unexpected removed instance for key", key)
+		}
+	}
+}
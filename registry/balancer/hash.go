@@ -0,0 +1,91 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package balancer
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+const defaultHashReplicas = 160
+
+// hashBalancer is the implementation of Balancer interface based on consistent-hash. Each instance
+// is placed on the hash ring with replicas virtual points multiplied by its weight, and key is routed
+// to the first point clockwise. Only keys of changed instances will be remapped after update.
+//        point(a#0)
+//       ↗         ↘
+//  point(c#1)   point(b#0) ← hash(key)
+//       ↖         ↙
+//        point(a#1)
+type hashBalancer struct {
+	replicas  int
+	points    []uint32
+	instances map[uint32]Instance
+	mutex     sync.RWMutex
+}
+
+func (b *hashBalancer) Update(instances []Instance) {
+	points := make([]uint32, 0)
+	pointInstances := make(map[uint32]Instance)
+	for _, instance := range instances {
+		for i := 0; i < b.replicas*weightOf(instance); i++ {
+			point := crc32.ChecksumIEEE([]byte(instance.Id + "#" + strconv.Itoa(i)))
+			if _, exists := pointInstances[point]; exists {
+				continue
+			}
+			points = append(points, point)
+			pointInstances[point] = instance
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i] < points[j] })
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.points = points
+	b.instances = pointInstances
+}
+
+func (b *hashBalancer) Select(key string) (Instance, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	if len(b.points) == 0 {
+		return Instance{}, ErrNoInstance
+	}
+	hash := crc32.ChecksumIEEE([]byte(key))
+	index := sort.Search(len(b.points), func(i int) bool { return b.points[i] >= hash })
+	if index == len(b.points) {
+		index = 0
+	}
+	return b.instances[b.points[index]], nil
+}
+
+// NewConsistentHash create a new Balancer instance which route the same key to the same instance
+// with specified number of virtual points per weight. Default is 160 if replicas is not positive.
+func NewConsistentHash(replicas int) Balancer {
+	if replicas <= 0 {
+		replicas = defaultHashReplicas
+	}
+	return &hashBalancer{replicas: replicas}
+}
@@ -0,0 +1,186 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package balancer
+
+import (
+	"errors"
+	"github.com/mervinkid/matcha/misc"
+	"github.com/mervinkid/matcha/net/tcp"
+	"github.com/mervinkid/matcha/parallel"
+	"sync"
+)
+
+var ErrPoolNotRunning = errors.New("client pool is not running")
+
+// ClientPool is the interface of tcp client pool which route outbound messages to instances
+// selected by Balancer.
+// Methods:
+//  Update replace instances with latest discovered ones. Clients of removed instances will be stopped.
+//  Send data synchronized to instance selected for key.
+//  SendFuture send data async to instance selected for key, the callback method will be invoked
+//  after data has been handled.
+// Clients are created by factory and connected lazily on first routing to their instances, and
+// will be reconnected while routed again after disconnected.
+type ClientPool interface {
+	misc.Lifecycle
+	Update(instances []Instance)
+	Send(key string, data interface{}) error
+	SendFuture(key string, data interface{}, callback func(err error))
+}
+
+// balancedClientPool is the default implementation of ClientPool interface.
+type balancedClientPool struct {
+	// Props
+	balancer Balancer
+	factory  func(instance Instance) tcp.Client
+	// Runtime
+	clients map[string]tcp.Client
+	known   map[string]bool
+	connect parallel.SingleFlight
+	// State
+	running    bool
+	stateMutex sync.RWMutex
+}
+
+func (p *balancedClientPool) Start() error {
+	p.stateMutex.Lock()
+	defer p.stateMutex.Unlock()
+	p.running = true
+	return nil
+}
+
+func (p *balancedClientPool) Stop() {
+	p.stateMutex.Lock()
+	clients := p.clients
+	p.clients = make(map[string]tcp.Client)
+	p.running = false
+	p.stateMutex.Unlock()
+
+	for _, client := range clients {
+		misc.LifecycleStop(client)
+	}
+}
+
+func (p *balancedClientPool) IsRunning() bool {
+	p.stateMutex.RLock()
+	defer p.stateMutex.RUnlock()
+	return p.running
+}
+
+func (p *balancedClientPool) Update(instances []Instance) {
+	p.balancer.Update(instances)
+
+	known := make(map[string]bool)
+	for _, instance := range instances {
+		known[instance.Id] = true
+	}
+	removed := make([]tcp.Client, 0)
+	p.stateMutex.Lock()
+	p.known = known
+	for id, client := range p.clients {
+		if !known[id] {
+			removed = append(removed, client)
+			delete(p.clients, id)
+		}
+	}
+	p.stateMutex.Unlock()
+
+	for _, client := range removed {
+		misc.LifecycleStop(client)
+	}
+}
+
+func (p *balancedClientPool) Send(key string, data interface{}) error {
+	client, err := p.route(key)
+	if err != nil {
+		return err
+	}
+	return client.Send(data)
+}
+
+func (p *balancedClientPool) SendFuture(key string, data interface{}, callback func(err error)) {
+	client, err := p.route(key)
+	if err != nil {
+		if callback != nil {
+			callback(err)
+		}
+		return
+	}
+	client.SendFuture(data, callback)
+}
+
+// route returns running client of instance selected for key. Concurrent connecting to the same
+// instance will be collapsed into one.
+func (p *balancedClientPool) route(key string) (tcp.Client, error) {
+	instance, err := p.balancer.Select(key)
+	if err != nil {
+		return nil, err
+	}
+
+	p.stateMutex.RLock()
+	running := p.running
+	client := p.clients[instance.Id]
+	p.stateMutex.RUnlock()
+	if !running {
+		return nil, ErrPoolNotRunning
+	}
+	if client != nil && client.IsRunning() {
+		return client, nil
+	}
+
+	connected, err, _ := p.connect.Do(instance.Id, func() (interface{}, error) {
+		client := p.factory(instance)
+		if err := client.Start(); err != nil {
+			return nil, err
+		}
+		p.stateMutex.Lock()
+		if !p.running || !p.known[instance.Id] {
+			// Pool stopped or instance removed while connecting.
+			p.stateMutex.Unlock()
+			misc.LifecycleStop(client)
+			return nil, ErrNoInstance
+		}
+		if previous := p.clients[instance.Id]; previous != nil {
+			misc.LifecycleStop(previous)
+		}
+		p.clients[instance.Id] = client
+		p.stateMutex.Unlock()
+		return client, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return connected.(tcp.Client), nil
+}
+
+// NewClientPool create a new ClientPool instance which route messages with specified balancer and
+// create client of instance with specified factory.
+func NewClientPool(balancer Balancer, factory func(instance Instance) tcp.Client) ClientPool {
+	return &balancedClientPool{
+		balancer: balancer,
+		factory:  factory,
+		clients:  make(map[string]tcp.Client),
+		known:    make(map[string]bool),
+		connect:  parallel.NewSingleFlight(),
+	}
+}
@@ -0,0 +1,57 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package balancer
+
+import (
+	"sync"
+)
+
+// roundRobinBalancer is the implementation of Balancer interface which select instances in turn.
+type roundRobinBalancer struct {
+	instances []Instance
+	next      int
+	mutex     sync.Mutex
+}
+
+func (b *roundRobinBalancer) Update(instances []Instance) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.instances = append([]Instance(nil), instances...)
+	b.next = 0
+}
+
+func (b *roundRobinBalancer) Select(key string) (Instance, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if len(b.instances) == 0 {
+		return Instance{}, ErrNoInstance
+	}
+	instance := b.instances[b.next%len(b.instances)]
+	b.next = (b.next + 1) % len(b.instances)
+	return instance, nil
+}
+
+// NewRoundRobin create a new Balancer instance which select instances in turn.
+func NewRoundRobin() Balancer {
+	return &roundRobinBalancer{}
+}
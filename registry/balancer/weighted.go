@@ -0,0 +1,70 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package balancer
+
+import (
+	"sync"
+)
+
+// weightedBalancer is the implementation of Balancer interface based on smooth weighted round-robin.
+// Each instance gains its weight on every selection and the one with max current weight is selected
+// then loses total weight, so instances with higher weight are selected more often but interleaved.
+type weightedBalancer struct {
+	instances []Instance
+	current   []int
+	total     int
+	mutex     sync.Mutex
+}
+
+func (b *weightedBalancer) Update(instances []Instance) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.instances = append([]Instance(nil), instances...)
+	b.current = make([]int, len(instances))
+	b.total = 0
+	for _, instance := range instances {
+		b.total += weightOf(instance)
+	}
+}
+
+func (b *weightedBalancer) Select(key string) (Instance, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if len(b.instances) == 0 {
+		return Instance{}, ErrNoInstance
+	}
+	selected := 0
+	for i, instance := range b.instances {
+		b.current[i] += weightOf(instance)
+		if b.current[i] > b.current[selected] {
+			selected = i
+		}
+	}
+	b.current[selected] -= b.total
+	return b.instances[selected], nil
+}
+
+// NewWeighted create a new Balancer instance which select instances in proportion to their weight.
+func NewWeighted() Balancer {
+	return &weightedBalancer{}
+}
@@ -0,0 +1,108 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package registry
+
+import (
+	"github.com/mervinkid/matcha/logging"
+	"github.com/mervinkid/matcha/parallel"
+	"strconv"
+	"sync"
+)
+
+// SubscriptionId identifies a subscriber of election events.
+type SubscriptionId uint64
+
+type electionNotice struct {
+	event    ElectionEvent
+	masterId string
+}
+
+type subscription struct {
+	handler func(event ElectionEvent, masterId string)
+	noticeC chan electionNotice
+}
+
+// deliver invoke handler with buffered notices in order until subscription is cancelled.
+func (s *subscription) deliver() {
+	for notice := range s.noticeC {
+		s.handler(notice.event, notice.masterId)
+	}
+}
+
+// eventBus dispatch election events to subscribers independently. Each subscriber has its own
+// buffer and delivery goroutine, so a slow subscriber will not block election or other subscribers.
+// Events will be dropped for subscribers whose buffer is full. Subscriptions outlive restart of
+// registry until unsubscribed.
+//                +----------+     +--------+
+//                |          | → → | buffer | → → handler 1
+//  publish → → → | eventBus |     |  ...   |
+//                |          | → → | buffer | → → handler N
+//                +----------+     +--------+
+type eventBus struct {
+	subscriptions map[SubscriptionId]*subscription
+	lastId        SubscriptionId
+	mutex         sync.Mutex
+}
+
+// subscribe register handler and returns id of the subscription. Returns 0 if handler is nil.
+func (b *eventBus) subscribe(handler func(event ElectionEvent, masterId string)) SubscriptionId {
+	if handler == nil {
+		return 0
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.subscriptions == nil {
+		b.subscriptions = make(map[SubscriptionId]*subscription)
+	}
+	b.lastId++
+	s := &subscription{handler: handler, noticeC: make(chan electionNotice, watchBufferSize)}
+	b.subscriptions[b.lastId] = s
+	parallel.NewGoroutineWithConfig(s.deliver, parallel.GoroutineConfig{
+		Name:    "ElectionSubscriber-" + strconv.FormatUint(uint64(b.lastId), 10),
+		Restart: parallel.RestartAlways,
+	}).Start()
+	return b.lastId
+}
+
+// unsubscribe cancel subscription with specified id. Buffered events will still be delivered.
+func (b *eventBus) unsubscribe(id SubscriptionId) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if s, ok := b.subscriptions[id]; ok {
+		delete(b.subscriptions, id)
+		close(s.noticeC)
+	}
+}
+
+// publish send election event to all subscribers.
+func (b *eventBus) publish(event ElectionEvent, masterId string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for id, s := range b.subscriptions {
+		select {
+		case s.noticeC <- electionNotice{event: event, masterId: masterId}:
+		default:
+			logging.Warn("Drop election event for subscription %d cause buffer is full.", id)
+		}
+	}
+}
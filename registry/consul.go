@@ -0,0 +1,497 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/mervinkid/matcha/logging"
+	"github.com/mervinkid/matcha/misc"
+	"github.com/mervinkid/matcha/task"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	consulTtl              = 10 * time.Second
+	consulLockDelay        = time.Second
+	consulDeregisterAfter  = "1m"
+	consulElectionDelay    = 2 * time.Second
+	consulRequestTimeout   = 3 * time.Second
+	consulSessionNotExists = http.StatusNotFound
+)
+
+// consulClient is a minimal client of Consul HTTP API.
+type consulClient struct {
+	endpoint   string
+	httpClient *http.Client
+}
+
+type consulServiceCheck struct {
+	TTL                            string `json:"TTL"`
+	DeregisterCriticalServiceAfter string `json:"DeregisterCriticalServiceAfter"`
+}
+
+type consulService struct {
+	ID    string             `json:"ID"`
+	Name  string             `json:"Name"`
+	Check consulServiceCheck `json:"Check"`
+}
+
+type consulSession struct {
+	ID        string   `json:"ID,omitempty"`
+	Name      string   `json:"Name,omitempty"`
+	TTL       string   `json:"TTL,omitempty"`
+	Behavior  string   `json:"Behavior,omitempty"`
+	LockDelay string   `json:"LockDelay,omitempty"`
+	Checks    []string `json:"Checks,omitempty"`
+}
+
+type consulKeyValue struct {
+	Key       string `json:"Key"`
+	Value     []byte `json:"Value"`
+	Session   string `json:"Session"`
+	LockIndex uint64 `json:"LockIndex"`
+}
+
+// consulStatusError is the error of request which Consul responded with unexpected status.
+type consulStatusError struct {
+	path    string
+	status  int
+	message string
+}
+
+func (e *consulStatusError) Error() string {
+	return fmt.Sprintf("consul %s fail with status %d: %s", e.path, e.status, e.message)
+}
+
+// call send request with specified method and path, and decode JSON response if response is not nil.
+// The body will be sent as raw bytes if it is a []byte or encoded as JSON otherwise.
+func (c *consulClient) call(method, path string, body interface{}, response interface{}) error {
+	var reader io.Reader
+	switch value := body.(type) {
+	case nil:
+	case []byte:
+		reader = bytes.NewReader(value)
+	default:
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	request, err := http.NewRequest(method, c.endpoint+path, reader)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return &consulStatusError{path: path, status: resp.StatusCode, message: string(message)}
+	}
+	if response == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
+
+// registerService register service into agent with a TTL health check.
+func (c *consulClient) registerService(id, name string, ttl time.Duration) error {
+	service := consulService{
+		ID:   id,
+		Name: name,
+		Check: consulServiceCheck{
+			TTL:                            ttl.String(),
+			DeregisterCriticalServiceAfter: consulDeregisterAfter,
+		},
+	}
+	return c.call(http.MethodPut, "/v1/agent/service/register", service, nil)
+}
+
+// passService mark TTL health check of specified service as passing.
+func (c *consulClient) passService(id string) error {
+	return c.call(http.MethodPut, "/v1/agent/check/pass/service:"+id, nil, nil)
+}
+
+func (c *consulClient) deregisterService(id string) error {
+	return c.call(http.MethodPut, "/v1/agent/service/deregister/"+id, nil, nil)
+}
+
+// passingServices returns id of service instances with specified name which pass health checks.
+func (c *consulClient) passingServices(name string) ([]string, error) {
+	var entries []struct {
+		Service consulService `json:"Service"`
+	}
+	if err := c.call(http.MethodGet, "/v1/health/service/"+name+"?passing", nil, &entries); err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.Service.ID
+	}
+	return ids, nil
+}
+
+// createSession create a session bound to health check of specified service and returns its id.
+// The lock released by invalidated session can not be acquired by others within lock delay.
+func (c *consulClient) createSession(name, serviceId string, ttl, lockDelay time.Duration) (string, error) {
+	session := consulSession{
+		Name:      name,
+		TTL:       ttl.String(),
+		Behavior:  "release",
+		LockDelay: lockDelay.String(),
+		Checks:    []string{"serfHealth", "service:" + serviceId},
+	}
+	var response consulSession
+	if err := c.call(http.MethodPut, "/v1/session/create", session, &response); err != nil {
+		return "", err
+	}
+	return response.ID, nil
+}
+
+// renewSession renew specified session and returns false if it has been invalidated.
+func (c *consulClient) renewSession(id string) (bool, error) {
+	err := c.call(http.MethodPut, "/v1/session/renew/"+id, nil, nil)
+	if statusErr, ok := err.(*consulStatusError); ok && statusErr.status == consulSessionNotExists {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (c *consulClient) destroySession(id string) error {
+	return c.call(http.MethodPut, "/v1/session/destroy/"+id, nil, nil)
+}
+
+// acquire try to lock key with specified session and returns true if lock acquired.
+func (c *consulClient) acquire(key, value, session string) (bool, error) {
+	var acquired bool
+	err := c.call(http.MethodPut, "/v1/kv/"+key+"?acquire="+session, []byte(value), &acquired)
+	return acquired, err
+}
+
+// release unlock key held by specified session.
+func (c *consulClient) release(key, session string) error {
+	return c.call(http.MethodPut, "/v1/kv/"+key+"?release="+session, nil, nil)
+}
+
+// holder returns value and lock index of key if it is locked by any session. Lock index increases
+// monotonically for each acquisition by a new session.
+func (c *consulClient) holder(key string) (string, uint64, error) {
+	var kvs []consulKeyValue
+	err := c.call(http.MethodGet, "/v1/kv/"+key, nil, &kvs)
+	if statusErr, ok := err.(*consulStatusError); ok && statusErr.status == http.StatusNotFound {
+		return unknownNodeId, 0, nil
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	if len(kvs) == 0 || kvs[0].Session == "" {
+		return unknownNodeId, 0, nil
+	}
+	return string(kvs[0].Value), kvs[0].LockIndex, nil
+}
+
+// consulRegistry is the implementation of Registry interface based on Consul. Local node is
+// registered as a service instance with TTL health check, and master is elected by locking
+// election key with a session bound to the health check.
+//  +-----------------+     +---------+     +------------------------+
+//  | service (check) | ← ← | session | → → | kv: app/election(lock) |
+//  +-----------------+     +---------+     +------------------------+
+type consulRegistry struct {
+	// Props
+	config Config
+	client *consulClient
+	// Runtime
+	role              roleState
+	watch             watchHub
+	backend           backendState
+	sessionId         string
+	ttl               time.Duration
+	interval          time.Duration
+	takeover          takeoverGuard
+	electionScheduler task.Scheduler
+	// State
+	running    bool
+	stateMutex sync.RWMutex
+	waitGroup  sync.WaitGroup
+}
+
+func (r *consulRegistry) String() string {
+	return "consul-registry-" + r.config.AppId
+}
+
+func (r *consulRegistry) Type() string {
+	return "consul"
+}
+
+func (r *consulRegistry) Start() error {
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+	if !r.running {
+		if r.config.NodeId == "" {
+			r.config.NodeId = generateNodeId(r.config.AppId)
+		}
+		ttl, interval := electionTiming(r.config, consulTtl, consulElectionDelay)
+		// Observer does not register itself
+		if !r.config.Observer {
+			if err := r.client.registerService(r.config.NodeId, r.config.AppId, ttl); err != nil {
+				return err
+			}
+		}
+		electionScheduler := task.NewFixedDelayScheduler(r.electionTask, interval)
+		if err := misc.LifecycleStart(electionScheduler); err != nil {
+			r.client.deregisterService(r.config.NodeId)
+			return err
+		}
+		r.ttl, r.interval = ttl, interval
+		r.backend.reset(interval)
+		r.electionScheduler = electionScheduler
+		r.running = true
+		r.waitGroup.Add(1)
+	}
+	return nil
+}
+
+func (r *consulRegistry) Stop() {
+	defer r.watch.flushCallbacks()
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+	if r.running {
+		misc.LifecycleStop(r.electionScheduler)
+		r.electionScheduler = nil
+		if r.sessionId != "" {
+			// Destroy session to release election lock immediately.
+			if err := r.client.destroySession(r.sessionId); err != nil {
+				logging.Warn("Destroy consul session fail cause %s.", err.Error())
+			}
+			r.sessionId = ""
+		}
+		if !r.config.Observer {
+			if err := r.client.deregisterService(r.config.NodeId); err != nil {
+				logging.Warn("Deregister consul service fail cause %s.", err.Error())
+			}
+		}
+		r.changeRole(Slaver, unknownNodeId)
+		r.watch.close()
+		r.running = false
+		r.waitGroup.Done()
+	}
+}
+
+func (r *consulRegistry) IsRunning() bool {
+	r.stateMutex.RLock()
+	defer r.stateMutex.RUnlock()
+	return r.running
+}
+
+func (r *consulRegistry) Sync() {
+	r.waitGroup.Wait()
+}
+
+func (r *consulRegistry) IsMaster() bool {
+	return r.role.isMaster()
+}
+
+func (r *consulRegistry) Master() (string, bool) {
+	return r.role.master()
+}
+
+func (r *consulRegistry) FencingToken() (uint64, bool) {
+	return r.role.fencingToken()
+}
+
+func (r *consulRegistry) Nodes() []NodeInfo {
+	return nodeInfos(&r.role, &r.watch)
+}
+
+func (r *consulRegistry) Healthy() bool {
+	return r.backend.healthy()
+}
+
+func (r *consulRegistry) WatchRole() <-chan RoleChange {
+	return r.watch.watchRole()
+}
+
+func (r *consulRegistry) WatchMembers() <-chan MemberChange {
+	return r.watch.watchMembers()
+}
+
+func (r *consulRegistry) Subscribe(handler func(event ElectionEvent, masterId string)) SubscriptionId {
+	return r.watch.events.subscribe(handler)
+}
+
+func (r *consulRegistry) Unsubscribe(id SubscriptionId) {
+	r.watch.events.unsubscribe(id)
+}
+
+func (r *consulRegistry) NotifyLeadership(notify func()) func() {
+	return r.watch.notifyLeadership(notify)
+}
+
+func (r *consulRegistry) Resign() error {
+	defer r.watch.flushCallbacks()
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+	if !r.running || !r.IsMaster() || r.sessionId == "" {
+		return nil
+	}
+	if err := r.client.release(r.electionKey(), r.sessionId); err != nil {
+		return err
+	}
+	r.takeover.resign(r.ttl)
+	r.changeRole(Slaver, unknownNodeId)
+	return nil
+}
+
+func (r *consulRegistry) electionKey() string {
+	return fmt.Sprintf("%s/election", r.config.AppId)
+}
+
+// checkSession keep service healthy and session alive, or create a new session.
+func (r *consulRegistry) checkSession() error {
+	if err := r.client.passService(r.config.NodeId); err != nil {
+		// Service may be removed by agent restart, register it again.
+		if err := r.client.registerService(r.config.NodeId, r.config.AppId, r.ttl); err != nil {
+			return err
+		}
+		if err := r.client.passService(r.config.NodeId); err != nil {
+			return err
+		}
+	}
+	if r.sessionId != "" {
+		alive, err := r.client.renewSession(r.sessionId)
+		if err != nil {
+			return err
+		}
+		if alive {
+			return nil
+		}
+		r.sessionId = ""
+	}
+	// Takeover grace is implemented with lock delay of session
+	lockDelay := r.config.TakeoverGrace
+	if lockDelay <= 0 {
+		lockDelay = consulLockDelay
+	}
+	sessionId, err := r.client.createSession(r.String(), r.config.NodeId, r.ttl, lockDelay)
+	if err != nil {
+		return err
+	}
+	r.sessionId = sessionId
+	return nil
+}
+
+func (r *consulRegistry) electionTask() {
+	defer r.watch.flushCallbacks()
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+	if !r.running {
+		return
+	}
+	// Back off checks while backend keeps failing, master keeps renewing to hold its role
+	if backoffGuard(&r.role, &r.backend, r.degradeRole) {
+		return
+	}
+
+	// Observer has no session, connectivity is checked by refreshing members
+	if !r.config.Observer {
+		if err := r.checkSession(); err != nil {
+			logging.Error("Check session with consul fail cause %s.", err.Error())
+			r.backend.fail(r.config, &r.watch, err)
+			r.degradeRole()
+			return
+		}
+	}
+	if nodeIds, err := r.client.passingServices(r.config.AppId); err == nil {
+		r.watch.updateMembers(nodeIds)
+	} else if r.config.Observer {
+		logging.Error("Refresh members with consul fail cause %s.", err.Error())
+		r.backend.fail(r.config, &r.watch, err)
+		r.degradeRole()
+		return
+	} else {
+		logging.Warn("Refresh members with consul fail cause %s.", err.Error())
+	}
+	r.backend.ok(r.config, &r.watch)
+	// Skip acquiring lock in resign hold-off, observer never acquires
+	var acquired bool
+	var err error
+	if !r.config.Observer && (r.IsMaster() || !r.takeover.resigned()) {
+		acquired, err = r.client.acquire(r.electionKey(), r.config.NodeId, r.sessionId)
+	}
+	if err != nil {
+		logging.Error("Acquire lock with consul fail cause %s.", err.Error())
+		notifyElectionError(r.config, &r.watch, err)
+		r.degradeRole()
+		return
+	}
+	if acquired && r.IsMaster() {
+		r.changeRole(Master, r.config.NodeId)
+		return
+	}
+	master, token, err := r.client.holder(r.electionKey())
+	if acquired {
+		// Take lead with lock index as fencing token
+		if err != nil {
+			logging.Error("Get lock index from consul fail cause %s.", err.Error())
+			notifyElectionError(r.config, &r.watch, err)
+			return
+		}
+		r.role.setToken(token)
+		r.changeRole(Master, r.config.NodeId)
+		return
+	}
+	if err != nil {
+		logging.Error("Get lock holder from consul fail cause %s.", err.Error())
+		notifyElectionError(r.config, &r.watch, err)
+		master = unknownNodeId
+	}
+	r.changeRole(Slaver, master)
+}
+
+func (r *consulRegistry) changeRole(newRole Role, newMaster string) {
+	updateRole(r.config, &r.role, &r.watch, newRole, newMaster)
+}
+
+// degradeRole demote local node on backend failure unless role was confirmed within ttl.
+func (r *consulRegistry) degradeRole() {
+	degradeRole(r.config, &r.role, &r.watch, r.ttl-r.interval)
+}
+
+func newConsulRegistry(config Config) *consulRegistry {
+	return &consulRegistry{
+		config: config,
+		client: &consulClient{
+			endpoint:   "http://" + config.Url.Address(),
+			httpClient: &http.Client{Timeout: consulRequestTimeout},
+		},
+	}
+}
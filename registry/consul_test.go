@@ -0,0 +1,276 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package registry
+
+import (
+	"encoding/json"
+	"github.com/mervinkid/matcha/util"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeConsul is a fake Consul agent which keeps services, sessions and keys in memory. Requests
+// fail with status 503 while it is down.
+type fakeConsul struct {
+	server      *httptest.Server
+	services    map[string]string
+	passing     map[string]bool
+	sessions    map[string]bool
+	kvs         map[string]consulKeyValue
+	lastSession int
+	renewals    int
+	down        bool
+	mutex       sync.Mutex
+}
+
+func newFakeConsul() *fakeConsul {
+	c := &fakeConsul{
+		services: make(map[string]string),
+		passing:  make(map[string]bool),
+		sessions: make(map[string]bool),
+		kvs:      make(map[string]consulKeyValue),
+	}
+	c.server = httptest.NewServer(http.HandlerFunc(c.serve))
+	return c
+}
+
+func (c *fakeConsul) setDown(down bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.down = down
+}
+
+func (c *fakeConsul) holder(key string) string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if kv := c.kvs[key]; kv.Session != "" {
+		return string(kv.Value)
+	}
+	return ""
+}
+
+func (c *fakeConsul) renewCount() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.renewals
+}
+
+func (c *fakeConsul) serve(w http.ResponseWriter, r *http.Request) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.down {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	var response interface{}
+	switch path := r.URL.Path; {
+	case path == "/v1/agent/service/register":
+		var service consulService
+		json.NewDecoder(r.Body).Decode(&service)
+		c.services[service.ID] = service.Name
+	case strings.HasPrefix(path, "/v1/agent/service/deregister/"):
+		id := strings.TrimPrefix(path, "/v1/agent/service/deregister/")
+		delete(c.services, id)
+		delete(c.passing, id)
+	case strings.HasPrefix(path, "/v1/agent/check/pass/service:"):
+		id := strings.TrimPrefix(path, "/v1/agent/check/pass/service:")
+		if _, ok := c.services[id]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		c.passing[id] = true
+	case strings.HasPrefix(path, "/v1/health/service/"):
+		name := strings.TrimPrefix(path, "/v1/health/service/")
+		var entries []map[string]consulService
+		for id, serviceName := range c.services {
+			if serviceName == name && c.passing[id] {
+				entries = append(entries, map[string]consulService{"Service": {ID: id, Name: name}})
+			}
+		}
+		response = entries
+	case path == "/v1/session/create":
+		c.lastSession++
+		id := "session-" + strconv.Itoa(c.lastSession)
+		c.sessions[id] = true
+		response = consulSession{ID: id}
+	case strings.HasPrefix(path, "/v1/session/renew/"):
+		if !c.sessions[strings.TrimPrefix(path, "/v1/session/renew/")] {
+			w.WriteHeader(consulSessionNotExists)
+			return
+		}
+		c.renewals++
+	case strings.HasPrefix(path, "/v1/session/destroy/"):
+		id := strings.TrimPrefix(path, "/v1/session/destroy/")
+		delete(c.sessions, id)
+		for key, kv := range c.kvs {
+			if kv.Session == id {
+				kv.Session = ""
+				c.kvs[key] = kv
+			}
+		}
+	case strings.HasPrefix(path, "/v1/kv/"):
+		key := strings.TrimPrefix(path, "/v1/kv/")
+		if r.Method == http.MethodGet {
+			kv, ok := c.kvs[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			response = []consulKeyValue{kv}
+			break
+		}
+		response = c.lock(key, r)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// lock acquire or release key with session in query like Consul, lock index increases for each
+// acquisition by a new session.
+func (c *fakeConsul) lock(key string, r *http.Request) bool {
+	kv := c.kvs[key]
+	kv.Key = key
+	if session := r.URL.Query().Get("release"); session != "" {
+		if kv.Session != session {
+			return false
+		}
+		kv.Session = ""
+		c.kvs[key] = kv
+		return true
+	}
+	session := r.URL.Query().Get("acquire")
+	if !c.sessions[session] || kv.Session != "" && kv.Session != session {
+		return false
+	}
+	if kv.Session != session {
+		kv.LockIndex++
+	}
+	kv.Session = session
+	kv.Value, _ = ioutil.ReadAll(r.Body)
+	c.kvs[key] = kv
+	return true
+}
+
+// newTestConsulRegistry create consul registry of specified node with fake agent and short election timing.
+func newTestConsulRegistry(c *fakeConsul, nodeId string, observer bool) *consulRegistry {
+	return newConsulRegistry(Config{
+		AppId:            "demo",
+		NodeId:           nodeId,
+		Url:              util.ParseUrl("consul://" + strings.TrimPrefix(c.server.URL, "http://")),
+		Observer:         observer,
+		ElectionTtl:      time.Second,
+		ElectionInterval: 50 * time.Millisecond,
+	})
+}
+
+func TestConsulRegistry_Election(t *testing.T) {
+
+	c := newFakeConsul()
+	defer c.server.Close()
+	first, second := newTestConsulRegistry(c, "node0", false), newTestConsulRegistry(c, "node1", false)
+	observer := newTestConsulRegistry(c, "observer", true)
+	for _, reg := range []*consulRegistry{first, observer} {
+		if err := reg.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer reg.Stop()
+	}
+	waitFor(t, "node0 take master", first.IsMaster)
+	if err := second.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer second.Stop()
+	waitFor(t, "members registered", func() bool {
+		return len(second.Nodes()) == 2 && len(observer.Nodes()) == 2
+	})
+	if token, ok := first.FencingToken(); !ok || token != 1 {
+		t.Fatal("expect lock index as fencing token of master but got", token)
+	}
+
+	// Master renews its session while slaver and observer follow it.
+	renewals := c.renewCount()
+	time.Sleep(200 * time.Millisecond)
+	if c.renewCount() <= renewals || !first.IsMaster() || c.holder("demo/election") != "node0" {
+		t.Fatal("expect master renews session and holds election lock")
+	}
+	for _, reg := range []*consulRegistry{second, observer} {
+		if master, ok := reg.Master(); reg.IsMaster() || !ok || master != "node0" {
+			t.Fatal("expect node0 as master but got", master)
+		}
+	}
+
+	// Slaver takes over after master stopped and session destroyed.
+	first.Stop()
+	waitFor(t, "node1 take master", second.IsMaster)
+	if token, _ := second.FencingToken(); token != 2 {
+		t.Fatal("expect fencing token increased but got", token)
+	}
+	waitFor(t, "observer follow node1", func() bool {
+		master, _ := observer.Master()
+		return master == "node1" && !observer.IsMaster()
+	})
+}
+
+func TestConsulRegistry_Failure(t *testing.T) {
+
+	c := newFakeConsul()
+	defer c.server.Close()
+	events := make(chan BackendEvent, 64)
+	reg := newTestConsulRegistry(c, "node0", false)
+	reg.config.Backend = func(event BackendEvent, err error) {
+		events <- event
+	}
+	if err := reg.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer reg.Stop()
+	waitFor(t, "node0 take master", reg.IsMaster)
+
+	// Master is kept while agent is briefly unreachable.
+	c.setDown(true)
+	waitEvent(t, events, BackendUnreachable)
+	if reg.Healthy() {
+		t.Fatal("expect backend unhealthy")
+	}
+	c.setDown(false)
+	waitEvent(t, events, Reconnected)
+	if !reg.IsMaster() {
+		t.Fatal("expect master kept while agent briefly unreachable")
+	}
+
+	// Master is lost while agent keeps unreachable after window.
+	c.setDown(true)
+	waitEvent(t, events, BackendUnreachable)
+	waitFor(t, "node0 lose master", func() bool {
+		master, _ := reg.Master()
+		return !reg.IsMaster() && master == unknownNodeId
+	})
+}
@@ -0,0 +1,327 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package registry
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"github.com/mervinkid/matcha/logging"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const unknownNodeId = "unknown"
+
+// Max delay between backend checks while backend keeps failing.
+const backendMaxBackoff = 30 * time.Second
+
+// roleState keeps role of local node and id of master for registry implementations.
+type roleState struct {
+	role        Role
+	masterId    string
+	token       uint64
+	confirmedAt time.Time
+	mutex       sync.RWMutex
+}
+
+// isMaster returns true if local node current holds master role.
+func (s *roleState) isMaster() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.role == Master
+}
+
+// master returns id of current master and true if master is known.
+func (s *roleState) master() (string, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.masterId, s.masterId != "" && s.masterId != unknownNodeId
+}
+
+// fencingToken returns fencing token of local node and true if it holds master role.
+func (s *roleState) fencingToken() (uint64, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.token, s.role == Master
+}
+
+// setToken set fencing token for the coming master role of local node.
+func (s *roleState) setToken(token uint64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.token = token
+}
+
+// change set role of local node and id of master, returns whether role and master changed.
+// Fencing token will be cleared while local node is not master.
+func (s *roleState) change(newRole Role, newMaster string) (roleChanged, masterChanged bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	roleChanged = s.role != newRole
+	masterChanged = s.masterId != newMaster
+	s.role = newRole
+	s.masterId = newMaster
+	if newRole != Master {
+		s.token = 0
+	}
+	if newMaster != "" && newMaster != unknownNodeId {
+		s.confirmedAt = time.Now()
+	}
+	return
+}
+
+// confirmedWithin returns true if role and master have been confirmed by backend within specified window.
+func (s *roleState) confirmedWithin(window time.Duration) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return !s.confirmedAt.IsZero() && time.Since(s.confirmedAt) < window
+}
+
+// nodeInfos returns info of known members with master flag.
+func nodeInfos(role *roleState, watch *watchHub) []NodeInfo {
+	masterId, _ := role.master()
+	nodeIds := watch.memberIds()
+	nodes := make([]NodeInfo, len(nodeIds))
+	for i, nodeId := range nodeIds {
+		nodes[i] = NodeInfo{Id: nodeId, Master: nodeId == masterId}
+	}
+	return nodes
+}
+
+// updateRole change role of local node, and notify election callback, subscribers and role watchers
+// while role changed. Observer will also be notified while master changed. Election callback is
+// deferred until watch flushes callbacks.
+func updateRole(config Config, role *roleState, watch *watchHub, newRole Role, newMaster string) {
+	roleChanged, masterChanged := role.change(newRole, newMaster)
+	token, _ := role.fencingToken()
+	if roleChanged {
+		notifyElection(config, watch, newRole, newMaster)
+		watch.publishRole(RoleChange{Role: newRole, MasterId: newMaster, FencingToken: token})
+	} else if config.Observer && masterChanged {
+		logging.Debug("Master of %s is %s.", config.AppId, newMaster)
+		if config.Election != nil {
+			watch.deferCallback(func() {
+				config.Election(MasterChange, newMaster)
+			})
+		}
+		watch.events.publish(MasterChange, newMaster)
+		watch.publishRole(RoleChange{Role: newRole, MasterId: newMaster})
+	}
+}
+
+// degradeRole demote local node to slaver with unknown master on backend failure. Current role
+// will be kept within specified window since last confirmed, so that a briefly slow backend will not
+// cause flapping transitions. The window should end before master lock may expire on backend.
+func degradeRole(config Config, role *roleState, watch *watchHub, window time.Duration) {
+	if role.confirmedWithin(window) {
+		logging.Debug("Keep role of node %s while backend is failing.", config.NodeId)
+		return
+	}
+	updateRole(config, role, watch, Slaver, unknownNodeId)
+}
+
+// backoffGuard degrade role with specified function and returns true while next check of backend is
+// backed off after failures, then election round should be skipped. Master keeps checking backend
+// to renew its role.
+func backoffGuard(role *roleState, backend *backendState, degrade func()) bool {
+	if role.isMaster() || backend.due() {
+		return false
+	}
+	degrade()
+	return true
+}
+
+// notifyElection invoke election callback of config and subscribers with role change of local node.
+func notifyElection(config Config, watch *watchHub, newRole Role, newMaster string) {
+	event := MasterTake
+	if newRole == Slaver {
+		logging.Debug("Node %s is slaver.", config.NodeId)
+		event = MasterLose
+	} else {
+		logging.Debug("Node %s is master.", config.NodeId)
+	}
+	if config.Election != nil {
+		watch.deferCallback(func() {
+			config.Election(event, newMaster)
+		})
+	}
+	watch.events.publish(event, newMaster)
+}
+
+// backendState keeps connectivity of backend for registry implementations. Checks will be backed off
+// exponentially from interval while backend keeps failing. Unreachable and
+// reconnected events will be notified once per connectivity change.
+type backendState struct {
+	unreachable bool
+	failures    uint
+	retryAt     time.Time
+	interval    time.Duration
+	mutex       sync.Mutex
+}
+
+// reset mark backend as reachable and use specified interval as initial delay of backoff.
+func (s *backendState) reset(interval time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.unreachable = false
+	s.failures = 0
+	s.retryAt = time.Time{}
+	s.interval = interval
+}
+
+// healthy returns true if backend is reachable.
+func (s *backendState) healthy() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return !s.unreachable
+}
+
+// due returns false while next check of backend is backed off after failures.
+func (s *backendState) due() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return !time.Now().Before(s.retryAt)
+}
+
+// fail mark backend as unreachable with specified error and back off next check. Backend callback
+// is deferred until watch flushes callbacks.
+func (s *backendState) fail(config Config, watch *watchHub, err error) {
+	s.mutex.Lock()
+	changed := !s.unreachable
+	s.unreachable = true
+	s.failures++
+	backoff := s.interval
+	for i := uint(1); i < s.failures && backoff < backendMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > backendMaxBackoff {
+		backoff = backendMaxBackoff
+	}
+	s.retryAt = time.Now().Add(backoff)
+	s.mutex.Unlock()
+	if changed {
+		logging.Warn("Backend of registry %s is unreachable cause %s.", config.AppId, err.Error())
+		if config.Backend != nil {
+			watch.deferCallback(func() {
+				config.Backend(BackendUnreachable, err)
+			})
+		}
+	}
+}
+
+// ok mark backend as reachable. Backend callback is deferred until watch flushes callbacks.
+func (s *backendState) ok(config Config, watch *watchHub) {
+	s.mutex.Lock()
+	changed := s.unreachable
+	s.unreachable = false
+	s.failures = 0
+	s.retryAt = time.Time{}
+	s.mutex.Unlock()
+	if changed {
+		logging.Info("Backend of registry %s is reconnected.", config.AppId)
+		if config.Backend != nil {
+			watch.deferCallback(func() {
+				config.Backend(Reconnected, nil)
+			})
+		}
+	}
+}
+
+// notifyElectionError defer backend callback of config with specified election error until watch
+// flushes callbacks.
+func notifyElectionError(config Config, watch *watchHub, err error) {
+	if config.Backend != nil {
+		watch.deferCallback(func() {
+			config.Backend(ElectionError, err)
+		})
+	}
+}
+
+// electionTiming returns ttl and interval of election in config. The missing one will be derived
+// from the other, or specified defaults will be used if neither is set.
+func electionTiming(config Config, defaultTtl, defaultInterval time.Duration) (ttl, interval time.Duration) {
+	ttl, interval = config.ElectionTtl, config.ElectionInterval
+	switch {
+	case ttl <= 0 && interval <= 0:
+		return defaultTtl, defaultInterval
+	case ttl <= 0:
+		return 2 * interval, interval
+	case interval <= 0:
+		return ttl, ttl / 2
+	}
+	return
+}
+
+// takeoverGuard delay takeover of slaver until master lock has been observed free for grace period,
+// or the hold-off after local node resigned expired.
+type takeoverGuard struct {
+	freeSince   time.Time
+	resignUntil time.Time
+}
+
+// allow returns true if slaver can try to take master lock with specified state of lock.
+func (g *takeoverGuard) allow(free bool, grace time.Duration) bool {
+	if g.resigned() {
+		return false
+	}
+	if !free {
+		g.freeSince = time.Time{}
+		return false
+	}
+	if grace <= 0 {
+		return true
+	}
+	now := time.Now()
+	if g.freeSince.IsZero() {
+		g.freeSince = now
+	}
+	return now.Sub(g.freeSince) >= grace
+}
+
+// reset forget observed free state of master lock.
+func (g *takeoverGuard) reset() {
+	g.freeSince = time.Time{}
+}
+
+// resign prevent local node from taking master lock within specified hold-off.
+func (g *takeoverGuard) resign(holdOff time.Duration) {
+	g.resignUntil = time.Now().Add(holdOff)
+}
+
+// resigned returns true if local node is in hold-off after resigned.
+func (g *takeoverGuard) resigned() bool {
+	return time.Now().Before(g.resignUntil)
+}
+
+// generateNodeId returns a random node id with app id as prefix.
+func generateNodeId(appId string) string {
+	timestamp := time.Now().UnixNano()
+	random := rand.New(rand.NewSource(timestamp)).Int63()
+	src := strconv.FormatInt(timestamp, 10) + strconv.FormatInt(random, 10)
+	hash := md5.New()
+	hash.Write([]byte(src))
+	hashCode := hex.EncodeToString(hash.Sum(nil))
+	return appId + "-" + hashCode
+}
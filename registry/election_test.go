@@ -0,0 +1,131 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package registry
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestElectionTiming(t *testing.T) {
+
+	cases := []struct {
+		ttl, interval             time.Duration
+		expectTtl, expectInterval time.Duration
+	}{
+		{0, 0, 6 * time.Second, 2 * time.Second},
+		{time.Second, 0, time.Second, 500 * time.Millisecond},
+		{0, 100 * time.Millisecond, 200 * time.Millisecond, 100 * time.Millisecond},
+		{time.Second, 100 * time.Millisecond, time.Second, 100 * time.Millisecond},
+	}
+	for _, c := range cases {
+		config := Config{ElectionTtl: c.ttl, ElectionInterval: c.interval}
+		ttl, interval := electionTiming(config, 6*time.Second, 2*time.Second)
+		if ttl != c.expectTtl || interval != c.expectInterval {
+			t.Fatalf("ttl %v and interval %v expect timing (%v, %v) but got (%v, %v)",
+				c.ttl, c.interval, c.expectTtl, c.expectInterval, ttl, interval)
+		}
+	}
+}
+
+func TestTakeoverGuard(t *testing.T) {
+
+	guard := &takeoverGuard{}
+	if !guard.allow(true, 0) {
+		t.Fatal("expect takeover allowed without grace")
+	}
+
+	// Takeover is allowed after lock has been observed free for grace period.
+	grace := 50 * time.Millisecond
+	if guard.allow(true, grace) {
+		t.Fatal("expect takeover delayed within grace")
+	}
+	time.Sleep(2 * grace)
+	if guard.allow(false, grace) {
+		t.Fatal("expect takeover denied while lock held")
+	}
+	if guard.allow(true, grace) {
+		t.Fatal("expect grace restarted after lock observed held")
+	}
+	time.Sleep(2 * grace)
+	if !guard.allow(true, grace) {
+		t.Fatal("expect takeover allowed after grace")
+	}
+}
+
+func TestBackendState(t *testing.T) {
+
+	var events []BackendEvent
+	config := Config{AppId: "backend", NodeId: "node0", Backend: func(event BackendEvent, err error) {
+		events = append(events, event)
+	}}
+	backend, watch := &backendState{}, &watchHub{}
+
+	// Unreachable and reconnected are notified once per connectivity change.
+	backend.fail(config, watch, errors.New("unreachable"))
+	backend.fail(config, watch, errors.New("unreachable"))
+	backend.ok(config, watch)
+	backend.ok(config, watch)
+	notifyElectionError(config, watch, errors.New("campaign"))
+	if len(events) != 0 {
+		t.Fatal("expect backend events deferred but got", events)
+	}
+	watch.flushCallbacks()
+	if expect := []BackendEvent{BackendUnreachable, Reconnected, ElectionError}; !reflect.DeepEqual(events, expect) {
+		t.Fatal("expect backend events", expect, "but got", events)
+	}
+}
+
+func TestBackoffGuard(t *testing.T) {
+
+	config := Config{AppId: "guard", NodeId: "node0"}
+	role, watch, backend := &roleState{}, &watchHub{}, &backendState{}
+	backend.reset(time.Hour)
+	degrades := 0
+	degrade := func() {
+		degrades++
+		degradeRole(config, role, watch, 0)
+	}
+
+	// Check is due while backend is healthy.
+	if backoffGuard(role, backend, degrade) || degrades != 0 {
+		t.Fatal("expect check due while backend healthy")
+	}
+
+	// Slaver skips check and degrades while backed off.
+	backend.fail(config, watch, errors.New("unreachable"))
+	if !backoffGuard(role, backend, degrade) || degrades != 1 {
+		t.Fatal("expect check backed off after failure")
+	}
+	if masterId, _ := role.master(); masterId != unknownNodeId {
+		t.Fatal("expect master unknown after degrade but got", masterId)
+	}
+
+	// Master keeps checking to renew its role.
+	role.change(Master, config.NodeId)
+	if backoffGuard(role, backend, degrade) || degrades != 1 {
+		t.Fatal("expect master check not backed off")
+	}
+}
@@ -0,0 +1,547 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/mervinkid/matcha/logging"
+	"github.com/mervinkid/matcha/misc"
+	"github.com/mervinkid/matcha/task"
+	"github.com/mervinkid/matcha/util"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	etcdLeaseTtl       = 6 * time.Second
+	etcdElectionDelay  = 2 * time.Second
+	etcdRequestTimeout = 3 * time.Second
+)
+
+// etcdClient is a minimal client of etcd v3 JSON gateway.
+type etcdClient struct {
+	endpoint   string
+	httpClient *http.Client
+}
+
+type etcdKeyValue struct {
+	Key            []byte `json:"key"`
+	Value          []byte `json:"value"`
+	CreateRevision int64  `json:"create_revision,string"`
+}
+
+type etcdLeaseRequest struct {
+	ID  int64 `json:"ID,string"`
+	TTL int64 `json:"TTL,string"`
+}
+
+type etcdPutRequest struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+	Lease int64  `json:"lease,string"`
+}
+
+type etcdRangeRequest struct {
+	Key      []byte `json:"key"`
+	RangeEnd []byte `json:"range_end,omitempty"`
+	KeysOnly bool   `json:"keys_only,omitempty"`
+}
+
+// etcdCompare is the compare of txn. Only one of CreateRevision and Value should be set as target.
+type etcdCompare struct {
+	Target         string `json:"target"`
+	Result         string `json:"result"`
+	Key            []byte `json:"key"`
+	CreateRevision int64  `json:"create_revision,string,omitempty"`
+	Value          []byte `json:"value,omitempty"`
+}
+
+type etcdRequestOp struct {
+	RequestPut         *etcdPutRequest   `json:"request_put,omitempty"`
+	RequestRange       *etcdRangeRequest `json:"request_range,omitempty"`
+	RequestDeleteRange *etcdRangeRequest `json:"request_delete_range,omitempty"`
+}
+
+type etcdTxnRequest struct {
+	Compare []etcdCompare   `json:"compare"`
+	Success []etcdRequestOp `json:"success"`
+	Failure []etcdRequestOp `json:"failure,omitempty"`
+}
+
+type etcdTxnResponse struct {
+	Header struct {
+		Revision int64 `json:"revision,string"`
+	} `json:"header"`
+	Succeeded bool `json:"succeeded"`
+	Responses []struct {
+		ResponseRange *struct {
+			Kvs []etcdKeyValue `json:"kvs"`
+		} `json:"response_range"`
+	} `json:"responses"`
+}
+
+// call post request as JSON to specified path and decode JSON response.
+func (c *etcdClient) call(path string, request, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Post(c.endpoint+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("etcd %s fail with status %d: %s", path, resp.StatusCode, string(message))
+	}
+	if response == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
+
+// grantLease returns id of a new lease with specified ttl in seconds.
+func (c *etcdClient) grantLease(ttl int64) (int64, error) {
+	var response etcdLeaseRequest
+	if err := c.call("/v3/lease/grant", etcdLeaseRequest{TTL: ttl}, &response); err != nil {
+		return 0, err
+	}
+	return response.ID, nil
+}
+
+// keepAliveLease refresh specified lease and returns false if it has expired.
+func (c *etcdClient) keepAliveLease(id int64) (bool, error) {
+	var response struct {
+		Result etcdLeaseRequest `json:"result"`
+	}
+	if err := c.call("/v3/lease/keepalive", etcdLeaseRequest{ID: id}, &response); err != nil {
+		return false, err
+	}
+	return response.Result.TTL > 0, nil
+}
+
+// revokeLease revoke specified lease and delete keys attached to it.
+func (c *etcdClient) revokeLease(id int64) error {
+	return c.call("/v3/lease/revoke", etcdLeaseRequest{ID: id}, nil)
+}
+
+// put set value of key attached to specified lease.
+func (c *etcdClient) put(key, value string, lease int64) error {
+	return c.call("/v3/kv/put", etcdPutRequest{Key: []byte(key), Value: []byte(value), Lease: lease}, nil)
+}
+
+// get returns value of specified key, or empty string if key does not exist.
+func (c *etcdClient) get(key string) (string, error) {
+	var response struct {
+		Kvs []etcdKeyValue `json:"kvs"`
+	}
+	if err := c.call("/v3/kv/range", etcdRangeRequest{Key: []byte(key)}, &response); err != nil {
+		return "", err
+	}
+	if len(response.Kvs) == 0 {
+		return "", nil
+	}
+	return string(response.Kvs[0].Value), nil
+}
+
+// release delete key if its value equals to specified value.
+func (c *etcdClient) release(key, value string) error {
+	request := etcdTxnRequest{
+		Compare: []etcdCompare{{Target: "VALUE", Result: "EQUAL", Key: []byte(key), Value: []byte(value)}},
+		Success: []etcdRequestOp{{RequestDeleteRange: &etcdRangeRequest{Key: []byte(key)}}},
+	}
+	return c.call("/v3/kv/txn", request, nil)
+}
+
+// keys returns keys with specified prefix.
+func (c *etcdClient) keys(prefix string) ([]string, error) {
+	kvs, err := c.rangePrefix(prefix, true)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, len(kvs))
+	for i, kv := range kvs {
+		keys[i] = string(kv.Key)
+	}
+	return keys, nil
+}
+
+// values returns keys and values with specified prefix.
+func (c *etcdClient) values(prefix string) (map[string]string, error) {
+	kvs, err := c.rangePrefix(prefix, false)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		values[string(kv.Key)] = string(kv.Value)
+	}
+	return values, nil
+}
+
+func (c *etcdClient) rangePrefix(prefix string, keysOnly bool) ([]etcdKeyValue, error) {
+	key, rangeEnd := etcdPrefixRange(prefix)
+	var response struct {
+		Kvs []etcdKeyValue `json:"kvs"`
+	}
+	request := etcdRangeRequest{Key: key, RangeEnd: rangeEnd, KeysOnly: keysOnly}
+	if err := c.call("/v3/kv/range", request, &response); err != nil {
+		return nil, err
+	}
+	return response.Kvs, nil
+}
+
+// etcdPrefixRange returns key and range end which cover all keys with specified prefix.
+// Range end is the prefix with last byte below 0xff increased and following bytes removed.
+// Range "\x00" covers all keys greater than or equal to key, which is used for empty prefix
+// and prefix of all 0xff bytes.
+func etcdPrefixRange(prefix string) ([]byte, []byte) {
+	if len(prefix) == 0 {
+		return []byte{0}, []byte{0}
+	}
+	rangeEnd := []byte(prefix)
+	for i := len(rangeEnd) - 1; i >= 0; i-- {
+		if rangeEnd[i] < 0xff {
+			rangeEnd[i]++
+			return []byte(prefix), rangeEnd[:i+1]
+		}
+	}
+	return []byte(prefix), []byte{0}
+}
+
+// campaign create key with value attached to specified lease if key does not exist.
+// Returns the value and create revision of key after campaign. The create revision increases
+// monotonically for each new holder and is used as fencing token.
+func (c *etcdClient) campaign(key, value string, lease int64) (string, uint64, error) {
+	request := etcdTxnRequest{
+		Compare: []etcdCompare{{Target: "CREATE", Result: "EQUAL", Key: []byte(key), CreateRevision: 0}},
+		Success: []etcdRequestOp{{RequestPut: &etcdPutRequest{Key: []byte(key), Value: []byte(value), Lease: lease}}},
+		Failure: []etcdRequestOp{{RequestRange: &etcdRangeRequest{Key: []byte(key)}}},
+	}
+	var response etcdTxnResponse
+	if err := c.call("/v3/kv/txn", request, &response); err != nil {
+		return "", 0, err
+	}
+	if response.Succeeded {
+		return value, uint64(response.Header.Revision), nil
+	}
+	for _, op := range response.Responses {
+		if op.ResponseRange != nil && len(op.ResponseRange.Kvs) > 0 {
+			kv := op.ResponseRange.Kvs[0]
+			return string(kv.Value), uint64(kv.CreateRevision), nil
+		}
+	}
+	return unknownNodeId, 0, nil
+}
+
+// etcdRegistry is the implementation of Registry interface based on etcd v3. Local node is
+// registered with a lease, and master is elected by creating election key attached to the lease.
+//  +-----------------------+     +-------------------------------+
+//  | app/nodes/{nodeId}    | ← ← |                               |
+//  +-----------------------+     | lease (ttl) ← keepalive ← node |
+//  | app/election = nodeId | ← ← |                               |
+//  +-----------------------+     +-------------------------------+
+type etcdRegistry struct {
+	// Props
+	config Config
+	// Runtime
+	client            *etcdClient
+	role              roleState
+	watch             watchHub
+	backend           backendState
+	leaseId           int64
+	ttl               time.Duration
+	interval          time.Duration
+	takeover          takeoverGuard
+	electionScheduler task.Scheduler
+	electionMutex     sync.Mutex
+	// State
+	running    bool
+	stateMutex sync.RWMutex
+	waitGroup  sync.WaitGroup
+}
+
+func (r *etcdRegistry) String() string {
+	return "etcd-registry-" + r.config.AppId
+}
+
+func (r *etcdRegistry) Type() string {
+	return "etcd"
+}
+
+func (r *etcdRegistry) Start() error {
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+	if !r.running {
+		if r.config.NodeId == "" {
+			r.config.NodeId = generateNodeId(r.config.AppId)
+		}
+		r.client = newEtcdClient(r.config.Url)
+		r.ttl, r.interval = electionTiming(r.config, etcdLeaseTtl, etcdElectionDelay)
+		r.backend.reset(r.interval)
+		electionScheduler := task.NewFixedDelayScheduler(r.electionTask, r.interval)
+		if err := misc.LifecycleStart(electionScheduler); err != nil {
+			r.client = nil
+			return err
+		}
+		r.electionScheduler = electionScheduler
+		r.running = true
+		r.waitGroup.Add(1)
+	}
+	return nil
+}
+
+func (r *etcdRegistry) Stop() {
+	defer r.watch.flushCallbacks()
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+	if r.running {
+		misc.LifecycleStop(r.electionScheduler)
+		r.electionScheduler = nil
+		// Wait for running election task
+		r.electionMutex.Lock()
+		if r.leaseId != 0 {
+			// Revoke lease to release election key and node key immediately.
+			if err := r.client.revokeLease(r.leaseId); err != nil {
+				logging.Warn("Revoke etcd lease fail cause %s.", err.Error())
+			}
+			r.leaseId = 0
+		}
+		r.client = nil
+		r.changeRole(Slaver, unknownNodeId)
+		r.electionMutex.Unlock()
+		r.watch.close()
+		r.running = false
+		r.waitGroup.Done()
+	}
+}
+
+func (r *etcdRegistry) IsRunning() bool {
+	r.stateMutex.RLock()
+	defer r.stateMutex.RUnlock()
+	return r.running
+}
+
+func (r *etcdRegistry) Sync() {
+	r.waitGroup.Wait()
+}
+
+func (r *etcdRegistry) IsMaster() bool {
+	return r.role.isMaster()
+}
+
+func (r *etcdRegistry) Master() (string, bool) {
+	return r.role.master()
+}
+
+func (r *etcdRegistry) FencingToken() (uint64, bool) {
+	return r.role.fencingToken()
+}
+
+func (r *etcdRegistry) Nodes() []NodeInfo {
+	return nodeInfos(&r.role, &r.watch)
+}
+
+func (r *etcdRegistry) Healthy() bool {
+	return r.backend.healthy()
+}
+
+func (r *etcdRegistry) WatchRole() <-chan RoleChange {
+	return r.watch.watchRole()
+}
+
+func (r *etcdRegistry) WatchMembers() <-chan MemberChange {
+	return r.watch.watchMembers()
+}
+
+func (r *etcdRegistry) Subscribe(handler func(event ElectionEvent, masterId string)) SubscriptionId {
+	return r.watch.events.subscribe(handler)
+}
+
+func (r *etcdRegistry) Unsubscribe(id SubscriptionId) {
+	r.watch.events.unsubscribe(id)
+}
+
+func (r *etcdRegistry) NotifyLeadership(notify func()) func() {
+	return r.watch.notifyLeadership(notify)
+}
+
+func (r *etcdRegistry) Resign() error {
+	defer r.watch.flushCallbacks()
+	r.electionMutex.Lock()
+	defer r.electionMutex.Unlock()
+	if r.client == nil || !r.IsMaster() {
+		return nil
+	}
+	if err := r.client.release(r.electionKey(), r.config.NodeId); err != nil {
+		return err
+	}
+	r.takeover.resign(r.ttl)
+	r.changeRole(Slaver, unknownNodeId)
+	return nil
+}
+
+func (r *etcdRegistry) electionKey() string {
+	return fmt.Sprintf("%s/election", r.config.AppId)
+}
+
+func (r *etcdRegistry) nodesPrefix() string {
+	return fmt.Sprintf("%s/nodes/", r.config.AppId)
+}
+
+func (r *etcdRegistry) nodeKey() string {
+	return r.nodesPrefix() + r.config.NodeId
+}
+
+// refreshMembers update members with node keys registered in etcd.
+func (r *etcdRegistry) refreshMembers() error {
+	keys, err := r.client.keys(r.nodesPrefix())
+	if err != nil {
+		return err
+	}
+	nodeIds := make([]string, len(keys))
+	for i, key := range keys {
+		nodeIds[i] = strings.TrimPrefix(key, r.nodesPrefix())
+	}
+	r.watch.updateMembers(nodeIds)
+	return nil
+}
+
+// checkLease keep lease alive, or grant a new one and register local node with it.
+func (r *etcdRegistry) checkLease() error {
+	if r.leaseId != 0 {
+		alive, err := r.client.keepAliveLease(r.leaseId)
+		if err != nil {
+			return err
+		}
+		if alive {
+			return nil
+		}
+		r.leaseId = 0
+	}
+	// Lease ttl of etcd is in seconds
+	ttlSeconds := int64((r.ttl + time.Second - 1) / time.Second)
+	leaseId, err := r.client.grantLease(ttlSeconds)
+	if err != nil {
+		return err
+	}
+	if err := r.client.put(r.nodeKey(), r.config.NodeId, leaseId); err != nil {
+		r.client.revokeLease(leaseId)
+		return err
+	}
+	r.leaseId = leaseId
+	return nil
+}
+
+func (r *etcdRegistry) electionTask() {
+	defer r.watch.flushCallbacks()
+	r.electionMutex.Lock()
+	defer r.electionMutex.Unlock()
+	if r.client == nil {
+		return
+	}
+	// Back off checks while backend keeps failing, master keeps renewing to hold its role
+	if backoffGuard(&r.role, &r.backend, r.degradeRole) {
+		return
+	}
+
+	// Observer has no lease, connectivity is checked by refreshing members
+	if !r.config.Observer {
+		if err := r.checkLease(); err != nil {
+			logging.Error("Check lease with etcd fail cause %s.", err.Error())
+			r.backend.fail(r.config, &r.watch, err)
+			r.degradeRole()
+			return
+		}
+	}
+	if err := r.refreshMembers(); err != nil {
+		if r.config.Observer {
+			logging.Error("Refresh members with etcd fail cause %s.", err.Error())
+			r.backend.fail(r.config, &r.watch, err)
+			r.degradeRole()
+			return
+		}
+		logging.Warn("Refresh members with etcd fail cause %s.", err.Error())
+	}
+	r.backend.ok(r.config, &r.watch)
+	if !r.IsMaster() && (r.config.Observer || r.config.TakeoverGrace > 0 || r.takeover.resigned()) {
+		// Take over only if election key has been free for grace period and not in resign hold-off.
+		// Observer never takes over.
+		holder, err := r.client.get(r.electionKey())
+		if err != nil {
+			logging.Error("Get election key from etcd fail cause %s.", err.Error())
+			notifyElectionError(r.config, &r.watch, err)
+			r.degradeRole()
+			return
+		}
+		if r.config.Observer || !r.takeover.allow(holder == "", r.config.TakeoverGrace) {
+			if holder == "" {
+				holder = unknownNodeId
+			}
+			r.changeRole(Slaver, holder)
+			return
+		}
+	}
+	master, token, err := r.client.campaign(r.electionKey(), r.config.NodeId, r.leaseId)
+	if err != nil {
+		logging.Error("Campaign with etcd fail cause %s.", err.Error())
+		notifyElectionError(r.config, &r.watch, err)
+		r.degradeRole()
+		return
+	}
+	if master == r.config.NodeId {
+		r.takeover.reset()
+		r.role.setToken(token)
+		r.changeRole(Master, master)
+	} else {
+		r.changeRole(Slaver, master)
+	}
+}
+
+func (r *etcdRegistry) changeRole(newRole Role, newMaster string) {
+	updateRole(r.config, &r.role, &r.watch, newRole, newMaster)
+}
+
+// degradeRole demote local node on backend failure unless role was confirmed within ttl.
+func (r *etcdRegistry) degradeRole() {
+	degradeRole(r.config, &r.role, &r.watch, r.ttl-r.interval)
+}
+
+func newEtcdRegistry(config Config) *etcdRegistry {
+	return &etcdRegistry{
+		config: config,
+	}
+}
+
+func newEtcdClient(url util.URL) *etcdClient {
+	return &etcdClient{
+		endpoint:   "http://" + url.Address(),
+		httpClient: &http.Client{Timeout: etcdRequestTimeout},
+	}
+}
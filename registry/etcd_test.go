@@ -0,0 +1,435 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/mervinkid/matcha/util"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEtcdPrefixRange(t *testing.T) {
+	cases := []struct {
+		prefix   string
+		key      []byte
+		rangeEnd []byte
+	}{
+		{"", []byte{0}, []byte{0}},
+		{"demo/nodes/", []byte("demo/nodes/"), []byte("demo/nodes0")},
+		{"a\xff", []byte("a\xff"), []byte("b")},
+		{"a\xff\xff", []byte("a\xff\xff"), []byte("b")},
+		{"\xff\xff", []byte("\xff\xff"), []byte{0}},
+	}
+	for _, c := range cases {
+		key, rangeEnd := etcdPrefixRange(c.prefix)
+		if !bytes.Equal(key, c.key) || !bytes.Equal(rangeEnd, c.rangeEnd) {
+			t.Fatalf("prefix %q expect [%q, %q) but got [%q, %q)", c.prefix, c.key, c.rangeEnd, key, rangeEnd)
+		}
+	}
+}
+
+// fakeEtcd is a fake etcd v3 JSON gateway which keeps keys and leases in memory. Requests fail
+// with status 503 while it is down.
+type fakeEtcd struct {
+	server     *httptest.Server
+	kvs        map[string]etcdKeyValue
+	leases     map[int64]int64
+	keyLeases  map[string]int64
+	revision   int64
+	lastLease  int64
+	keepAlives int
+	down       bool
+	mutex      sync.Mutex
+}
+
+func newFakeEtcd() *fakeEtcd {
+	e := &fakeEtcd{
+		kvs:       make(map[string]etcdKeyValue),
+		leases:    make(map[int64]int64),
+		keyLeases: make(map[string]int64),
+	}
+	e.server = httptest.NewServer(http.HandlerFunc(e.serve))
+	return e
+}
+
+func (e *fakeEtcd) setDown(down bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.down = down
+}
+
+func (e *fakeEtcd) value(key string) string {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return string(e.kvs[key].Value)
+}
+
+func (e *fakeEtcd) leaseTtl(id int64) int64 {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.leases[id]
+}
+
+func (e *fakeEtcd) keepAliveCount() int {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.keepAlives
+}
+
+func (e *fakeEtcd) serve(w http.ResponseWriter, r *http.Request) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.down {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	var response interface{}
+	switch r.URL.Path {
+	case "/v3/lease/grant":
+		var request etcdLeaseRequest
+		json.NewDecoder(r.Body).Decode(&request)
+		e.lastLease++
+		e.leases[e.lastLease] = request.TTL
+		response = etcdLeaseRequest{ID: e.lastLease, TTL: request.TTL}
+	case "/v3/lease/keepalive":
+		var request etcdLeaseRequest
+		json.NewDecoder(r.Body).Decode(&request)
+		e.keepAlives++
+		response = map[string]etcdLeaseRequest{"result": {ID: request.ID, TTL: e.leases[request.ID]}}
+	case "/v3/lease/revoke":
+		var request etcdLeaseRequest
+		json.NewDecoder(r.Body).Decode(&request)
+		delete(e.leases, request.ID)
+		for key, lease := range e.keyLeases {
+			if lease == request.ID {
+				e.delete(key)
+			}
+		}
+		response = struct{}{}
+	case "/v3/kv/put":
+		var request etcdPutRequest
+		json.NewDecoder(r.Body).Decode(&request)
+		e.put(request)
+		response = struct{}{}
+	case "/v3/kv/range":
+		var request etcdRangeRequest
+		json.NewDecoder(r.Body).Decode(&request)
+		response = map[string][]etcdKeyValue{"kvs": e.rangeKeys(request)}
+	case "/v3/kv/txn":
+		var request etcdTxnRequest
+		json.NewDecoder(r.Body).Decode(&request)
+		response = e.txn(request)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (e *fakeEtcd) put(request etcdPutRequest) {
+	e.revision++
+	kv, ok := e.kvs[string(request.Key)]
+	if !ok {
+		kv = etcdKeyValue{Key: request.Key, CreateRevision: e.revision}
+	}
+	kv.Value = request.Value
+	e.kvs[string(request.Key)] = kv
+	e.keyLeases[string(request.Key)] = request.Lease
+}
+
+func (e *fakeEtcd) delete(key string) {
+	delete(e.kvs, key)
+	delete(e.keyLeases, key)
+}
+
+func (e *fakeEtcd) rangeKeys(request etcdRangeRequest) []etcdKeyValue {
+	var kvs []etcdKeyValue
+	for key, kv := range e.kvs {
+		inRange := key == string(request.Key)
+		if len(request.RangeEnd) > 0 {
+			inRange = key >= string(request.Key) &&
+				(bytes.Equal(request.RangeEnd, []byte{0}) || key < string(request.RangeEnd))
+		}
+		if inRange {
+			kvs = append(kvs, kv)
+		}
+	}
+	return kvs
+}
+
+func (e *fakeEtcd) txn(request etcdTxnRequest) interface{} {
+	succeeded := true
+	for _, compare := range request.Compare {
+		kv, ok := e.kvs[string(compare.Key)]
+		switch compare.Target {
+		case "CREATE":
+			succeeded = succeeded && (ok && kv.CreateRevision == compare.CreateRevision || !ok && compare.CreateRevision == 0)
+		case "VALUE":
+			succeeded = succeeded && ok && bytes.Equal(kv.Value, compare.Value)
+		}
+	}
+	ops := request.Failure
+	if succeeded {
+		ops = request.Success
+	}
+	var responses []interface{}
+	for _, op := range ops {
+		switch {
+		case op.RequestPut != nil:
+			e.put(*op.RequestPut)
+			responses = append(responses, map[string]interface{}{})
+		case op.RequestRange != nil:
+			responses = append(responses, map[string]interface{}{
+				"response_range": map[string][]etcdKeyValue{"kvs": e.rangeKeys(*op.RequestRange)},
+			})
+		case op.RequestDeleteRange != nil:
+			e.delete(string(op.RequestDeleteRange.Key))
+			responses = append(responses, map[string]interface{}{})
+		}
+	}
+	return map[string]interface{}{
+		"header":    map[string]string{"revision": strconv.FormatInt(e.revision, 10)},
+		"succeeded": succeeded,
+		"responses": responses,
+	}
+}
+
+// newTestEtcdRegistry create etcd registry of specified node with fake etcd and short election timing.
+func newTestEtcdRegistry(e *fakeEtcd, nodeId string, observer bool) *etcdRegistry {
+	return newEtcdRegistry(Config{
+		AppId:            "demo",
+		NodeId:           nodeId,
+		Url:              util.ParseUrl("etcd://" + strings.TrimPrefix(e.server.URL, "http://")),
+		Observer:         observer,
+		ElectionTtl:      time.Second,
+		ElectionInterval: 50 * time.Millisecond,
+	})
+}
+
+func TestEtcdRegistry_Election(t *testing.T) {
+
+	e := newFakeEtcd()
+	defer e.server.Close()
+	first, second := newTestEtcdRegistry(e, "node0", false), newTestEtcdRegistry(e, "node1", false)
+	observer := newTestEtcdRegistry(e, "observer", true)
+	for _, reg := range []*etcdRegistry{first, observer} {
+		if err := reg.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer reg.Stop()
+	}
+	waitFor(t, "node0 take master", first.IsMaster)
+	if err := second.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer second.Stop()
+	waitFor(t, "members registered", func() bool {
+		return len(second.Nodes()) == 2 && len(observer.Nodes()) == 2
+	})
+	if token, ok := first.FencingToken(); !ok || token == 0 {
+		t.Fatal("expect fencing token of master")
+	}
+
+	// Master renews its lease while slaver and observer follow it.
+	keepAlives := e.keepAliveCount()
+	time.Sleep(200 * time.Millisecond)
+	if e.keepAliveCount() <= keepAlives || !first.IsMaster() || e.value("demo/election") != "node0" {
+		t.Fatal("expect master renews lease and holds election key")
+	}
+	for _, reg := range []*etcdRegistry{second, observer} {
+		if master, ok := reg.Master(); reg.IsMaster() || !ok || master != "node0" {
+			t.Fatal("expect node0 as master but got", master)
+		}
+	}
+
+	// Slaver takes over after master stopped and lease revoked.
+	first.Stop()
+	waitFor(t, "node1 take master", second.IsMaster)
+	waitFor(t, "observer follow node1", func() bool {
+		master, _ := observer.Master()
+		return master == "node1" && !observer.IsMaster()
+	})
+}
+
+func TestEtcdRegistry_Failure(t *testing.T) {
+
+	e := newFakeEtcd()
+	defer e.server.Close()
+	events := make(chan BackendEvent, 64)
+	reg := newTestEtcdRegistry(e, "node0", false)
+	reg.config.Backend = func(event BackendEvent, err error) {
+		events <- event
+	}
+	if err := reg.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer reg.Stop()
+	waitFor(t, "node0 take master", reg.IsMaster)
+
+	// Master is kept while backend is briefly unreachable.
+	e.setDown(true)
+	waitEvent(t, events, BackendUnreachable)
+	if reg.Healthy() {
+		t.Fatal("expect backend unhealthy")
+	}
+	e.setDown(false)
+	waitEvent(t, events, Reconnected)
+	if !reg.IsMaster() {
+		t.Fatal("expect master kept while backend briefly unreachable")
+	}
+
+	// Master is lost while backend keeps unreachable after window.
+	e.setDown(true)
+	waitEvent(t, events, BackendUnreachable)
+	waitFor(t, "node0 lose master", func() bool {
+		master, _ := reg.Master()
+		return !reg.IsMaster() && master == unknownNodeId
+	})
+}
+
+func TestEtcdRegistry_Callback(t *testing.T) {
+
+	e := newFakeEtcd()
+	defer e.server.Close()
+	events := make(chan ElectionEvent, 64)
+	reg := newTestEtcdRegistry(e, "node0", false)
+	// Callbacks are invoked after state lock released, so they are able to access the registry.
+	reg.config.Election = func(event ElectionEvent, masterId string) {
+		events <- event
+		if event == MasterTake && reg.IsRunning() {
+			reg.Resign()
+		}
+	}
+	if err := reg.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer reg.Stop()
+	for _, want := range []ElectionEvent{MasterTake, MasterLose} {
+		select {
+		case event := <-events:
+			if event != want {
+				t.Fatal("expect election event", want, "but got", event)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatal("timeout waiting for election event", want)
+		}
+	}
+}
+
+func TestEtcdRegistry_Watch(t *testing.T) {
+
+	e := newFakeEtcd()
+	defer e.server.Close()
+	first, second := newTestEtcdRegistry(e, "node0", false), newTestEtcdRegistry(e, "node1", false)
+	roleC, memberC := first.WatchRole(), first.WatchMembers()
+	if err := first.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer first.Stop()
+
+	// Role change of local node and joined members are sent to watchers.
+	if change := <-roleC; change.Role != Master || change.MasterId != "node0" {
+		t.Fatal("expect node0 take master but got", change)
+	}
+	if change := <-memberC; change.Event != MemberJoin || change.NodeId != "node0" {
+		t.Fatal("expect node0 join but got", change)
+	}
+	if err := second.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if change := <-memberC; change.Event != MemberJoin || change.NodeId != "node1" {
+		t.Fatal("expect node1 join but got", change)
+	}
+
+	// Leaving node is sent to member watchers.
+	second.Stop()
+	if change := <-memberC; change.Event != MemberLeave || change.NodeId != "node1" {
+		t.Fatal("expect node1 leave but got", change)
+	}
+
+	// Watchers receive role lost and are closed while registry stopped.
+	first.Stop()
+	if change := <-roleC; change.Role != Slaver {
+		t.Fatal("expect node0 lose master but got", change)
+	}
+	if _, ok := <-roleC; ok {
+		t.Fatal("expect role watcher closed")
+	}
+	if _, ok := <-memberC; ok {
+		t.Fatal("expect member watcher closed")
+	}
+}
+
+func TestEtcdRegistry_ElectionTtl(t *testing.T) {
+
+	e := newFakeEtcd()
+	defer e.server.Close()
+	reg := newTestEtcdRegistry(e, "node0", false)
+	reg.config.ElectionTtl = 1500 * time.Millisecond
+	if err := reg.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer reg.Stop()
+	waitFor(t, "node0 take master", reg.IsMaster)
+
+	// Lease ttl in seconds is rounded up from election ttl.
+	if ttl := e.leaseTtl(reg.leaseId); ttl != 2 {
+		t.Fatal("expect lease ttl of 2 seconds but got", ttl)
+	}
+}
+
+// waitFor wait at most 3 seconds until condition is satisfied.
+func waitFor(t *testing.T, description string, condition func() bool) {
+	deadline := time.Now().Add(3 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for", description)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitEvent wait at most 3 seconds until specified backend event received, election errors are skipped.
+func waitEvent(t *testing.T, events chan BackendEvent, want BackendEvent) {
+	timeout := time.After(3 * time.Second)
+	for {
+		select {
+		case event := <-events:
+			if event == want {
+				return
+			}
+			if event != ElectionError {
+				t.Fatal("expect backend event", want, "but got", event)
+			}
+		case <-timeout:
+			t.Fatal("timeout waiting for backend event", want)
+		}
+	}
+}
@@ -0,0 +1,552 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package registry
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mervinkid/matcha/logging"
+	"github.com/mervinkid/matcha/misc"
+	"github.com/mervinkid/matcha/task"
+	"github.com/mervinkid/matcha/util"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	kubernetesLeaseTtl       = 10 * time.Second
+	kubernetesElectionDelay  = 3 * time.Second
+	kubernetesRequestTimeout = 3 * time.Second
+	kubernetesAppLabel       = "matcha.registry/app"
+	kubernetesTimeFormat     = "2006-01-02T15:04:05.000000Z07:00"
+	kubernetesLeasePath      = "/apis/coordination.k8s.io/v1/namespaces/%s/leases"
+
+	kubernetesServiceAccountPath = "/var/run/secrets/kubernetes.io/serviceaccount/"
+)
+
+var errKubernetesConflict = errors.New("kubernetes lease has been modified")
+
+type kubernetesMetadata struct {
+	Name            string            `json:"name"`
+	ResourceVersion string            `json:"resourceVersion,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+}
+
+type kubernetesLeaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int64  `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int64  `json:"leaseTransitions"`
+}
+
+type kubernetesLease struct {
+	ApiVersion string              `json:"apiVersion"`
+	Kind       string              `json:"kind"`
+	Metadata   kubernetesMetadata  `json:"metadata"`
+	Spec       kubernetesLeaseSpec `json:"spec"`
+}
+
+// expired returns true if lease has no holder or has not been renewed within its duration.
+func (l *kubernetesLease) expired(now time.Time) bool {
+	if l.Spec.HolderIdentity == "" {
+		return true
+	}
+	renewTime, err := time.Parse(time.RFC3339Nano, l.Spec.RenewTime)
+	if err != nil {
+		return true
+	}
+	return now.After(renewTime.Add(time.Duration(l.Spec.LeaseDurationSeconds) * time.Second))
+}
+
+// hold set holder of lease to specified identity and renew it.
+func (l *kubernetesLease) hold(identity string, ttl time.Duration, now time.Time) {
+	if l.Spec.HolderIdentity != identity {
+		l.Spec.HolderIdentity = identity
+		l.Spec.AcquireTime = now.UTC().Format(kubernetesTimeFormat)
+		l.Spec.LeaseTransitions++
+	}
+	l.Spec.LeaseDurationSeconds = int64((ttl + time.Second - 1) / time.Second)
+	l.Spec.RenewTime = now.UTC().Format(kubernetesTimeFormat)
+}
+
+func newKubernetesLease(name string, labels map[string]string) *kubernetesLease {
+	return &kubernetesLease{
+		ApiVersion: "coordination.k8s.io/v1",
+		Kind:       "Lease",
+		Metadata:   kubernetesMetadata{Name: name, Labels: labels},
+	}
+}
+
+// kubernetesStatusError is the error of request which api server responded with unexpected status.
+type kubernetesStatusError struct {
+	path    string
+	status  int
+	message string
+}
+
+func (e *kubernetesStatusError) Error() string {
+	return fmt.Sprintf("kubernetes %s fail with status %d: %s", e.path, e.status, e.message)
+}
+
+// kubernetesClient is a minimal client of Lease API of kubernetes api server.
+type kubernetesClient struct {
+	endpoint   string
+	namespace  string
+	token      string
+	httpClient *http.Client
+}
+
+// call send request with specified method and path, and decode JSON response if response is not nil.
+func (c *kubernetesClient) call(method, path string, body, response interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	request, err := http.NewRequest(method, c.endpoint+path, reader)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusConflict {
+		return errKubernetesConflict
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return &kubernetesStatusError{path: path, status: resp.StatusCode, message: string(message)}
+	}
+	if response == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
+
+func (c *kubernetesClient) leasesPath() string {
+	return fmt.Sprintf(kubernetesLeasePath, c.namespace)
+}
+
+// getLease returns lease with specified name, or nil if it does not exist.
+func (c *kubernetesClient) getLease(name string) (*kubernetesLease, error) {
+	lease := &kubernetesLease{}
+	err := c.call(http.MethodGet, c.leasesPath()+"/"+name, nil, lease)
+	if statusErr, ok := err.(*kubernetesStatusError); ok && statusErr.status == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return lease, nil
+}
+
+// createLease create lease. Returns errKubernetesConflict if it already exists.
+func (c *kubernetesClient) createLease(lease *kubernetesLease) error {
+	return c.call(http.MethodPost, c.leasesPath(), lease, nil)
+}
+
+// updateLease replace lease with optimistic concurrency by resource version. Returns
+// errKubernetesConflict if it has been modified by others.
+func (c *kubernetesClient) updateLease(lease *kubernetesLease) error {
+	return c.call(http.MethodPut, c.leasesPath()+"/"+lease.Metadata.Name, lease, nil)
+}
+
+func (c *kubernetesClient) deleteLease(name string) error {
+	return c.call(http.MethodDelete, c.leasesPath()+"/"+name, nil, nil)
+}
+
+// listLeases returns leases matching specified label selector.
+func (c *kubernetesClient) listLeases(labelSelector string) ([]kubernetesLease, error) {
+	var response struct {
+		Items []kubernetesLease `json:"items"`
+	}
+	path := c.leasesPath() + "?labelSelector=" + url.QueryEscape(labelSelector)
+	if err := c.call(http.MethodGet, path, nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Items, nil
+}
+
+// newKubernetesClient create client for api server in host and port of url, or the api server of
+// current cluster with service account if host is not set. Namespace can be set with "namespace"
+// param of url, default is the namespace of service account.
+//  kubernetes://
+//  kubernetes://127.0.0.1:8001?namespace=default&scheme=http
+func newKubernetesClient(address util.URL) (*kubernetesClient, error) {
+	client := &kubernetesClient{namespace: address.Param["namespace"]}
+	transport := &http.Transport{}
+	if address.Host != "" {
+		scheme := address.Param["scheme"]
+		if scheme == "" {
+			scheme = "https"
+		}
+		client.endpoint = scheme + "://" + address.Address()
+	} else {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, ErrInvalidHost
+		}
+		client.endpoint = "https://" + host + ":" + port
+		token, err := ioutil.ReadFile(kubernetesServiceAccountPath + "token")
+		if err != nil {
+			return nil, err
+		}
+		client.token = strings.TrimSpace(string(token))
+		ca, err := ioutil.ReadFile(kubernetesServiceAccountPath + "ca.crt")
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(ca)
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+		if client.namespace == "" {
+			if namespace, err := ioutil.ReadFile(kubernetesServiceAccountPath + "namespace"); err == nil {
+				client.namespace = strings.TrimSpace(string(namespace))
+			}
+		}
+	}
+	if client.namespace == "" {
+		client.namespace = "default"
+	}
+	client.httpClient = &http.Client{Transport: transport, Timeout: kubernetesRequestTimeout}
+	return client, nil
+}
+
+// kubernetesRegistry is the implementation of Registry interface based on Lease API of kubernetes.
+// Master holds the election lease, and each node renews a lease of its own labeled with app id
+// for membership. App id and node id should be valid DNS subdomain names.
+//  +-------------------------------+     +-------------------------------------+
+//  | lease {appId}                 |     | lease {appId}-node-{nodeId} (label) |
+//  |  holderIdentity = master      |     |  holderIdentity = nodeId            |
+//  +-------------------------------+     +-------------------------------------+
+type kubernetesRegistry struct {
+	// Props
+	config Config
+	// Runtime
+	client            *kubernetesClient
+	role              roleState
+	watch             watchHub
+	backend           backendState
+	ttl               time.Duration
+	interval          time.Duration
+	takeover          takeoverGuard
+	electionScheduler task.Scheduler
+	electionMutex     sync.Mutex
+	// State
+	running    bool
+	stateMutex sync.RWMutex
+	waitGroup  sync.WaitGroup
+}
+
+func (r *kubernetesRegistry) String() string {
+	return "kubernetes-registry-" + r.config.AppId
+}
+
+func (r *kubernetesRegistry) Type() string {
+	return "kubernetes"
+}
+
+func (r *kubernetesRegistry) Start() error {
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+	if !r.running {
+		if r.config.NodeId == "" {
+			r.config.NodeId = generateNodeId(r.config.AppId)
+		}
+		client, err := newKubernetesClient(r.config.Url)
+		if err != nil {
+			return err
+		}
+		r.client = client
+		r.ttl, r.interval = electionTiming(r.config, kubernetesLeaseTtl, kubernetesElectionDelay)
+		r.backend.reset(r.interval)
+		electionScheduler := task.NewFixedDelayScheduler(r.electionTask, r.interval)
+		if err := misc.LifecycleStart(electionScheduler); err != nil {
+			r.client = nil
+			return err
+		}
+		r.electionScheduler = electionScheduler
+		r.running = true
+		r.waitGroup.Add(1)
+	}
+	return nil
+}
+
+func (r *kubernetesRegistry) Stop() {
+	defer r.watch.flushCallbacks()
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+	if r.running {
+		misc.LifecycleStop(r.electionScheduler)
+		r.electionScheduler = nil
+		// Wait for running election task
+		r.electionMutex.Lock()
+		if err := r.release(); err != nil {
+			logging.Warn("Release kubernetes lease fail cause %s.", err.Error())
+		}
+		if !r.config.Observer {
+			if err := r.client.deleteLease(r.nodeLeaseName()); err != nil {
+				logging.Warn("Delete kubernetes node lease fail cause %s.", err.Error())
+			}
+		}
+		r.client = nil
+		r.changeRole(Slaver, unknownNodeId)
+		r.electionMutex.Unlock()
+		r.watch.close()
+		r.running = false
+		r.waitGroup.Done()
+	}
+}
+
+func (r *kubernetesRegistry) IsRunning() bool {
+	r.stateMutex.RLock()
+	defer r.stateMutex.RUnlock()
+	return r.running
+}
+
+func (r *kubernetesRegistry) Sync() {
+	r.waitGroup.Wait()
+}
+
+func (r *kubernetesRegistry) IsMaster() bool {
+	return r.role.isMaster()
+}
+
+func (r *kubernetesRegistry) Master() (string, bool) {
+	return r.role.master()
+}
+
+func (r *kubernetesRegistry) FencingToken() (uint64, bool) {
+	return r.role.fencingToken()
+}
+
+func (r *kubernetesRegistry) Nodes() []NodeInfo {
+	return nodeInfos(&r.role, &r.watch)
+}
+
+func (r *kubernetesRegistry) Healthy() bool {
+	return r.backend.healthy()
+}
+
+func (r *kubernetesRegistry) Resign() error {
+	defer r.watch.flushCallbacks()
+	r.electionMutex.Lock()
+	defer r.electionMutex.Unlock()
+	if r.client == nil || !r.IsMaster() {
+		return nil
+	}
+	if err := r.release(); err != nil {
+		return err
+	}
+	r.takeover.resign(r.ttl)
+	r.changeRole(Slaver, unknownNodeId)
+	return nil
+}
+
+func (r *kubernetesRegistry) WatchRole() <-chan RoleChange {
+	return r.watch.watchRole()
+}
+
+func (r *kubernetesRegistry) WatchMembers() <-chan MemberChange {
+	return r.watch.watchMembers()
+}
+
+func (r *kubernetesRegistry) Subscribe(handler func(event ElectionEvent, masterId string)) SubscriptionId {
+	return r.watch.events.subscribe(handler)
+}
+
+func (r *kubernetesRegistry) Unsubscribe(id SubscriptionId) {
+	r.watch.events.unsubscribe(id)
+}
+
+func (r *kubernetesRegistry) NotifyLeadership(notify func()) func() {
+	return r.watch.notifyLeadership(notify)
+}
+
+func (r *kubernetesRegistry) electionLeaseName() string {
+	return r.config.AppId
+}
+
+func (r *kubernetesRegistry) nodeLeaseName() string {
+	return r.config.AppId + "-node-" + r.config.NodeId
+}
+
+// release clear holder of election lease if it is held by local node.
+func (r *kubernetesRegistry) release() error {
+	lease, err := r.client.getLease(r.electionLeaseName())
+	if err != nil || lease == nil || lease.Spec.HolderIdentity != r.config.NodeId {
+		return err
+	}
+	lease.Spec.HolderIdentity = ""
+	lease.Spec.LeaseDurationSeconds = 1
+	return r.client.updateLease(lease)
+}
+
+// refreshNode create or renew node lease of local node.
+func (r *kubernetesRegistry) refreshNode() error {
+	now := time.Now()
+	lease, err := r.client.getLease(r.nodeLeaseName())
+	if err != nil {
+		return err
+	}
+	if lease == nil {
+		lease = newKubernetesLease(r.nodeLeaseName(), map[string]string{kubernetesAppLabel: r.config.AppId})
+		lease.hold(r.config.NodeId, r.ttl, now)
+		return r.client.createLease(lease)
+	}
+	lease.hold(r.config.NodeId, r.ttl, now)
+	return r.client.updateLease(lease)
+}
+
+// refreshMembers update members with node leases which have not expired.
+func (r *kubernetesRegistry) refreshMembers() error {
+	leases, err := r.client.listLeases(kubernetesAppLabel + "=" + r.config.AppId)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	var nodeIds []string
+	for i := range leases {
+		if !leases[i].expired(now) {
+			nodeIds = append(nodeIds, leases[i].Spec.HolderIdentity)
+		}
+	}
+	r.watch.updateMembers(nodeIds)
+	return nil
+}
+
+// campaign renew election lease if local node holds it, or try to take it over if it has expired.
+// Observer never takes it over. Returns id of current master.
+func (r *kubernetesRegistry) campaign() (string, error) {
+	now := time.Now()
+	lease, err := r.client.getLease(r.electionLeaseName())
+	if err != nil {
+		return "", err
+	}
+	if lease == nil {
+		if r.config.Observer || !r.takeover.allow(true, r.config.TakeoverGrace) {
+			return unknownNodeId, nil
+		}
+		lease = newKubernetesLease(r.electionLeaseName(), nil)
+		lease.hold(r.config.NodeId, r.ttl, now)
+		err = r.client.createLease(lease)
+	} else if lease.Spec.HolderIdentity == r.config.NodeId {
+		lease.hold(r.config.NodeId, r.ttl, now)
+		err = r.client.updateLease(lease)
+	} else {
+		expired := lease.expired(now)
+		if r.config.Observer || !r.takeover.allow(expired, r.config.TakeoverGrace) {
+			if expired || lease.Spec.HolderIdentity == "" {
+				return unknownNodeId, nil
+			}
+			return lease.Spec.HolderIdentity, nil
+		}
+		lease.hold(r.config.NodeId, r.ttl, now)
+		err = r.client.updateLease(lease)
+	}
+	if err == errKubernetesConflict {
+		// Modified by others, retry in next round
+		return unknownNodeId, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	// Lease transitions increases monotonically for each new holder and is used as fencing token
+	r.takeover.reset()
+	r.role.setToken(uint64(lease.Spec.LeaseTransitions))
+	return r.config.NodeId, nil
+}
+
+func (r *kubernetesRegistry) electionTask() {
+	defer r.watch.flushCallbacks()
+	r.electionMutex.Lock()
+	defer r.electionMutex.Unlock()
+	if r.client == nil {
+		return
+	}
+	// Back off checks while backend keeps failing, master keeps renewing to hold its role
+	if backoffGuard(&r.role, &r.backend, r.degradeRole) {
+		return
+	}
+
+	// Observer has no node lease, connectivity is checked by refreshing members
+	if !r.config.Observer {
+		if err := r.refreshNode(); err != nil && err != errKubernetesConflict {
+			logging.Error("Refresh node lease with kubernetes fail cause %s.", err.Error())
+			r.backend.fail(r.config, &r.watch, err)
+			r.degradeRole()
+			return
+		}
+	}
+	if err := r.refreshMembers(); err != nil {
+		if r.config.Observer {
+			logging.Error("Refresh members with kubernetes fail cause %s.", err.Error())
+			r.backend.fail(r.config, &r.watch, err)
+			r.degradeRole()
+			return
+		}
+		logging.Warn("Refresh members with kubernetes fail cause %s.", err.Error())
+	}
+	r.backend.ok(r.config, &r.watch)
+	master, err := r.campaign()
+	if err != nil {
+		logging.Error("Campaign with kubernetes fail cause %s.", err.Error())
+		notifyElectionError(r.config, &r.watch, err)
+		r.degradeRole()
+		return
+	}
+	if master == r.config.NodeId {
+		r.changeRole(Master, master)
+	} else {
+		r.changeRole(Slaver, master)
+	}
+}
+
+func (r *kubernetesRegistry) changeRole(newRole Role, newMaster string) {
+	updateRole(r.config, &r.role, &r.watch, newRole, newMaster)
+}
+
+// degradeRole demote local node on backend failure unless role was confirmed within ttl.
+func (r *kubernetesRegistry) degradeRole() {
+	degradeRole(r.config, &r.role, &r.watch, r.ttl-r.interval)
+}
@@ -0,0 +1,227 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mervinkid/matcha/util"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeKubernetes is a fake api server which keeps leases of namespace default in memory and
+// checks resource version on update. Requests fail with status 503 while it is down.
+type fakeKubernetes struct {
+	server   *httptest.Server
+	leases   map[string]kubernetesLease
+	version  int
+	renewals map[string]int
+	down     bool
+	mutex    sync.Mutex
+}
+
+func newFakeKubernetes() *fakeKubernetes {
+	k := &fakeKubernetes{leases: make(map[string]kubernetesLease), renewals: make(map[string]int)}
+	k.server = httptest.NewServer(http.HandlerFunc(k.serve))
+	return k
+}
+
+func (k *fakeKubernetes) setDown(down bool) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.down = down
+}
+
+func (k *fakeKubernetes) holder(name string) string {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	return k.leases[name].Spec.HolderIdentity
+}
+
+func (k *fakeKubernetes) renewCount(name string) int {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	return k.renewals[name]
+}
+
+func (k *fakeKubernetes) serve(w http.ResponseWriter, r *http.Request) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if k.down {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	leasesPath := fmt.Sprintf(kubernetesLeasePath, "default")
+	if !strings.HasPrefix(r.URL.Path, leasesPath) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, leasesPath), "/")
+	var response interface{}
+	switch r.Method {
+	case http.MethodGet:
+		if name == "" {
+			selector := strings.SplitN(r.URL.Query().Get("labelSelector"), "=", 2)
+			items := []kubernetesLease{}
+			for _, lease := range k.leases {
+				if len(selector) == 2 && lease.Metadata.Labels[selector[0]] == selector[1] {
+					items = append(items, lease)
+				}
+			}
+			response = map[string][]kubernetesLease{"items": items}
+			break
+		}
+		lease, ok := k.leases[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		response = lease
+	case http.MethodPost, http.MethodPut:
+		var lease kubernetesLease
+		json.NewDecoder(r.Body).Decode(&lease)
+		current, ok := k.leases[lease.Metadata.Name]
+		if r.Method == http.MethodPost && ok ||
+			r.Method == http.MethodPut && (!ok || current.Metadata.ResourceVersion != lease.Metadata.ResourceVersion) {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		if ok && current.Spec.HolderIdentity == lease.Spec.HolderIdentity {
+			k.renewals[lease.Metadata.Name]++
+		}
+		k.version++
+		lease.Metadata.ResourceVersion = strconv.Itoa(k.version)
+		k.leases[lease.Metadata.Name] = lease
+		response = lease
+	case http.MethodDelete:
+		delete(k.leases, name)
+		response = struct{}{}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// newTestKubernetesRegistry create kubernetes registry of specified node with fake api server and
+// short election timing.
+func newTestKubernetesRegistry(k *fakeKubernetes, nodeId string, observer bool) *kubernetesRegistry {
+	return &kubernetesRegistry{config: Config{
+		AppId:            "demo",
+		NodeId:           nodeId,
+		Url:              util.ParseUrl("kubernetes://" + strings.TrimPrefix(k.server.URL, "http://") + "?scheme=http"),
+		Observer:         observer,
+		ElectionTtl:      time.Second,
+		ElectionInterval: 50 * time.Millisecond,
+	}}
+}
+
+func TestKubernetesRegistry_Election(t *testing.T) {
+
+	k := newFakeKubernetes()
+	defer k.server.Close()
+	first, second := newTestKubernetesRegistry(k, "node0", false), newTestKubernetesRegistry(k, "node1", false)
+	observer := newTestKubernetesRegistry(k, "observer", true)
+	for _, reg := range []*kubernetesRegistry{first, observer} {
+		if err := reg.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer reg.Stop()
+	}
+	waitFor(t, "node0 take master", first.IsMaster)
+	if err := second.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer second.Stop()
+	waitFor(t, "members registered", func() bool {
+		return len(second.Nodes()) == 2 && len(observer.Nodes()) == 2
+	})
+	if token, ok := first.FencingToken(); !ok || token != 1 {
+		t.Fatal("expect lease transitions as fencing token of master but got", token)
+	}
+
+	// Master renews election lease while slaver and observer follow it.
+	renewals := k.renewCount("demo")
+	time.Sleep(200 * time.Millisecond)
+	if k.renewCount("demo") <= renewals || !first.IsMaster() || k.holder("demo") != "node0" {
+		t.Fatal("expect master renews and holds election lease")
+	}
+	for _, reg := range []*kubernetesRegistry{second, observer} {
+		if master, ok := reg.Master(); reg.IsMaster() || !ok || master != "node0" {
+			t.Fatal("expect node0 as master but got", master)
+		}
+	}
+
+	// Slaver takes over after master stopped and released election lease.
+	first.Stop()
+	if k.holder("demo-node-node0") != "" {
+		t.Fatal("expect node lease deleted after stop")
+	}
+	waitFor(t, "node1 take master", second.IsMaster)
+	if token, _ := second.FencingToken(); token != 2 {
+		t.Fatal("expect fencing token increased but got", token)
+	}
+	waitFor(t, "observer follow node1", func() bool {
+		master, _ := observer.Master()
+		return master == "node1" && !observer.IsMaster()
+	})
+}
+
+func TestKubernetesRegistry_Failure(t *testing.T) {
+
+	k := newFakeKubernetes()
+	defer k.server.Close()
+	events := make(chan BackendEvent, 64)
+	reg := newTestKubernetesRegistry(k, "node0", false)
+	reg.config.Backend = func(event BackendEvent, err error) {
+		events <- event
+	}
+	if err := reg.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer reg.Stop()
+	waitFor(t, "node0 take master", reg.IsMaster)
+
+	// Master is kept while api server is briefly unreachable.
+	k.setDown(true)
+	waitEvent(t, events, BackendUnreachable)
+	if reg.Healthy() {
+		t.Fatal("expect backend unhealthy")
+	}
+	k.setDown(false)
+	waitEvent(t, events, Reconnected)
+	if !reg.IsMaster() {
+		t.Fatal("expect master kept while api server briefly unreachable")
+	}
+
+	// Master is lost while api server keeps unreachable after window.
+	k.setDown(true)
+	waitEvent(t, events, BackendUnreachable)
+	waitFor(t, "node0 lose master", func() bool {
+		master, _ := reg.Master()
+		return !reg.IsMaster() && master == unknownNodeId
+	})
+}
@@ -0,0 +1,306 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package registry
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const memoryElectionTtl = time.Second
+
+var (
+	memoryClusters      = make(map[string]*memoryCluster)
+	memoryClustersMutex sync.Mutex
+	// memoryEpoch is the sequence of election results of all clusters. It increases while cluster
+	// lock held, so that results notified out of lock can be ordered.
+	memoryEpoch uint64
+)
+
+// memoryCluster is the in-process election state shared by memory registries with the same host
+// of url and app id. The earliest joined node which is not observer or in resign hold-off takes
+// master role.
+type memoryCluster struct {
+	name        string
+	nodes       []*memoryRegistry
+	masterId    string
+	token       uint64
+	resignUntil map[string]time.Time
+	mutex       sync.Mutex
+}
+
+// join add node into cluster and returns the cluster.
+func joinMemoryCluster(node *memoryRegistry) *memoryCluster {
+	name := node.config.Url.Host + "/" + node.config.AppId
+	memoryClustersMutex.Lock()
+	cluster, ok := memoryClusters[name]
+	if !ok {
+		cluster = &memoryCluster{name: name, resignUntil: make(map[string]time.Time)}
+		memoryClusters[name] = cluster
+	}
+	cluster.mutex.Lock()
+	cluster.nodes = append(cluster.nodes, node)
+	cluster.mutex.Unlock()
+	memoryClustersMutex.Unlock()
+	cluster.elect()
+	return cluster
+}
+
+// leave remove node from cluster, the cluster will be dropped while it is empty. Returns epoch of
+// the leave, results of elections before it should be ignored by the node.
+func (c *memoryCluster) leave(node *memoryRegistry) uint64 {
+	memoryClustersMutex.Lock()
+	c.mutex.Lock()
+	for i, member := range c.nodes {
+		if member == node {
+			c.nodes = append(c.nodes[:i], c.nodes[i+1:]...)
+			break
+		}
+	}
+	if c.masterId == node.config.NodeId {
+		c.masterId = ""
+	}
+	delete(c.resignUntil, node.config.NodeId)
+	if len(c.nodes) == 0 {
+		delete(memoryClusters, c.name)
+	}
+	epoch := atomic.AddUint64(&memoryEpoch, 1)
+	c.mutex.Unlock()
+	memoryClustersMutex.Unlock()
+	c.elect()
+	return epoch
+}
+
+// resign release master role of node which will not take master role again within hold-off.
+// Returns false if node is not master.
+func (c *memoryCluster) resign(node *memoryRegistry, holdOff time.Duration) bool {
+	c.mutex.Lock()
+	if c.masterId != node.config.NodeId {
+		c.mutex.Unlock()
+		return false
+	}
+	c.masterId = ""
+	c.resignUntil[node.config.NodeId] = time.Now().Add(holdOff)
+	epoch := atomic.AddUint64(&memoryEpoch, 1)
+	c.mutex.Unlock()
+	node.applyElection(epoch, func() {
+		node.changeRole(Slaver, unknownNodeId)
+	})
+	node.watch.flushCallbacks()
+	c.elect()
+	return true
+}
+
+// elect choose master if there is no master and notify all nodes. Election will be triggered
+// again while resign hold-off expired if all nodes are in hold-off.
+func (c *memoryCluster) elect() {
+	c.mutex.Lock()
+	now := time.Now()
+	if c.masterId == "" {
+		var retryAt time.Time
+		for _, node := range c.nodes {
+			if node.config.Observer {
+				continue
+			}
+			until := c.resignUntil[node.config.NodeId]
+			if !now.Before(until) {
+				c.masterId = node.config.NodeId
+				c.token++
+				break
+			}
+			if retryAt.IsZero() || until.Before(retryAt) {
+				retryAt = until
+			}
+		}
+		if c.masterId == "" && !retryAt.IsZero() {
+			time.AfterFunc(retryAt.Sub(now), c.elect)
+		}
+	}
+	nodes := make([]*memoryRegistry, len(c.nodes))
+	copy(nodes, c.nodes)
+	masterId := c.masterId
+	token := c.token
+	epoch := atomic.AddUint64(&memoryEpoch, 1)
+	c.mutex.Unlock()
+
+	// Notify out of lock for callbacks to access registry, stale results are ignored by nodes
+	var nodeIds []string
+	for _, node := range nodes {
+		if !node.config.Observer {
+			nodeIds = append(nodeIds, node.config.NodeId)
+		}
+	}
+	for _, node := range nodes {
+		node := node
+		node.applyElection(epoch, func() {
+			node.watch.updateMembers(nodeIds)
+			switch {
+			case masterId == node.config.NodeId:
+				node.role.setToken(token)
+				node.changeRole(Master, masterId)
+			case masterId == "":
+				node.changeRole(Slaver, unknownNodeId)
+			default:
+				node.changeRole(Slaver, masterId)
+			}
+		})
+		node.watch.flushCallbacks()
+	}
+}
+
+// memoryRegistry is the in-process implementation of Registry interface for unit tests and local
+// development. Registries with the same host of url and app id join the same cluster.
+//  memory://cluster
+type memoryRegistry struct {
+	// Props
+	config Config
+	// Runtime
+	role    roleState
+	watch   watchHub
+	cluster *memoryCluster
+	ttl     time.Duration
+	// Epoch of the latest election result applied
+	epoch      uint64
+	epochMutex sync.Mutex
+	// State
+	running    bool
+	stateMutex sync.RWMutex
+	waitGroup  sync.WaitGroup
+}
+
+func (r *memoryRegistry) String() string {
+	return "memory-registry-" + r.config.AppId
+}
+
+func (r *memoryRegistry) Type() string {
+	return "memory"
+}
+
+func (r *memoryRegistry) Start() error {
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+	if !r.running {
+		if r.config.NodeId == "" {
+			r.config.NodeId = generateNodeId(r.config.AppId)
+		}
+		r.ttl, _ = electionTiming(r.config, memoryElectionTtl, memoryElectionTtl/2)
+		r.cluster = joinMemoryCluster(r)
+		r.running = true
+		r.waitGroup.Add(1)
+	}
+	return nil
+}
+
+func (r *memoryRegistry) Stop() {
+	defer r.watch.flushCallbacks()
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+	if r.running {
+		epoch := r.cluster.leave(r)
+		r.cluster = nil
+		r.applyElection(epoch, func() {
+			r.changeRole(Slaver, unknownNodeId)
+		})
+		r.watch.close()
+		r.running = false
+		r.waitGroup.Done()
+	}
+}
+
+func (r *memoryRegistry) IsRunning() bool {
+	r.stateMutex.RLock()
+	defer r.stateMutex.RUnlock()
+	return r.running
+}
+
+func (r *memoryRegistry) Sync() {
+	r.waitGroup.Wait()
+}
+
+func (r *memoryRegistry) IsMaster() bool {
+	return r.role.isMaster()
+}
+
+func (r *memoryRegistry) Master() (string, bool) {
+	return r.role.master()
+}
+
+func (r *memoryRegistry) FencingToken() (uint64, bool) {
+	return r.role.fencingToken()
+}
+
+func (r *memoryRegistry) Nodes() []NodeInfo {
+	return nodeInfos(&r.role, &r.watch)
+}
+
+// Healthy always returns true since memory registry has no remote backend.
+func (r *memoryRegistry) Healthy() bool {
+	return true
+}
+
+func (r *memoryRegistry) Resign() error {
+	r.stateMutex.RLock()
+	cluster := r.cluster
+	r.stateMutex.RUnlock()
+	if cluster != nil {
+		cluster.resign(r, r.ttl)
+	}
+	return nil
+}
+
+func (r *memoryRegistry) WatchRole() <-chan RoleChange {
+	return r.watch.watchRole()
+}
+
+func (r *memoryRegistry) WatchMembers() <-chan MemberChange {
+	return r.watch.watchMembers()
+}
+
+func (r *memoryRegistry) Subscribe(handler func(event ElectionEvent, masterId string)) SubscriptionId {
+	return r.watch.events.subscribe(handler)
+}
+
+func (r *memoryRegistry) Unsubscribe(id SubscriptionId) {
+	r.watch.events.unsubscribe(id)
+}
+
+func (r *memoryRegistry) NotifyLeadership(notify func()) func() {
+	return r.watch.notifyLeadership(notify)
+}
+
+func (r *memoryRegistry) changeRole(newRole Role, newMaster string) {
+	updateRole(r.config, &r.role, &r.watch, newRole, newMaster)
+}
+
+// applyElection invoke apply with election result of specified epoch. Results are notified out of
+// cluster lock and may arrive out of order, the one older than applied is ignored.
+func (r *memoryRegistry) applyElection(epoch uint64, apply func()) {
+	r.epochMutex.Lock()
+	defer r.epochMutex.Unlock()
+	if epoch <= r.epoch {
+		return
+	}
+	r.epoch = epoch
+	apply()
+}
@@ -0,0 +1,67 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package registry
+
+import (
+	"github.com/mervinkid/matcha/util"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoryRegistry_StaleElection(t *testing.T) {
+
+	reg := &memoryRegistry{config: Config{
+		AppId:       "stale",
+		NodeId:      "node0",
+		Url:         util.ParseUrl("memory://test"),
+		ElectionTtl: time.Minute,
+	}}
+	if err := reg.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer reg.Stop()
+	if !reg.IsMaster() {
+		t.Fatal("expect node0 take master")
+	}
+
+	// Result of election before resign arrives late and is ignored.
+	stale := atomic.LoadUint64(&memoryEpoch)
+	reg.Resign()
+	reg.applyElection(stale, func() {
+		reg.changeRole(Master, reg.config.NodeId)
+	})
+	if master, _ := reg.Master(); reg.IsMaster() || master != unknownNodeId {
+		t.Fatal("expect stale election result ignored but master is", master)
+	}
+
+	// Result of election before stop is ignored after stopped.
+	stale = atomic.LoadUint64(&memoryEpoch)
+	reg.Stop()
+	reg.applyElection(stale, func() {
+		reg.changeRole(Master, reg.config.NodeId)
+	})
+	if reg.IsMaster() {
+		t.Fatal("expect stale election result ignored after stopped")
+	}
+}
@@ -0,0 +1,244 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package registry
+
+import (
+	"errors"
+	"github.com/mervinkid/matcha/logging"
+	"github.com/mervinkid/matcha/misc"
+	"github.com/mervinkid/matcha/task"
+	"sort"
+	"sync"
+	"time"
+)
+
+const partitionBalanceDelay = 3 * time.Second
+
+var ErrInvalidPartition = errors.New("invalid partition")
+
+// PartitionedRegistry is the interface of registry which elects master for each named partition
+// within one app. A node resigns partitions beyond its fair share (partitions / nodes) for other
+// nodes to take over, so partitions will be spread across the cluster.
+// Methods:
+//  Partitions returns name of all partitions.
+//  IsMaster returns true if local node current holds master role of partition.
+//  Master returns id of current master of partition and true if master is known.
+//  Owned returns partitions of which local node current holds master role.
+//  Resign release master role of partition voluntarily.
+//
+// Model:
+//  +--------------------+     +------------------------------+
+//  |                    | → → | Registry (appId-partition 0) |
+//  | PartitionedRegistry| → → | ...                          |
+//  |                    | → → | Registry (appId-partition N) |
+//  +--------------------+     +------------------------------+
+type PartitionedRegistry interface {
+	misc.Lifecycle
+	misc.Sync
+	Partitions() []string
+	IsMaster(partition string) bool
+	Master(partition string) (nodeId string, ok bool)
+	Owned() []string
+	Resign(partition string) error
+}
+
+type partitionedRegistry struct {
+	// Props
+	config     Config
+	partitions []string
+	election   func(partition string, event ElectionEvent, masterId string)
+	// Runtime
+	registries       map[string]Registry
+	balanceScheduler task.Scheduler
+	// State
+	running    bool
+	stateMutex sync.RWMutex
+	waitGroup  sync.WaitGroup
+}
+
+func (r *partitionedRegistry) Start() error {
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+	if !r.running {
+		if r.config.NodeId == "" {
+			r.config.NodeId = generateNodeId(r.config.AppId)
+		}
+		registries := make(map[string]Registry, len(r.partitions))
+		for _, partition := range r.partitions {
+			registry, err := NewRegister(r.partitionConfig(partition))
+			if err == nil {
+				err = registry.Start()
+			}
+			if err != nil {
+				for _, started := range registries {
+					started.Stop()
+				}
+				return err
+			}
+			registries[partition] = registry
+		}
+		interval := r.config.ElectionInterval
+		if interval <= 0 {
+			interval = partitionBalanceDelay
+		}
+		balanceScheduler := task.NewFixedDelayScheduler(r.balanceTask, interval)
+		if err := misc.LifecycleStart(balanceScheduler); err != nil {
+			for _, started := range registries {
+				started.Stop()
+			}
+			return err
+		}
+		r.registries = registries
+		r.balanceScheduler = balanceScheduler
+		r.running = true
+		r.waitGroup.Add(1)
+	}
+	return nil
+}
+
+func (r *partitionedRegistry) Stop() {
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+	if r.running {
+		misc.LifecycleStop(r.balanceScheduler)
+		r.balanceScheduler = nil
+		for _, registry := range r.registries {
+			registry.Stop()
+		}
+		r.registries = nil
+		r.running = false
+		r.waitGroup.Done()
+	}
+}
+
+func (r *partitionedRegistry) IsRunning() bool {
+	r.stateMutex.RLock()
+	defer r.stateMutex.RUnlock()
+	return r.running
+}
+
+func (r *partitionedRegistry) Sync() {
+	r.waitGroup.Wait()
+}
+
+func (r *partitionedRegistry) Partitions() []string {
+	partitions := make([]string, len(r.partitions))
+	copy(partitions, r.partitions)
+	return partitions
+}
+
+func (r *partitionedRegistry) IsMaster(partition string) bool {
+	registry := r.registry(partition)
+	return registry != nil && registry.IsMaster()
+}
+
+func (r *partitionedRegistry) Master(partition string) (string, bool) {
+	if registry := r.registry(partition); registry != nil {
+		return registry.Master()
+	}
+	return unknownNodeId, false
+}
+
+func (r *partitionedRegistry) Owned() []string {
+	var owned []string
+	for _, partition := range r.partitions {
+		if r.IsMaster(partition) {
+			owned = append(owned, partition)
+		}
+	}
+	return owned
+}
+
+func (r *partitionedRegistry) Resign(partition string) error {
+	registry := r.registry(partition)
+	if registry == nil {
+		return ErrInvalidPartition
+	}
+	return registry.Resign()
+}
+
+func (r *partitionedRegistry) registry(partition string) Registry {
+	r.stateMutex.RLock()
+	defer r.stateMutex.RUnlock()
+	return r.registries[partition]
+}
+
+// partitionConfig returns config of registry for specified partition. The app id of partition
+// registry is the app id with partition name as suffix.
+func (r *partitionedRegistry) partitionConfig(partition string) Config {
+	config := r.config
+	config.AppId = r.config.AppId + "-" + partition
+	if r.election != nil {
+		config.Election = func(event ElectionEvent, masterId string) {
+			r.election(partition, event, masterId)
+		}
+	}
+	return config
+}
+
+// balanceTask resign owned partitions beyond fair share of local node.
+func (r *partitionedRegistry) balanceTask() {
+	if r.config.Observer || len(r.partitions) == 0 {
+		return
+	}
+	nodes := 0
+	if registry := r.registry(r.partitions[0]); registry != nil {
+		nodes = len(registry.Nodes())
+	}
+	if nodes == 0 {
+		return
+	}
+	fairShare := (len(r.partitions) + nodes - 1) / nodes
+	owned := r.Owned()
+	sort.Strings(owned)
+	for i := fairShare; i < len(owned); i++ {
+		logging.Debug("Node %s resign partition %s for balance.", r.config.NodeId, owned[i])
+		if err := r.Resign(owned[i]); err != nil {
+			logging.Warn("Resign partition %s fail cause %s.", owned[i], err.Error())
+		}
+	}
+}
+
+// NewPartitionedRegistry create a PartitionedRegistry which elects master for each of specified
+// partitions with the backend in url of config. The Election of config is replaced by specified
+// election callback which receives name of partition.
+func NewPartitionedRegistry(config Config, partitions []string,
+	election func(partition string, event ElectionEvent, masterId string)) (PartitionedRegistry, error) {
+	if config.AppId == "" {
+		return nil, ErrInvalidAppId
+	}
+	seen := make(map[string]bool, len(partitions))
+	for _, partition := range partitions {
+		if partition == "" || seen[partition] {
+			return nil, ErrInvalidPartition
+		}
+		seen[partition] = true
+	}
+	registry := &partitionedRegistry{
+		config:   config,
+		election: election,
+	}
+	registry.partitions = make([]string, len(partitions))
+	copy(registry.partitions, partitions)
+	return registry, nil
+}
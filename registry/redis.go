@@ -23,32 +23,71 @@
 package registry
 
 import (
-	"crypto/md5"
-	"encoding/hex"
+	"context"
 	"fmt"
 	"github.com/gomodule/redigo/redis"
 	"github.com/mervinkid/matcha/logging"
 	"github.com/mervinkid/matcha/misc"
+	"github.com/mervinkid/matcha/parallel"
 	"github.com/mervinkid/matcha/task"
-	"math/rand"
-	"strconv"
+	"github.com/mervinkid/matcha/util"
+	"strings"
 	"sync"
 	"time"
 )
 
 const (
-	redisElectionTtl   = 6000
-	redisElectionDelay = 3 * time.Second
-	unknownNodeId      = "unknown"
+	redisElectionTtl     = 6 * time.Second
+	redisElectionDelay   = 3 * time.Second
+	redisPoolMaxIdle     = 4
+	redisPoolIdleTimeout = 5 * time.Minute
+)
+
+// redisDialRetryPolicy is the policy for dialing redis in pool.
+var redisDialRetryPolicy = parallel.RetryPolicy{
+	MaxAttempts: 3,
+	Backoff:     parallel.BackoffExponential,
+	Delay:       100 * time.Millisecond,
+	Jitter:      0.2,
+}
+
+// Scripts for atomic acquire with fencing token, compare-and-expire and compare-and-delete of
+// election lock.
+//  KEYS[1]: election key
+//  KEYS[2]: fencing key
+//  ARGV[1]: node id
+//  ARGV[2]: ttl in milliseconds
+var (
+	redisAcquireScript = redis.NewScript(2, `
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return redis.call("INCR", KEYS[2])
+end
+return 0`)
+	redisRenewScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+	redisReleaseScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
 )
 
 type redisRegistry struct {
 	// Props
 	config Config
 	// Runtime
-	role              Role
-	redisConn         redis.Conn
+	role              roleState
+	watch             watchHub
+	backend           backendState
+	redisPool         *redis.Pool
+	ttl               time.Duration
+	interval          time.Duration
+	takeover          takeoverGuard
 	electionScheduler task.Scheduler
+	electionMutex     sync.Mutex
 	// State
 	running    bool
 	stateMutex sync.RWMutex
@@ -59,7 +98,7 @@ func (r *redisRegistry) String() string {
 	return "redis-registry-" + r.config.AppId
 }
 
-func (redisRegistry) Type() string {
+func (r *redisRegistry) Type() string {
 	return "redis"
 }
 
@@ -67,9 +106,15 @@ func (r *redisRegistry) Start() error {
 	r.stateMutex.Lock()
 	defer r.stateMutex.Unlock()
 	if !r.running {
-		electionScheduler := task.NewFixedDelayScheduler(r.electionTask, redisElectionDelay)
+		r.redisPool = r.config.RedisPool
+		if r.redisPool == nil {
+			r.redisPool = NewRedisPool(r.config.Url)
+		}
+		r.ttl, r.interval = electionTiming(r.config, redisElectionTtl, redisElectionDelay)
+		r.backend.reset(r.interval)
+		electionScheduler := task.NewFixedDelayScheduler(r.electionTask, r.interval)
 		if err := misc.LifecycleStart(electionScheduler); err != nil {
-			r.redisConn.Close()
+			r.closePool()
 			return err
 		}
 		r.electionScheduler = electionScheduler
@@ -81,6 +126,7 @@ func (r *redisRegistry) Start() error {
 }
 
 func (r *redisRegistry) Stop() {
+	defer r.watch.flushCallbacks()
 	r.stateMutex.Lock()
 	defer r.stateMutex.Unlock()
 	if r.running {
@@ -88,11 +134,16 @@ func (r *redisRegistry) Stop() {
 			misc.LifecycleStop(r.electionScheduler)
 			r.electionScheduler = nil
 		}
-		if r.redisConn != nil {
-			r.releaseRole()
-			r.redisConn.Close()
-			r.redisConn = nil
-		}
+		// Wait for running election task
+		r.electionMutex.Lock()
+		conn := r.redisPool.Get()
+		r.releaseRole(conn)
+		r.changeRole(Slaver, unknownNodeId)
+		conn.Do("ZREM", r.membersKey(), r.config.NodeId)
+		conn.Close()
+		r.closePool()
+		r.electionMutex.Unlock()
+		r.watch.close()
 		r.running = false
 		r.waitGroup.Done()
 	}
@@ -108,96 +159,206 @@ func (r *redisRegistry) Sync() {
 	r.waitGroup.Wait()
 }
 
-func (r *redisRegistry) checkNodeId() {
-	if r.config.NodeId == "" {
-		timestamp := time.Now().UnixNano()
-		random := rand.New(rand.NewSource(timestamp)).Int63()
-		src := strconv.FormatInt(timestamp, 10) + strconv.FormatInt(random, 10)
-		hash := md5.New()
-		hash.Write([]byte(src))
-		hashCode := hex.EncodeToString(hash.Sum(nil))
-		r.config.NodeId = r.config.AppId + "-" + hashCode
-	}
+func (r *redisRegistry) IsMaster() bool {
+	return r.role.isMaster()
 }
 
-func (r *redisRegistry) checkConn() error {
-	if r.redisConn != nil {
-		_, err := r.redisConn.Do("PING")
-		if err == nil {
-			return nil
-		}
-		r.redisConn.Close()
-		r.redisConn = nil
+func (r *redisRegistry) Master() (string, bool) {
+	return r.role.master()
+}
+
+func (r *redisRegistry) FencingToken() (uint64, bool) {
+	return r.role.fencingToken()
+}
+
+func (r *redisRegistry) Nodes() []NodeInfo {
+	return nodeInfos(&r.role, &r.watch)
+}
+
+func (r *redisRegistry) Healthy() bool {
+	return r.backend.healthy()
+}
+
+func (r *redisRegistry) WatchRole() <-chan RoleChange {
+	return r.watch.watchRole()
+}
+
+func (r *redisRegistry) WatchMembers() <-chan MemberChange {
+	return r.watch.watchMembers()
+}
+
+func (r *redisRegistry) Subscribe(handler func(event ElectionEvent, masterId string)) SubscriptionId {
+	return r.watch.events.subscribe(handler)
+}
+
+func (r *redisRegistry) Unsubscribe(id SubscriptionId) {
+	r.watch.events.unsubscribe(id)
+}
+
+func (r *redisRegistry) NotifyLeadership(notify func()) func() {
+	return r.watch.notifyLeadership(notify)
+}
+
+func (r *redisRegistry) Resign() error {
+	defer r.watch.flushCallbacks()
+	r.electionMutex.Lock()
+	defer r.electionMutex.Unlock()
+	if r.redisPool == nil || !r.IsMaster() {
+		return nil
 	}
-	host := r.config.Url.Host
-	port := r.config.Url.Port
-	conn, err := redis.Dial("tcp", fmt.Sprintf("%s:%d", host, port))
-	if err != nil {
+	conn := r.redisPool.Get()
+	defer conn.Close()
+	if _, err := redisReleaseScript.Do(conn, r.electionKey(), r.config.NodeId); err != nil {
 		return err
 	}
-	r.redisConn = conn
+	r.takeover.resign(r.ttl)
+	r.changeRole(Slaver, unknownNodeId)
 	return nil
 }
 
+func (r *redisRegistry) checkNodeId() {
+	if r.config.NodeId == "" {
+		r.config.NodeId = generateNodeId(r.config.AppId)
+	}
+}
+
+// closePool close redis pool if it is not shared by config.
+func (r *redisRegistry) closePool() {
+	if r.redisPool != r.config.RedisPool {
+		r.redisPool.Close()
+	}
+	r.redisPool = nil
+}
+
 func (r *redisRegistry) electionKey() string {
 	return fmt.Sprintf("%s/election", r.config.AppId)
 }
 
+// ttlMillis returns election ttl in milliseconds.
+func (r *redisRegistry) ttlMillis() int64 {
+	return int64(r.ttl / time.Millisecond)
+}
+
+func (r *redisRegistry) fencingKey() string {
+	return fmt.Sprintf("%s/fencing", r.config.AppId)
+}
+
+func (r *redisRegistry) membersKey() string {
+	return fmt.Sprintf("%s/nodes", r.config.AppId)
+}
+
+// refreshMembers keep local node in member set with current timestamp as score, remove nodes
+// not refreshed within election ttl and update members.
+func (r *redisRegistry) refreshMembers(conn redis.Conn) error {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	// Pipeline commands in one round trip
+	if !r.config.Observer {
+		conn.Send("ZADD", r.membersKey(), now, r.config.NodeId)
+	}
+	conn.Send("ZREMRANGEBYSCORE", r.membersKey(), "-inf", now-r.ttlMillis())
+	conn.Send("ZRANGE", r.membersKey(), 0, -1)
+	replies, err := redis.Values(conn.Do(""))
+	if err != nil {
+		return err
+	}
+	nodeIds, err := redis.Strings(replies[len(replies)-1], nil)
+	if err != nil {
+		return err
+	}
+	r.watch.updateMembers(nodeIds)
+	return nil
+}
+
 func (r *redisRegistry) electionTask() {
+	defer r.watch.flushCallbacks()
+	r.electionMutex.Lock()
+	defer r.electionMutex.Unlock()
+	if r.redisPool == nil {
+		return
+	}
+	// Back off checks while backend keeps failing, master keeps renewing to hold its role
+	if backoffGuard(&r.role, &r.backend, r.degradeRole) {
+		return
+	}
 	// Init node id
 	r.checkNodeId()
-	if err := r.checkConn(); err != nil {
+	conn := r.redisPool.Get()
+	defer conn.Close()
+	if err := conn.Err(); err != nil {
 		logging.Error("Check connection with redis fail cause %s.", err)
-		r.changeRole(Slaver, unknownNodeId)
+		r.backend.fail(r.config, &r.watch, err)
+		r.degradeRole()
 		return
 	}
+	r.backend.ok(r.config, &r.watch)
+	if err := r.refreshMembers(conn); err != nil {
+		logging.Warn("Refresh members with redis fail cause %s.", err.Error())
+	}
 
-	if r.role == Master {
-		// Valid role
-		reply, err := r.redisConn.Do("GET", r.electionKey())
+	if r.IsMaster() {
+		// Refresh lock expire only if it is still held by local node
+		renewed, err := redis.Int(redisRenewScript.Do(conn, r.electionKey(), r.config.NodeId, r.ttlMillis()))
 		if err != nil {
-			logging.Error("Try get value fail cause %s.", err.Error())
-			r.changeRole(Slaver, "unknown")
+			logging.Error("Refresh lock expire fail cause %s.", err.Error())
+			notifyElectionError(r.config, &r.watch, err)
+			r.degradeRole()
+			return
+		}
+		if renewed == 1 {
+			r.changeRole(Master, r.config.NodeId)
 			return
 		}
-		if nodeIdBytes, ok := reply.([]byte); ok && string(nodeIdBytes) == r.config.NodeId {
-			// Refresh data
-			result, err := redis.Int(r.redisConn.Do("PEXPIRE", r.electionKey(), redisElectionTtl))
+		// Lock lost, get current holder
+		reply, err := conn.Do("GET", r.electionKey())
+		if nodeId, ok := reply.([]byte); err == nil && ok {
+			r.changeRole(Slaver, string(nodeId))
+		} else {
+			r.changeRole(Slaver, unknownNodeId)
+		}
+		return
+
+	} else {
+		if r.config.Observer || r.config.TakeoverGrace > 0 || r.takeover.resigned() {
+			// Take over only if lock has been free for grace period and not in resign hold-off.
+			// Observer never takes over.
+			reply, err := conn.Do("GET", r.electionKey())
 			if err != nil {
-				logging.Error("Refresh lock expire fail cause %s.", err.Error())
-				r.changeRole(Slaver, unknownNodeId)
+				logging.Error("Try get value fail cause %s.", err.Error())
+				notifyElectionError(r.config, &r.watch, err)
+				r.degradeRole()
 				return
 			}
-			if result == 1 {
-				r.changeRole(Master, r.config.NodeId)
-				return
-			} else {
-				r.changeRole(Slaver, unknownNodeId)
+			nodeId, held := reply.([]byte)
+			if r.config.Observer || !r.takeover.allow(!held, r.config.TakeoverGrace) {
+				if held {
+					r.changeRole(Slaver, string(nodeId))
+				} else {
+					r.changeRole(Slaver, unknownNodeId)
+				}
 				return
 			}
-		} else {
-			r.changeRole(Slaver, string(nodeIdBytes))
-			return
 		}
-
-	} else {
-		getLock, err := r.redisConn.Do("SET", r.electionKey(), r.config.NodeId, "NX", "PX", redisElectionTtl)
+		token, err := redis.Uint64(redisAcquireScript.Do(conn, r.electionKey(), r.fencingKey(), r.config.NodeId, r.ttlMillis()))
 		if err != nil {
 			logging.Error("Try get lock fail cause %s.", err.Error())
-			r.changeRole(Slaver, unknownNodeId)
+			notifyElectionError(r.config, &r.watch, err)
+			r.degradeRole()
 			return
 		}
-		if getLock == "OK" {
+		if token > 0 {
 			// Take lead
+			r.takeover.reset()
+			r.role.setToken(token)
 			r.changeRole(Master, r.config.NodeId)
 			return
 		} else {
 			// Lose lead
 			// Get current lead data
-			reply, err := r.redisConn.Do("GET", r.electionKey())
+			reply, err := conn.Do("GET", r.electionKey())
 			if err != nil {
 				logging.Error("Try get value fail cause %s.", err.Error())
-				r.changeRole(Slaver, unknownNodeId)
+				notifyElectionError(r.config, &r.watch, err)
+				r.degradeRole()
 				return
 			}
 			if nodeId, ok := reply.([]byte); ok {
@@ -212,30 +373,113 @@ func (r *redisRegistry) electionTask() {
 }
 
 func (r *redisRegistry) changeRole(newRole Role, newMaster string) {
-	if r.role != newRole {
-		r.role = newRole
-		if r.config.Election != nil {
-			if newRole == Slaver {
-				logging.Debug("Node %s is slaver.", r.config.NodeId)
-				r.config.Election(MasterLose, newMaster)
-			} else {
-				logging.Debug("Node %s is master.", r.config.NodeId)
-				r.config.Election(MasterTake, newMaster)
-			}
+	updateRole(r.config, &r.role, &r.watch, newRole, newMaster)
+}
+
+// degradeRole demote local node on backend failure unless role was confirmed within ttl.
+func (r *redisRegistry) degradeRole() {
+	degradeRole(r.config, &r.role, &r.watch, r.ttl-r.interval)
+}
+
+func (r *redisRegistry) releaseRole(conn redis.Conn) {
+	if r.IsMaster() {
+		// Delete lock only if it is still held by local node
+		if _, err := redisReleaseScript.Do(conn, r.electionKey(), r.config.NodeId); err != nil {
+			logging.Warn("Release lock fail cause %s.", err.Error())
 		}
+		r.changeRole(Slaver, unknownNodeId)
 	}
 }
 
-func (r *redisRegistry) releaseRole() {
-	if r.role == Master {
-		reply, err := r.redisConn.Do("GET", r.electionKey())
-		if err != nil {
+// NewRedisPool create a redis pool for specified url which can be shared by registry and other
+// subsystems. Sentinel will be used to discover master if "master" param is set in url, and
+// the address of other sentinels can be set with comma separated "sentinels" param.
+//  redis://127.0.0.1:6379
+//  redis://sentinel1:26379?master=mymaster&sentinels=sentinel2:26379,sentinel3:26379
+func NewRedisPool(url util.URL) *redis.Pool {
+	return &redis.Pool{
+		MaxIdle:     redisPoolMaxIdle,
+		IdleTimeout: redisPoolIdleTimeout,
+		Dial: func() (conn redis.Conn, err error) {
+			err = parallel.Retry(context.Background(), redisDialRetryPolicy, func() error {
+				address, err := resolveRedisAddress(url)
+				if err != nil {
+					return err
+				}
+				if conn, err = redis.Dial("tcp", address); err != nil {
+					return err
+				}
+				if err = pingRedis(url, conn); err != nil {
+					conn.Close()
+				}
+				return err
+			})
 			return
+		},
+		TestOnBorrow: func(conn redis.Conn, _ time.Time) error {
+			return pingRedis(url, conn)
+		},
+	}
+}
+
+// redisSentinelAddresses returns address of sentinels in host and port of url and the comma
+// separated "sentinels" param of url.
+func redisSentinelAddresses(url util.URL) []string {
+	addresses := []string{url.Address()}
+	for _, address := range strings.Split(url.Param["sentinels"], ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			addresses = append(addresses, address)
 		}
-		if nodeIdBytes, ok := reply.([]byte); ok && string(nodeIdBytes) == r.config.NodeId {
-			// Release
-			r.redisConn.Do("DEL", r.electionKey())
+	}
+	return addresses
+}
+
+// resolveRedisAddress returns address of redis server. Address of current master will be queried
+// from sentinels if sentinel is configured.
+func resolveRedisAddress(url util.URL) (string, error) {
+	master := url.Param["master"]
+	if master == "" {
+		return url.Address(), nil
+	}
+	var lastErr error
+	for _, sentinel := range redisSentinelAddresses(url) {
+		conn, err := redis.Dial("tcp", sentinel)
+		if err != nil {
+			lastErr = err
+			continue
 		}
-		r.changeRole(Slaver, unknownNodeId)
+		reply, err := redis.Strings(conn.Do("SENTINEL", "get-master-addr-by-name", master))
+		conn.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if len(reply) == 2 {
+			return reply[0] + ":" + reply[1], nil
+		}
+	}
+	if lastErr == nil {
+		lastErr = ErrNoRedisMaster
+	}
+	return "", lastErr
+}
+
+// pingRedis check specified connection. Server must be master if sentinel is configured, the
+// connection to a demoted master after failover will be treated as invalid.
+func pingRedis(url util.URL, conn redis.Conn) error {
+	if url.Param["master"] == "" {
+		_, err := conn.Do("PING")
+		return err
 	}
+	reply, err := redis.Values(conn.Do("ROLE"))
+	if err != nil {
+		return err
+	}
+	if len(reply) == 0 {
+		return ErrNoRedisMaster
+	}
+	if role, _ := redis.String(reply[0], nil); role != "master" {
+		return ErrNoRedisMaster
+	}
+	return nil
 }
@@ -0,0 +1,532 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package registry
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/mervinkid/matcha/util"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// redisStatus and redisError are simple string and error replies of fakeRedis.
+type redisStatus string
+type redisError string
+
+// fakeRedis is a fake redis server speaking RESP which keeps strings and sorted sets in memory.
+// It replies address of masters to SENTINEL queries if masters are set. Scripts of redis registry
+// are emulated by their content since Lua is not supported.
+type fakeRedis struct {
+	listener net.Listener
+	role     string
+	masters  map[string]string
+	values   map[string]string
+	expires  map[string]time.Time
+	zsets    map[string]map[string]float64
+	hook     func(args []string)
+	mutex    sync.Mutex
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &fakeRedis{
+		listener: listener,
+		role:     "master",
+		masters:  make(map[string]string),
+		values:   make(map[string]string),
+		expires:  make(map[string]time.Time),
+		zsets:    make(map[string]map[string]float64),
+	}
+	go r.accept()
+	return r
+}
+
+func (r *fakeRedis) address() string {
+	return r.listener.Addr().String()
+}
+
+func (r *fakeRedis) close() {
+	r.listener.Close()
+}
+
+func (r *fakeRedis) setRole(role string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.role = role
+}
+
+func (r *fakeRedis) setMaster(name, address string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.masters[name] = address
+}
+
+func (r *fakeRedis) value(key string) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	value, _ := r.get(key)
+	return value
+}
+
+func (r *fakeRedis) setValue(key, value string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.values[key] = value
+	delete(r.expires, key)
+}
+
+// expire set ttl of key, the key expires immediately if ttl is zero.
+func (r *fakeRedis) expire(key string, ttl time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.expires[key] = time.Now().Add(ttl)
+}
+
+func (r *fakeRedis) ttl(key string) time.Duration {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return time.Until(r.expires[key])
+}
+
+// setHook set function invoked with fake locked after each command executed.
+func (r *fakeRedis) setHook(hook func(args []string)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.hook = hook
+}
+
+func (r *fakeRedis) addMember(key, member string, score float64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.zsets[key] == nil {
+		r.zsets[key] = make(map[string]float64)
+	}
+	r.zsets[key][member] = score
+}
+
+func (r *fakeRedis) members(key string) []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.zrange(key)
+}
+
+func (r *fakeRedis) accept() {
+	for {
+		conn, err := r.listener.Accept()
+		if err != nil {
+			return
+		}
+		go r.serve(conn)
+	}
+}
+
+// serve execute commands from connection, replies of pipelined commands are flushed together.
+func (r *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader, writer := bufio.NewReader(conn), bufio.NewWriter(conn)
+	for {
+		args, err := readRedisCommand(reader)
+		if err != nil {
+			return
+		}
+		writeRedisReply(writer, r.execute(args))
+		if reader.Buffered() == 0 {
+			if err := writer.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (r *fakeRedis) execute(args []string) interface{} {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.hook != nil {
+		defer r.hook(args)
+	}
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return redisStatus("PONG")
+	case "ROLE":
+		return []interface{}{r.role}
+	case "SENTINEL":
+		address, ok := r.masters[args[2]]
+		if !ok {
+			return nil
+		}
+		host, port, _ := net.SplitHostPort(address)
+		return []interface{}{host, port}
+	case "GET":
+		if value, ok := r.get(args[1]); ok {
+			return value
+		}
+		return nil
+	case "SET":
+		return r.set(args[1], args[2], args[3:])
+	case "DEL":
+		return r.del(args[1])
+	case "PEXPIRE":
+		return r.pexpire(args[1], args[2])
+	case "ZADD":
+		score, _ := strconv.ParseFloat(args[2], 64)
+		if r.zsets[args[1]] == nil {
+			r.zsets[args[1]] = make(map[string]float64)
+		}
+		_, ok := r.zsets[args[1]][args[3]]
+		r.zsets[args[1]][args[3]] = score
+		if ok {
+			return 0
+		}
+		return 1
+	case "ZREMRANGEBYSCORE":
+		min, _ := strconv.ParseFloat(args[2], 64)
+		max, _ := strconv.ParseFloat(args[3], 64)
+		removed := 0
+		for member, score := range r.zsets[args[1]] {
+			if score >= min && score <= max {
+				delete(r.zsets[args[1]], member)
+				removed++
+			}
+		}
+		return removed
+	case "ZRANGE":
+		var members []interface{}
+		for _, member := range r.zrange(args[1]) {
+			members = append(members, member)
+		}
+		return members
+	case "ZREM":
+		if _, ok := r.zsets[args[1]][args[2]]; ok {
+			delete(r.zsets[args[1]], args[2])
+			return 1
+		}
+		return 0
+	case "EVALSHA":
+		return redisError("NOSCRIPT No matching script.")
+	case "EVAL":
+		count, _ := strconv.Atoi(args[2])
+		return r.eval(args[1], args[3:3+count], args[3+count:])
+	}
+	return redisError("ERR unknown command '" + args[0] + "'")
+}
+
+// eval emulate scripts of redis registry by their content.
+func (r *fakeRedis) eval(script string, keys, args []string) interface{} {
+	if strings.Contains(script, `"SET"`) {
+		if r.set(keys[0], args[0], []string{"NX", "PX", args[1]}) == nil {
+			return 0
+		}
+		return r.incr(keys[1])
+	}
+	if value, ok := r.get(keys[0]); !ok || value != args[0] {
+		return 0
+	}
+	switch {
+	case strings.Contains(script, `"PEXPIRE"`):
+		return r.pexpire(keys[0], args[1])
+	case strings.Contains(script, `"DEL"`):
+		return r.del(keys[0])
+	}
+	return redisError("ERR unsupported script")
+}
+
+// get returns value of key which has not expired.
+func (r *fakeRedis) get(key string) (string, bool) {
+	if expire, ok := r.expires[key]; ok && !time.Now().Before(expire) {
+		r.del(key)
+	}
+	value, ok := r.values[key]
+	return value, ok
+}
+
+// set key to value with NX and PX options.
+func (r *fakeRedis) set(key, value string, options []string) interface{} {
+	var ttl time.Duration
+	for i := 0; i < len(options); i++ {
+		switch strings.ToUpper(options[i]) {
+		case "NX":
+			if _, ok := r.get(key); ok {
+				return nil
+			}
+		case "PX":
+			i++
+			millis, _ := strconv.Atoi(options[i])
+			ttl = time.Duration(millis) * time.Millisecond
+		}
+	}
+	r.values[key] = value
+	delete(r.expires, key)
+	if ttl > 0 {
+		r.expires[key] = time.Now().Add(ttl)
+	}
+	return redisStatus("OK")
+}
+
+// incr increase integer value of key by one.
+func (r *fakeRedis) incr(key string) int {
+	value, _ := r.get(key)
+	count, _ := strconv.Atoi(value)
+	count++
+	r.values[key] = strconv.Itoa(count)
+	return count
+}
+
+func (r *fakeRedis) del(key string) int {
+	if _, ok := r.values[key]; !ok {
+		return 0
+	}
+	delete(r.values, key)
+	delete(r.expires, key)
+	return 1
+}
+
+func (r *fakeRedis) pexpire(key, millis string) int {
+	if _, ok := r.get(key); !ok {
+		return 0
+	}
+	ttl, _ := strconv.Atoi(millis)
+	r.expires[key] = time.Now().Add(time.Duration(ttl) * time.Millisecond)
+	return 1
+}
+
+// zrange returns members of sorted set ordered by score.
+func (r *fakeRedis) zrange(key string) []string {
+	zset := r.zsets[key]
+	members := make([]string, 0, len(zset))
+	for member := range zset {
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if zset[members[i]] != zset[members[j]] {
+			return zset[members[i]] < zset[members[j]]
+		}
+		return members[i] < members[j]
+	})
+	return members
+}
+
+// readRedisCommand read command sent as array of bulk strings.
+func readRedisCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, count)
+	for i := range args {
+		if line, err = reader.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		length, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, length+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:length])
+	}
+	return args, nil
+}
+
+func writeRedisReply(writer *bufio.Writer, reply interface{}) {
+	switch reply := reply.(type) {
+	case nil:
+		writer.WriteString("$-1\r\n")
+	case redisStatus:
+		fmt.Fprintf(writer, "+%s\r\n", reply)
+	case redisError:
+		fmt.Fprintf(writer, "-%s\r\n", reply)
+	case int:
+		fmt.Fprintf(writer, ":%d\r\n", reply)
+	case string:
+		fmt.Fprintf(writer, "$%d\r\n%s\r\n", len(reply), reply)
+	case []interface{}:
+		fmt.Fprintf(writer, "*%d\r\n", len(reply))
+		for _, item := range reply {
+			writeRedisReply(writer, item)
+		}
+	}
+}
+
+func TestRedisRegistry_Sentinel(t *testing.T) {
+
+	master, replica, sentinel := newFakeRedis(t), newFakeRedis(t), newFakeRedis(t)
+	for _, server := range []*fakeRedis{master, replica, sentinel} {
+		defer server.close()
+	}
+	// The first sentinel is down, master is resolved by the next one.
+	down := newFakeRedis(t)
+	down.close()
+	sentinel.setMaster("mymaster", master.address())
+	url := util.ParseUrl(fmt.Sprintf("redis://%s?master=mymaster&sentinels=%s", down.address(), sentinel.address()))
+	reg := &redisRegistry{config: Config{AppId: "demo", NodeId: "node0", Url: url}}
+	if err := reg.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer reg.Stop()
+
+	reg.electionTask()
+	if !reg.IsMaster() || master.value("demo/election") != "node0" {
+		t.Fatal("expect node0 take master on master resolved by sentinel")
+	}
+
+	// Connection to demoted master is dropped and new master is resolved after failover.
+	master.setRole("slave")
+	sentinel.setMaster("mymaster", replica.address())
+	reg.electionTask()
+	reg.electionTask()
+	if !reg.IsMaster() || replica.value("demo/election") != "node0" {
+		t.Fatal("expect node0 take master on new master after failover")
+	}
+	if members := replica.members("demo/nodes"); len(members) != 1 || members[0] != "node0" {
+		t.Fatal("expect node0 registered on new master but got", members)
+	}
+}
+
+func TestRedisRegistry_Members(t *testing.T) {
+
+	server := newFakeRedis(t)
+	defer server.close()
+	url := util.ParseUrl("redis://" + server.address())
+	pool := NewRedisPool(url)
+	defer pool.Close()
+	// Member not refreshed within election ttl will be removed.
+	server.addMember("demo/nodes", "stale", 0)
+	first := &redisRegistry{config: Config{AppId: "demo", NodeId: "node0", Url: url, RedisPool: pool}}
+	second := &redisRegistry{config: Config{AppId: "demo", NodeId: "node1", Url: url, RedisPool: pool}}
+	for _, reg := range []*redisRegistry{first, second} {
+		if err := reg.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer reg.Stop()
+	}
+	memberC := first.WatchMembers()
+
+	// Members are refreshed with pipelined commands through shared pool.
+	first.electionTask()
+	second.electionTask()
+	first.electionTask()
+	for _, nodeId := range []string{"node0", "node1"} {
+		if change := <-memberC; change.Event != MemberJoin || change.NodeId != nodeId {
+			t.Fatal("expect", nodeId, "join but got", change)
+		}
+	}
+	if members := server.members("demo/nodes"); len(members) != 2 {
+		t.Fatal("expect stale member removed but got", members)
+	}
+
+	// Pool shared by config is kept after registry stopped.
+	second.Stop()
+	conn := pool.Get()
+	defer conn.Close()
+	if _, err := conn.Do("PING"); err != nil {
+		t.Fatal("expect shared pool available but got", err)
+	}
+	first.electionTask()
+	if change := <-memberC; change.Event != MemberLeave || change.NodeId != "node1" {
+		t.Fatal("expect node1 leave but got", change)
+	}
+}
+
+func TestRedisRegistry_Election(t *testing.T) {
+
+	server := newFakeRedis(t)
+	defer server.close()
+	url := util.ParseUrl("redis://" + server.address())
+	first := &redisRegistry{config: Config{AppId: "demo", NodeId: "node0", Url: url}}
+	second := &redisRegistry{config: Config{AppId: "demo", NodeId: "node1", Url: url}}
+	for _, reg := range []*redisRegistry{first, second} {
+		if err := reg.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer reg.Stop()
+	}
+
+	first.electionTask()
+	second.electionTask()
+	if !first.IsMaster() || second.IsMaster() || server.value("demo/election") != "node0" {
+		t.Fatal("expect node0 take master")
+	}
+	if token, ok := first.FencingToken(); !ok || token != 1 {
+		t.Fatal("expect fencing token of master but got", token)
+	}
+
+	// Master renews expire of lock held by itself.
+	server.expire("demo/election", time.Second)
+	first.electionTask()
+	if ttl := server.ttl("demo/election"); !first.IsMaster() || ttl <= time.Second {
+		t.Fatal("expect master renews lock expire but got ttl", ttl)
+	}
+
+	// Lock of node0 expires and is taken by node1, node0 must not renew it.
+	server.expire("demo/election", 0)
+	second.electionTask()
+	first.electionTask()
+	if !second.IsMaster() || first.IsMaster() || server.value("demo/election") != "node1" {
+		t.Fatal("expect node1 take master after lock of node0 expired")
+	}
+	if token, _ := second.FencingToken(); token != 2 {
+		t.Fatal("expect fencing token increased but got", token)
+	}
+
+	// Lock expires and is taken by node2 right after node1 checked it while stopping, node1 must
+	// not delete lock of node2.
+	taken := false
+	server.setHook(func(args []string) {
+		for _, arg := range args {
+			if arg == "demo/election" && !taken {
+				taken = true
+				server.values[arg] = "node2"
+			}
+		}
+	})
+	second.Stop()
+	server.setHook(nil)
+	if server.value("demo/election") != "node2" {
+		t.Fatal("expect lock of node2 kept after node1 stopped")
+	}
+
+	// Master deletes lock held by itself while stopping.
+	first.electionTask()
+	server.expire("demo/election", 0)
+	first.electionTask()
+	first.Stop()
+	if server.value("demo/election") != "" {
+		t.Fatal("expect lock of node0 deleted after node0 stopped")
+	}
+}
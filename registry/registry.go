@@ -24,8 +24,11 @@ package registry
 
 import (
 	"errors"
+	"github.com/gomodule/redigo/redis"
 	"github.com/mervinkid/matcha/misc"
 	"github.com/mervinkid/matcha/util"
+	"sync"
+	"time"
 )
 
 var (
@@ -33,6 +36,8 @@ var (
 	ErrInvalidHost         = errors.New("invalid host of url")
 	ErrInvalidPort         = errors.New("invalid port of url")
 	ErrUnsupportedProtocol = errors.New("invalid protocol of url")
+	ErrNoRedisMaster       = errors.New("no redis master available")
+	ErrInvalidElection     = errors.New("election interval should be less than ttl")
 )
 
 type ElectionEvent uint8
@@ -40,6 +45,17 @@ type ElectionEvent uint8
 const (
 	MasterTake ElectionEvent = iota
 	MasterLose
+	// MasterChange is only sent to observer while master changed.
+	MasterChange
+)
+
+// BackendEvent is the event of backend connectivity or election failure, distinct from role changes.
+type BackendEvent uint8
+
+const (
+	BackendUnreachable BackendEvent = iota
+	ElectionError
+	Reconnected
 )
 
 type Role uint8
@@ -53,30 +69,120 @@ type Config struct {
 	AppId  string
 	NodeId string
 	Url    util.URL
+	// RedisPool is the optional pool shared with other subsystems for redis registry. A pool
+	// created with Url will be used and closed by registry if it is nil.
+	RedisPool *redis.Pool
+	// Observer make local node watch election and membership without campaigning for master role
+	// or registering itself as member.
+	Observer bool
+	// Backend is the callback method which will be invoked while backend becomes unreachable,
+	// reconnected or election failed.
+	Backend func(event BackendEvent, err error)
+	// ElectionTtl is the time to live of master lock or session. Default depends on backend.
+	ElectionTtl time.Duration
+	// ElectionInterval is the interval of renewal and campaign, should be less than ElectionTtl.
+	// Default is half of ElectionTtl if only ElectionTtl is set.
+	ElectionInterval time.Duration
+	// TakeoverGrace is the period which a free master lock must be observed before slaver takes
+	// over, gives previous master a chance to recover from transient failure. Not supported by
+	// zookeeper registry.
+	TakeoverGrace time.Duration
 	// Election is the callback method which will be invoked while election event happened.
 	Election func(event ElectionEvent, masterId string)
 }
 
+// NodeInfo is the info of node registered in registry.
+type NodeInfo struct {
+	Id     string
+	Master bool
+}
+
+// Registry is the interface of service registry with master election.
+// Methods:
+//  IsMaster returns true if local node current holds master role.
+//  Master returns id of current master and true if master is known.
+//  FencingToken returns the monotonically increasing token of current master term and true if
+//  local node is master. Downstream writes guarded by the token can reject stale masters.
+//  Nodes returns info of nodes known in latest election round.
+//  Healthy returns true if backend is reachable. Checks are backed off exponentially while backend
+//  keeps failing, and master role is kept while backend is briefly slow within election ttl.
+//  Resign release master role voluntarily and notify MasterLose immediately. Local node will not
+//  campaign again within election ttl for other nodes to take over.
+//  WatchRole returns a channel which receives role changes of local node.
+//  WatchMembers returns a channel which receives nodes joining and leaving, starts with known nodes.
+//  Subscribe register handler of election events same as Election callback of config and returns
+//  id of the subscription. Each subscriber receives events in order with its own buffer.
+//  Unsubscribe cancel subscription with specified id.
+//  NotifyLeadership register function invoked after election events and returns function to
+//  cancel it, which satisfies task.LeadershipNotifier.
+// Watch channels will be closed while registry stopped, subscriptions remain until unsubscribed.
 type Registry interface {
 	misc.Lifecycle
 	misc.Sync
 	misc.Type
+	IsMaster() bool
+	Master() (nodeId string, ok bool)
+	FencingToken() (token uint64, ok bool)
+	Nodes() []NodeInfo
+	Healthy() bool
+	Resign() error
+	WatchRole() <-chan RoleChange
+	WatchMembers() <-chan MemberChange
+	Subscribe(handler func(event ElectionEvent, masterId string)) SubscriptionId
+	Unsubscribe(id SubscriptionId)
+	NotifyLeadership(notify func()) (cancel func())
+}
+
+// drivers is the registry factories indexed by protocol of url.
+var (
+	drivers = map[string]func(Config) (Registry, error){
+		"redis":     remoteDriver(func(config Config) Registry { return &redisRegistry{config: config} }),
+		"etcd":      remoteDriver(func(config Config) Registry { return newEtcdRegistry(config) }),
+		"zookeeper": remoteDriver(func(config Config) Registry { return &zookeeperRegistry{config: config} }),
+		"consul":    remoteDriver(func(config Config) Registry { return newConsulRegistry(config) }),
+		// In-cluster kubernetes registry and in-process memory registry do not need host and port
+		"kubernetes": func(config Config) (Registry, error) { return &kubernetesRegistry{config: config}, nil },
+		"memory":     func(config Config) (Registry, error) { return &memoryRegistry{config: config}, nil },
+	}
+	driversMutex sync.RWMutex
+)
+
+// RegisterDriver make registry created by factory available with specified protocol of url in
+// NewRegister. Existing driver of the protocol will be replaced, and nil factory removes it.
+func RegisterDriver(scheme string, factory func(Config) (Registry, error)) {
+	driversMutex.Lock()
+	defer driversMutex.Unlock()
+	if factory == nil {
+		delete(drivers, scheme)
+		return
+	}
+	drivers[scheme] = factory
 }
 
 func NewRegister(config Config) (Registry, error) {
 	if config.AppId == "" {
 		return nil, ErrInvalidAppId
 	}
-	if err := validateUrl(config.Url); err != nil {
-		return nil, err
+	if config.ElectionTtl > 0 && config.ElectionInterval >= config.ElectionTtl {
+		return nil, ErrInvalidElection
 	}
-	switch config.Url.Protocol {
-	case "redis":
-		registry := &redisRegistry{config: config}
-		return registry, nil
-	default:
+	driversMutex.RLock()
+	factory, ok := drivers[config.Url.Protocol]
+	driversMutex.RUnlock()
+	if !ok {
 		return nil, ErrUnsupportedProtocol
 	}
+	return factory(config)
+}
+
+// remoteDriver returns factory which validate host and port of url before creating registry.
+func remoteDriver(create func(Config) Registry) func(Config) (Registry, error) {
+	return func(config Config) (Registry, error) {
+		if err := validateUrl(config.Url); err != nil {
+			return nil, err
+		}
+		return create(config), nil
+	}
 }
 
 func validateUrl(url util.URL) error {
@@ -4,8 +4,13 @@ import (
 	"fmt"
 	"github.com/gomodule/redigo/redis"
 	"github.com/mervinkid/matcha/registry"
+	"github.com/mervinkid/matcha/task"
 	"github.com/mervinkid/matcha/util"
+	"os"
+	"os/signal"
 	"strconv"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -50,3 +55,380 @@ func TestRedisRegistry(t *testing.T) {
 	}
 	time.Sleep(10 * time.Second)
 }
+
+func TestMemoryRegistry(t *testing.T) {
+	newRegistry := func(nodeId string, observer bool) registry.Registry {
+		config := registry.Config{}
+		config.AppId = "demo"
+		config.NodeId = nodeId
+		config.Observer = observer
+		config.Url = util.ParseUrl("memory://test")
+		config.ElectionTtl = 50 * time.Millisecond
+		reg, err := registry.NewRegister(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := reg.Start(); err != nil {
+			t.Fatal(err)
+		}
+		return reg
+	}
+
+	observer := newRegistry("observer", true)
+	observerC := observer.WatchRole()
+	node0 := newRegistry("node0", false)
+	roleC := node0.WatchRole()
+	node1 := newRegistry("node1", false)
+	memberC := node1.WatchMembers()
+
+	// Earliest joined node takes master role
+	if !node0.IsMaster() || node1.IsMaster() {
+		t.Fatal("expect node0 to be master")
+	}
+	if masterId, ok := node1.Master(); !ok || masterId != "node0" {
+		t.Fatal("expect master node0 but got", masterId)
+	}
+	if nodes := node1.Nodes(); len(nodes) != 2 || !nodes[0].Master || nodes[1].Master {
+		t.Fatal("unexpected nodes", nodes)
+	}
+	for _, nodeId := range []string{"node0", "node1"} {
+		if change := <-memberC; change.Event != registry.MemberJoin || change.NodeId != nodeId {
+			t.Fatal("unexpected member change", change)
+		}
+	}
+
+	// Observer never takes master role but knows master
+	if observer.IsMaster() || len(observer.Nodes()) != 2 {
+		t.Fatal("expect observer not to be master or member")
+	}
+	if change := <-observerC; change.Role != registry.Slaver || change.MasterId != "node0" {
+		t.Fatal("expect observer notified master node0 but got", change)
+	}
+
+	// Fencing token increases for each new master
+	token0, ok := node0.FencingToken()
+	if !ok {
+		t.Fatal("expect fencing token of master")
+	}
+	if _, ok := node1.FencingToken(); ok {
+		t.Fatal("expect no fencing token of slaver")
+	}
+
+	// Resign hands master role over to node1
+	if err := node0.Resign(); err != nil {
+		t.Fatal(err)
+	}
+	if change := <-roleC; change.Role != registry.Slaver {
+		t.Fatal("expect node0 lose master role")
+	}
+	if !node1.IsMaster() {
+		t.Fatal("expect node1 to be master after node0 resigned")
+	}
+	if token1, _ := node1.FencingToken(); token1 <= token0 {
+		t.Fatal("expect fencing token increased but got", token1)
+	}
+
+	if change := <-observerC; change.MasterId != "node1" {
+		t.Fatal("expect observer notified master node1 but got", change)
+	}
+
+	// Stop node1 and node0 takes master role again
+	node1.Stop()
+	if change := <-roleC; change.Role != registry.Master || change.FencingToken <= token0+1 {
+		t.Fatal("expect node0 take master role with new fencing token but got", change)
+	}
+	node0.Stop()
+	observer.Stop()
+	if change := <-roleC; change.Role != registry.Slaver {
+		t.Fatal("expect node0 lose master role after stop")
+	}
+	if _, ok := <-roleC; ok {
+		t.Fatal("expect watch channel closed after stop")
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	config := registry.Config{AppId: "subscribe", NodeId: "node0", Url: util.ParseUrl("memory://test")}
+	reg, err := registry.NewRegister(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eventC0 := make(chan registry.ElectionEvent, 4)
+	eventC1 := make(chan registry.ElectionEvent, 4)
+	id0 := reg.Subscribe(func(event registry.ElectionEvent, masterId string) { eventC0 <- event })
+	id1 := reg.Subscribe(func(event registry.ElectionEvent, masterId string) { eventC1 <- event })
+	if id0 == id1 {
+		t.Fatal("expect unique subscription id")
+	}
+	if err := reg.Start(); err != nil {
+		t.Fatal(err)
+	}
+	for _, eventC := range []chan registry.ElectionEvent{eventC0, eventC1} {
+		if event := <-eventC; event != registry.MasterTake {
+			t.Fatal("expect master take but got", event)
+		}
+	}
+
+	// Unsubscribed handler receives no further events
+	reg.Unsubscribe(id1)
+	reg.Stop()
+	if event := <-eventC0; event != registry.MasterLose {
+		t.Fatal("expect master lose but got", event)
+	}
+	select {
+	case event := <-eventC1:
+		t.Fatal("expect no event after unsubscribe but got", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+	reg.Unsubscribe(id0)
+}
+
+func TestNotifyLeadership(t *testing.T) {
+	config := registry.Config{AppId: "notify", NodeId: "node0", Url: util.ParseUrl("memory://test")}
+	reg, err := registry.NewRegister(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Leader scheduler resumes on notification of registry without waiting for check.
+	runC := make(chan bool, 1)
+	scheduler := task.NewLeaderScheduler(reg, task.NewFixedRateScheduler(func() {
+		select {
+		case runC <- true:
+		default:
+		}
+	}, 10*time.Millisecond))
+	if err := scheduler.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer scheduler.Stop()
+	if err := reg.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer reg.Stop()
+	select {
+	case <-runC:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("expect execution once master taken")
+	}
+}
+
+func TestRegisterDriver(t *testing.T) {
+	registry.RegisterDriver("custom", func(config registry.Config) (registry.Registry, error) {
+		config.Url.Protocol = "memory"
+		return registry.NewRegister(config)
+	})
+	config := registry.Config{AppId: "demo", Url: util.ParseUrl("custom://test")}
+	reg, err := registry.NewRegister(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reg.Type() != "memory" {
+		t.Fatal("expect registry created by custom driver but got", reg.Type())
+	}
+
+	registry.RegisterDriver("custom", nil)
+	if _, err := registry.NewRegister(config); err != registry.ErrUnsupportedProtocol {
+		t.Fatal("expect unsupported protocol but got", err)
+	}
+}
+
+func TestPartitionedRegistry(t *testing.T) {
+	partitions := []string{"p0", "p1", "p2", "p3"}
+	newRegistry := func(nodeId string) registry.PartitionedRegistry {
+		config := registry.Config{}
+		config.AppId = "partition"
+		config.NodeId = nodeId
+		config.Url = util.ParseUrl("memory://test")
+		config.ElectionTtl = 50 * time.Millisecond
+		config.ElectionInterval = 10 * time.Millisecond
+		reg, err := registry.NewPartitionedRegistry(config, partitions, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := reg.Start(); err != nil {
+			t.Fatal(err)
+		}
+		return reg
+	}
+
+	node0 := newRegistry("node0")
+	defer node0.Stop()
+	if owned := node0.Owned(); len(owned) != len(partitions) {
+		t.Fatal("expect single node own all partitions but got", owned)
+	}
+
+	// Partitions will be spread after node1 joined
+	node1 := newRegistry("node1")
+	defer node1.Stop()
+	deadline := time.Now().Add(3 * time.Second)
+	for len(node0.Owned()) != 2 || len(node1.Owned()) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("expect partitions spread but got", node0.Owned(), node1.Owned())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, partition := range partitions {
+		masterId, ok := node0.Master(partition)
+		if !ok || node1.IsMaster(partition) != (masterId == "node1") {
+			t.Fatal("unexpected master of partition", partition, masterId)
+		}
+	}
+}
+
+func TestPartitionedRegistry_Takeover(t *testing.T) {
+	partitions := []string{"p0", "p1"}
+	taken := make(chan string, 8)
+	newRegistry := func(nodeId string, observer bool) registry.PartitionedRegistry {
+		config := registry.Config{}
+		config.AppId = "takeover"
+		config.NodeId = nodeId
+		config.Observer = observer
+		config.Url = util.ParseUrl("memory://test")
+		config.ElectionTtl = 50 * time.Millisecond
+		config.ElectionInterval = 10 * time.Millisecond
+		reg, err := registry.NewPartitionedRegistry(config, partitions,
+			func(partition string, event registry.ElectionEvent, masterId string) {
+				if event == registry.MasterTake {
+					taken <- nodeId + "/" + partition
+				}
+			})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := reg.Start(); err != nil {
+			t.Fatal(err)
+		}
+		return reg
+	}
+
+	// Election callback receives partition name
+	node0 := newRegistry("node0", false)
+	defer node0.Stop()
+	for range partitions {
+		if event := <-taken; event != "node0/p0" && event != "node0/p1" {
+			t.Fatal("unexpected master take", event)
+		}
+	}
+
+	// Observer owns no partition but knows master of each
+	observer := newRegistry("observer", true)
+	defer observer.Stop()
+	time.Sleep(50 * time.Millisecond)
+	if owned := observer.Owned(); len(owned) != 0 {
+		t.Fatal("expect observer own no partition but got", owned)
+	}
+	for _, partition := range partitions {
+		if masterId, ok := observer.Master(partition); !ok || masterId != "node0" {
+			t.Fatal("expect observer know master node0 of", partition, "but got", masterId)
+		}
+	}
+	if err := observer.Resign("p9"); err != registry.ErrInvalidPartition {
+		t.Fatal("expect invalid partition but got", err)
+	}
+
+	// Partitions of stopped node are taken over
+	node1 := newRegistry("node1", false)
+	defer node1.Stop()
+	node0.Stop()
+	deadline := time.Now().Add(3 * time.Second)
+	for len(node1.Owned()) != len(partitions) {
+		if time.Now().After(deadline) {
+			t.Fatal("expect node1 take over all partitions but got", node1.Owned())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if node0.IsMaster("p0") {
+		t.Fatal("expect stopped node own no partition")
+	}
+}
+
+func TestNewPartitionedRegistry(t *testing.T) {
+	config := registry.Config{AppId: "partition", Url: util.ParseUrl("memory://test")}
+	if _, err := registry.NewPartitionedRegistry(registry.Config{}, []string{"p0"}, nil); err != registry.ErrInvalidAppId {
+		t.Fatal("expect invalid app id but got", err)
+	}
+	for _, partitions := range [][]string{{"p0", ""}, {"p0", "p1", "p0"}} {
+		if _, err := registry.NewPartitionedRegistry(config, partitions, nil); err != registry.ErrInvalidPartition {
+			t.Fatal("expect invalid partition of", partitions, "but got", err)
+		}
+	}
+	partitions := []string{"p0", "p1"}
+	reg, err := registry.NewPartitionedRegistry(config, partitions, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	partitions[0] = "p2"
+	if got := reg.Partitions(); len(got) != 2 || got[0] != "p0" || got[1] != "p1" {
+		t.Fatal("expect partitions copied but got", got)
+	}
+}
+
+// resignRecorder is a registry which records whether it has been resigned.
+type resignRecorder struct {
+	registry.Registry
+	resigned int32
+}
+
+func (r *resignRecorder) Resign() error {
+	atomic.StoreInt32(&r.resigned, 1)
+	return r.Registry.Resign()
+}
+
+func TestStopOnSignal(t *testing.T) {
+	config := registry.Config{AppId: "signal", NodeId: "node0", Url: util.ParseUrl("memory://test")}
+	reg, err := registry.NewRegister(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer reg.Stop()
+	recorder := &resignRecorder{Registry: reg}
+
+	// Catch the signal and the one raised again after stop instead of default behavior
+	signalC := make(chan os.Signal, 2)
+	signal.Notify(signalC, syscall.SIGHUP)
+	defer signal.Stop(signalC)
+	cancel := registry.StopOnSignal(recorder, syscall.SIGHUP)
+	defer cancel()
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-signalC:
+		case <-time.After(3 * time.Second):
+			t.Fatal("expect signal raised again after registry stopped")
+		}
+	}
+	if atomic.LoadInt32(&recorder.resigned) != 1 {
+		t.Fatal("expect master resigned before stop")
+	}
+	if reg.IsRunning() || reg.IsMaster() {
+		t.Fatal("expect registry stopped")
+	}
+
+	// Cancelled hook never stops registry
+	if err := reg.Start(); err != nil {
+		t.Fatal(err)
+	}
+	cancel = registry.StopOnSignal(reg, syscall.SIGHUP)
+	cancel()
+	cancel()
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-signalC:
+	case <-time.After(3 * time.Second):
+		t.Fatal("expect signal received")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if !reg.IsRunning() {
+		t.Fatal("expect registry kept running after hook cancelled")
+	}
+}
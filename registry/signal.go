@@ -0,0 +1,86 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package registry
+
+import (
+	"github.com/mervinkid/matcha/logging"
+	"github.com/mervinkid/matcha/misc"
+	"github.com/mervinkid/matcha/parallel"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// StopOnSignal hook specified signals, SIGTERM and SIGINT by default, to resign master role and stop
+// registry which deregister local node before process exits, so other nodes take over immediately
+// rather than waiting for election ttl. Registry will be resigned only if it provides Resign() error.
+// The signal will be raised again after registry stopped, so that default behavior or other handlers
+// of the process take effect. Returns a function to remove the hook.
+//  +--------+     +--------+     +------+     +-------------+
+//  | signal | → → | Resign | → → | Stop | → → | raise again |
+//  +--------+     +--------+     +------+     +-------------+
+func StopOnSignal(lifecycle misc.Lifecycle, signals ...os.Signal) (cancel func()) {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGTERM, os.Interrupt}
+	}
+	signalC := make(chan os.Signal, 1)
+	cancelC := make(chan uint8)
+	signal.Notify(signalC, signals...)
+
+	parallel.NewNamedGoroutine("RegistrySignalHook", func() {
+		select {
+		case <-cancelC:
+		case sig := <-signalC:
+			signal.Stop(signalC)
+			logging.Info("Stop registry cause received signal %s.", sig.String())
+			if resigner, ok := lifecycle.(interface{ Resign() error }); ok && misc.LifecycleCheckRun(lifecycle) {
+				if err := resigner.Resign(); err != nil {
+					logging.Warn("Resign before stop fail cause %s.", err.Error())
+				}
+			}
+			misc.LifecycleStop(lifecycle)
+			raiseSignal(sig)
+		}
+	}).Start()
+
+	var cancelOnce sync.Once
+	return func() {
+		cancelOnce.Do(func() {
+			signal.Stop(signalC)
+			close(cancelC)
+		})
+	}
+}
+
+// raiseSignal send signal to current process, or exit if it is not supported by platform.
+func raiseSignal(sig os.Signal) {
+	process, err := os.FindProcess(os.Getpid())
+	if err == nil {
+		err = process.Signal(sig)
+	}
+	if err != nil {
+		logging.Warn("Raise signal %s fail cause %s.", sig.String(), err.Error())
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,101 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package registry
+
+import (
+	"fmt"
+	"github.com/gomodule/redigo/redis"
+	"github.com/mervinkid/matcha/misc"
+	"github.com/mervinkid/matcha/util"
+	"strings"
+)
+
+// RedisConfigLoader returns misc.ConfigLoader which load config from specified key of redis through
+// pool, which can be shared with registry as Config.RedisPool. Fields of hash key are loaded as
+// properties, and value of string key is parsed in specified format, FormatYml by default.
+//  HSET app:config redis.address 10.0.0.1:6379
+//  SET  app:config "{\"redis\": {\"address\": \"10.0.0.1:6379\"}}"
+func RedisConfigLoader(pool *redis.Pool, key string, format string) misc.ConfigLoader {
+	if format == "" {
+		format = misc.FormatYml
+	}
+	return func() (map[string]interface{}, error) {
+		conn := pool.Get()
+		defer conn.Close()
+
+		keyType, err := redis.String(conn.Do("TYPE", key))
+		if err != nil {
+			return nil, err
+		}
+		switch keyType {
+		case "hash":
+			properties, err := redis.StringMap(conn.Do("HGETALL", key))
+			if err != nil {
+				return nil, err
+			}
+			misc.ExpandProperties(properties)
+			if err := misc.DecryptProperties(properties); err != nil {
+				return nil, err
+			}
+			config := make(map[string]interface{}, len(properties))
+			for field, value := range properties {
+				config[field] = value
+			}
+			return config, nil
+		case "string":
+			data, err := redis.Bytes(conn.Do("GET", key))
+			if err != nil {
+				return nil, err
+			}
+			return misc.ParseConfig(data, format)
+		case "none":
+			return make(map[string]interface{}), nil
+		}
+		return nil, fmt.Errorf("unsupported type %s of config key %s", keyType, key)
+	}
+}
+
+// EtcdConfigLoader returns misc.ConfigLoader which load keys with specified prefix from etcd at url
+// like the one of etcd registry. Path of key relative to prefix is used as dotted key.
+//  prefix: /config/app/, key: /config/app/redis/address → redis.address
+func EtcdConfigLoader(url util.URL, prefix string) misc.ConfigLoader {
+	client := newEtcdClient(url)
+	return func() (map[string]interface{}, error) {
+		values, err := client.values(prefix)
+		if err != nil {
+			return nil, err
+		}
+		config := make(map[string]interface{}, len(values))
+		for key, value := range values {
+			key = strings.Trim(strings.TrimPrefix(key, prefix), "/")
+			if key == "" {
+				continue
+			}
+			if value, err = misc.DecryptValue(misc.ExpandEnv(value)); err != nil {
+				return nil, err
+			}
+			config[strings.Replace(key, "/", ".", -1)] = value
+		}
+		return config, nil
+	}
+}
@@ -0,0 +1,215 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package registry
+
+import (
+	"github.com/mervinkid/matcha/logging"
+	"sort"
+	"sync"
+)
+
+const watchBufferSize = 64
+
+// RoleChange is the event of role change of local node. FencingToken is set while local node
+// takes master role.
+type RoleChange struct {
+	Role         Role
+	MasterId     string
+	FencingToken uint64
+}
+
+type MemberEvent uint8
+
+const (
+	MemberJoin MemberEvent = iota
+	MemberLeave
+)
+
+// MemberChange is the event of node joining or leaving the registry.
+type MemberChange struct {
+	Event  MemberEvent
+	NodeId string
+}
+
+// watchHub broadcast role and membership changes to watcher channels for registry implementations.
+// Changes will be dropped for watchers which do not consume in time, and all watcher channels
+// will be closed while registry stopped. Election events are dispatched to subscribers by events.
+// Callbacks of config are collected while registry holds its state lock and invoked by
+// flushCallbacks after the lock released.
+//                           +----------+
+//  publishRole   → → → → → → |          | → → watcher 1
+//                           | watchHub | → → ...
+//  updateMembers → (diff) → |          | → → watcher N
+//                           +----------+
+type watchHub struct {
+	roleWatchers   []chan RoleChange
+	memberWatchers []chan MemberChange
+	members        map[string]bool
+	events         eventBus
+	mutex          sync.Mutex
+	callbacks      []func()
+	flushing       bool
+	callbackMutex  sync.Mutex
+}
+
+// watchRole returns a new channel which receives role changes of local node.
+func (h *watchHub) watchRole() <-chan RoleChange {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	watcher := make(chan RoleChange, watchBufferSize)
+	h.roleWatchers = append(h.roleWatchers, watcher)
+	return watcher
+}
+
+// notifyLeadership subscribe election events with notify function, returns function to cancel
+// the subscription.
+func (h *watchHub) notifyLeadership(notify func()) func() {
+	id := h.events.subscribe(func(event ElectionEvent, masterId string) {
+		notify()
+	})
+	return func() {
+		h.events.unsubscribe(id)
+	}
+}
+
+// watchMembers returns a new channel which receives membership changes. Known members will be
+// sent as MemberJoin at first.
+func (h *watchHub) watchMembers() <-chan MemberChange {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	watcher := make(chan MemberChange, watchBufferSize)
+	for _, nodeId := range sortedNodeIds(h.members) {
+		sendMemberChange(watcher, MemberChange{Event: MemberJoin, NodeId: nodeId})
+	}
+	h.memberWatchers = append(h.memberWatchers, watcher)
+	return watcher
+}
+
+// memberIds returns sorted id of known members.
+func (h *watchHub) memberIds() []string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return sortedNodeIds(h.members)
+}
+
+// publishRole send role change to all role watchers.
+func (h *watchHub) publishRole(change RoleChange) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, watcher := range h.roleWatchers {
+		select {
+		case watcher <- change:
+		default:
+			logging.Warn("Drop role change cause watcher is full.")
+		}
+	}
+}
+
+// updateMembers compare specified node ids with known members and send differences to all
+// member watchers.
+func (h *watchHub) updateMembers(nodeIds []string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	members := make(map[string]bool, len(nodeIds))
+	for _, nodeId := range nodeIds {
+		members[nodeId] = true
+	}
+	var changes []MemberChange
+	for _, nodeId := range sortedNodeIds(members) {
+		if !h.members[nodeId] {
+			changes = append(changes, MemberChange{Event: MemberJoin, NodeId: nodeId})
+		}
+	}
+	for _, nodeId := range sortedNodeIds(h.members) {
+		if !members[nodeId] {
+			changes = append(changes, MemberChange{Event: MemberLeave, NodeId: nodeId})
+		}
+	}
+	h.members = members
+	for _, watcher := range h.memberWatchers {
+		for _, change := range changes {
+			sendMemberChange(watcher, change)
+		}
+	}
+}
+
+// deferCallback queue specified callback which will be invoked by next flushCallbacks.
+func (h *watchHub) deferCallback(callback func()) {
+	h.callbackMutex.Lock()
+	defer h.callbackMutex.Unlock()
+	h.callbacks = append(h.callbacks, callback)
+}
+
+// flushCallbacks invoke queued callbacks in order. It must be invoked without state lock of
+// registry held, so that callbacks are able to access the registry. Callbacks queued by a nested
+// or concurrent flush will be invoked by the flushing one to keep the order.
+func (h *watchHub) flushCallbacks() {
+	h.callbackMutex.Lock()
+	if h.flushing {
+		h.callbackMutex.Unlock()
+		return
+	}
+	h.flushing = true
+	for len(h.callbacks) > 0 {
+		callback := h.callbacks[0]
+		h.callbacks = h.callbacks[1:]
+		h.callbackMutex.Unlock()
+		callback()
+		h.callbackMutex.Lock()
+	}
+	h.callbacks = nil
+	h.flushing = false
+	h.callbackMutex.Unlock()
+}
+
+// close close all watcher channels and forget known members.
+func (h *watchHub) close() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, watcher := range h.roleWatchers {
+		close(watcher)
+	}
+	for _, watcher := range h.memberWatchers {
+		close(watcher)
+	}
+	h.roleWatchers = nil
+	h.memberWatchers = nil
+	h.members = nil
+}
+
+func sendMemberChange(watcher chan MemberChange, change MemberChange) {
+	select {
+	case watcher <- change:
+	default:
+		logging.Warn("Drop member change of node %s cause watcher is full.", change.NodeId)
+	}
+}
+
+func sortedNodeIds(members map[string]bool) []string {
+	nodeIds := make([]string, 0, len(members))
+	for nodeId := range members {
+		nodeIds = append(nodeIds, nodeId)
+	}
+	sort.Strings(nodeIds)
+	return nodeIds
+}
@@ -0,0 +1,378 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package registry
+
+import (
+	"github.com/go-zookeeper/zk"
+	"github.com/mervinkid/matcha/logging"
+	"github.com/mervinkid/matcha/misc"
+	"github.com/mervinkid/matcha/task"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	zookeeperSessionTimeout = 6 * time.Second
+	zookeeperElectionDelay  = 2 * time.Second
+	zookeeperElectionPrefix = "n_"
+)
+
+// zookeeperConn is the session of ZooKeeper used by zookeeperRegistry, which is satisfied by *zk.Conn.
+type zookeeperConn interface {
+	Create(path string, data []byte, flags int32, acl []zk.ACL) (string, error)
+	Exists(path string) (bool, *zk.Stat, error)
+	Children(path string) ([]string, *zk.Stat, error)
+	Get(path string) ([]byte, *zk.Stat, error)
+	Delete(path string, version int32) error
+	State() zk.State
+	Close()
+}
+
+// connectZookeeper connect to specified servers and returns session with timeout.
+func connectZookeeper(servers []string, sessionTimeout time.Duration) (zookeeperConn, error) {
+	conn, _, err := zk.Connect(servers, sessionTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// zookeeperRegistry is the implementation of Registry interface based on ZooKeeper. Local node
+// is registered as an ephemeral node, and master is the owner of the ephemeral sequential node
+// with lowest sequence under election path.
+//  {path}/{appId}
+//   ├── nodes
+//   │    ├── {nodeId}
+//   │    └── ...
+//   └── election
+//        ├── n_0000000001 = nodeId  ← master
+//        └── n_0000000002 = nodeId
+type zookeeperRegistry struct {
+	// Props
+	config  Config
+	connect func(servers []string, sessionTimeout time.Duration) (zookeeperConn, error)
+	// Runtime
+	conn              zookeeperConn
+	electionNode      string
+	role              roleState
+	watch             watchHub
+	backend           backendState
+	ttl               time.Duration
+	interval          time.Duration
+	electionScheduler task.Scheduler
+	// State
+	running    bool
+	stateMutex sync.RWMutex
+	waitGroup  sync.WaitGroup
+}
+
+func (r *zookeeperRegistry) String() string {
+	return "zookeeper-registry-" + r.config.AppId
+}
+
+func (r *zookeeperRegistry) Type() string {
+	return "zookeeper"
+}
+
+func (r *zookeeperRegistry) Start() error {
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+	if !r.running {
+		if r.config.NodeId == "" {
+			r.config.NodeId = generateNodeId(r.config.AppId)
+		}
+		server := r.config.Url.Address()
+		ttl, interval := electionTiming(r.config, zookeeperSessionTimeout, zookeeperElectionDelay)
+		connect := r.connect
+		if connect == nil {
+			connect = connectZookeeper
+		}
+		conn, err := connect([]string{server}, ttl)
+		if err != nil {
+			return err
+		}
+		electionScheduler := task.NewFixedDelayScheduler(r.electionTask, interval)
+		if err := misc.LifecycleStart(electionScheduler); err != nil {
+			conn.Close()
+			return err
+		}
+		r.conn = conn
+		r.ttl, r.interval = ttl, interval
+		r.backend.reset(interval)
+		r.electionScheduler = electionScheduler
+		r.running = true
+		r.waitGroup.Add(1)
+	}
+	return nil
+}
+
+func (r *zookeeperRegistry) Stop() {
+	defer r.watch.flushCallbacks()
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+	if r.running {
+		misc.LifecycleStop(r.electionScheduler)
+		r.electionScheduler = nil
+		// Delete ephemeral nodes explicitly for other nodes to take over without waiting for session timeout.
+		if r.electionNode != "" {
+			r.conn.Delete(r.electionNode, -1)
+			r.electionNode = ""
+		}
+		r.conn.Delete(r.nodePath(), -1)
+		r.conn.Close()
+		r.conn = nil
+		r.changeRole(Slaver, unknownNodeId)
+		r.watch.close()
+		r.running = false
+		r.waitGroup.Done()
+	}
+}
+
+func (r *zookeeperRegistry) IsRunning() bool {
+	r.stateMutex.RLock()
+	defer r.stateMutex.RUnlock()
+	return r.running
+}
+
+func (r *zookeeperRegistry) Sync() {
+	r.waitGroup.Wait()
+}
+
+func (r *zookeeperRegistry) IsMaster() bool {
+	return r.role.isMaster()
+}
+
+func (r *zookeeperRegistry) Master() (string, bool) {
+	return r.role.master()
+}
+
+func (r *zookeeperRegistry) FencingToken() (uint64, bool) {
+	return r.role.fencingToken()
+}
+
+func (r *zookeeperRegistry) Nodes() []NodeInfo {
+	return nodeInfos(&r.role, &r.watch)
+}
+
+func (r *zookeeperRegistry) Healthy() bool {
+	return r.backend.healthy()
+}
+
+func (r *zookeeperRegistry) WatchRole() <-chan RoleChange {
+	return r.watch.watchRole()
+}
+
+func (r *zookeeperRegistry) WatchMembers() <-chan MemberChange {
+	return r.watch.watchMembers()
+}
+
+func (r *zookeeperRegistry) Subscribe(handler func(event ElectionEvent, masterId string)) SubscriptionId {
+	return r.watch.events.subscribe(handler)
+}
+
+func (r *zookeeperRegistry) Unsubscribe(id SubscriptionId) {
+	r.watch.events.unsubscribe(id)
+}
+
+func (r *zookeeperRegistry) NotifyLeadership(notify func()) func() {
+	return r.watch.notifyLeadership(notify)
+}
+
+// Resign delete election node of local node. Local node will join election again with a new
+// sequence behind other nodes in next election round.
+func (r *zookeeperRegistry) Resign() error {
+	defer r.watch.flushCallbacks()
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+	if !r.running || !r.IsMaster() || r.electionNode == "" {
+		return nil
+	}
+	if err := r.conn.Delete(r.electionNode, -1); err != nil && err != zk.ErrNoNode {
+		return err
+	}
+	r.electionNode = ""
+	r.changeRole(Slaver, unknownNodeId)
+	return nil
+}
+
+func (r *zookeeperRegistry) basePath() string {
+	return path.Join("/", r.config.Url.Path, r.config.AppId)
+}
+
+func (r *zookeeperRegistry) electionPath() string {
+	return path.Join(r.basePath(), "election")
+}
+
+func (r *zookeeperRegistry) nodesPath() string {
+	return path.Join(r.basePath(), "nodes")
+}
+
+func (r *zookeeperRegistry) nodePath() string {
+	return path.Join(r.nodesPath(), r.config.NodeId)
+}
+
+// ensurePath create persistent node of specified path and all its parents if not exist.
+func (r *zookeeperRegistry) ensurePath(nodePath string) error {
+	current := ""
+	for _, part := range strings.Split(strings.Trim(nodePath, "/"), "/") {
+		current += "/" + part
+		if _, err := r.conn.Create(current, nil, 0, zk.WorldACL(zk.PermAll)); err != nil && err != zk.ErrNodeExists {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureEphemeral returns true if specified node exists, or create it under existing parents with
+// ephemeral flag. Ephemeral nodes will be removed by ZooKeeper while session expired.
+func (r *zookeeperRegistry) ensureEphemeral(nodePath string, data []byte) error {
+	exist, _, err := r.conn.Exists(nodePath)
+	if err != nil || exist {
+		return err
+	}
+	if err := r.ensurePath(path.Dir(nodePath)); err != nil {
+		return err
+	}
+	if _, err := r.conn.Create(nodePath, data, zk.FlagEphemeral, zk.WorldACL(zk.PermAll)); err != nil && err != zk.ErrNodeExists {
+		return err
+	}
+	return nil
+}
+
+// ensureElectionNode create ephemeral sequential node under election path if local node has not
+// joined election yet or its node has been removed.
+func (r *zookeeperRegistry) ensureElectionNode(data []byte) error {
+	if r.electionNode != "" {
+		exist, _, err := r.conn.Exists(r.electionNode)
+		if err != nil || exist {
+			return err
+		}
+	}
+	if err := r.ensurePath(r.electionPath()); err != nil {
+		return err
+	}
+	prefix := path.Join(r.electionPath(), zookeeperElectionPrefix)
+	electionNode, err := r.conn.Create(prefix, data, zk.FlagEphemeral|zk.FlagSequence, zk.WorldACL(zk.PermAll))
+	if err != nil {
+		return err
+	}
+	r.electionNode = electionNode
+	return nil
+}
+
+func (r *zookeeperRegistry) electionTask() {
+	defer r.watch.flushCallbacks()
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+	if !r.running {
+		return
+	}
+	// Back off checks while backend keeps failing, master keeps renewing to hold its role
+	if backoffGuard(&r.role, &r.backend, r.degradeRole) {
+		return
+	}
+
+	master, err := r.elect()
+	if err != nil {
+		logging.Error("Election with zookeeper fail cause %s.", err.Error())
+		if r.conn.State() != zk.StateHasSession {
+			r.backend.fail(r.config, &r.watch, err)
+		} else {
+			notifyElectionError(r.config, &r.watch, err)
+		}
+		r.degradeRole()
+		return
+	}
+	r.backend.ok(r.config, &r.watch)
+	if master == r.config.NodeId {
+		r.role.setToken(r.electionSequence())
+		r.changeRole(Master, master)
+	} else {
+		r.changeRole(Slaver, master)
+	}
+}
+
+// elect register local node and returns id of current master.
+func (r *zookeeperRegistry) elect() (string, error) {
+	nodeId := []byte(r.config.NodeId)
+	// Register local node, observer does not register itself
+	if !r.config.Observer {
+		if err := r.ensureEphemeral(r.nodePath(), nodeId); err != nil {
+			return "", err
+		}
+	}
+	if children, _, err := r.conn.Children(r.nodesPath()); err == nil {
+		r.watch.updateMembers(children)
+	} else if err == zk.ErrNoNode {
+		r.watch.updateMembers(nil)
+	} else {
+		logging.Warn("Refresh members with zookeeper fail cause %s.", err.Error())
+	}
+	// Join election, observer never joins
+	if !r.config.Observer {
+		if err := r.ensureElectionNode(nodeId); err != nil {
+			return "", err
+		}
+	}
+	// Node with lowest sequence takes master role
+	children, _, err := r.conn.Children(r.electionPath())
+	if err == zk.ErrNoNode {
+		return unknownNodeId, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(children) == 0 {
+		return unknownNodeId, nil
+	}
+	sort.Strings(children)
+	data, _, err := r.conn.Get(path.Join(r.electionPath(), children[0]))
+	if err == zk.ErrNoNode {
+		return unknownNodeId, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// electionSequence returns sequence of election node of local node as fencing token. Sequence
+// increases monotonically for each node joining election.
+func (r *zookeeperRegistry) electionSequence() uint64 {
+	sequence := strings.TrimPrefix(path.Base(r.electionNode), zookeeperElectionPrefix)
+	token, _ := strconv.ParseUint(sequence, 10, 64)
+	return token
+}
+
+func (r *zookeeperRegistry) changeRole(newRole Role, newMaster string) {
+	updateRole(r.config, &r.role, &r.watch, newRole, newMaster)
+}
+
+// degradeRole demote local node on backend failure unless role was confirmed within ttl.
+func (r *zookeeperRegistry) degradeRole() {
+	degradeRole(r.config, &r.role, &r.watch, r.ttl-r.interval)
+}
@@ -0,0 +1,258 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package registry
+
+import (
+	"fmt"
+	"github.com/go-zookeeper/zk"
+	"github.com/mervinkid/matcha/util"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeZookeeperNode struct {
+	data  []byte
+	owner *fakeZookeeperConn
+}
+
+// fakeZookeeper is a fake ZooKeeper which keeps node tree in memory. Sessions are disconnected
+// while it is down.
+type fakeZookeeper struct {
+	nodes    map[string]*fakeZookeeperNode
+	sequence int
+	down     bool
+	mutex    sync.Mutex
+}
+
+func newFakeZookeeper() *fakeZookeeper {
+	return &fakeZookeeper{nodes: map[string]*fakeZookeeperNode{"/": {}}}
+}
+
+func (z *fakeZookeeper) connect(servers []string, sessionTimeout time.Duration) (zookeeperConn, error) {
+	return &fakeZookeeperConn{server: z}, nil
+}
+
+func (z *fakeZookeeper) setDown(down bool) {
+	z.mutex.Lock()
+	defer z.mutex.Unlock()
+	z.down = down
+}
+
+// fakeZookeeperConn is the session of fakeZookeeper, ephemeral nodes are removed while closed.
+type fakeZookeeperConn struct {
+	server *fakeZookeeper
+}
+
+func (c *fakeZookeeperConn) lock() error {
+	c.server.mutex.Lock()
+	if c.server.down {
+		c.server.mutex.Unlock()
+		return zk.ErrConnectionClosed
+	}
+	return nil
+}
+
+func (c *fakeZookeeperConn) Create(nodePath string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+	if err := c.lock(); err != nil {
+		return "", err
+	}
+	defer c.server.mutex.Unlock()
+	if _, ok := c.server.nodes[path.Dir(nodePath)]; !ok {
+		return "", zk.ErrNoNode
+	}
+	if flags&zk.FlagSequence != 0 {
+		c.server.sequence++
+		nodePath = fmt.Sprintf("%s%010d", nodePath, c.server.sequence)
+	}
+	if _, ok := c.server.nodes[nodePath]; ok {
+		return "", zk.ErrNodeExists
+	}
+	node := &fakeZookeeperNode{data: data}
+	if flags&zk.FlagEphemeral != 0 {
+		node.owner = c
+	}
+	c.server.nodes[nodePath] = node
+	return nodePath, nil
+}
+
+func (c *fakeZookeeperConn) Exists(nodePath string) (bool, *zk.Stat, error) {
+	if err := c.lock(); err != nil {
+		return false, nil, err
+	}
+	defer c.server.mutex.Unlock()
+	_, ok := c.server.nodes[nodePath]
+	return ok, &zk.Stat{}, nil
+}
+
+func (c *fakeZookeeperConn) Children(nodePath string) ([]string, *zk.Stat, error) {
+	if err := c.lock(); err != nil {
+		return nil, nil, err
+	}
+	defer c.server.mutex.Unlock()
+	if _, ok := c.server.nodes[nodePath]; !ok {
+		return nil, nil, zk.ErrNoNode
+	}
+	var children []string
+	for childPath := range c.server.nodes {
+		if childPath != "/" && path.Dir(childPath) == nodePath {
+			children = append(children, path.Base(childPath))
+		}
+	}
+	return children, &zk.Stat{}, nil
+}
+
+func (c *fakeZookeeperConn) Get(nodePath string) ([]byte, *zk.Stat, error) {
+	if err := c.lock(); err != nil {
+		return nil, nil, err
+	}
+	defer c.server.mutex.Unlock()
+	node, ok := c.server.nodes[nodePath]
+	if !ok {
+		return nil, nil, zk.ErrNoNode
+	}
+	return node.data, &zk.Stat{}, nil
+}
+
+func (c *fakeZookeeperConn) Delete(nodePath string, version int32) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.server.mutex.Unlock()
+	if _, ok := c.server.nodes[nodePath]; !ok {
+		return zk.ErrNoNode
+	}
+	delete(c.server.nodes, nodePath)
+	return nil
+}
+
+func (c *fakeZookeeperConn) State() zk.State {
+	c.server.mutex.Lock()
+	defer c.server.mutex.Unlock()
+	if c.server.down {
+		return zk.StateDisconnected
+	}
+	return zk.StateHasSession
+}
+
+func (c *fakeZookeeperConn) Close() {
+	c.server.mutex.Lock()
+	defer c.server.mutex.Unlock()
+	for nodePath, node := range c.server.nodes {
+		if node.owner == c {
+			delete(c.server.nodes, nodePath)
+		}
+	}
+}
+
+// newTestZookeeperRegistry create zookeeper registry of specified node with fake zookeeper and
+// short election timing.
+func newTestZookeeperRegistry(z *fakeZookeeper, nodeId string, observer bool) *zookeeperRegistry {
+	return &zookeeperRegistry{
+		config: Config{
+			AppId:            "demo",
+			NodeId:           nodeId,
+			Url:              util.ParseUrl("zookeeper://127.0.0.1:2181/matcha"),
+			Observer:         observer,
+			ElectionTtl:      time.Second,
+			ElectionInterval: 50 * time.Millisecond,
+		},
+		connect: z.connect,
+	}
+}
+
+func TestZookeeperRegistry_Election(t *testing.T) {
+
+	z := newFakeZookeeper()
+	first, second := newTestZookeeperRegistry(z, "node0", false), newTestZookeeperRegistry(z, "node1", false)
+	observer := newTestZookeeperRegistry(z, "observer", true)
+	for _, reg := range []*zookeeperRegistry{first, observer} {
+		if err := reg.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer reg.Stop()
+	}
+	waitFor(t, "node0 take master", first.IsMaster)
+	if err := second.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer second.Stop()
+	waitFor(t, "members registered", func() bool {
+		return len(second.Nodes()) == 2 && len(observer.Nodes()) == 2
+	})
+	if !strings.HasPrefix(first.electionNode, "/matcha/demo/election/n_") {
+		t.Fatal("unexpected election node", first.electionNode)
+	}
+	if token, ok := first.FencingToken(); !ok || token != first.electionSequence() || token == 0 {
+		t.Fatal("expect sequence of election node as fencing token but got", token)
+	}
+	for _, reg := range []*zookeeperRegistry{second, observer} {
+		if master, ok := reg.Master(); reg.IsMaster() || !ok || master != "node0" {
+			t.Fatal("expect node0 as master but got", master)
+		}
+	}
+
+	// Slaver with next sequence takes over after master stopped.
+	first.Stop()
+	waitFor(t, "node1 take master", second.IsMaster)
+	waitFor(t, "observer follow node1", func() bool {
+		master, _ := observer.Master()
+		return master == "node1" && !observer.IsMaster()
+	})
+	if token, _ := second.FencingToken(); token <= first.electionSequence() {
+		t.Fatal("expect fencing token increased but got", token)
+	}
+}
+
+func TestZookeeperRegistry_Failure(t *testing.T) {
+
+	z := newFakeZookeeper()
+	events := make(chan BackendEvent, 64)
+	reg := newTestZookeeperRegistry(z, "node0", false)
+	reg.config.Backend = func(event BackendEvent, err error) {
+		events <- event
+	}
+	if err := reg.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer reg.Stop()
+	waitFor(t, "node0 take master", reg.IsMaster)
+
+	// Master is kept while session is briefly lost.
+	z.setDown(true)
+	waitEvent(t, events, BackendUnreachable)
+	if reg.Healthy() || !reg.IsMaster() {
+		t.Fatal("expect backend unhealthy with master kept")
+	}
+	z.setDown(false)
+	waitEvent(t, events, Reconnected)
+
+	// Master is lost while session keeps lost after window.
+	z.setDown(true)
+	waitEvent(t, events, BackendUnreachable)
+	waitFor(t, "node0 lose master", func() bool {
+		return !reg.IsMaster()
+	})
+}
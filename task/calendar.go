@@ -0,0 +1,111 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package task
+
+import (
+	"time"
+)
+
+// Calendar is the interface defined exclusion of fire times. Fire times excluded by any calendar
+// of scheduler will be skipped.
+// Methods:
+//  IsExcluded returns true if specified time is excluded.
+type Calendar interface {
+	IsExcluded(t time.Time) bool
+}
+
+// dateRangeCalendar exclude times in [start, end).
+type dateRangeCalendar struct {
+	start time.Time
+	end   time.Time
+}
+
+func (c *dateRangeCalendar) IsExcluded(t time.Time) bool {
+	return !t.Before(c.start) && t.Before(c.end)
+}
+
+// weekdayCalendar exclude whole days of specified weekdays.
+type weekdayCalendar struct {
+	weekdays [7]bool
+}
+
+func (c *weekdayCalendar) IsExcluded(t time.Time) bool {
+	return c.weekdays[t.Weekday()]
+}
+
+// holidayCalendar exclude whole days of specified dates.
+type holidayCalendar struct {
+	dates map[string]bool
+}
+
+func (c *holidayCalendar) IsExcluded(t time.Time) bool {
+	return c.dates[t.Format(holidayDateFormat)]
+}
+
+const holidayDateFormat = "2006-01-02"
+
+// dailyCalendar exclude times of day in [start, end). The range wraps midnight if start is after end.
+type dailyCalendar struct {
+	start time.Duration
+	end   time.Duration
+}
+
+func (c *dailyCalendar) IsExcluded(t time.Time) bool {
+	hour, minute, second := t.Clock()
+	offset := time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute + time.Duration(second)*time.Second
+	if c.start <= c.end {
+		return offset >= c.start && offset < c.end
+	}
+	return offset >= c.start || offset < c.end
+}
+
+// NewDateRangeCalendar create a new Calendar instance which exclude times in [start, end).
+func NewDateRangeCalendar(start, end time.Time) Calendar {
+	return &dateRangeCalendar{start: start, end: end}
+}
+
+// NewWeekdayCalendar create a new Calendar instance which exclude whole days of specified weekdays.
+func NewWeekdayCalendar(weekdays ...time.Weekday) Calendar {
+	calendar := &weekdayCalendar{}
+	for _, weekday := range weekdays {
+		calendar.weekdays[weekday%7] = true
+	}
+	return calendar
+}
+
+// NewHolidayCalendar create a new Calendar instance which exclude whole days of specified dates.
+// Dates are compared in the location of fire time.
+func NewHolidayCalendar(dates ...time.Time) Calendar {
+	calendar := &holidayCalendar{dates: make(map[string]bool)}
+	for _, date := range dates {
+		calendar.dates[date.Format(holidayDateFormat)] = true
+	}
+	return calendar
+}
+
+// NewDailyCalendar create a new Calendar instance which exclude times of day in [start, end),
+// start and end are offsets since midnight. The range wraps midnight if start is after end.
+//  NewDailyCalendar(17*time.Hour, 9*time.Hour) // Business hours only
+func NewDailyCalendar(start, end time.Duration) Calendar {
+	return &dailyCalendar{start: start, end: end}
+}
@@ -0,0 +1,173 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package task
+
+import (
+	"sync"
+	"time"
+)
+
+// Trigger create a scheduler which fire specified task. It is used for binding one task with
+// multiple triggers in composite scheduler.
+type Trigger func(task ContextTask, config SchedulerConfig) Scheduler
+
+// CornTrigger returns a Trigger which fire task with corn expression.
+func CornTrigger(corn string) Trigger {
+	return func(task ContextTask, config SchedulerConfig) Scheduler {
+		return NewCornContextScheduler(corn, task, config)
+	}
+}
+
+// FixedRateTrigger returns a Trigger which fire task with fixed rate.
+func FixedRateTrigger(rate time.Duration) Trigger {
+	return func(task ContextTask, config SchedulerConfig) Scheduler {
+		return NewFixedRateContextScheduler(task, rate, config)
+	}
+}
+
+// FixedDelayTrigger returns a Trigger which fire task with fixed delay.
+func FixedDelayTrigger(delay time.Duration) Trigger {
+	return func(task ContextTask, config SchedulerConfig) Scheduler {
+		return NewFixedDelayContextScheduler(task, delay, config)
+	}
+}
+
+// compositeScheduler is the implementation of Scheduler interface which fire one task with
+// multiple triggers. Executions of all triggers share the same policies, so that overlap policy
+// is applied across triggers.
+//  +-----------+
+//  | trigger 1 | ↘
+//  +-----------+   +--------+     +------+
+//  |    ...    | → | runner | → → | task |
+//  +-----------+   +--------+     +------+
+//  | trigger N | ↗
+//  +-----------+
+type compositeScheduler struct {
+	schedulers []Scheduler
+	paused     bool
+	state      state
+	stateMutex sync.RWMutex
+}
+
+// Start will start all triggers. Started triggers will be stopped if any of them fail to start.
+func (s *compositeScheduler) Start() error {
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+
+	if s.state != stateNew {
+		return nil
+	}
+	for i, scheduler := range s.schedulers {
+		if err := scheduler.Start(); err != nil {
+			for _, started := range s.schedulers[:i] {
+				started.Stop()
+			}
+			return err
+		}
+	}
+	s.state = stateRunning
+
+	return nil
+}
+
+// Stop will stop all triggers.
+func (s *compositeScheduler) Stop() {
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+	if s.state == stateRunning {
+		for _, scheduler := range s.schedulers {
+			scheduler.Stop()
+		}
+		s.state = stateFinish
+	}
+}
+
+// IsRunning returns true is scheduler current running.
+func (s *compositeScheduler) IsRunning() bool {
+	s.stateMutex.RLock()
+	defer s.stateMutex.RUnlock()
+	return s.state == stateRunning && !s.paused
+}
+
+// Pause halt task executions of all triggers.
+func (s *compositeScheduler) Pause() {
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+	if s.state == stateRunning && !s.paused {
+		for _, scheduler := range s.schedulers {
+			scheduler.Pause()
+		}
+		s.paused = true
+	}
+}
+
+// Resume continue task executions of all triggers.
+func (s *compositeScheduler) Resume() {
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+	if s.state == stateRunning && s.paused {
+		for _, scheduler := range s.schedulers {
+			scheduler.Resume()
+		}
+		s.paused = false
+	}
+}
+
+// IsPaused returns true if scheduler current paused.
+func (s *compositeScheduler) IsPaused() bool {
+	s.stateMutex.RLock()
+	defer s.stateMutex.RUnlock()
+	return s.state == stateRunning && s.paused
+}
+
+// NextRun returns the earliest next execution of all triggers.
+func (s *compositeScheduler) NextRun() time.Time {
+	s.stateMutex.RLock()
+	defer s.stateMutex.RUnlock()
+	var nextRun time.Time
+	for _, scheduler := range s.schedulers {
+		if next := scheduler.NextRun(); !next.IsZero() && (nextRun.IsZero() || next.Before(nextRun)) {
+			nextRun = next
+		}
+	}
+	return nextRun
+}
+
+// NewCompositeScheduler create a new scheduler instance which fire specified task with all
+// triggers as one schedule unit.
+//  NewCompositeScheduler(task, config, CornTrigger("0 0 9 * * 1-5"), FixedRateTrigger(time.Hour))
+func NewCompositeScheduler(task ContextTask, config SchedulerConfig, triggers ...Trigger) Scheduler {
+	runner := newTaskRunner(task, config)
+	schedulers := make([]Scheduler, 0, len(triggers))
+	for _, trigger := range triggers {
+		scheduler := trigger(task, config)
+		switch scheduler := scheduler.(type) {
+		case *cornScheduler:
+			scheduler.runner = runner
+		case *fixedTimeScheduler:
+			scheduler.runner = runner
+		}
+		schedulers = append(schedulers, scheduler)
+	}
+	return &compositeScheduler{schedulers: schedulers}
+}
@@ -28,7 +28,6 @@ import (
 	"github.com/mervinkid/matcha/logging"
 	"github.com/mervinkid/matcha/parallel"
 	"github.com/mervinkid/matcha/util"
-	"math"
 	"regexp"
 	"strconv"
 	"strings"
@@ -40,6 +39,15 @@ var (
 	InvalidCornExpressionError = errors.New("invalid corn expression")
 )
 
+// Max number of years to search for next matched time of corn expression.
+const cornSearchYears = 5
+
+// Sleep and misfire properties of corn scheduler
+const (
+	cornMaxSleep         = 1 * time.Minute
+	cornMisfireThreshold = 1 * time.Second
+)
+
 // Range constants
 const (
 	secondMin  = 0
@@ -58,12 +66,19 @@ const (
 	yearMax    = -1
 )
 
+// Names for describing corn expression
+var (
+	monthNames   = []string{"", "Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"}
+	weekdayNames = []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+)
+
 // Regular expressions
 var (
-	regexpAll, _      = regexp.Compile("^\\*$")                          // Match '*'
-	regexpRange, _    = regexp.Compile("^(\\d)+-(\\d)+$")                // Match 'NUM-NUM'
-	regexpDisperse, _ = regexp.Compile("^(\\d)+(,(\\d)+)*$")             // Match 'NUM,NUM,NUM'
-	regexpStep, _     = regexp.Compile("^(\\*)|((\\d)+-(\\d)+)/(\\d)+$") // Match '*/NUM' and 'NUM-NUM/NUM'
+	regexpAll, _   = regexp.Compile("^\\*$")                  // Match '*'
+	regexpValue, _ = regexp.Compile("^\\d+$")                 // Match 'NUM'
+	regexpRange, _ = regexp.Compile("^(\\d)+-(\\d)+$")        // Match 'NUM-NUM'
+	regexpStep, _  = regexp.Compile("^(\\*|\\d+-\\d+)/\\d+$") // Match '*/NUM' and 'NUM-NUM/NUM'
+	regexpName, _  = regexp.Compile("[A-Za-z]+")              // Match names like 'MON' and 'JAN'
 )
 
 type cornData struct {
@@ -88,6 +103,57 @@ func initCornData() *cornData {
 	}
 }
 
+// next returns the first time after specified time which matches corn data.
+// Returns zero time if no time matches within cornSearchYears.
+func (d *cornData) next(from time.Time) time.Time {
+
+	loc := from.Location()
+	t := from.Truncate(time.Second).Add(time.Second)
+	limit := t.AddDate(cornSearchYears, 0, 0)
+
+	for t.Before(limit) {
+		year, month, day := t.Date()
+		hour, minute, _ := t.Clock()
+		switch {
+		case !matchBitSet(d.Years, year):
+			t = time.Date(year+1, time.January, 1, 0, 0, 0, 0, loc)
+		case !matchBitSet(d.Months, int(month)):
+			t = time.Date(year, month+1, 1, 0, 0, 0, 0, loc)
+		case !d.matchDay(day, t.Weekday()):
+			t = time.Date(year, month, day+1, 0, 0, 0, 0, loc)
+		case !matchBitSet(d.Hours, hour):
+			t = time.Date(year, month, day, hour+1, 0, 0, 0, loc)
+		case !matchBitSet(d.Minutes, minute):
+			t = time.Date(year, month, day, hour, minute+1, 0, 0, loc)
+		case !matchBitSet(d.Seconds, t.Second()):
+			t = t.Add(time.Second)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// matchDay check match of day of month and day of week. The day matches if either field matches
+// while both fields are restricted, like crontab.
+func (d *cornData) matchDay(day int, weekday time.Weekday) bool {
+	matchDays := matchBitSet(d.Days, day)
+	matchWeekdays := matchBitSet(d.Weekdays, int(weekday))
+	if !d.Days.IsEmpty() && !d.Weekdays.IsEmpty() {
+		return matchDays || matchWeekdays
+	}
+	return matchDays && matchWeekdays
+}
+
+// count returns the number of times between from and to (both exclusive) which match corn data.
+func (d *cornData) count(from, to time.Time) int {
+	count := 0
+	for t := d.next(from); !t.IsZero() && t.Before(to); t = d.next(t) {
+		count++
+	}
+	return count
+}
+
 func (d *cornData) String() string {
 	return fmt.Sprintf("cornData{Seconds:%v, Minute:%v, Hour:%v, Days:%v, Months:%v, Weekdays:%v, Year:%v}",
 		d.Seconds, d.Minutes, d.Hours, d.Days, d.Months, d.Weekdays, d.Years)
@@ -96,19 +162,25 @@ func (d *cornData) String() string {
 // CornScheduler is the implementation of Scheduler interface provide corn expression support.
 type cornScheduler struct {
 	// Props
-	CornExp  string
-	Task     func()
-	cornData *cornData
+	CornExp     string
+	Task        func()
+	ContextTask ContextTask
+	Config      SchedulerConfig
+	cornData    *cornData
 	// State
 	state      state
 	stateMutex sync.RWMutex
 	stopC      stopChan
+	runner     *taskRunner
+	// Reschedule signal
+	rescheduleC chan uint8
 }
 
 // Start will start scheduler for task scheduling execution.
 func (s *cornScheduler) Start() error {
 
-	if s.Task == nil {
+	task := resolveTask(s.Task, s.ContextTask)
+	if task == nil {
 		return NoTaskError
 	}
 
@@ -127,33 +199,69 @@ func (s *cornScheduler) Start() error {
 	s.cornData = parsed
 
 	s.stopC = initStopChan()
+	s.rescheduleC = make(chan uint8, 1)
+	if s.runner == nil {
+		s.runner = newTaskRunner(task, s.Config)
+	}
 
-	scheduler := parallel.NewGoroutine(func() {
-		// Whole second alignment
-		offset := int64(time.Second) - time.Now().UnixNano()%int64(time.Second)
-		ticker := time.NewTicker(time.Duration(offset) * time.Nanosecond)
-		firstExecute := true
-
-		var latestTaskExecuteTimestamp int64
+	scheduler := parallel.NewNamedGoroutine("CornScheduler-"+s.CornExp, func() {
+		// Sleep until next fire time. The sleep is capped by cornMaxSleep in order to
+		// follow wall clock changes.
+		corn, data := s.getCorn()
+		// Apply fire times missed since last fire recorded in store.
+		if lastFire := s.runner.loadLastFire(); !lastFire.IsZero() {
+			now := time.Now()
+			if missed := data.count(lastFire, now); missed > 0 {
+				logging.Warn("CornScheduler %s misfire %d times since %v.", corn, missed, lastFire.String())
+				for i := s.runner.executions(missed, false); i > 0; i-- {
+					s.runner.fire(now)
+				}
+			}
+		}
+		next := data.next(time.Now())
 		for {
+			// Block until stop or reschedule if there is no more fire time.
+			sleep := cornMaxSleep
+			if until := time.Until(next); !next.IsZero() && until < sleep {
+				sleep = until
+			}
+			timer := time.NewTimer(sleep)
+			timerC := timer.C
+			if next.IsZero() {
+				logging.Warn("CornScheduler %s has no more fire time.", corn)
+				timerC = nil
+			}
 			select {
 			case <-s.stopC:
-				ticker.Stop()
+				timer.Stop()
 				return
-			case <-ticker.C:
-				now := time.Now()
-				nowUnix := now.Unix()
-				if matchCornData(*s.cornData, now) && nowUnix != latestTaskExecuteTimestamp {
+			case <-s.rescheduleC:
+				timer.Stop()
+				corn, data = s.getCorn()
+				next = data.next(time.Now())
+				continue
+			case <-timerC:
+			}
+			now := time.Now()
+			if now.Before(next) {
+				continue
+			}
+			// Fire times between scheduled one and now are missed while process blocked
+			// or suspended.
+			missed := 0
+			if now.Sub(next) >= cornMisfireThreshold {
+				missed = 1 + data.count(next, now)
+			}
+			if !s.IsPaused() {
+				if missed > 0 {
+					logging.Warn("CornScheduler %s misfire %d times since %v.", corn, missed, next.String())
+				}
+				for i := s.runner.executions(missed, missed == 0); i > 0; i-- {
 					logging.Trace("CornScheduler start task at %v.", now.String())
-					parallel.NewGoroutine(s.Task).Start()
-					latestTaskExecuteTimestamp = nowUnix
+					s.runner.fire(next)
 				}
 			}
-			// Match corn data every second
-			if !firstExecute {
-				firstExecute = false
-				ticker = time.NewTicker(1*time.Second - 10*time.Millisecond)
-			}
+			next = data.next(now)
 		}
 	})
 	scheduler.Start()
@@ -166,7 +274,7 @@ func (s *cornScheduler) Start() error {
 func (s *cornScheduler) Stop() {
 	s.stateMutex.Lock()
 	defer s.stateMutex.Unlock()
-	if s.state == stateRunning {
+	if s.state == stateRunning || s.state == statePaused {
 		close(s.stopC)
 		s.state = stateFinish
 	}
@@ -179,16 +287,100 @@ func (s *cornScheduler) IsRunning() bool {
 	return s.state == stateRunning
 }
 
-// Check match between specified corn data and time.
-func matchCornData(data cornData, time time.Time) bool {
+// Pause halt task executions temporarily. Triggers during pause will be skipped.
+func (s *cornScheduler) Pause() {
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+	if s.state == stateRunning {
+		s.state = statePaused
+	}
+}
+
+// Resume continue task executions after pause.
+func (s *cornScheduler) Resume() {
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+	if s.state == statePaused {
+		s.state = stateRunning
+	}
+}
+
+// IsPaused returns true if scheduler current paused.
+func (s *cornScheduler) IsPaused() bool {
+	s.stateMutex.RLock()
+	defer s.stateMutex.RUnlock()
+	return s.state == statePaused
+}
+
+// RescheduleCorn change corn expression of scheduler. Next execution will be scheduled with
+// new expression if scheduler is running.
+func (s *cornScheduler) RescheduleCorn(corn string) error {
+	parsed, err := parseCornExp(corn)
+	if err != nil {
+		return err
+	}
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+	s.CornExp = corn
+	s.cornData = parsed
+	if s.state == stateRunning || s.state == statePaused {
+		select {
+		case s.rescheduleC <- 1:
+		default:
+		}
+	}
+	return nil
+}
+
+func (s *cornScheduler) getCorn() (string, *cornData) {
+	s.stateMutex.RLock()
+	defer s.stateMutex.RUnlock()
+	return s.CornExp, s.cornData
+}
+
+// NextRun returns the time of next execution.
+func (s *cornScheduler) NextRun() time.Time {
+	s.stateMutex.RLock()
+	defer s.stateMutex.RUnlock()
+	if s.state != stateRunning {
+		return time.Time{}
+	}
+	return s.cornData.next(time.Now())
+}
+
+// ValidateCorn returns error if specified corn expression is invalid.
+func ValidateCorn(corn string) error {
+	_, err := parseCornExp(corn)
+	return err
+}
 
-	return matchBitSet(data.Seconds, time.Second()) &&
-		matchBitSet(data.Minutes, time.Minute()) &&
-		matchBitSet(data.Hours, time.Hour()) &&
-		matchBitSet(data.Days, time.Day()) &&
-		matchBitSet(data.Months, int(time.Month())) &&
-		matchBitSet(data.Weekdays, int(time.Weekday())) &&
-		matchBitSet(data.Years, time.Year())
+// DescribeCorn returns a human-readable summary of fields of specified corn expression.
+// Returns empty string if the expression is invalid.
+//  DescribeCorn("0 */15 9-17 * * 1-5")
+//  → "second 0, minute 0,15,30,45, hour 9-17, every day, every month, weekday Mon-Fri"
+func DescribeCorn(corn string) string {
+	data, err := parseCornExp(corn)
+	if err != nil {
+		return ""
+	}
+	return strings.Join([]string{
+		describeBitSet("second", data.Seconds, secondMin, secondMax, nil),
+		describeBitSet("minute", data.Minutes, minuteMin, minuteMax, nil),
+		describeBitSet("hour", data.Hours, hourMin, hourMax, nil),
+		describeBitSet("day", data.Days, dayMin, dayMax, nil),
+		describeBitSet("month", data.Months, monthMin, monthMax, monthNames),
+		describeBitSet("weekday", data.Weekdays, weekdayMin, weekdayMax, weekdayNames),
+	}, ", ")
+}
+
+// NextCorn returns the first time after specified time which matches corn expression.
+// Returns zero time if no time matches within 5 years.
+func NextCorn(corn string, from time.Time) (time.Time, error) {
+	data, err := parseCornExp(corn)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return data.next(from), nil
 }
 
 // Parse specified expression to corn data.
@@ -202,88 +394,184 @@ func parseCornExp(expression string) (*cornData, error) {
 	cornData := initCornData()
 
 	// Set seconds
-	if err = setBitSet(cornData.Seconds, cornExpParts[0], secondMin, secondMax); err != nil {
+	if err = setBitSet(cornData.Seconds, cornExpParts[0], secondMin, secondMax, nil); err != nil {
 		return nil, err
 	}
 	// Set minutes
-	if err = setBitSet(cornData.Minutes, cornExpParts[1], minuteMin, minuteMax); err != nil {
+	if err = setBitSet(cornData.Minutes, cornExpParts[1], minuteMin, minuteMax, nil); err != nil {
 		return nil, err
 	}
 	// Set hours
-	if err = setBitSet(cornData.Hours, cornExpParts[2], hourMin, hourMax); err != nil {
+	if err = setBitSet(cornData.Hours, cornExpParts[2], hourMin, hourMax, nil); err != nil {
 		return nil, err
 	}
 	// Set days
-	if err = setBitSet(cornData.Days, cornExpParts[3], dayMin, dayMax); err != nil {
+	if err = setBitSet(cornData.Days, cornExpParts[3], dayMin, dayMax, nil); err != nil {
 		return nil, err
 	}
 	// Set months
-	if err = setBitSet(cornData.Months, cornExpParts[4], monthMin, monthMax); err != nil {
+	if err = setBitSet(cornData.Months, cornExpParts[4], monthMin, monthMax, monthNames); err != nil {
 		return nil, err
 	}
-	// Set weekdays
-	if err = setBitSet(cornData.Weekdays, cornExpParts[5], weekdayMin, weekdayMax); err != nil {
+	// Set weekdays, 7 is Sunday as well as 0.
+	if err = setBitSet(cornData.Weekdays, cornExpParts[5], weekdayMin, weekdayMax+1, weekdayNames); err != nil {
 		return nil, err
 	}
+	if cornData.Weekdays.Get(weekdayMax + 1) {
+		cornData.Weekdays.Clear(weekdayMax + 1)
+		cornData.Weekdays.Set(weekdayMin)
+	}
 	// Set years
-	if err = setBitSet(cornData.Years, cornExpParts[6], yearMin, yearMax); err != nil {
+	if err = setBitSet(cornData.Years, cornExpParts[6], yearMin, yearMax, nil); err != nil {
 		return nil, err
 	}
 
 	return cornData, nil
 }
 
-// Split specified expression string with space and validate.
+// Split specified expression string with space and validate. Expressions in
+// following formats are accepted and normalized to 7 parts with year:
+//  5 fields: minute hour day month weekday
+//  6 fields: second minute hour day month weekday
+//  8 fields: second minute hour day month weekday year ?
+// The '?' in day or weekday field is treated as '*'. Each field is a comma separated list of
+// values, ranges and steps like '1-5,10,30-40/5'. Month and weekday fields accept names like 'JAN'
+// and 'MON', and 7 is Sunday in weekday field.
 func splitCornExpression(expression string) ([]string, error) {
 
-	if expression == "" {
-		return nil, InvalidCornExpressionError
-	}
 	// Split parts
-	cornExpParts := strings.Split(expression, " ")
-	// Validate parts
-	if len(cornExpParts) != 8 || !strings.Contains(cornExpParts[7], "?") {
+	cornExpParts := strings.Fields(expression)
+	// Validate and normalize parts
+	switch len(cornExpParts) {
+	case 5:
+		cornExpParts = append(append([]string{"0"}, cornExpParts...), "*")
+	case 6:
+		cornExpParts = append(cornExpParts, "*")
+	case 8:
+		if !strings.Contains(cornExpParts[7], "?") {
+			return nil, InvalidCornExpressionError
+		}
+		cornExpParts = cornExpParts[:7]
+	default:
 		return nil, InvalidCornExpressionError
 	}
-	// Remove spaces
-	for i := range cornExpParts {
-		cornExpParts[i] = strings.Replace(cornExpParts[i], " ", "", -1)
+	for _, i := range []int{3, 5} {
+		if cornExpParts[i] == "?" {
+			cornExpParts[i] = "*"
+		}
 	}
 	return cornExpParts, nil
 }
 
-func setBitSet(target util.BitSet, exp string, min int, max int) error {
+// setBitSet set bits of values in specified field expression. Field without range accepts any value
+// if min is negative. Names are replaced with their index before parsing if specified.
+func setBitSet(target util.BitSet, exp string, min int, max int, names []string) error {
 
 	if target == nil {
 		return nil
 	}
+	target.Reset()
 
 	// Match "all" rule
-	if success, err := trySetBitSetAll(target, exp); err != nil || success {
-		return err
+	if regexpAll != nil && regexpAll.MatchString(exp) {
+		return nil
 	}
 
-	// Match "range" rule
-	if success, err := trySetBitSetRange(target, exp, min, max); err != nil || success {
+	exp, err := replaceNames(exp, names)
+	if err != nil {
 		return err
 	}
 
-	// Match "disperse"
-	if success, err := trySetBitSetDisperse(target, exp, min, max); err != nil || success {
-		return err
+	// Match "value", "range" and "step" rule for each part of list. Values out of range are not
+	// allowed unless the field has no range.
+	rules := []func(target util.BitSet, exp string, min int, max int) (bool, error){
+		trySetBitSetValue,
+		trySetBitSetRange,
+		trySetBitSetStep,
+	}
+	for _, part := range strings.Split(exp, ",") {
+		matched := false
+		for _, rule := range rules {
+			success, err := rule(target, part, min, max)
+			if err != nil {
+				return err
+			}
+			if success {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return InvalidCornExpressionError
+		}
 	}
 
-	// Match "step" rule
-	if success, err := trySetBitSetStep(target, exp, min, max); err != nil || success {
-		return err
+	return nil
+}
+
+// replaceNames replace names in expression with their index in names, case insensitive.
+func replaceNames(exp string, names []string) (string, error) {
+	if regexpName == nil || !regexpName.MatchString(exp) {
+		return exp, nil
 	}
+	var err error
+	exp = regexpName.ReplaceAllStringFunc(exp, func(name string) string {
+		for i, candidate := range names {
+			if candidate != "" && strings.EqualFold(candidate, name) {
+				return strconv.Itoa(i)
+			}
+		}
+		err = InvalidCornExpressionError
+		return name
+	})
+	return exp, err
+}
 
-	return InvalidCornExpressionError
+// parseBound parse value of field and check whether it is in range.
+func parseBound(exp string, min int, max int) (int, error) {
+	value, err := strconv.Atoi(exp)
+	if err != nil {
+		return 0, InvalidCornExpressionError
+	}
+	if min >= 0 && (value < min || value > max) {
+		return 0, InvalidCornExpressionError
+	}
+	return value, nil
 }
 
-func trySetBitSetAll(target util.BitSet, exp string) (bool, error) {
+// parseRange parse range like 'NUM-NUM', or '*' for whole range of field.
+func parseRange(exp string, min int, max int) (int, int, error) {
 	if regexpAll != nil && regexpAll.MatchString(exp) {
-		target.Reset()
+		if min < 0 {
+			return 0, 0, InvalidCornExpressionError
+		}
+		return min, max, nil
+	}
+	rangeParts := strings.Split(exp, "-")
+	if len(rangeParts) != 2 {
+		return 0, 0, InvalidCornExpressionError
+	}
+	start, err := parseBound(rangeParts[0], min, max)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseBound(rangeParts[1], min, max)
+	if err != nil {
+		return 0, 0, err
+	}
+	if start > end {
+		return 0, 0, InvalidCornExpressionError
+	}
+	return start, end, nil
+}
+
+func trySetBitSetValue(target util.BitSet, exp string, min int, max int) (bool, error) {
+	if regexpValue != nil && regexpValue.MatchString(exp) {
+		value, err := parseBound(exp, min, max)
+		if err != nil {
+			return false, err
+		}
+		target.Set(value)
 		return true, nil
 	}
 	return false, nil
@@ -291,19 +579,9 @@ func trySetBitSetAll(target util.BitSet, exp string) (bool, error) {
 
 func trySetBitSetRange(target util.BitSet, exp string, min int, max int) (bool, error) {
 	if regexpRange != nil && regexpRange.MatchString(exp) {
-		target.Reset()
-		rangeParts := strings.Split(exp, "-")
-		start, err := strconv.Atoi(rangeParts[0])
+		start, end, err := parseRange(exp, min, max)
 		if err != nil {
 			return false, err
-		} else {
-			start = int(math.Max(float64(start), float64(min)))
-		}
-		end, err := strconv.Atoi(rangeParts[1])
-		if err != nil {
-			return false, err
-		} else {
-			end = int(math.Min(float64(end), float64(max)))
 		}
 		for i := start; i <= end; i++ {
 			target.Set(i)
@@ -313,57 +591,20 @@ func trySetBitSetRange(target util.BitSet, exp string, min int, max int) (bool,
 	return false, nil
 }
 
-func trySetBitSetDisperse(target util.BitSet, exp string, min int, max int) (bool, error) {
-	if regexpDisperse != nil && regexpDisperse.MatchString(exp) {
-		target.Reset()
-		disperseParts := strings.Split(exp, ",")
-		for _, part := range disperseParts {
-			value, err := strconv.Atoi(part)
-			if err == nil {
-				if value >= min && value <= max {
-					target.Set(value)
-				}
-			}
-		}
-		return true, nil
-	}
-	return false, nil
-}
-
 func trySetBitSetStep(target util.BitSet, exp string, min int, max int) (bool, error) {
 	if regexpStep != nil && regexpStep.MatchString(exp) {
 		perParts := strings.Split(exp, "/")
-		leftPart := perParts[0]
-		rightPart := perParts[1]
-
-		var start, end int
-
-		if regexpAll != nil && regexpAll.MatchString(leftPart) {
-			start = min
-			end = max
+		if len(perParts) != 2 {
+			return false, InvalidCornExpressionError
 		}
-
-		if regexpRange != nil && regexpRange.MatchString(leftPart) {
-			rangeParts := strings.Split(leftPart, "-")
-			startTmp, err := strconv.Atoi(rangeParts[0])
-			if err != nil {
-				return false, err
-			} else {
-				start = int(math.Max(float64(startTmp), float64(min)))
-			}
-			endTmp, err := strconv.Atoi(rangeParts[1])
-			if err != nil {
-				return false, err
-			} else {
-				end = int(math.Min(float64(endTmp), float64(max)))
-			}
-		}
-
-		step, err := strconv.Atoi(rightPart)
+		start, end, err := parseRange(perParts[0], min, max)
 		if err != nil {
 			return false, err
 		}
-
+		step, err := strconv.Atoi(perParts[1])
+		if err != nil || step <= 0 {
+			return false, InvalidCornExpressionError
+		}
 		for i := start; i <= end; i += step {
 			target.Set(i)
 		}
@@ -372,6 +613,39 @@ func trySetBitSetStep(target util.BitSet, exp string, min int, max int) (bool, e
 	return false, nil
 }
 
+// describeBitSet returns description of specified field. Consecutive values are described as range.
+func describeBitSet(field string, source util.BitSet, min int, max int, names []string) string {
+	if source.IsEmpty() {
+		return "every " + field
+	}
+	name := func(value int) string {
+		if names != nil {
+			return names[value]
+		}
+		return strconv.Itoa(value)
+	}
+	var parts []string
+	for start := min; start <= max; start++ {
+		if !source.Get(start) {
+			continue
+		}
+		end := start
+		for end+1 <= max && source.Get(end+1) {
+			end++
+		}
+		switch {
+		case end-start >= 2:
+			parts = append(parts, name(start)+"-"+name(end))
+		case end > start:
+			parts = append(parts, name(start), name(end))
+		default:
+			parts = append(parts, name(start))
+		}
+		start = end
+	}
+	return field + " " + strings.Join(parts, ",")
+}
+
 // Check match between the specified set and offset.
 func matchBitSet(source util.BitSet, value int) bool {
 	return source != nil && (source.Get(value) || source.IsEmpty())
@@ -0,0 +1,233 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package task
+
+import (
+	"errors"
+	"github.com/mervinkid/matcha/logging"
+	"github.com/mervinkid/matcha/misc"
+	"github.com/mervinkid/matcha/parallel"
+	"sync"
+	"time"
+)
+
+var (
+	ExecutorShutdownError = errors.New("scheduled executor is shutdown")
+)
+
+// ScheduledFuture is the handle of a task submitted to ScheduledExecutor.
+// Methods:
+//  Cancel stop further executions of the task. A running execution will not be interrupted.
+//  IsCancelled returns true if the task has been cancelled before done.
+//  IsDone returns true if execution of delayed task has been triggered, which will not be cancelled.
+type ScheduledFuture interface {
+	Cancel()
+	IsCancelled() bool
+	IsDone() bool
+}
+
+// ScheduledExecutor is the interface defined a executor which runs delayed and periodic tasks
+// with a bounded worker pool.
+// Methods:
+//  Schedule execute task once after delay.
+//  ScheduleAtFixedRate execute task periodically with fixed rate.
+//  ScheduleCorn execute task periodically with corn expression.
+//  Shutdown cancel all tasks and wait for running tasks to finish.
+//
+// Model:
+//  +---------------------+     +-------------+
+//  | Schedule            |     |  worker 1   |
+//  | ScheduleAtFixedRate | → → |    ...      |
+//  | ScheduleCorn        |     |  worker N   |
+//  +---------------------+     +-------------+
+//         triggers               worker pool
+type ScheduledExecutor interface {
+	Schedule(task func(), delay time.Duration) (ScheduledFuture, error)
+	ScheduleAtFixedRate(task func(), rate time.Duration) (ScheduledFuture, error)
+	ScheduleCorn(corn string, task func()) (ScheduledFuture, error)
+	Shutdown()
+}
+
+// scheduledFuture is the implementation of ScheduledFuture interface. The trigger is a
+// Scheduler for periodic tasks or a timer for delayed tasks.
+type scheduledFuture struct {
+	executor   *poolScheduledExecutor
+	scheduler  Scheduler
+	timer      *time.Timer
+	cancelled  bool
+	done       bool
+	stateMutex sync.RWMutex
+}
+
+// Cancel stop further executions of the task. Cancel a done future takes no effect.
+func (f *scheduledFuture) Cancel() {
+	f.stateMutex.Lock()
+	if f.cancelled || f.done {
+		f.stateMutex.Unlock()
+		return
+	}
+	f.cancelled = true
+	if f.timer != nil {
+		f.timer.Stop()
+	}
+	scheduler := f.scheduler
+	f.stateMutex.Unlock()
+
+	misc.LifecycleStop(scheduler)
+	f.executor.removeFuture(f)
+}
+
+// IsCancelled returns true if the task has been cancelled.
+func (f *scheduledFuture) IsCancelled() bool {
+	f.stateMutex.RLock()
+	defer f.stateMutex.RUnlock()
+	return f.cancelled
+}
+
+// IsDone returns true if execution of delayed task has been triggered.
+func (f *scheduledFuture) IsDone() bool {
+	f.stateMutex.RLock()
+	defer f.stateMutex.RUnlock()
+	return f.done
+}
+
+// finish mark delayed task done and remove it from executor. Returns false if it has been cancelled.
+func (f *scheduledFuture) finish() bool {
+	f.stateMutex.Lock()
+	if f.cancelled || f.done {
+		f.stateMutex.Unlock()
+		return false
+	}
+	f.done = true
+	f.stateMutex.Unlock()
+
+	f.executor.removeFuture(f)
+	return true
+}
+
+// poolScheduledExecutor is the default implementation of ScheduledExecutor interface which
+// submit task executions to a parallel.WorkerPool.
+type poolScheduledExecutor struct {
+	pool       parallel.WorkerPool
+	futures    map[*scheduledFuture]bool
+	shutdown   bool
+	stateMutex sync.Mutex
+}
+
+// Schedule execute task once after delay.
+func (e *poolScheduledExecutor) Schedule(task func(), delay time.Duration) (ScheduledFuture, error) {
+	if task == nil {
+		return nil, NoTaskError
+	}
+	future := &scheduledFuture{executor: e}
+	if err := e.addFuture(future); err != nil {
+		return nil, err
+	}
+	future.stateMutex.Lock()
+	future.timer = time.AfterFunc(delay, func() {
+		if future.finish() {
+			e.submit(task)
+		}
+	})
+	future.stateMutex.Unlock()
+	return future, nil
+}
+
+// ScheduleAtFixedRate execute task periodically with fixed rate.
+func (e *poolScheduledExecutor) ScheduleAtFixedRate(task func(), rate time.Duration) (ScheduledFuture, error) {
+	if task == nil {
+		return nil, NoTaskError
+	}
+	return e.schedule(NewFixedRateSchedulerWithConfig(task, rate, SchedulerConfig{Pool: e.pool}))
+}
+
+// ScheduleCorn execute task periodically with corn expression.
+func (e *poolScheduledExecutor) ScheduleCorn(corn string, task func()) (ScheduledFuture, error) {
+	if task == nil {
+		return nil, NoTaskError
+	}
+	return e.schedule(NewCornSchedulerWithConfig(corn, task, SchedulerConfig{Pool: e.pool}))
+}
+
+// Shutdown cancel all tasks and wait for running tasks to finish.
+func (e *poolScheduledExecutor) Shutdown() {
+	e.stateMutex.Lock()
+	if e.shutdown {
+		e.stateMutex.Unlock()
+		return
+	}
+	e.shutdown = true
+	futures := e.futures
+	e.futures = nil
+	e.stateMutex.Unlock()
+
+	for future := range futures {
+		future.Cancel()
+	}
+	e.pool.Shutdown()
+}
+
+// schedule start specified scheduler as trigger of a new future.
+func (e *poolScheduledExecutor) schedule(scheduler Scheduler) (ScheduledFuture, error) {
+	future := &scheduledFuture{executor: e, scheduler: scheduler}
+	if err := e.addFuture(future); err != nil {
+		return nil, err
+	}
+	if err := scheduler.Start(); err != nil {
+		e.removeFuture(future)
+		return nil, err
+	}
+	return future, nil
+}
+
+// submit put task execution into worker pool.
+func (e *poolScheduledExecutor) submit(task func()) {
+	if err := e.pool.Submit(task); err != nil {
+		logging.Warn("ScheduledExecutor reject task execution cause %s.", err.Error())
+	}
+}
+
+func (e *poolScheduledExecutor) addFuture(future *scheduledFuture) error {
+	e.stateMutex.Lock()
+	defer e.stateMutex.Unlock()
+	if e.shutdown {
+		return ExecutorShutdownError
+	}
+	e.futures[future] = true
+	return nil
+}
+
+func (e *poolScheduledExecutor) removeFuture(future *scheduledFuture) {
+	e.stateMutex.Lock()
+	defer e.stateMutex.Unlock()
+	delete(e.futures, future)
+}
+
+// NewScheduledExecutor create a new ScheduledExecutor instance which owns a worker pool with
+// specified number of workers and queue capacity.
+func NewScheduledExecutor(poolSize, queueCap int) ScheduledExecutor {
+	return &poolScheduledExecutor{
+		pool:    parallel.NewWorkerPool(poolSize, queueCap),
+		futures: make(map[*scheduledFuture]bool),
+	}
+}
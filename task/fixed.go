@@ -54,16 +54,28 @@ const (
 //  +-----+           +---------+          +--------+
 //  | NEW | → Start → | RUNNING | → Stop → | FINISH |
 //  +-----+           +---------+          +--------+
+//                     ↓       ↑               ↑
+//                   Pause   Resume            |
+//                     ↓       ↑               |
+//                    +---------+              |
+//                    | PAUSED  | → → Stop → → ┘
+//                    +---------+
 type fixedTimeScheduler struct {
 	// Props
-	FixedTime time.Duration
-	Policy    fixedTimePolicy
-	Task      func()
+	FixedTime   time.Duration
+	Policy      fixedTimePolicy
+	Task        func()
+	ContextTask ContextTask
+	Config      SchedulerConfig
 	// State
 	state      state
 	stateMutex sync.RWMutex
 	scheduler  parallel.Goroutine
 	stopC      stopChan
+	nextRun    time.Time
+	runner     *taskRunner
+	// Reschedule signal
+	rescheduleC chan uint8
 }
 
 // Start will start scheduler for task scheduling execution.
@@ -73,24 +85,66 @@ func (s *fixedTimeScheduler) Start() error {
 	if s.state != stateNew {
 		return nil
 	}
-	if s.Task == nil {
+	task := resolveTask(s.Task, s.ContextTask)
+	if task == nil {
 		return NoTaskError
 	}
 
 	s.stopC = initStopChan()
+	s.rescheduleC = make(chan uint8, 1)
+	if s.runner == nil {
+		s.runner = newTaskRunner(task, s.Config)
+	}
+	s.nextRun = time.Now().Add(s.FixedTime)
 
-	s.scheduler = parallel.NewGoroutine(func() {
-		timer := time.NewTimer(s.FixedTime)
+	s.scheduler = parallel.NewNamedGoroutine("FixedTimeScheduler-"+s.FixedTime.String(), func() {
+		fixedTime := s.getFixedTime()
+		// Apply fire times missed since last fire recorded in store.
+		if lastFire := s.runner.loadLastFire(); !lastFire.IsZero() && fixedTime > 0 {
+			if missed := int(time.Since(lastFire) / fixedTime); missed > 0 {
+				logging.Warn("FixedTimeScheduler %s misfire %d times since %v.", s.Config.Name, missed, lastFire.String())
+				for i := s.runner.executions(missed, false); i > 0; i-- {
+					s.execute(time.Now())
+				}
+			}
+		}
+		timer := time.NewTimer(fixedTime)
+		expected := time.Now().Add(fixedTime)
 		for {
 			select {
 			case <-s.stopC:
 				timer.Stop()
 				return
+			case <-s.rescheduleC:
+				// Schedule next execution with new fixed time since now.
+				timer.Stop()
+				fixedTime = s.getFixedTime()
+				expected = time.Now().Add(fixedTime)
+				s.setNextRun(expected)
+				timer = time.NewTimer(fixedTime)
 			case <-timer.C:
-				// Execute task with policy.
-				logging.Debug("Execute task with policy.")
-				s.execute()
-				timer = time.NewTimer(s.FixedTime)
+				// Trigger late for more than one fixed time is treated as misfire.
+				executions := 1
+				if late := time.Now().Sub(expected); late >= fixedTime {
+					missed := int(late/fixedTime) + 1
+					logging.Warn("FixedTimeScheduler misfire %d times.", missed)
+					executions = s.runner.executions(missed, false)
+				}
+				// Execute task with policy. Skip execution while paused.
+				if !s.IsPaused() && executions > 0 {
+					logging.Debug("Execute task with policy.")
+					if s.Policy == fixedDelayPolicy {
+						// Next run is unknown until task finish.
+						s.setNextRun(time.Time{})
+					}
+					for ; executions > 0; executions-- {
+						s.execute(expected)
+					}
+				}
+				fixedTime = s.getFixedTime()
+				expected = time.Now().Add(fixedTime)
+				s.setNextRun(expected)
+				timer = time.NewTimer(fixedTime)
 			}
 		}
 	})
@@ -104,7 +158,7 @@ func (s *fixedTimeScheduler) Start() error {
 func (s *fixedTimeScheduler) Stop() {
 	s.stateMutex.Lock()
 	defer s.stateMutex.Unlock()
-	if s.state == stateRunning {
+	if s.state == stateRunning || s.state == statePaused {
 		close(s.stopC)
 		s.scheduler = nil
 		s.state = stateFinish
@@ -118,19 +172,78 @@ func (s *fixedTimeScheduler) IsRunning() bool {
 	return s.state == stateRunning
 }
 
+// Pause halt task executions temporarily. Triggers during pause will be skipped.
+func (s *fixedTimeScheduler) Pause() {
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+	if s.state == stateRunning {
+		s.state = statePaused
+	}
+}
+
+// Resume continue task executions after pause.
+func (s *fixedTimeScheduler) Resume() {
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+	if s.state == statePaused {
+		s.state = stateRunning
+	}
+}
+
+// IsPaused returns true if scheduler current paused.
+func (s *fixedTimeScheduler) IsPaused() bool {
+	s.stateMutex.RLock()
+	defer s.stateMutex.RUnlock()
+	return s.state == statePaused
+}
+
+// Reschedule change fixed time of scheduler. Next execution will be scheduled with new fixed
+// time since now if scheduler is running.
+func (s *fixedTimeScheduler) Reschedule(fixedTime time.Duration) error {
+	if fixedTime <= 0 {
+		return InvalidFixedTimeError
+	}
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+	s.FixedTime = fixedTime
+	if s.state == stateRunning || s.state == statePaused {
+		select {
+		case s.rescheduleC <- 1:
+		default:
+		}
+	}
+	return nil
+}
+
+func (s *fixedTimeScheduler) getFixedTime() time.Duration {
+	s.stateMutex.RLock()
+	defer s.stateMutex.RUnlock()
+	return s.FixedTime
+}
+
+// NextRun returns the time of next execution. Returns zero time while task with fixed
+// delay policy is executing.
+func (s *fixedTimeScheduler) NextRun() time.Time {
+	s.stateMutex.RLock()
+	defer s.stateMutex.RUnlock()
+	if s.state != stateRunning {
+		return time.Time{}
+	}
+	return s.nextRun
+}
+
+func (s *fixedTimeScheduler) setNextRun(nextRun time.Time) {
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+	s.nextRun = nextRun
+}
+
 // executeTaskWithFixedTimePolicy will execute specified task function with policy.
 // If the policy is FixedDelay then execute in current goroutine or start a new
 // goroutine for task execution.
-func (s *fixedTimeScheduler) execute() {
-	if s.Task != nil {
-		executor := parallel.NewGoroutine(s.Task)
-		executor.Start()
-		switch s.Policy {
-		case fixedDelayPolicy:
-			executor.Join()
-			return
-		case fixedRatePolicy:
-			return
-		}
+func (s *fixedTimeScheduler) execute(scheduled time.Time) {
+	doneC := s.runner.fire(scheduled)
+	if doneC != nil && s.Policy == fixedDelayPolicy {
+		<-doneC
 	}
 }
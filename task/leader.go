@@ -0,0 +1,215 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package task
+
+import (
+	"github.com/mervinkid/matcha/logging"
+	"github.com/mervinkid/matcha/misc"
+	"sync"
+	"time"
+)
+
+// Interval of checking leadership
+const (
+	leaderCheckInterval    = 1 * time.Second
+	leaderFallbackInterval = 10 * time.Second
+)
+
+// Leadership is the interface that wraps the method for checking whether or not local node holds
+// master role of election. The registry.Registry satisfies it.
+type Leadership interface {
+	IsMaster() bool
+}
+
+// LeadershipNotifier is the optional interface of Leadership which notifies changes of leadership.
+// NotifyLeadership register notify function invoked after leadership changed and returns function
+// to cancel it. The registry.Registry satisfies it.
+type LeadershipNotifier interface {
+	NotifyLeadership(notify func()) (cancel func())
+}
+
+// leaderScheduler is the implementation of Scheduler interface which only execute the underlying
+// scheduler while local node holds master role. The underlying scheduler is started once local
+// node becomes master, so that executions of misfire on start never happen on slaver.
+//  +----------+  IsMaster  +-------------------+
+//  | notifier | ---------→ | underlying        |
+//  | watcher  |            | Start if master   |
+//  +----------+            | Resume if master  |
+//                          | Pause if slaver   |
+//                          +-------------------+
+type leaderScheduler struct {
+	leadership Leadership
+	scheduler  Scheduler
+	watcher    Scheduler
+	cancel     func()
+	paused     bool
+	started    bool
+	state      state
+	stateMutex sync.RWMutex
+}
+
+// Start will start leadership watcher, and underlying scheduler if local node is master.
+func (s *leaderScheduler) Start() error {
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+
+	if s.state != stateNew {
+		return nil
+	}
+	if err := s.apply(); err != nil {
+		return err
+	}
+
+	// Apply on notification of leadership changes, and check periodically in case of
+	// notifications are dropped.
+	interval := leaderCheckInterval
+	notifier, notifiable := s.leadership.(LeadershipNotifier)
+	if notifiable {
+		interval = leaderFallbackInterval
+	}
+	watcher := NewFixedRateScheduler(s.check, interval)
+	if err := watcher.Start(); err != nil {
+		s.scheduler.Stop()
+		return err
+	}
+	if notifiable {
+		s.cancel = notifier.NotifyLeadership(s.check)
+	}
+	s.watcher = watcher
+	s.state = stateRunning
+
+	return nil
+}
+
+// Stop will stop underlying scheduler and leadership watcher.
+func (s *leaderScheduler) Stop() {
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+	if s.state == stateRunning {
+		if s.cancel != nil {
+			s.cancel()
+			s.cancel = nil
+		}
+		s.watcher.Stop()
+		s.scheduler.Stop()
+		s.state = stateFinish
+	}
+}
+
+// IsRunning returns true is scheduler current running whether or not local node is master.
+func (s *leaderScheduler) IsRunning() bool {
+	s.stateMutex.RLock()
+	defer s.stateMutex.RUnlock()
+	return s.state == stateRunning
+}
+
+// Pause halt task executions temporarily regardless of leadership.
+func (s *leaderScheduler) Pause() {
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+	s.paused = true
+	if s.state == stateRunning {
+		s.applyOrLog()
+	}
+}
+
+// Resume continue task executions while local node is master.
+func (s *leaderScheduler) Resume() {
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+	s.paused = false
+	if s.state == stateRunning {
+		s.applyOrLog()
+	}
+}
+
+// IsPaused returns true if scheduler has been paused by invoker.
+func (s *leaderScheduler) IsPaused() bool {
+	s.stateMutex.RLock()
+	defer s.stateMutex.RUnlock()
+	return s.paused
+}
+
+// NextRun returns the time of next execution. Returns zero time while local node is not master.
+func (s *leaderScheduler) NextRun() time.Time {
+	s.stateMutex.RLock()
+	defer s.stateMutex.RUnlock()
+	if s.state != stateRunning || !s.started || s.scheduler.IsPaused() {
+		return time.Time{}
+	}
+	return s.scheduler.NextRun()
+}
+
+// check apply leadership while scheduler is running.
+func (s *leaderScheduler) check() {
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+	if s.state == stateRunning {
+		s.applyOrLog()
+	}
+}
+
+// apply start, pause or resume underlying scheduler with leadership. Must be invoked with state
+// lock held.
+func (s *leaderScheduler) apply() error {
+	active := !s.paused && s.leadership.IsMaster()
+	if !s.started {
+		if !active {
+			return nil
+		}
+		if err := misc.LifecycleStart(s.scheduler); err != nil {
+			return err
+		}
+		s.started = true
+		return nil
+	}
+	if active && s.scheduler.IsPaused() {
+		s.scheduler.Resume()
+	}
+	if !active && !s.scheduler.IsPaused() {
+		s.scheduler.Pause()
+	}
+	return nil
+}
+
+// applyOrLog apply leadership and log failure of starting underlying scheduler, which is retried
+// on next check. Must be invoked with state lock held.
+func (s *leaderScheduler) applyOrLog() {
+	if err := s.apply(); err != nil {
+		logging.Error("Start scheduler of leader fail cause %s.", err.Error())
+	}
+}
+
+// NewLeaderScheduler create a new scheduler instance which only execute specified scheduler
+// while local node holds master role of leadership, and pause it while master is lost. Specified
+// scheduler is not started until local node becomes master.
+// Notes:
+// Leadership implements LeadershipNotifier is applied once changed and checked every 10 seconds
+// as fallback. Otherwise leadership is checked every second, executions may happen within one
+// second after master lost.
+func NewLeaderScheduler(leadership Leadership, scheduler Scheduler) Scheduler {
+	return &leaderScheduler{
+		leadership: leadership,
+		scheduler:  scheduler,
+	}
+}
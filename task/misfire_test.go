@@ -0,0 +1,136 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package task
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMisfireExecutions(t *testing.T) {
+	cases := []struct {
+		policy MisfirePolicy
+		missed int
+		onTime bool
+		expect int
+	}{
+		{MisfireFireOnce, 0, true, 1},
+		{MisfireFireOnce, 0, false, 0},
+		{MisfireFireOnce, 3, false, 1},
+		{MisfireFireOnce, 3, true, 1},
+		{MisfireSkip, 0, true, 1},
+		{MisfireSkip, 3, false, 0},
+		{MisfireSkip, 3, true, 1},
+		{MisfireFireAll, 0, true, 1},
+		{MisfireFireAll, 3, false, 3},
+		{MisfireFireAll, 3, true, 4},
+	}
+	for _, c := range cases {
+		runner := &taskRunner{config: SchedulerConfig{Misfire: c.policy}}
+		if executions := runner.executions(c.missed, c.onTime); executions != c.expect {
+			t.Errorf("policy %d with %d missed (on time %v) expect %d executions but %d",
+				c.policy, c.missed, c.onTime, c.expect, executions)
+		}
+	}
+}
+
+func TestMisfireBlockedScheduler(t *testing.T) {
+	data, err := parseCornExp("*/10 * * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Scheduler checked at 12:00:00 and blocked until 12:00:35, fire times at
+	// 12:00:10, 12:00:20 and 12:00:30 are missed.
+	latestCheck := time.Date(2018, 1, 1, 12, 0, 0, 0, time.Local)
+	now := latestCheck.Add(35 * time.Second)
+	missed := data.count(latestCheck, now)
+	if missed != 3 {
+		t.Fatalf("expect 3 missed fire times but %d", missed)
+	}
+	onTime := data.next(now.Add(-time.Second)).Equal(now)
+	if onTime {
+		t.Fatalf("unexpected fire time %v", now)
+	}
+
+	expects := map[MisfirePolicy]int{
+		MisfireFireOnce: 1,
+		MisfireSkip:     0,
+		MisfireFireAll:  3,
+	}
+	for policy, expect := range expects {
+		runner := &taskRunner{config: SchedulerConfig{Misfire: policy}}
+		if executions := runner.executions(missed, onTime); executions != expect {
+			t.Errorf("policy %d expect %d executions but %d", policy, expect, executions)
+		}
+	}
+
+	// Scheduler recovers at next fire time 12:00:40 which is on time.
+	next := data.next(now)
+	if !next.Equal(latestCheck.Add(40*time.Second)) {
+		t.Fatalf("unexpected next fire time %v", next)
+	}
+	if missed := data.count(now, next); missed != 0 {
+		t.Fatalf("expect no missed fire time but %d", missed)
+	}
+	for policy := range expects {
+		runner := &taskRunner{config: SchedulerConfig{Misfire: policy}}
+		if executions := runner.executions(0, true); executions != 1 {
+			t.Errorf("policy %d expect 1 execution but %d", policy, executions)
+		}
+	}
+}
+
+func TestRunnerSaveLastFire(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "matcha-task")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := NewFileStateStore(filepath.Join(dir, "state.json"))
+
+	releaseC := make(chan uint8)
+	runner := newTaskRunner(func(ctx context.Context) error {
+		<-releaseC
+		return nil
+	}, SchedulerConfig{Name: "report", Store: store, Overlap: OverlapSkipIfRunning})
+
+	// Fire time is recorded after execution started, and skipped one is not recorded.
+	started := time.Date(2018, 1, 1, 12, 0, 0, 0, time.Local)
+	doneC := runner.fire(started)
+	if doneC == nil {
+		t.Fatal("expect execution started")
+	}
+	if runner.fire(started.Add(time.Minute)) != nil {
+		t.Fatal("expect execution skipped while previous one is running")
+	}
+	close(releaseC)
+	<-doneC
+	if lastFire, err := store.LoadLastFire("report"); err != nil || !lastFire.Equal(started) {
+		t.Fatal("expect last fire of started execution but got", lastFire, err)
+	}
+}
@@ -0,0 +1,293 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package task
+
+import (
+	"context"
+	"fmt"
+	"github.com/mervinkid/matcha/logging"
+	"github.com/mervinkid/matcha/parallel"
+	"sync"
+	"time"
+)
+
+// taskRunner execute task for scheduler with policies defined in SchedulerConfig.
+type taskRunner struct {
+	task    ContextTask
+	config  SchedulerConfig
+	running int
+	queued  bool
+	// Scheduled time of queued execution
+	queuedTime time.Time
+	// Start times of executions in rolling window
+	windowStarts []time.Time
+	mutex        sync.Mutex
+}
+
+// fire execute task scheduled at specified time in a new goroutine or worker pool with overlap
+// policy. Returns a channel which will be closed after execution finish, or nil if the execution
+// is skipped, queued since previous execution is still running or rejected by worker pool.
+// Fire time is recorded into store only after the execution is started or queued.
+func (r *taskRunner) fire(scheduled time.Time) chan uint8 {
+
+	for _, calendar := range r.config.Exclusions {
+		if calendar.IsExcluded(scheduled) {
+			logging.Debug("Skip task execution at %v excluded by calendar.", scheduled.String())
+			return nil
+		}
+	}
+
+	r.mutex.Lock()
+	if r.running > 0 {
+		switch r.config.Overlap {
+		case OverlapSkipIfRunning:
+			r.mutex.Unlock()
+			logging.Debug("Skip task execution since previous execution is still running.")
+			return nil
+		case OverlapQueueOne:
+			queued := !r.queued
+			if queued {
+				r.queued = true
+				r.queuedTime = scheduled
+			}
+			r.mutex.Unlock()
+			if queued {
+				r.saveLastFire(scheduled)
+			}
+			logging.Debug("Queue task execution since previous execution is still running.")
+			return nil
+		}
+	}
+	if !r.acquireWindow(time.Now()) {
+		r.mutex.Unlock()
+		logging.Debug("Skip task execution since %d executions in %s reached.",
+			r.config.MaxExecutions, r.config.ExecutionWindow.String())
+		return nil
+	}
+	r.running++
+	r.mutex.Unlock()
+
+	doneC := make(chan uint8)
+	execution := func() {
+		defer close(doneC)
+		next := scheduled
+		for {
+			r.execute(next)
+			r.mutex.Lock()
+			if r.queued {
+				// Execute queued execution in current goroutine.
+				r.queued = false
+				next = r.queuedTime
+				r.mutex.Unlock()
+				continue
+			}
+			r.running--
+			r.mutex.Unlock()
+			return
+		}
+	}
+
+	if r.config.Pool == nil {
+		parallel.NewGoroutine(execution).Start()
+		r.saveLastFire(scheduled)
+		return doneC
+	}
+	if err := r.config.Pool.Submit(execution); err != nil {
+		logging.Warn("Worker pool reject task execution cause %s.", err.Error())
+		r.mutex.Lock()
+		r.running--
+		r.mutex.Unlock()
+		return nil
+	}
+	r.saveLastFire(scheduled)
+	return doneC
+}
+
+// acquireWindow returns true and record the execution if number of executions in rolling window
+// does not reach the limit. Must be invoked with lock held.
+func (r *taskRunner) acquireWindow(now time.Time) bool {
+	if r.config.MaxExecutions <= 0 {
+		return true
+	}
+	// Drop executions out of window.
+	expired := 0
+	for expired < len(r.windowStarts) && now.Sub(r.windowStarts[expired]) >= r.config.ExecutionWindow {
+		expired++
+	}
+	r.windowStarts = r.windowStarts[expired:]
+	if len(r.windowStarts) >= r.config.MaxExecutions {
+		return false
+	}
+	r.windowStarts = append(r.windowStarts, now)
+	return true
+}
+
+// executions returns the number of executions for specified number of missed fire times with
+// misfire policy. The onTime should be true if current fire time is on time.
+func (r *taskRunner) executions(missed int, onTime bool) int {
+	executions := 0
+	if onTime {
+		executions = 1
+	}
+	if missed <= 0 {
+		return executions
+	}
+	switch r.config.Misfire {
+	case MisfireFireOnce:
+		return 1
+	case MisfireFireAll:
+		return executions + missed
+	default:
+		return executions
+	}
+}
+
+// loadLastFire returns the last fire time recorded in store. Returns zero time if store is not
+// configured or there is no record.
+func (r *taskRunner) loadLastFire() time.Time {
+	if r.config.Store == nil || r.config.Name == "" {
+		return time.Time{}
+	}
+	lastFire, err := r.config.Store.LoadLastFire(r.config.Name)
+	if err != nil {
+		logging.Warn("Load last fire time of %s fail cause %s.", r.config.Name, err.Error())
+		return time.Time{}
+	}
+	return lastFire
+}
+
+// saveLastFire record specified fire time into store if it is configured.
+func (r *taskRunner) saveLastFire(scheduled time.Time) {
+	if r.config.Store == nil || r.config.Name == "" {
+		return
+	}
+	if err := r.config.Store.SaveLastFire(r.config.Name, scheduled); err != nil {
+		logging.Warn("Save last fire time of %s fail cause %s.", r.config.Name, err.Error())
+	}
+}
+
+// execute run task once with context and notify listeners. The context will be cancelled and
+// TaskTimeoutError will be reported once timeout expires.
+func (r *taskRunner) execute(scheduled time.Time) {
+
+	execution := JobExecution{
+		Name:      r.config.Name,
+		Scheduled: scheduled,
+		Start:     time.Now(),
+	}
+	for _, listener := range r.config.Listeners {
+		if listener.Before != nil {
+			listener.Before(execution)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var timer *time.Timer
+	if r.config.Timeout > 0 {
+		timeoutExecution := execution
+		timer = time.AfterFunc(r.config.Timeout, func() {
+			cancel()
+			timeoutExecution.Duration = time.Since(timeoutExecution.Start)
+			timeoutExecution.Err = TaskTimeoutError
+			r.report(timeoutExecution)
+		})
+	}
+
+	var err error
+	if r.config.Retry != nil {
+		attempt := 0
+		err = parallel.Retry(ctx, *r.config.Retry, func() error {
+			attempt++
+			attemptErr := r.run(ctx)
+			if attemptErr != nil {
+				logging.Debug("Scheduled task %s attempt %d failed cause %s.", r.config.Name, attempt, attemptErr.Error())
+			}
+			return attemptErr
+		})
+	} else {
+		err = r.run(ctx)
+	}
+	execution.Duration = time.Since(execution.Start)
+	execution.Err = err
+	if timer != nil && !timer.Stop() {
+		// Timeout has been reported.
+		execution.Err = TaskTimeoutError
+	} else if err != nil {
+		r.report(execution)
+	}
+
+	for _, listener := range r.config.Listeners {
+		if listener.After != nil {
+			listener.After(execution)
+		}
+	}
+}
+
+// run execute task and convert panic from it to error.
+func (r *taskRunner) run(ctx context.Context) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("task panic cause %v", p)
+		}
+	}()
+	return r.task(ctx)
+}
+
+// report invoke error hook and listeners with failed execution. The error will be logged if
+// error hook is not set.
+func (r *taskRunner) report(execution JobExecution) {
+	if r.config.OnError != nil {
+		r.config.OnError(execution.Err)
+	} else {
+		logging.Error("Scheduled task %s failed cause %s.", execution.Name, execution.Err.Error())
+	}
+	for _, listener := range r.config.Listeners {
+		if listener.Error != nil {
+			listener.Error(execution)
+		}
+	}
+}
+
+// resolveTask returns contextTask if it is not nil, or a ContextTask which wraps task.
+// Returns nil if both are nil.
+func resolveTask(task func(), contextTask ContextTask) ContextTask {
+	if contextTask != nil {
+		return contextTask
+	}
+	if task != nil {
+		return func(ctx context.Context) error {
+			task()
+			return nil
+		}
+	}
+	return nil
+}
+
+func newTaskRunner(task ContextTask, config SchedulerConfig) *taskRunner {
+	return &taskRunner{
+		task:   task,
+		config: config,
+	}
+}
@@ -23,8 +23,10 @@
 package task
 
 import (
+	"context"
 	"errors"
 	"github.com/mervinkid/matcha/misc"
+	"github.com/mervinkid/matcha/parallel"
 	"time"
 )
 
@@ -33,22 +35,144 @@ type state uint8
 const (
 	stateNew     state = iota
 	stateRunning
+	statePaused
 	stateFinish
 )
 
 type stopChan chan uint8
 
 var (
-	NoTaskError = errors.New("no task to be scheduled execute")
+	NoTaskError           = errors.New("no task to be scheduled execute")
+	TaskTimeoutError      = errors.New("task execution timeout")
+	InvalidFixedTimeError = errors.New("fixed time must be positive")
 )
 
+// ContextTask is the task which accept a context cancelled on timeout and returns error
+// reported to error hook.
+type ContextTask func(ctx context.Context) error
+
+// OverlapPolicy defines the behavior while previous execution of task is still running.
+type OverlapPolicy uint8
+
+const (
+	// OverlapAllowConcurrent start a new execution concurrently.
+	OverlapAllowConcurrent OverlapPolicy = iota
+	// OverlapSkipIfRunning skip the execution.
+	OverlapSkipIfRunning
+	// OverlapQueueOne queue the execution until previous one finish. At most one execution
+	// will be queued, further executions are skipped while one is queued.
+	OverlapQueueOne
+)
+
+// MisfirePolicy defines the behavior while scheduled fire times have been missed since
+// process was blocked or suspended past them.
+type MisfirePolicy uint8
+
+const (
+	// MisfireFireOnce fire once immediately for all missed fire times.
+	MisfireFireOnce MisfirePolicy = iota
+	// MisfireSkip skip missed fire times and wait for next one.
+	MisfireSkip
+	// MisfireFireAll fire immediately once for each missed fire time.
+	MisfireFireAll
+)
+
+// JobExecution provide properties of a task execution for listeners.
+type JobExecution struct {
+	// Name is the name of job defined in SchedulerConfig.
+	Name string
+	// Scheduled is the time execution scheduled at.
+	Scheduled time.Time
+	// Start is the actual start time of execution.
+	Start time.Time
+	// Duration is the time execution took. It is zero before execution.
+	Duration time.Duration
+	// Err is the error of execution. It is nil before execution or on success.
+	Err error
+}
+
+// JobListener provide hooks of task execution. Hooks which are nil will be ignored.
+// Hooks:
+//  Before will be invoked before each execution.
+//  After will be invoked after each execution whether or not it failed.
+//  Error will be invoked while execution failed or timeout.
+type JobListener struct {
+	Before func(execution JobExecution)
+	After  func(execution JobExecution)
+	Error  func(execution JobExecution)
+}
+
+// SchedulerConfig provide properties for scheduler creation.
+type SchedulerConfig struct {
+	// Name is the name of job for listeners and logs.
+	Name string
+	// Overlap is the policy applied while previous execution is still running.
+	// It does not take effect on fixed delay scheduler.
+	Overlap OverlapPolicy
+	// Misfire is the policy applied while fire times have been missed.
+	// A fixed time scheduler misfires if trigger is late for more than one fixed time.
+	Misfire MisfirePolicy
+	// Timeout cancel the context of execution and report TaskTimeoutError after specified
+	// duration. Zero means no timeout.
+	Timeout time.Duration
+	// OnError will be invoked with error returned by task, TaskTimeoutError on timeout or
+	// error converted from panic. The error will be logged with error level if it is nil.
+	OnError func(err error)
+	// Listeners will be notified with each execution.
+	Listeners []JobListener
+	// Retry is the policy for retrying failed execution within the same scheduling. The Timeout
+	// covers all attempts of execution. No retry if it is nil.
+	Retry *parallel.RetryPolicy
+	// Exclusions are calendars which fire times excluded by will be skipped.
+	// NextRun does not take exclusions into account.
+	Exclusions []Calendar
+	// Pool is the worker pool executions will be submitted to, which can be shared by schedulers
+	// to bound the number of goroutines. Each execution runs in a new goroutine if it is nil.
+	// Executions rejected by pool will be skipped.
+	Pool parallel.WorkerPool
+	// Store records last fire time of job with Name once its execution is started or queued. Fire
+	// times missed since last fire will be applied with misfire policy on start. It takes effect
+	// only if Name is not empty.
+	Store StateStore
+	// MaxExecutions is the max number of executions in any rolling ExecutionWindow. Fire times
+	// beyond the limit will be skipped. Zero means unlimited.
+	MaxExecutions int
+	// ExecutionWindow is the duration of rolling window for MaxExecutions.
+	ExecutionWindow time.Duration
+}
+
 // Scheduler is the interface defined a scheduler for task scheduling execution.
 // Methods:
 //  Start will start scheduler for task scheduling execution.
 //  Stop will stop scheduler.
 //  IsRunning returns true is scheduler current running.
+//  Pause halt task executions temporarily without stopping scheduler.
+//  Resume continue task executions after pause.
+//  IsPaused returns true if scheduler current paused.
+//  NextRun returns the time of next execution. Returns zero time if scheduler is not running
+//  or next execution is unknown.
 type Scheduler interface {
 	misc.Lifecycle
+	Pause()
+	Resume()
+	IsPaused() bool
+	NextRun() time.Time
+}
+
+// FixedTimeScheduler is the interface of scheduler execute task with fixed delay or fixed rate.
+// Methods:
+//  Reschedule change fixed time of scheduler at runtime.
+type FixedTimeScheduler interface {
+	Scheduler
+	Reschedule(fixedTime time.Duration) error
+}
+
+// CornScheduler is the interface of scheduler execute task with corn expression.
+// Methods:
+//  RescheduleCorn change corn expression of scheduler at runtime.
+type CornScheduler interface {
+	Scheduler
+	RescheduleCorn(corn string) error
 }
 
 // NewFixedDelayScheduler create a new scheduler instance which execute task with fixed delay time.
@@ -62,11 +186,34 @@ type Scheduler interface {
 //  +-----+           +---------+          +--------+
 //  | NEW | → Start → | RUNNING | → Stop → | FINISH |
 //  +-----+           +---------+          +--------+
-func NewFixedDelayScheduler(task func(), delay time.Duration) Scheduler {
+//                     ↓       ↑               ↑
+//                   Pause   Resume            |
+//                     ↓       ↑               |
+//                    +---------+              |
+//                    | PAUSED  | → → Stop → → ┘
+//                    +---------+
+func NewFixedDelayScheduler(task func(), delay time.Duration) FixedTimeScheduler {
+	return NewFixedDelaySchedulerWithConfig(task, delay, SchedulerConfig{})
+}
+
+// NewFixedDelaySchedulerWithConfig create a new fixed delay scheduler instance with specified config.
+func NewFixedDelaySchedulerWithConfig(task func(), delay time.Duration, config SchedulerConfig) FixedTimeScheduler {
 	return &fixedTimeScheduler{
 		Task:      task,
 		FixedTime: delay,
 		Policy:    fixedDelayPolicy,
+		Config:    config,
+	}
+}
+
+// NewFixedDelayContextScheduler create a new fixed delay scheduler instance which execute
+// task with context.
+func NewFixedDelayContextScheduler(task ContextTask, delay time.Duration, config SchedulerConfig) FixedTimeScheduler {
+	return &fixedTimeScheduler{
+		ContextTask: task,
+		FixedTime:   delay,
+		Policy:      fixedDelayPolicy,
+		Config:      config,
 	}
 }
 
@@ -81,19 +228,62 @@ func NewFixedDelayScheduler(task func(), delay time.Duration) Scheduler {
 //  +-----+           +---------+          +--------+
 //  | NEW | → Start → | RUNNING | → Stop → | FINISH |
 //  +-----+           +---------+          +--------+
-func NewFixedRateScheduler(task func(), rate time.Duration) Scheduler {
+//                     ↓       ↑               ↑
+//                   Pause   Resume            |
+//                     ↓       ↑               |
+//                    +---------+              |
+//                    | PAUSED  | → → Stop → → ┘
+//                    +---------+
+func NewFixedRateScheduler(task func(), rate time.Duration) FixedTimeScheduler {
+	return NewFixedRateSchedulerWithConfig(task, rate, SchedulerConfig{})
+}
+
+// NewFixedRateSchedulerWithConfig create a new fixed rate scheduler instance with specified config.
+func NewFixedRateSchedulerWithConfig(task func(), rate time.Duration, config SchedulerConfig) FixedTimeScheduler {
 	return &fixedTimeScheduler{
 		Task:      task,
 		FixedTime: rate,
 		Policy:    fixedRatePolicy,
+		Config:    config,
+	}
+}
+
+// NewFixedRateContextScheduler create a new fixed rate scheduler instance which execute
+// task with context.
+func NewFixedRateContextScheduler(task ContextTask, rate time.Duration, config SchedulerConfig) FixedTimeScheduler {
+	return &fixedTimeScheduler{
+		ContextTask: task,
+		FixedTime:   rate,
+		Policy:      fixedRatePolicy,
+		Config:      config,
 	}
 }
 
 // NewCornScheduler create a new scheduler instance with corn expression support.
-func NewCornScheduler(corn string, task func()) Scheduler {
+// Standard 5-field (minute resolution) and 6-field (with seconds) crontab expressions
+// are accepted as well as the 8-field expression ending with '?'.
+//  +--------+--------+------+-----+-------+---------+------+---+
+//  | second | minute | hour | day | month | weekday | year | ? |
+//  +--------+--------+------+-----+-------+---------+------+---+
+func NewCornScheduler(corn string, task func()) CornScheduler {
+	return NewCornSchedulerWithConfig(corn, task, SchedulerConfig{})
+}
+
+// NewCornSchedulerWithConfig create a new corn scheduler instance with specified config.
+func NewCornSchedulerWithConfig(corn string, task func(), config SchedulerConfig) CornScheduler {
 	return &cornScheduler{
 		Task:    task,
 		CornExp: corn,
+		Config:  config,
+	}
+}
+
+// NewCornContextScheduler create a new corn scheduler instance which execute task with context.
+func NewCornContextScheduler(corn string, task ContextTask, config SchedulerConfig) CornScheduler {
+	return &cornScheduler{
+		ContextTask: task,
+		CornExp:     corn,
+		Config:      config,
 	}
 }
 
@@ -23,11 +23,19 @@
 package task_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/mervinkid/matcha/logging"
+	"github.com/mervinkid/matcha/parallel"
 	"github.com/mervinkid/matcha/task"
+	"io/ioutil"
 	"log"
+	"os"
+	"path/filepath"
 	"runtime"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -105,3 +113,632 @@ func TestNewCornScheduler(t *testing.T) {
 	scheduler.Stop()
 	time.Sleep(5 * time.Second)
 }
+
+func TestCornExpressionFormats(t *testing.T) {
+
+	valid := []string{
+		"*/5 * * * *",
+		"0 0 12 * * ?",
+		"*/2 * * * * * * ?",
+		"0 0 9 * * MON-FRI * ?",
+		"0 0 9 * * 1-5,6",
+		"0 0 0 * * 7",
+		"1-5,10 * * * *",
+		"0 0 0 1 jan,Jul-DEC/2 ?",
+	}
+	for _, corn := range valid {
+		scheduler := task.NewCornScheduler(corn, func() {})
+		if err := scheduler.Start(); err != nil {
+			t.Fatal("expect valid corn expression", corn, "but got", err)
+		}
+		scheduler.Stop()
+	}
+
+	invalid := []string{"", "* * * *", "* * * * * * *", "* * * * * * * *",
+		"0 0 9 * * MON-FUN", "0 0 9 * * 5-1", "1-5,,10 * * * *", "0 0 0 * * 8", "0 0 0 1 JAN-13 ?"}
+	for _, corn := range invalid {
+		if err := task.NewCornScheduler(corn, func() {}).Start(); err != task.InvalidCornExpressionError {
+			t.Fatal("expect invalid corn expression", corn, "but got", err)
+		}
+	}
+}
+
+func TestCornSchedulerFire(t *testing.T) {
+
+	firedC := make(chan time.Time, 10)
+	scheduler := task.NewCornScheduler("* * * * * *", func() {
+		firedC <- time.Now()
+	})
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case fired := <-firedC:
+			if fired.Nanosecond() > int(100*time.Millisecond) {
+				t.Fatal("expect execution at whole second but got", fired)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("expect execution every second")
+		}
+	}
+}
+
+func TestDescribeCorn(t *testing.T) {
+
+	for _, corn := range []string{"*/0 * * * *", "99 * * * *", "* * * * 13", "x * * * *", "*x * * * * *", "*/5x * * * *"} {
+		if err := task.ValidateCorn(corn); err == nil {
+			t.Fatal("expect invalid corn expression", corn)
+		}
+	}
+
+	description := task.DescribeCorn("0 */15 9-17 * * 1-5")
+	expected := "second 0, minute 0,15,30,45, hour 9-17, every day, every month, weekday Mon-Fri"
+	if description != expected {
+		t.Fatal("expect description", expected, "but got", description)
+	}
+}
+
+func TestNextCorn(t *testing.T) {
+
+	from := time.Date(2018, time.January, 31, 23, 59, 30, 0, time.UTC)
+	cases := map[string]time.Time{
+		"* * * * * *":     time.Date(2018, time.January, 31, 23, 59, 31, 0, time.UTC),
+		"*/15 * * * *":    time.Date(2018, time.February, 1, 0, 0, 0, 0, time.UTC),
+		"0 30 12 29 2 ?":  time.Date(2020, time.February, 29, 12, 30, 0, 0, time.UTC),
+		"0 0 9 * * 1":     time.Date(2018, time.February, 5, 9, 0, 0, 0, time.UTC),
+		"0 0 0 1 1 * * ?": time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC),
+		"0 0 9 * * SAT,7": time.Date(2018, time.February, 3, 9, 0, 0, 0, time.UTC),
+		"1-5,10 * * * *":  time.Date(2018, time.February, 1, 0, 1, 0, 0, time.UTC),
+		"0 0 0 15 * MON":  time.Date(2018, time.February, 5, 0, 0, 0, 0, time.UTC),
+		"0 0 12 1 feb ?":  time.Date(2018, time.February, 1, 12, 0, 0, 0, time.UTC),
+	}
+	for corn, expected := range cases {
+		next, err := task.NextCorn(corn, from)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !next.Equal(expected) {
+			t.Fatal("expect next time of", corn, "is", expected, "but got", next)
+		}
+	}
+
+	scheduler := task.NewFixedRateScheduler(func() {}, time.Hour)
+	if !scheduler.NextRun().IsZero() {
+		t.Fatal("expect zero next run before start")
+	}
+	scheduler.Start()
+	if scheduler.NextRun().Before(time.Now()) {
+		t.Fatal("expect next run in future but got", scheduler.NextRun())
+	}
+	scheduler.Stop()
+}
+
+func TestOverlapPolicy(t *testing.T) {
+
+	for _, overlap := range []task.OverlapPolicy{task.OverlapSkipIfRunning, task.OverlapQueueOne} {
+		var running, maxRunning, runs int32
+		config := task.SchedulerConfig{Overlap: overlap}
+		scheduler := task.NewFixedRateSchedulerWithConfig(func() {
+			current := atomic.AddInt32(&running, 1)
+			if current > atomic.LoadInt32(&maxRunning) {
+				atomic.StoreInt32(&maxRunning, current)
+			}
+			time.Sleep(50 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			atomic.AddInt32(&runs, 1)
+		}, 10*time.Millisecond, config)
+		scheduler.Start()
+		time.Sleep(200 * time.Millisecond)
+		scheduler.Stop()
+
+		if atomic.LoadInt32(&maxRunning) != 1 {
+			t.Fatal("expect no concurrent execution but got", maxRunning)
+		}
+		if atomic.LoadInt32(&runs) > 5 {
+			t.Fatal("expect executions not pile up but got", runs)
+		}
+	}
+}
+
+func TestPauseAndResume(t *testing.T) {
+
+	var runs int32
+	scheduler := task.NewFixedRateScheduler(func() {
+		atomic.AddInt32(&runs, 1)
+	}, 10*time.Millisecond)
+	scheduler.Start()
+	scheduler.Pause()
+	if !scheduler.IsPaused() || scheduler.IsRunning() {
+		t.Fatal("expect scheduler paused")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if atomic.LoadInt32(&runs) != 0 {
+		t.Fatal("expect no execution while paused but got", runs)
+	}
+
+	scheduler.Resume()
+	time.Sleep(50 * time.Millisecond)
+	scheduler.Stop()
+	if atomic.LoadInt32(&runs) == 0 {
+		t.Fatal("expect executions after resume")
+	}
+}
+
+func TestTaskTimeout(t *testing.T) {
+
+	errC := make(chan error, 1)
+	cancelledC := make(chan uint8, 1)
+	config := task.SchedulerConfig{
+		Timeout: 10 * time.Millisecond,
+		OnError: func(err error) {
+			errC <- err
+		},
+	}
+	scheduler := task.NewFixedDelayContextScheduler(func(ctx context.Context) error {
+		<-ctx.Done()
+		cancelledC <- 1
+		return ctx.Err()
+	}, 10*time.Millisecond, config)
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	if err := <-errC; err != task.TaskTimeoutError {
+		t.Fatal("expect timeout error but got", err)
+	}
+	<-cancelledC
+}
+
+type testLeadership struct {
+	master int32
+}
+
+func (l *testLeadership) IsMaster() bool {
+	return atomic.LoadInt32(&l.master) == 1
+}
+
+func TestLeaderScheduler(t *testing.T) {
+
+	var runs int32
+	leadership := &testLeadership{}
+	scheduler := task.NewLeaderScheduler(leadership, task.NewFixedRateScheduler(func() {
+		atomic.AddInt32(&runs, 1)
+	}, 10*time.Millisecond))
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	time.Sleep(50 * time.Millisecond)
+	if atomic.LoadInt32(&runs) != 0 {
+		t.Fatal("expect no execution while not master but got", runs)
+	}
+
+	atomic.StoreInt32(&leadership.master, 1)
+	time.Sleep(1500 * time.Millisecond)
+	if atomic.LoadInt32(&runs) == 0 {
+		t.Fatal("expect executions after master taken")
+	}
+}
+
+// testStateStore is a StateStore which keeps last fire times in memory.
+type testStateStore struct {
+	lastFires map[string]time.Time
+	mutex     sync.Mutex
+}
+
+func (s *testStateStore) LoadLastFire(name string) (time.Time, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.lastFires[name], nil
+}
+
+func (s *testStateStore) SaveLastFire(name string, t time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lastFires[name] = t
+	return nil
+}
+
+func TestLeaderScheduler_NotMaster(t *testing.T) {
+
+	// Missed fire time would be applied at once if underlying scheduler started.
+	store := &testStateStore{lastFires: map[string]time.Time{"leader-job": time.Now().Add(-time.Hour)}}
+	config := task.SchedulerConfig{Name: "leader-job", Store: store}
+	var runs int32
+	leadership := &testLeadership{}
+	scheduler := task.NewLeaderScheduler(leadership, task.NewFixedRateSchedulerWithConfig(func() {
+		atomic.AddInt32(&runs, 1)
+	}, time.Hour, config))
+	if err := scheduler.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer scheduler.Stop()
+
+	time.Sleep(50 * time.Millisecond)
+	if atomic.LoadInt32(&runs) != 0 || !scheduler.NextRun().IsZero() {
+		t.Fatal("expect no execution while not master from beginning but got", runs)
+	}
+
+	// Misfire is applied once master taken.
+	atomic.StoreInt32(&leadership.master, 1)
+	time.Sleep(1500 * time.Millisecond)
+	if atomic.LoadInt32(&runs) != 1 || scheduler.NextRun().IsZero() {
+		t.Fatal("expect misfire applied after master taken but got", runs)
+	}
+}
+
+type testNotifiedLeadership struct {
+	testLeadership
+	notify func()
+	mutex  sync.Mutex
+}
+
+func (l *testNotifiedLeadership) NotifyLeadership(notify func()) func() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.notify = notify
+	return func() {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		l.notify = nil
+	}
+}
+
+func (l *testNotifiedLeadership) setMaster(master bool) {
+	if master {
+		atomic.StoreInt32(&l.master, 1)
+	} else {
+		atomic.StoreInt32(&l.master, 0)
+	}
+	l.mutex.Lock()
+	notify := l.notify
+	l.mutex.Unlock()
+	if notify != nil {
+		notify()
+	}
+}
+
+func TestLeaderScheduler_Notify(t *testing.T) {
+
+	var runs int32
+	leadership := &testNotifiedLeadership{}
+	scheduler := task.NewLeaderScheduler(leadership, task.NewFixedRateScheduler(func() {
+		atomic.AddInt32(&runs, 1)
+	}, 10*time.Millisecond))
+	scheduler.Start()
+
+	// Leadership changes are applied at once without waiting for check.
+	leadership.setMaster(true)
+	time.Sleep(100 * time.Millisecond)
+	if atomic.LoadInt32(&runs) == 0 {
+		t.Fatal("expect executions after master taken")
+	}
+	leadership.setMaster(false)
+	time.Sleep(20 * time.Millisecond)
+	paused := atomic.LoadInt32(&runs)
+	time.Sleep(100 * time.Millisecond)
+	if atomic.LoadInt32(&runs) != paused || !scheduler.NextRun().IsZero() {
+		t.Fatal("expect no execution after master lost")
+	}
+
+	// Notification is cancelled after stopped.
+	scheduler.Stop()
+	leadership.mutex.Lock()
+	defer leadership.mutex.Unlock()
+	if leadership.notify != nil {
+		t.Fatal("expect notification cancelled after stopped")
+	}
+}
+
+func TestJobListener(t *testing.T) {
+
+	executionC := make(chan task.JobExecution, 1)
+	errorC := make(chan task.JobExecution, 1)
+	config := task.SchedulerConfig{
+		Name:    "listener-job",
+		OnError: func(err error) {},
+		Listeners: []task.JobListener{{
+			After: func(execution task.JobExecution) {
+				executionC <- execution
+			},
+			Error: func(execution task.JobExecution) {
+				errorC <- execution
+			},
+		}},
+	}
+	scheduler := task.NewFixedDelayContextScheduler(func(ctx context.Context) error {
+		time.Sleep(10 * time.Millisecond)
+		return errors.New("job failed")
+	}, 10*time.Millisecond, config)
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	failed := <-errorC
+	execution := <-executionC
+	if execution.Name != "listener-job" || failed.Err == nil || execution.Err == nil {
+		t.Fatal("expect failed execution of listener-job but got", execution)
+	}
+	if execution.Duration < 10*time.Millisecond || execution.Start.Before(execution.Scheduled) {
+		t.Fatal("expect execution start after scheduled and take 10ms but got", execution)
+	}
+}
+
+func TestTaskRetry(t *testing.T) {
+
+	attempts := 0
+	attemptsC := make(chan int, 1)
+	errC := make(chan error, 1)
+	config := task.SchedulerConfig{
+		Retry: &parallel.RetryPolicy{MaxAttempts: 3, Delay: time.Millisecond},
+		Listeners: []task.JobListener{{
+			After: func(execution task.JobExecution) {
+				select {
+				case attemptsC <- attempts:
+					errC <- execution.Err
+				default:
+				}
+			},
+		}},
+	}
+	scheduler := task.NewFixedDelayContextScheduler(func(ctx context.Context) error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("dependency unavailable")
+		}
+		return nil
+	}, 10*time.Millisecond, config)
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	if attempts, err := <-attemptsC, <-errC; err != nil || attempts != 3 {
+		t.Fatal("expect success at 3rd attempt but got", attempts, err)
+	}
+}
+
+func TestCalendar(t *testing.T) {
+
+	monday := time.Date(2018, time.January, 1, 12, 0, 0, 0, time.UTC)
+	saturday := time.Date(2018, time.January, 6, 12, 0, 0, 0, time.UTC)
+
+	businessHours := task.NewDailyCalendar(17*time.Hour, 9*time.Hour)
+	if businessHours.IsExcluded(monday) || !businessHours.IsExcluded(monday.Add(6*time.Hour)) {
+		t.Fatal("expect daily calendar exclude times out of business hours")
+	}
+	if !task.NewWeekdayCalendar(time.Saturday, time.Sunday).IsExcluded(saturday) {
+		t.Fatal("expect weekday calendar exclude saturday")
+	}
+	holidays := task.NewHolidayCalendar(monday)
+	if !holidays.IsExcluded(monday.Add(time.Hour)) || holidays.IsExcluded(saturday) {
+		t.Fatal("expect holiday calendar exclude whole day of holiday")
+	}
+
+	// Scheduler skip all fire times excluded.
+	var runs int32
+	config := task.SchedulerConfig{
+		Exclusions: []task.Calendar{task.NewDateRangeCalendar(time.Now(), time.Now().Add(time.Hour))},
+	}
+	scheduler := task.NewFixedRateSchedulerWithConfig(func() {
+		atomic.AddInt32(&runs, 1)
+	}, 10*time.Millisecond, config)
+	scheduler.Start()
+	time.Sleep(50 * time.Millisecond)
+	scheduler.Stop()
+	if atomic.LoadInt32(&runs) != 0 {
+		t.Fatal("expect no execution in excluded range but got", runs)
+	}
+}
+
+func TestReschedule(t *testing.T) {
+
+	firedC := make(chan uint8, 10)
+	fixed := task.NewFixedRateScheduler(func() {
+		select {
+		case firedC <- 1:
+		default:
+		}
+	}, time.Hour)
+	fixed.Start()
+	defer fixed.Stop()
+	if err := fixed.Reschedule(0); err != task.InvalidFixedTimeError {
+		t.Fatal("expect invalid fixed time error but got", err)
+	}
+	fixed.Reschedule(10 * time.Millisecond)
+	select {
+	case <-firedC:
+	case <-time.After(time.Second):
+		t.Fatal("expect execution with new fixed time")
+	}
+
+	cornFiredC := make(chan uint8, 1)
+	corn := task.NewCornScheduler("0 0 0 1 1 *", func() {
+		select {
+		case cornFiredC <- 1:
+		default:
+		}
+	})
+	corn.Start()
+	defer corn.Stop()
+	if err := corn.RescheduleCorn("invalid"); err == nil {
+		t.Fatal("expect invalid corn expression error")
+	}
+	corn.RescheduleCorn("* * * * * *")
+	select {
+	case <-cornFiredC:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expect execution with new corn expression")
+	}
+}
+
+func TestSharedWorkerPool(t *testing.T) {
+
+	pool := parallel.NewWorkerPool(1, 10)
+	defer pool.Shutdown()
+
+	var running, maxRunning, runs int32
+	config := task.SchedulerConfig{Pool: pool}
+	job := func() {
+		current := atomic.AddInt32(&running, 1)
+		if current > atomic.LoadInt32(&maxRunning) {
+			atomic.StoreInt32(&maxRunning, current)
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		atomic.AddInt32(&runs, 1)
+	}
+	for i := 0; i < 3; i++ {
+		scheduler := task.NewFixedRateSchedulerWithConfig(job, 10*time.Millisecond, config)
+		scheduler.Start()
+		defer scheduler.Stop()
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if atomic.LoadInt32(&maxRunning) != 1 || atomic.LoadInt32(&runs) == 0 {
+		t.Fatal("expect executions bounded by shared pool but got", maxRunning, runs)
+	}
+}
+
+func TestStateStore(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "matcha-task")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := task.NewFileStateStore(filepath.Join(dir, "state.json"))
+	if err := store.SaveLastFire("report", time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Executions missed during downtime are applied on start.
+	firedC := make(chan uint8, 10)
+	config := task.SchedulerConfig{Name: "report", Store: store, Misfire: task.MisfireFireAll}
+	scheduler := task.NewFixedRateSchedulerWithConfig(func() {
+		firedC <- 1
+	}, 20*time.Minute, config)
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-firedC:
+		case <-time.After(time.Second):
+			t.Fatal("expect 3 missed executions applied but got", i)
+		}
+	}
+	lastFire, err := store.LoadLastFire("report")
+	if err != nil || time.Since(lastFire) > time.Minute {
+		t.Fatal("expect last fire time recorded but got", lastFire, err)
+	}
+}
+
+func TestCompositeScheduler(t *testing.T) {
+
+	var runs int32
+	scheduler := task.NewCompositeScheduler(func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	}, task.SchedulerConfig{},
+		task.CornTrigger("0 0 0 1 1 *"),
+		task.FixedRateTrigger(10*time.Millisecond))
+	if err := scheduler.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if next := scheduler.NextRun(); next.IsZero() || time.Until(next) > time.Second {
+		t.Fatal("expect earliest next run of triggers but got", next)
+	}
+	time.Sleep(50 * time.Millisecond)
+	scheduler.Stop()
+	if atomic.LoadInt32(&runs) == 0 {
+		t.Fatal("expect executions fired by fixed rate trigger")
+	}
+
+	invalid := task.NewCompositeScheduler(func(ctx context.Context) error {
+		return nil
+	}, task.SchedulerConfig{}, task.FixedRateTrigger(time.Hour), task.CornTrigger("invalid"))
+	if err := invalid.Start(); err == nil {
+		t.Fatal("expect start fail with invalid trigger")
+	}
+
+	weekdays := task.NewCompositeScheduler(func(ctx context.Context) error {
+		return nil
+	}, task.SchedulerConfig{}, task.CornTrigger("0 0 9 * * MON-FRI * ?"), task.CornTrigger("0 0 12 * * SAT,SUN"))
+	if err := weekdays.Start(); err != nil {
+		t.Fatal("expect weekday triggers valid but got", err)
+	}
+	if next := weekdays.NextRun(); next.IsZero() || (next.Hour() != 9 && next.Hour() != 12) {
+		t.Fatal("unexpected next run of weekday triggers", next)
+	}
+	weekdays.Stop()
+}
+
+func TestExecutionWindow(t *testing.T) {
+
+	var runs int32
+	config := task.SchedulerConfig{MaxExecutions: 3, ExecutionWindow: time.Hour}
+	scheduler := task.NewFixedRateSchedulerWithConfig(func() {
+		atomic.AddInt32(&runs, 1)
+	}, 5*time.Millisecond, config)
+	scheduler.Start()
+	time.Sleep(100 * time.Millisecond)
+	scheduler.Stop()
+
+	if atomic.LoadInt32(&runs) != 3 {
+		t.Fatal("expect 3 executions in window but got", runs)
+	}
+}
+
+func TestScheduledExecutor(t *testing.T) {
+
+	executor := task.NewScheduledExecutor(2, 10)
+
+	delayedC := make(chan uint8, 1)
+	delayed, err := executor.Schedule(func() {
+		delayedC <- 1
+	}, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delayed.IsDone() || delayed.IsCancelled() {
+		t.Fatal("expect delayed future pending")
+	}
+
+	// Cancelled delayed task is never executed.
+	cancelledC := make(chan uint8, 1)
+	cancelled, err := executor.Schedule(func() {
+		cancelledC <- 1
+	}, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancelled.Cancel()
+
+	rateC := make(chan uint8, 10)
+	future, err := executor.ScheduleAtFixedRate(func() {
+		rateC <- 1
+	}, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	<-delayedC
+	<-rateC
+	<-rateC
+	// Completed delayed task is done rather than cancelled.
+	delayed.Cancel()
+	if !delayed.IsDone() || delayed.IsCancelled() {
+		t.Fatal("expect delayed future done but not cancelled")
+	}
+	if !cancelled.IsCancelled() || cancelled.IsDone() || len(cancelledC) != 0 {
+		t.Fatal("expect cancelled future not executed")
+	}
+	future.Cancel()
+	if !future.IsCancelled() || future.IsDone() {
+		t.Fatal("expect future cancelled")
+	}
+	executor.Shutdown()
+
+	if _, err := executor.Schedule(func() {}, 0); err != task.ExecutorShutdownError {
+		t.Fatal("expect shutdown error but got", err)
+	}
+}
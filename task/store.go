@@ -0,0 +1,137 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package task
+
+import (
+	"encoding/json"
+	"github.com/gomodule/redigo/redis"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// StateStore is the interface defined a store recording last fire time of named jobs, so that
+// fire times missed while process is down can be applied with misfire policy after restart.
+// Methods:
+//  LoadLastFire returns the last fire time of job. Returns zero time if not found.
+//  SaveLastFire record the last fire time of job.
+type StateStore interface {
+	LoadLastFire(name string) (time.Time, error)
+	SaveLastFire(name string, t time.Time) error
+}
+
+// fileStateStore is the implementation of StateStore interface which keeps last fire times in
+// a JSON file.
+type fileStateStore struct {
+	path  string
+	mutex sync.Mutex
+}
+
+func (s *fileStateStore) LoadLastFire(name string) (time.Time, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	states, err := s.load()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return states[name], nil
+}
+
+func (s *fileStateStore) SaveLastFire(name string, t time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	states, err := s.load()
+	if err != nil {
+		return err
+	}
+	states[name] = t
+	data, err := json.Marshal(states)
+	if err != nil {
+		return err
+	}
+	// Write to temporary file and rename it for atomic replacement.
+	tmpPath := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.path)
+}
+
+func (s *fileStateStore) load() (map[string]time.Time, error) {
+	states := make(map[string]time.Time)
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return states, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &states); err != nil {
+		return nil, err
+	}
+	return states, nil
+}
+
+// redisStateStore is the implementation of StateStore interface which keeps last fire times in
+// redis with key "prefix/name".
+type redisStateStore struct {
+	pool   *redis.Pool
+	prefix string
+}
+
+func (s *redisStateStore) LoadLastFire(name string) (time.Time, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+	value, err := redis.Int64(conn.Do("GET", s.key(name)))
+	if err == redis.ErrNil {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, value), nil
+}
+
+func (s *redisStateStore) SaveLastFire(name string, t time.Time) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("SET", s.key(name), strconv.FormatInt(t.UnixNano(), 10))
+	return err
+}
+
+func (s *redisStateStore) key(name string) string {
+	return s.prefix + "/" + name
+}
+
+// NewFileStateStore create a new StateStore instance which keeps last fire times in specified file.
+func NewFileStateStore(path string) StateStore {
+	return &fileStateStore{path: path}
+}
+
+// NewRedisStateStore create a new StateStore instance which keeps last fire times in redis with
+// specified key prefix.
+func NewRedisStateStore(pool *redis.Pool, prefix string) StateStore {
+	return &redisStateStore{pool: pool, prefix: prefix}
+}
@@ -23,11 +23,24 @@
 package util
 
 import (
+	"encoding"
+	"errors"
 	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
 )
 
+var ErrInvalidBitSetText = errors.New("invalid bitset text")
+
 // BitSet is the interface wraps method for BitSet data structure implementation.
+// BitSet can be persisted or sent over the wire with binary form, which is bytes with bit of
+// index i at bit i%8 of byte i/8, or with compact text form of indexes and ranges like "1,3,9-12".
 type BitSet interface {
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+	encoding.TextMarshaler
+	encoding.TextUnmarshaler
 	// Clear used for set the bit specified by the index to false.
 	Clear(index int)
 	// Set used for set the bit at the specified index to true.
@@ -40,6 +53,21 @@ type BitSet interface {
 	IsEmpty() bool
 	// Reset clean all bit.
 	Reset()
+	// And performs a logical AND of this BitSet with specified BitSet.
+	And(set BitSet)
+	// Or performs a logical OR of this BitSet with specified BitSet.
+	Or(set BitSet)
+	// Xor performs a logical XOR of this BitSet with specified BitSet.
+	Xor(set BitSet)
+	// AndNot clears all of the bits in this BitSet whose corresponding bit is set in specified BitSet.
+	AndNot(set BitSet)
+	// Cardinality returns the number of bits set to true in this BitSet.
+	Cardinality() int
+	// NextSetBit returns the index of the first bit that is set to true that occurs on or after
+	// the specified index, or -1 if there is no such bit.
+	NextSetBit(from int) int
+	// Len returns the index of the highest set bit plus one, or zero if it contains no set bits.
+	Len() int
 }
 
 // ByteSliceBitSet is a implementation of BitSet interface based on byte slice.
@@ -82,10 +110,13 @@ func (bs *byteSliceBitSet) Set(index int) {
 	bs.checkAndIncreaseCapacity(index)
 	// Locate byte and bit
 	byteIndex, bitIndex := bs.locateBit(index)
+	// Validate word is not in use
+	if bs.bytes[byteIndex]&byte(1<<byte(bitIndex)) == 0 {
+		// Increase word in use counter
+		bs.wordInUse += 1
+	}
 	// Set value
 	bs.bytes[byteIndex] = bs.bytes[byteIndex] | (1 << byte(bitIndex))
-	// Increase word in use counter
-	bs.wordInUse += 1
 }
 
 // Get returns the value of the bit with the specified index.
@@ -117,6 +148,167 @@ func (bs *byteSliceBitSet) Reset() {
 	bs.bytes = []byte{}
 }
 
+// And performs a logical AND of this BitSet with specified BitSet.
+func (bs *byteSliceBitSet) And(set BitSet) {
+	other := bytesOfBitSet(set)
+	for i := range bs.bytes {
+		if i < len(other) {
+			bs.bytes[i] &= other[i]
+		} else {
+			bs.bytes[i] = 0
+		}
+	}
+	bs.wordInUse = bs.Cardinality()
+}
+
+// Or performs a logical OR of this BitSet with specified BitSet.
+func (bs *byteSliceBitSet) Or(set BitSet) {
+	other := bytesOfBitSet(set)
+	bs.checkAndIncreaseCapacity(len(other)*8 - 1)
+	for i, b := range other {
+		bs.bytes[i] |= b
+	}
+	bs.wordInUse = bs.Cardinality()
+}
+
+// Xor performs a logical XOR of this BitSet with specified BitSet.
+func (bs *byteSliceBitSet) Xor(set BitSet) {
+	other := bytesOfBitSet(set)
+	bs.checkAndIncreaseCapacity(len(other)*8 - 1)
+	for i, b := range other {
+		bs.bytes[i] ^= b
+	}
+	bs.wordInUse = bs.Cardinality()
+}
+
+// AndNot clears all of the bits in this BitSet whose corresponding bit is set in specified BitSet.
+func (bs *byteSliceBitSet) AndNot(set BitSet) {
+	other := bytesOfBitSet(set)
+	for i := 0; i < len(bs.bytes) && i < len(other); i++ {
+		bs.bytes[i] &^= other[i]
+	}
+	bs.wordInUse = bs.Cardinality()
+}
+
+// Cardinality returns the number of bits set to true in this BitSet.
+func (bs *byteSliceBitSet) Cardinality() int {
+	cardinality := 0
+	for _, b := range bs.bytes {
+		cardinality += bits.OnesCount8(b)
+	}
+	return cardinality
+}
+
+// NextSetBit returns the index of the first bit that is set to true that occurs on or after
+// the specified index, or -1 if there is no such bit.
+func (bs *byteSliceBitSet) NextSetBit(from int) int {
+	if from < 0 {
+		from = 0
+	}
+	byteIndex := from / 8
+	if byteIndex >= len(bs.bytes) {
+		return -1
+	}
+	// Mask bits before from in the first byte
+	b := bs.bytes[byteIndex] & (0xff << uint(from%8))
+	for {
+		if b != 0 {
+			return byteIndex*8 + bits.TrailingZeros8(b)
+		}
+		byteIndex++
+		if byteIndex >= len(bs.bytes) {
+			return -1
+		}
+		b = bs.bytes[byteIndex]
+	}
+}
+
+// Len returns the index of the highest set bit plus one, or zero if it contains no set bits.
+func (bs *byteSliceBitSet) Len() int {
+	for i := len(bs.bytes) - 1; i >= 0; i-- {
+		if bs.bytes[i] != 0 {
+			return i*8 + bits.Len8(bs.bytes[i])
+		}
+	}
+	return 0
+}
+
+// MarshalBinary returns bytes of this BitSet without trailing zero bytes.
+func (bs *byteSliceBitSet) MarshalBinary() ([]byte, error) {
+	data := make([]byte, (bs.Len()+7)/8)
+	copy(data, bs.bytes)
+	return data, nil
+}
+
+// UnmarshalBinary replace bits of this BitSet with specified bytes.
+func (bs *byteSliceBitSet) UnmarshalBinary(data []byte) error {
+	bs.bytes = make([]byte, len(data))
+	copy(bs.bytes, data)
+	bs.wordInUse = bs.Cardinality()
+	return nil
+}
+
+// MarshalText returns compact text form of this BitSet with indexes and ranges like "1,3,9-12".
+func (bs *byteSliceBitSet) MarshalText() ([]byte, error) {
+	var parts []string
+	for start := bs.NextSetBit(0); start >= 0; {
+		end := start
+		for bs.Get(end + 1) {
+			end++
+		}
+		if end == start {
+			parts = append(parts, strconv.Itoa(start))
+		} else {
+			parts = append(parts, strconv.Itoa(start)+"-"+strconv.Itoa(end))
+		}
+		start = bs.NextSetBit(end + 1)
+	}
+	return []byte(strings.Join(parts, ",")), nil
+}
+
+// UnmarshalText replace bits of this BitSet with specified compact text form.
+func (bs *byteSliceBitSet) UnmarshalText(text []byte) error {
+	result := &byteSliceBitSet{}
+	for _, part := range strings.Split(string(text), ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		bounds := strings.SplitN(part, "-", 2)
+		start, err := strconv.Atoi(bounds[0])
+		if err != nil || start < 0 {
+			return ErrInvalidBitSetText
+		}
+		end := start
+		if len(bounds) == 2 {
+			if end, err = strconv.Atoi(bounds[1]); err != nil || end < start {
+				return ErrInvalidBitSetText
+			}
+		}
+		for i := start; i <= end; i++ {
+			result.Set(i)
+		}
+	}
+	bs.bytes = result.bytes
+	bs.wordInUse = result.wordInUse
+	return nil
+}
+
+// bytesOfBitSet returns bytes of specified BitSet in layout of byteSliceBitSet.
+func bytesOfBitSet(set BitSet) []byte {
+	switch s := set.(type) {
+	case nil:
+		return nil
+	case *byteSliceBitSet:
+		return s.bytes
+	}
+	bytes := make([]byte, (set.Len()+7)/8)
+	for i := set.NextSetBit(0); i >= 0; i = set.NextSetBit(i + 1) {
+		bytes[i/8] |= 1 << uint(i%8)
+	}
+	return bytes
+}
+
 func (bs *byteSliceBitSet) checkAndIncreaseCapacity(index int) {
 
 	if index < 0 {
@@ -23,6 +23,7 @@
 package util_test
 
 import (
+	"fmt"
 	"github.com/mervinkid/matcha/logging"
 	"github.com/mervinkid/matcha/util"
 	"testing"
@@ -54,3 +55,74 @@ func TestByteSliceBitSet_Set(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func newBitSet(indexes ...int) util.BitSet {
+	bs := util.NewByteSliceBitSet()
+	for _, index := range indexes {
+		bs.Set(index)
+	}
+	return bs
+}
+
+func setBits(bs util.BitSet) []int {
+	var indexes []int
+	for i := bs.NextSetBit(0); i >= 0; i = bs.NextSetBit(i + 1) {
+		indexes = append(indexes, i)
+	}
+	return indexes
+}
+
+func TestByteSliceBitSet_Logical(t *testing.T) {
+	bs := newBitSet(1, 3, 3, 9, 30)
+	if bs.Cardinality() != 4 || bs.Len() != 31 || bs.NextSetBit(4) != 9 || bs.NextSetBit(31) != -1 {
+		t.Fatal("unexpected bitset", setBits(bs), bs.Len())
+	}
+	bs.Clear(3)
+	bs.Clear(1)
+	bs.Clear(9)
+	bs.Clear(30)
+	if !bs.IsEmpty() || bs.Len() != 0 {
+		t.Fatal("expect empty bitset")
+	}
+
+	cases := []struct {
+		op       func(a, b util.BitSet)
+		expected string
+	}{
+		{util.BitSet.And, "[3 9]"},
+		{util.BitSet.Or, "[1 3 9 12 40]"},
+		{util.BitSet.Xor, "[1 12 40]"},
+		{util.BitSet.AndNot, "[1]"},
+	}
+	for _, c := range cases {
+		a := newBitSet(1, 3, 9)
+		c.op(a, newBitSet(3, 9, 12, 40))
+		if fmt.Sprint(setBits(a)) != c.expected || a.Cardinality() != len(setBits(a)) {
+			t.Fatal("unexpected result", setBits(a), "expect", c.expected)
+		}
+	}
+}
+
+func TestByteSliceBitSet_Marshal(t *testing.T) {
+	bs := newBitSet(1, 3, 9, 10, 11, 12, 40)
+	data, err := bs.MarshalBinary()
+	if err != nil || len(data) != 6 {
+		t.Fatal("unexpected binary", data, err)
+	}
+	decoded := util.NewByteSliceBitSet()
+	if err := decoded.UnmarshalBinary(data); err != nil || fmt.Sprint(setBits(decoded)) != fmt.Sprint(setBits(bs)) {
+		t.Fatal("unexpected decoded bitset", setBits(decoded), err)
+	}
+
+	text, err := bs.MarshalText()
+	if err != nil || string(text) != "1,3,9-12,40" {
+		t.Fatal("unexpected text", string(text), err)
+	}
+	decoded = util.NewByteSliceBitSet()
+	if err := decoded.UnmarshalText(text); err != nil || decoded.Cardinality() != 7 || !decoded.Get(11) {
+		t.Fatal("unexpected decoded bitset", setBits(decoded), err)
+	}
+	if err := decoded.UnmarshalText([]byte("3-1")); err != util.ErrInvalidBitSetText {
+		t.Fatal("expect invalid text but got", err)
+	}
+}
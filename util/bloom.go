@@ -0,0 +1,184 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package util
+
+import (
+	"hash/fnv"
+	"math"
+	"sync"
+)
+
+const defaultFalsePositiveRate = 0.01
+
+// BloomFilter is the interface of probabilistic set which tells an element is definitely absent or
+// possibly present with false positive rate, such as suppressing replayed message ids cheaply.
+// Methods:
+//  Add add data into filter.
+//  Contains returns false if data is definitely absent, or true if it is possibly present.
+//  TestAndAdd add data and returns whether it was possibly present before, atomically in safe filter.
+//  Count returns number of data added, including duplicates.
+//  Clear removes all of data from filter.
+type BloomFilter interface {
+	Add(data []byte)
+	AddString(s string)
+	Contains(data []byte) bool
+	ContainsString(s string) bool
+	TestAndAdd(data []byte) bool
+	Count() uint
+	Clear()
+}
+
+// bloomFilter is an implementation of BloomFilter interface based on bit words and double hashing.
+type bloomFilter struct {
+	bits   []uint64
+	size   uint64
+	hashes uint64
+	count  uint
+}
+
+func (f *bloomFilter) Add(data []byte) {
+	f.TestAndAdd(data)
+}
+
+func (f *bloomFilter) AddString(s string) {
+	f.TestAndAdd([]byte(s))
+}
+
+func (f *bloomFilter) Contains(data []byte) bool {
+	h1, h2 := bloomHash(data)
+	for i := uint64(0); i < f.hashes; i++ {
+		index := (h1 + i*h2) % f.size
+		if f.bits[index/64]&(1<<(index%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *bloomFilter) ContainsString(s string) bool {
+	return f.Contains([]byte(s))
+}
+
+func (f *bloomFilter) TestAndAdd(data []byte) bool {
+	h1, h2 := bloomHash(data)
+	present := true
+	for i := uint64(0); i < f.hashes; i++ {
+		index := (h1 + i*h2) % f.size
+		if f.bits[index/64]&(1<<(index%64)) == 0 {
+			present = false
+			f.bits[index/64] |= 1 << (index % 64)
+		}
+	}
+	f.count++
+	return present
+}
+
+func (f *bloomFilter) Count() uint {
+	return f.count
+}
+
+func (f *bloomFilter) Clear() {
+	for i := range f.bits {
+		f.bits[i] = 0
+	}
+	f.count = 0
+}
+
+// bloomHash returns two hash values of data for double hashing.
+func bloomHash(data []byte) (uint64, uint64) {
+	hash := fnv.New64a()
+	hash.Write(data)
+	sum := hash.Sum64()
+	// Second hash should be odd to cover all bits.
+	return sum & math.MaxUint32, sum>>32 | 1
+}
+
+// safeBloomFilter is a parallel safe implementation of BloomFilter interface.
+type safeBloomFilter struct {
+	filter *bloomFilter
+	mutex  sync.RWMutex
+}
+
+func (f *safeBloomFilter) Add(data []byte) {
+	f.TestAndAdd(data)
+}
+
+func (f *safeBloomFilter) AddString(s string) {
+	f.TestAndAdd([]byte(s))
+}
+
+func (f *safeBloomFilter) Contains(data []byte) bool {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return f.filter.Contains(data)
+}
+
+func (f *safeBloomFilter) ContainsString(s string) bool {
+	return f.Contains([]byte(s))
+}
+
+func (f *safeBloomFilter) TestAndAdd(data []byte) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.filter.TestAndAdd(data)
+}
+
+func (f *safeBloomFilter) Count() uint {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return f.filter.Count()
+}
+
+func (f *safeBloomFilter) Clear() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.filter.Clear()
+}
+
+func newBloomFilter(expected uint, falsePositiveRate float64) *bloomFilter {
+	if expected < 1 {
+		expected = 1
+	}
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		falsePositiveRate = defaultFalsePositiveRate
+	}
+	// m = -n*ln(p)/(ln2)^2, k = m/n*ln2
+	size := uint64(math.Ceil(-float64(expected) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	hashes := uint64(math.Max(1, math.Round(float64(size)/float64(expected)*math.Ln2)))
+	return &bloomFilter{
+		bits:   make([]uint64, (size+63)/64),
+		size:   size,
+		hashes: hashes,
+	}
+}
+
+// NewBloomFilter create a new instance of BloomFilter sized for expected number of elements with
+// false positive rate between 0 and 1, which is 0.01 if out of range. False positive rate grows
+// while more elements than expected are added.
+// If the safe parameter is true, returns a instance with parallel safe support.
+func NewBloomFilter(expected uint, falsePositiveRate float64, safe bool) BloomFilter {
+	if safe {
+		return &safeBloomFilter{filter: newBloomFilter(expected, falsePositiveRate)}
+	}
+	return newBloomFilter(expected, falsePositiveRate)
+}
@@ -0,0 +1,68 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package util_test
+
+import (
+	"github.com/mervinkid/matcha/util"
+	"strconv"
+	"testing"
+)
+
+func TestSafeBloomFilter(t *testing.T) {
+	testBloomFilter(t, true)
+}
+
+func TestBloomFilter(t *testing.T) {
+	testBloomFilter(t, false)
+}
+
+func testBloomFilter(t *testing.T, safe bool) {
+	filter := util.NewBloomFilter(10000, 0.01, safe)
+	for i := 0; i < 10000; i++ {
+		filter.AddString("msg-" + strconv.Itoa(i))
+	}
+	for i := 0; i < 10000; i++ {
+		if !filter.ContainsString("msg-" + strconv.Itoa(i)) {
+			t.Fatal("expect added data present", i)
+		}
+	}
+	falsePositives := 0
+	for i := 10000; i < 20000; i++ {
+		if filter.ContainsString("msg-" + strconv.Itoa(i)) {
+			falsePositives++
+		}
+	}
+	if rate := float64(falsePositives) / 10000; rate > 0.02 {
+		t.Fatal("false positive rate too high", rate)
+	}
+	if filter.TestAndAdd([]byte("new")) || !filter.TestAndAdd([]byte("new")) {
+		t.Fatal("unexpected result of test and add")
+	}
+	if filter.Count() != 10002 {
+		t.Fatal("unexpected count", filter.Count())
+	}
+	filter.Clear()
+	if filter.Count() != 0 || filter.Contains([]byte("new")) {
+		t.Fatal("expect filter cleared")
+	}
+}
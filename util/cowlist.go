@@ -0,0 +1,171 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package util
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// CopyOnWriteList is the interface of parallel safe list optimized for read-heavy and rarely mutated
+// collections such as registered listeners. Readers access an immutable snapshot without lock, and
+// writers copy backing slice and swap it atomically.
+// Methods:
+//  Add append elements to the end of list.
+//  AddIfAbsent append element if it is not present and returns true if added.
+//  Remove removes the first occurrence of element and returns true if removed. Elements must be
+//  comparable, use RemoveIf for elements like functions.
+//  RemoveIf removes all elements satisfying predicate and returns number of removed elements.
+//  Get returns element at index and true if index is in range.
+//  Snapshot returns current elements, which must not be modified.
+//  Range calls f sequentially for each element of current snapshot, which is not affected by
+//  writes during iteration. If f returns false, range stops the iteration.
+type CopyOnWriteList interface {
+	Add(elements ...interface{})
+	AddIfAbsent(element interface{}) bool
+	Remove(element interface{}) bool
+	RemoveIf(predicate func(element interface{}) bool) int
+	Get(index int) (element interface{}, ok bool)
+	Contains(element interface{}) bool
+	Len() int
+	Snapshot() []interface{}
+	Range(f func(index int, element interface{}) bool)
+	Clear()
+}
+
+// copyOnWriteList is the default implementation of CopyOnWriteList interface based on atomic value.
+type copyOnWriteList struct {
+	elements atomic.Value
+	mutex    sync.Mutex
+}
+
+func (l *copyOnWriteList) Add(elements ...interface{}) {
+	if len(elements) == 0 {
+		return
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	current := l.Snapshot()
+	updated := make([]interface{}, len(current), len(current)+len(elements))
+	copy(updated, current)
+	l.elements.Store(append(updated, elements...))
+}
+
+func (l *copyOnWriteList) AddIfAbsent(element interface{}) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	current := l.Snapshot()
+	if indexOf(current, element) >= 0 {
+		return false
+	}
+	updated := make([]interface{}, len(current), len(current)+1)
+	copy(updated, current)
+	l.elements.Store(append(updated, element))
+	return true
+}
+
+func (l *copyOnWriteList) Remove(element interface{}) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	current := l.Snapshot()
+	index := indexOf(current, element)
+	if index < 0 {
+		return false
+	}
+	updated := make([]interface{}, 0, len(current)-1)
+	updated = append(updated, current[:index]...)
+	l.elements.Store(append(updated, current[index+1:]...))
+	return true
+}
+
+func (l *copyOnWriteList) RemoveIf(predicate func(element interface{}) bool) int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	current := l.Snapshot()
+	updated := make([]interface{}, 0, len(current))
+	for _, element := range current {
+		if !predicate(element) {
+			updated = append(updated, element)
+		}
+	}
+	if removed := len(current) - len(updated); removed > 0 {
+		l.elements.Store(updated)
+		return removed
+	}
+	return 0
+}
+
+func (l *copyOnWriteList) Get(index int) (interface{}, bool) {
+	current := l.Snapshot()
+	if index < 0 || index >= len(current) {
+		return nil, false
+	}
+	return current[index], true
+}
+
+func (l *copyOnWriteList) Contains(element interface{}) bool {
+	return indexOf(l.Snapshot(), element) >= 0
+}
+
+func (l *copyOnWriteList) Len() int {
+	return len(l.Snapshot())
+}
+
+func (l *copyOnWriteList) Snapshot() []interface{} {
+	current, _ := l.elements.Load().([]interface{})
+	return current
+}
+
+func (l *copyOnWriteList) Range(f func(index int, element interface{}) bool) {
+	if f == nil {
+		return
+	}
+	for i, element := range l.Snapshot() {
+		if !f(i, element) {
+			break
+		}
+	}
+}
+
+func (l *copyOnWriteList) Clear() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.elements.Store([]interface{}{})
+}
+
+// indexOf returns index of the first occurrence of element in elements, or -1 if absent.
+func indexOf(elements []interface{}, element interface{}) int {
+	for i, e := range elements {
+		if e == element {
+			return i
+		}
+	}
+	return -1
+}
+
+// NewCopyOnWriteList create a new instance of CopyOnWriteList with specified initial elements.
+func NewCopyOnWriteList(elements ...interface{}) CopyOnWriteList {
+	list := &copyOnWriteList{}
+	list.elements.Store(append([]interface{}{}, elements...))
+	return list
+}
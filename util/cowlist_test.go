@@ -0,0 +1,87 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package util_test
+
+import (
+	"github.com/mervinkid/matcha/util"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestCopyOnWriteList(t *testing.T) {
+	list := util.NewCopyOnWriteList(1, 2)
+	list.Add(3, 4)
+	if list.AddIfAbsent(2) || !list.AddIfAbsent(5) {
+		t.Fatal("unexpected result of add if absent")
+	}
+	snapshot := list.Snapshot()
+	if !list.Remove(1) || list.Remove(1) {
+		t.Fatal("unexpected result of remove")
+	}
+	if removed := list.RemoveIf(func(element interface{}) bool { return element.(int)%2 == 0 }); removed != 2 {
+		t.Fatal("unexpected removed count", removed)
+	}
+	if elements := list.Snapshot(); !reflect.DeepEqual(elements, []interface{}{3, 5}) {
+		t.Fatal("unexpected elements", elements)
+	}
+	if !reflect.DeepEqual(snapshot, []interface{}{1, 2, 3, 4, 5}) {
+		t.Fatal("snapshot modified by writes", snapshot)
+	}
+	if element, ok := list.Get(1); !ok || element != 5 {
+		t.Fatal("unexpected element", element)
+	}
+	if _, ok := list.Get(2); ok || !list.Contains(3) || list.Len() != 2 {
+		t.Fatal("unexpected state of list")
+	}
+	list.Clear()
+	if list.Len() != 0 {
+		t.Fatal("expect list cleared")
+	}
+}
+
+func TestCopyOnWriteList_Parallel(t *testing.T) {
+	list := util.NewCopyOnWriteList()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				list.Add(i*100 + j)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				list.Range(func(_ int, element interface{}) bool {
+					return element != nil
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	if list.Len() != 400 {
+		t.Fatal("unexpected length", list.Len())
+	}
+}
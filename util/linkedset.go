@@ -0,0 +1,277 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package util
+
+import (
+	"container/list"
+	"sync"
+)
+
+// OrderedSet is the interface of Set which Range iterates elements in insertion order. Adding an
+// element already present does not change its position.
+// Methods:
+//  First returns the earliest inserted element and true if set is not empty.
+//  Last returns the latest inserted element and true if set is not empty.
+//  Pop removes and returns the earliest inserted element and true if set is not empty.
+// Sets returned by Intersection and Union are OrderedSet keeping order of this set, followed by
+// elements of specified set in its order.
+type OrderedSet interface {
+	Set
+	First() (element interface{}, ok bool)
+	Last() (element interface{}, ok bool)
+	Pop() (element interface{}, ok bool)
+}
+
+// linkedHashSet is an implementation of OrderedSet interface based on hash table and doubly linked
+// list.
+type linkedHashSet struct {
+	elements map[interface{}]*list.Element
+	order    *list.List
+}
+
+func (s *linkedHashSet) Add(element interface{}) {
+	if _, ok := s.elements[element]; !ok {
+		s.elements[element] = s.order.PushBack(element)
+	}
+}
+
+func (s *linkedHashSet) Remove(element interface{}) {
+	if e, ok := s.elements[element]; ok {
+		s.order.Remove(e)
+		delete(s.elements, element)
+	}
+}
+
+func (s *linkedHashSet) Contains(element interface{}) bool {
+	_, ok := s.elements[element]
+	return ok
+}
+
+func (s *linkedHashSet) IsEmpty() bool {
+	return len(s.elements) == 0
+}
+
+func (s *linkedHashSet) Size() int {
+	return len(s.elements)
+}
+
+func (s *linkedHashSet) Range(f func(element interface{}) bool) {
+	if f == nil {
+		return
+	}
+	for e := s.order.Front(); e != nil; {
+		// Keep next element in case of current element removed by f.
+		next := e.Next()
+		if !f(e.Value) {
+			break
+		}
+		e = next
+	}
+}
+
+func (s *linkedHashSet) Clear() {
+	s.elements = make(map[interface{}]*list.Element)
+	s.order.Init()
+}
+
+func (s *linkedHashSet) Intersection(set Set) Set {
+	newSet := newLinkedHashSet()
+	if set != nil {
+		s.Range(func(element interface{}) bool {
+			if set.Contains(element) {
+				newSet.Add(element)
+			}
+			return true
+		})
+	}
+	return newSet
+}
+
+func (s *linkedHashSet) Union(set Set) Set {
+	newSet := newLinkedHashSet()
+	s.Range(func(element interface{}) bool {
+		newSet.Add(element)
+		return true
+	})
+	if set != nil {
+		set.Range(func(element interface{}) bool {
+			newSet.Add(element)
+			return true
+		})
+	}
+	return newSet
+}
+
+func (s *linkedHashSet) First() (interface{}, bool) {
+	if e := s.order.Front(); e != nil {
+		return e.Value, true
+	}
+	return nil, false
+}
+
+func (s *linkedHashSet) Last() (interface{}, bool) {
+	if e := s.order.Back(); e != nil {
+		return e.Value, true
+	}
+	return nil, false
+}
+
+func (s *linkedHashSet) Pop() (interface{}, bool) {
+	e := s.order.Front()
+	if e == nil {
+		return nil, false
+	}
+	s.order.Remove(e)
+	delete(s.elements, e.Value)
+	return e.Value, true
+}
+
+// safeLinkedHashSet is an implementation of OrderedSet interface provide parallel safe support.
+type safeLinkedHashSet struct {
+	set   *linkedHashSet
+	mutex sync.RWMutex
+}
+
+func (s *safeLinkedHashSet) Add(element interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.set.Add(element)
+}
+
+func (s *safeLinkedHashSet) Remove(element interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.set.Remove(element)
+}
+
+func (s *safeLinkedHashSet) Contains(element interface{}) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.set.Contains(element)
+}
+
+func (s *safeLinkedHashSet) IsEmpty() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.set.IsEmpty()
+}
+
+func (s *safeLinkedHashSet) Size() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.set.Size()
+}
+
+// Range iterates a snapshot of elements, so f can modify the set.
+func (s *safeLinkedHashSet) Range(f func(element interface{}) bool) {
+	if f == nil {
+		return
+	}
+	for _, element := range s.snapshot() {
+		if !f(element) {
+			break
+		}
+	}
+}
+
+func (s *safeLinkedHashSet) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.set.Clear()
+}
+
+func (s *safeLinkedHashSet) Intersection(set Set) Set {
+	newSet := newSafeLinkedHashSet()
+	if set != nil {
+		for _, element := range s.snapshot() {
+			if set.Contains(element) {
+				newSet.set.Add(element)
+			}
+		}
+	}
+	return newSet
+}
+
+func (s *safeLinkedHashSet) Union(set Set) Set {
+	newSet := newSafeLinkedHashSet()
+	for _, element := range s.snapshot() {
+		newSet.set.Add(element)
+	}
+	if set != nil {
+		set.Range(func(element interface{}) bool {
+			newSet.set.Add(element)
+			return true
+		})
+	}
+	return newSet
+}
+
+func (s *safeLinkedHashSet) First() (interface{}, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.set.First()
+}
+
+func (s *safeLinkedHashSet) Last() (interface{}, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.set.Last()
+}
+
+func (s *safeLinkedHashSet) Pop() (interface{}, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.set.Pop()
+}
+
+// snapshot returns elements in insertion order.
+func (s *safeLinkedHashSet) snapshot() []interface{} {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	elements := make([]interface{}, 0, s.set.Size())
+	s.set.Range(func(element interface{}) bool {
+		elements = append(elements, element)
+		return true
+	})
+	return elements
+}
+
+func newLinkedHashSet() *linkedHashSet {
+	return &linkedHashSet{
+		elements: make(map[interface{}]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func newSafeLinkedHashSet() *safeLinkedHashSet {
+	return &safeLinkedHashSet{set: newLinkedHashSet()}
+}
+
+// NewOrderedSet create a new instance of OrderedSet.
+// If the safe parameter is true, returns a instance with parallel safe support.
+func NewOrderedSet(safe bool) OrderedSet {
+	if safe {
+		return newSafeLinkedHashSet()
+	}
+	return newLinkedHashSet()
+}
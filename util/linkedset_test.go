@@ -0,0 +1,81 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package util_test
+
+import (
+	"github.com/mervinkid/matcha/util"
+	"reflect"
+	"testing"
+)
+
+func TestSafeOrderedSet(t *testing.T) {
+	testOrderedSet(t, true)
+}
+
+func TestOrderedSet(t *testing.T) {
+	testOrderedSet(t, false)
+}
+
+func testOrderedSet(t *testing.T, safe bool) {
+	set := util.NewOrderedSet(safe)
+	for _, item := range []int{3, 1, 2, 1, 5} {
+		set.Add(item)
+	}
+	if elements := collect(set); !reflect.DeepEqual(elements, []interface{}{3, 1, 2, 5}) {
+		t.Fatal("unexpected order", elements)
+	}
+	if first, ok := set.First(); !ok || first != 3 {
+		t.Fatal("unexpected first", first)
+	}
+	if last, ok := set.Last(); !ok || last != 5 {
+		t.Fatal("unexpected last", last)
+	}
+	set.Remove(1)
+	if popped, ok := set.Pop(); !ok || popped != 3 || set.Size() != 2 {
+		t.Fatal("unexpected popped", popped)
+	}
+
+	other := util.NewOrderedSet(safe)
+	other.Add(7)
+	other.Add(5)
+	if union := collect(set.Union(other)); !reflect.DeepEqual(union, []interface{}{2, 5, 7}) {
+		t.Fatal("unexpected union", union)
+	}
+	if intersection := collect(set.Intersection(other)); !reflect.DeepEqual(intersection, []interface{}{5}) {
+		t.Fatal("unexpected intersection", intersection)
+	}
+
+	set.Clear()
+	if _, ok := set.Pop(); ok || !set.IsEmpty() {
+		t.Fatal("expect set cleared")
+	}
+}
+
+func collect(set util.Set) []interface{} {
+	var elements []interface{}
+	set.Range(func(element interface{}) bool {
+		elements = append(elements, element)
+		return true
+	})
+	return elements
+}
@@ -0,0 +1,211 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package util
+
+import (
+	"container/list"
+	"sync"
+)
+
+// CacheStats is the statistics of cache.
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+}
+
+// LRUCache is the interface of size-bounded cache which evict the least recently used entry while
+// putting entry beyond capacity.
+// Methods:
+//  Get returns value of key and mark it as most recently used.
+//  Put add or update value of key and mark it as most recently used.
+//  Remove delete entry of key without invoking eviction callback.
+//  OnEvict set callback invoked with entry evicted by capacity. Callback of safe cache is invoked
+//  without holding lock.
+//  Stats returns hit, miss and eviction counts.
+type LRUCache interface {
+	Get(key interface{}) (value interface{}, ok bool)
+	Put(key, value interface{})
+	Remove(key interface{})
+	Contains(key interface{}) bool
+	Len() int
+	Clear()
+	OnEvict(callback func(key, value interface{}))
+	Stats() CacheStats
+}
+
+type lruEntry struct {
+	key   interface{}
+	value interface{}
+}
+
+// lruCache is an implementation of LRUCache interface based on hash table and doubly linked list.
+type lruCache struct {
+	capacity int
+	entries  map[interface{}]*list.Element
+	order    *list.List
+	onEvict  func(key, value interface{})
+	stats    CacheStats
+}
+
+func (c *lruCache) Get(key interface{}) (interface{}, bool) {
+	if element, ok := c.entries[key]; ok {
+		c.order.MoveToFront(element)
+		c.stats.Hits++
+		return element.Value.(*lruEntry).value, true
+	}
+	c.stats.Misses++
+	return nil, false
+}
+
+func (c *lruCache) Put(key, value interface{}) {
+	if evicted := c.put(key, value); evicted != nil && c.onEvict != nil {
+		c.onEvict(evicted.key, evicted.value)
+	}
+}
+
+// put add or update entry and returns the evicted entry if there is.
+func (c *lruCache) put(key, value interface{}) *lruEntry {
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*lruEntry).value = value
+		c.order.MoveToFront(element)
+		return nil
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value})
+	if c.order.Len() <= c.capacity {
+		return nil
+	}
+	oldest := c.order.Back()
+	c.order.Remove(oldest)
+	entry := oldest.Value.(*lruEntry)
+	delete(c.entries, entry.key)
+	c.stats.Evictions++
+	return entry
+}
+
+func (c *lruCache) Remove(key interface{}) {
+	if element, ok := c.entries[key]; ok {
+		c.order.Remove(element)
+		delete(c.entries, key)
+	}
+}
+
+func (c *lruCache) Contains(key interface{}) bool {
+	_, ok := c.entries[key]
+	return ok
+}
+
+func (c *lruCache) Len() int {
+	return c.order.Len()
+}
+
+func (c *lruCache) Clear() {
+	c.entries = make(map[interface{}]*list.Element)
+	c.order.Init()
+}
+
+func (c *lruCache) OnEvict(callback func(key, value interface{})) {
+	c.onEvict = callback
+}
+
+func (c *lruCache) Stats() CacheStats {
+	return c.stats
+}
+
+// safeLRUCache is an implementation of LRUCache interface provide parallel safe support.
+type safeLRUCache struct {
+	cache *lruCache
+	mutex sync.Mutex
+}
+
+func (c *safeLRUCache) Get(key interface{}) (interface{}, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.cache.Get(key)
+}
+
+func (c *safeLRUCache) Put(key, value interface{}) {
+	c.mutex.Lock()
+	evicted := c.cache.put(key, value)
+	onEvict := c.cache.onEvict
+	c.mutex.Unlock()
+	if evicted != nil && onEvict != nil {
+		onEvict(evicted.key, evicted.value)
+	}
+}
+
+func (c *safeLRUCache) Remove(key interface{}) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.cache.Remove(key)
+}
+
+func (c *safeLRUCache) Contains(key interface{}) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.cache.Contains(key)
+}
+
+func (c *safeLRUCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.cache.Len()
+}
+
+func (c *safeLRUCache) Clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.cache.Clear()
+}
+
+func (c *safeLRUCache) OnEvict(callback func(key, value interface{})) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.cache.OnEvict(callback)
+}
+
+func (c *safeLRUCache) Stats() CacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.cache.Stats()
+}
+
+func newLRUCache(capacity int) *lruCache {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &lruCache{
+		capacity: capacity,
+		entries:  make(map[interface{}]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// NewLRUCache create a new instance of LRUCache with capacity which is at least 1.
+// If the safe parameter is true, returns a instance with parallel safe support.
+func NewLRUCache(capacity int, safe bool) LRUCache {
+	if safe {
+		return &safeLRUCache{cache: newLRUCache(capacity)}
+	}
+	return newLRUCache(capacity)
+}
@@ -0,0 +1,67 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package util_test
+
+import (
+	"github.com/mervinkid/matcha/util"
+	"testing"
+)
+
+func TestSafeLRUCache(t *testing.T) {
+	testLRUCache(t, true)
+}
+
+func TestLRUCache(t *testing.T) {
+	testLRUCache(t, false)
+}
+
+func testLRUCache(t *testing.T, safe bool) {
+	cache := util.NewLRUCache(2, safe)
+	var evicted []interface{}
+	cache.OnEvict(func(key, value interface{}) {
+		evicted = append(evicted, key)
+	})
+	cache.Put("a", 1)
+	cache.Put("b", 2)
+	if value, ok := cache.Get("a"); !ok || value != 1 {
+		t.Fatal("unexpected value", value)
+	}
+	cache.Put("c", 3)
+	if cache.Contains("b") || !cache.Contains("a") || cache.Len() != 2 {
+		t.Fatal("expect b evicted")
+	}
+	if len(evicted) != 1 || evicted[0] != "b" {
+		t.Fatal("unexpected evicted", evicted)
+	}
+	cache.Remove("a")
+	if _, ok := cache.Get("a"); ok || len(evicted) != 1 {
+		t.Fatal("expect a removed without eviction")
+	}
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Misses != 1 || stats.Evictions != 1 {
+		t.Fatal("unexpected stats", stats)
+	}
+	cache.Clear()
+	if cache.Len() != 0 {
+		t.Fatal("expect empty cache")
+	}
+}
@@ -0,0 +1,140 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package util
+
+import (
+	"context"
+	"time"
+)
+
+// BlockingQueue is the interface of bounded FIFO queue which block invoker while it is full or
+// empty, as a building block for backpressure.
+// Methods:
+//  Put add value into queue, block until there is room or context done.
+//  Take remove and returns value from queue, block until there is value or context done.
+//  PutTimeout and TakeTimeout are Put and Take with timeout. Error is context.DeadlineExceeded on timeout.
+//  Offer and Poll are non-blocking Put and Take, returns false if queue is full or empty.
+//  Drain remove and returns at most max values available without blocking, or all if max is not positive.
+type BlockingQueue interface {
+	Put(ctx context.Context, value interface{}) error
+	Take(ctx context.Context) (interface{}, error)
+	PutTimeout(value interface{}, timeout time.Duration) error
+	TakeTimeout(timeout time.Duration) (interface{}, error)
+	Offer(value interface{}) bool
+	Poll() (value interface{}, ok bool)
+	Drain(max int) []interface{}
+	Len() int
+	Cap() int
+}
+
+// chanBlockingQueue is the default implementation of BlockingQueue interface based on buffered channel.
+type chanBlockingQueue struct {
+	queue chan interface{}
+}
+
+func (q *chanBlockingQueue) Put(ctx context.Context, value interface{}) error {
+	select {
+	case q.queue <- value:
+		return nil
+	default:
+	}
+	select {
+	case q.queue <- value:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (q *chanBlockingQueue) Take(ctx context.Context) (interface{}, error) {
+	select {
+	case value := <-q.queue:
+		return value, nil
+	default:
+	}
+	select {
+	case value := <-q.queue:
+		return value, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (q *chanBlockingQueue) PutTimeout(value interface{}, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return q.Put(ctx, value)
+}
+
+func (q *chanBlockingQueue) TakeTimeout(timeout time.Duration) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return q.Take(ctx)
+}
+
+func (q *chanBlockingQueue) Offer(value interface{}) bool {
+	select {
+	case q.queue <- value:
+		return true
+	default:
+		return false
+	}
+}
+
+func (q *chanBlockingQueue) Poll() (interface{}, bool) {
+	select {
+	case value := <-q.queue:
+		return value, true
+	default:
+		return nil, false
+	}
+}
+
+func (q *chanBlockingQueue) Drain(max int) []interface{} {
+	var values []interface{}
+	for max <= 0 || len(values) < max {
+		select {
+		case value := <-q.queue:
+			values = append(values, value)
+		default:
+			return values
+		}
+	}
+	return values
+}
+
+func (q *chanBlockingQueue) Len() int {
+	return len(q.queue)
+}
+
+func (q *chanBlockingQueue) Cap() int {
+	return cap(q.queue)
+}
+
+// NewBlockingQueue create a new instance of BlockingQueue with capacity which is at least 1.
+func NewBlockingQueue(capacity int) BlockingQueue {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &chanBlockingQueue{queue: make(chan interface{}, capacity)}
+}
@@ -0,0 +1,62 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package util_test
+
+import (
+	"context"
+	"github.com/mervinkid/matcha/util"
+	"testing"
+	"time"
+)
+
+func TestBlockingQueue(t *testing.T) {
+	queue := util.NewBlockingQueue(2)
+	queue.Put(context.Background(), 1)
+	if !queue.Offer(2) || queue.Offer(3) {
+		t.Fatal("expect queue full after 2 values")
+	}
+	if err := queue.PutTimeout(3, 10*time.Millisecond); err != context.DeadlineExceeded {
+		t.Fatal("expect deadline exceeded but got", err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		queue.Poll()
+	}()
+	if err := queue.PutTimeout(3, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if values := queue.Drain(0); len(values) != 2 || values[0] != 2 || values[1] != 3 {
+		t.Fatal("unexpected values", values)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := queue.Take(ctx); err != context.Canceled {
+		t.Fatal("expect canceled but got", err)
+	}
+	go queue.Put(context.Background(), 4)
+	if value, err := queue.TakeTimeout(time.Second); err != nil || value != 4 {
+		t.Fatal("unexpected value", value, err)
+	}
+}
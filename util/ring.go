@@ -0,0 +1,139 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package util
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// cacheLinePad is the padding which keep hot fields in different cache lines to avoid false sharing.
+type cacheLinePad [64]byte
+
+// RingQueue is the interface of bounded multi-producer/multi-consumer queue which is non-blocking.
+// Methods:
+//  Offer add value into tail of queue, returns false if queue is full.
+//  Poll remove and returns value from head of queue, returns false if queue is empty.
+//  Len returns the approximate number of values in queue.
+//  Cap returns the capacity of queue.
+type RingQueue interface {
+	Offer(value interface{}) bool
+	Poll() (value interface{}, ok bool)
+	Len() int
+	Cap() int
+}
+
+type ringCell struct {
+	sequence uint64
+	value    interface{}
+}
+
+// casRingQueue is the lock-free implementation of RingQueue interface based on ring buffer and
+// compare-and-swap. Each cell has a sequence telling producers and consumers whether it is ready
+// for writing or reading in current lap, so they only contend on positions.
+//  +---+---+---+---+---+---+---+---+
+//  |   |   | v | v | v |   |   |   |
+//  +---+---+---+---+---+---+---+---+
+//            ↑           ↑
+//          dequeue     enqueue
+type casRingQueue struct {
+	_          cacheLinePad
+	enqueuePos uint64
+	_          cacheLinePad
+	dequeuePos uint64
+	_          cacheLinePad
+	mask       uint64
+	cells      []ringCell
+}
+
+func (q *casRingQueue) Offer(value interface{}) bool {
+	pos := atomic.LoadUint64(&q.enqueuePos)
+	for {
+		cell := &q.cells[pos&q.mask]
+		sequence := atomic.LoadUint64(&cell.sequence)
+		switch diff := int64(sequence - pos); {
+		case diff == 0:
+			if atomic.CompareAndSwapUint64(&q.enqueuePos, pos, pos+1) {
+				cell.value = value
+				atomic.StoreUint64(&cell.sequence, pos+1)
+				return true
+			}
+		case diff < 0:
+			// Cell has not been consumed in previous lap.
+			return false
+		default:
+			runtime.Gosched()
+		}
+		pos = atomic.LoadUint64(&q.enqueuePos)
+	}
+}
+
+func (q *casRingQueue) Poll() (interface{}, bool) {
+	pos := atomic.LoadUint64(&q.dequeuePos)
+	for {
+		cell := &q.cells[pos&q.mask]
+		sequence := atomic.LoadUint64(&cell.sequence)
+		switch diff := int64(sequence - (pos + 1)); {
+		case diff == 0:
+			if atomic.CompareAndSwapUint64(&q.dequeuePos, pos, pos+1) {
+				value := cell.value
+				cell.value = nil
+				atomic.StoreUint64(&cell.sequence, pos+q.mask+1)
+				return value, true
+			}
+		case diff < 0:
+			// Cell has not been produced in current lap.
+			return nil, false
+		default:
+			runtime.Gosched()
+		}
+		pos = atomic.LoadUint64(&q.dequeuePos)
+	}
+}
+
+func (q *casRingQueue) Len() int {
+	dequeuePos := atomic.LoadUint64(&q.dequeuePos)
+	enqueuePos := atomic.LoadUint64(&q.enqueuePos)
+	if enqueuePos < dequeuePos {
+		return 0
+	}
+	return int(enqueuePos - dequeuePos)
+}
+
+func (q *casRingQueue) Cap() int {
+	return len(q.cells)
+}
+
+// NewRingQueue create a new instance of RingQueue with capacity rounded up to power of two, which
+// is at least 2.
+func NewRingQueue(capacity int) RingQueue {
+	size := uint64(2)
+	for size < uint64(capacity) {
+		size <<= 1
+	}
+	queue := &casRingQueue{mask: size - 1, cells: make([]ringCell, size)}
+	for i := range queue.cells {
+		queue.cells[i].sequence = uint64(i)
+	}
+	return queue
+}
@@ -0,0 +1,130 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package util_test
+
+import (
+	"github.com/mervinkid/matcha/util"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestRingQueue(t *testing.T) {
+	queue := util.NewRingQueue(3)
+	if queue.Cap() != 4 {
+		t.Fatal("unexpected capacity", queue.Cap())
+	}
+	for i := 0; i < 4; i++ {
+		if !queue.Offer(i) {
+			t.Fatal("expect offer success")
+		}
+	}
+	if queue.Offer(4) || queue.Len() != 4 {
+		t.Fatal("expect queue full")
+	}
+	for i := 0; i < 4; i++ {
+		if value, ok := queue.Poll(); !ok || value != i {
+			t.Fatal("unexpected value", value)
+		}
+	}
+	if _, ok := queue.Poll(); ok {
+		t.Fatal("expect queue empty")
+	}
+}
+
+func TestRingQueueConcurrent(t *testing.T) {
+	const producers, perProducer = 4, 10000
+	queue := util.NewRingQueue(64)
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < perProducer; i++ {
+				for !queue.Offer(p*perProducer + i) {
+					runtime.Gosched()
+				}
+			}
+		}(p)
+	}
+
+	seen := make([]bool, producers*perProducer)
+	var seenMutex sync.Mutex
+	var consumers sync.WaitGroup
+	remaining := producers * perProducer
+	for c := 0; c < 4; c++ {
+		consumers.Add(1)
+		go func() {
+			defer consumers.Done()
+			for {
+				seenMutex.Lock()
+				done := remaining == 0
+				seenMutex.Unlock()
+				if done {
+					return
+				}
+				value, ok := queue.Poll()
+				if !ok {
+					runtime.Gosched()
+					continue
+				}
+				seenMutex.Lock()
+				if seen[value.(int)] {
+					t.Error("duplicate value", value)
+				}
+				seen[value.(int)] = true
+				remaining--
+				seenMutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	consumers.Wait()
+}
+
+func BenchmarkRingQueue(b *testing.B) {
+	queue := util.NewRingQueue(1024)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			for !queue.Offer(1) {
+				runtime.Gosched()
+			}
+			for {
+				if _, ok := queue.Poll(); ok {
+					break
+				}
+				runtime.Gosched()
+			}
+		}
+	})
+}
+
+func BenchmarkChannel(b *testing.B) {
+	queue := make(chan interface{}, 1024)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			queue <- 1
+			<-queue
+		}
+	})
+}
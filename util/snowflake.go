@@ -0,0 +1,120 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package util
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// Layout of id generated by IdGenerator.
+const (
+	IdNodeBits     = 10
+	IdSequenceBits = 12
+	MaxIdNode      = 1<<IdNodeBits - 1
+	maxIdSequence  = 1<<IdSequenceBits - 1
+)
+
+// IdEpoch is the start time of timestamp in id, which can be used for about 69 years.
+var IdEpoch = time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// IdGenerator is the interface of thread-safe 64-bit unique id generator in snowflake layout. Ids
+// generated by generators with different node are unique across the cluster, and ids generated by
+// the same generator are increasing.
+// Layout:
+//  +-------+-----------------------+-------------+---------------+
+//  | 0 (1) | milliseconds (41)     | node (10)   | sequence (12) |
+//  +-------+-----------------------+-------------+---------------+
+// Methods:
+//  NextId returns a new id. It waits for next millisecond while 4096 ids have been generated in
+//  current millisecond or clock moved backwards.
+//  Node returns node of generator.
+type IdGenerator interface {
+	NextId() int64
+	Node() int64
+}
+
+// snowflakeIdGenerator is the default implementation of IdGenerator interface.
+type snowflakeIdGenerator struct {
+	node      int64
+	timestamp int64
+	sequence  int64
+	mutex     sync.Mutex
+}
+
+func (g *snowflakeIdGenerator) NextId() int64 {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	now := idTimestamp(time.Now())
+	for now < g.timestamp {
+		time.Sleep(time.Duration(g.timestamp-now) * time.Millisecond)
+		now = idTimestamp(time.Now())
+	}
+	if now == g.timestamp {
+		g.sequence = (g.sequence + 1) & maxIdSequence
+		if g.sequence == 0 {
+			for now <= g.timestamp {
+				time.Sleep(time.Millisecond / 10)
+				now = idTimestamp(time.Now())
+			}
+		}
+	} else {
+		g.sequence = 0
+	}
+	g.timestamp = now
+	return g.timestamp<<(IdNodeBits+IdSequenceBits) | g.node<<IdSequenceBits | g.sequence
+}
+
+func (g *snowflakeIdGenerator) Node() int64 {
+	return g.node
+}
+
+// idTimestamp returns milliseconds since IdEpoch.
+func idTimestamp(t time.Time) int64 {
+	return int64(t.Sub(IdEpoch) / time.Millisecond)
+}
+
+// ParseId returns generation time, node and sequence of id generated by IdGenerator.
+func ParseId(id int64) (t time.Time, node int64, sequence int64) {
+	t = IdEpoch.Add(time.Duration(id>>(IdNodeBits+IdSequenceBits)) * time.Millisecond)
+	node = id >> IdSequenceBits & MaxIdNode
+	sequence = id & maxIdSequence
+	return
+}
+
+// IdNodeOf returns node of IdGenerator hashed from node id string such as NodeId of registry
+// config. Different node ids may be hashed into the same node, specify node explicitly with
+// NewIdGenerator if uniqueness must be guaranteed.
+func IdNodeOf(nodeId string) int64 {
+	hash := fnv.New32a()
+	hash.Write([]byte(nodeId))
+	return int64(hash.Sum32() % (MaxIdNode + 1))
+}
+
+// NewIdGenerator create a new IdGenerator instance with specified node from 0 to MaxIdNode, which
+// must be unique in cluster. Node out of range is masked into range.
+func NewIdGenerator(node int64) IdGenerator {
+	return &snowflakeIdGenerator{node: node & MaxIdNode, timestamp: -1}
+}
@@ -0,0 +1,70 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package util_test
+
+import (
+	"github.com/mervinkid/matcha/util"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIdGenerator(t *testing.T) {
+	generator := util.NewIdGenerator(util.IdNodeOf("app-node-1"))
+	var (
+		ids   = make(map[int64]bool)
+		mutex sync.Mutex
+		wg    sync.WaitGroup
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var last int64
+			for j := 0; j < 2000; j++ {
+				id := generator.NextId()
+				if id <= last {
+					t.Error("id is not increasing", last, id)
+					return
+				}
+				last = id
+				mutex.Lock()
+				ids[id] = true
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(ids) != 16000 {
+		t.Fatal("duplicate ids generated", len(ids))
+	}
+
+	id := generator.NextId()
+	timestamp, node, _ := util.ParseId(id)
+	if node != generator.Node() || time.Since(timestamp) > time.Second || timestamp.After(time.Now()) {
+		t.Fatal("unexpected parsed id", timestamp, node)
+	}
+	if other := util.NewIdGenerator(util.MaxIdNode + 3); other.Node() != 2 {
+		t.Fatal("unexpected node", other.Node())
+	}
+}
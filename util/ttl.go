@@ -0,0 +1,178 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package util
+
+import (
+	"sync"
+	"time"
+)
+
+// TTLCache is the interface of concurrent cache which entries expire after time to live. Expired
+// entries are removed lazily while accessed, and by background sweeping with interval.
+// Methods:
+//  Put add or update value of key with default ttl.
+//  PutWithTTL add or update value of key with specified ttl. Zero or negative ttl means never expire.
+//  OnExpire set callback invoked with expired entry without holding lock. It is not invoked for
+//  entries removed by Remove or Clear.
+//  Close stop background sweeping.
+type TTLCache interface {
+	Get(key interface{}) (value interface{}, ok bool)
+	Put(key, value interface{})
+	PutWithTTL(key, value interface{}, ttl time.Duration)
+	Remove(key interface{})
+	Len() int
+	Clear()
+	OnExpire(callback func(key, value interface{}))
+	Close()
+}
+
+type ttlEntry struct {
+	value    interface{}
+	expireAt time.Time
+}
+
+func (e *ttlEntry) expired(now time.Time) bool {
+	return !e.expireAt.IsZero() && !now.Before(e.expireAt)
+}
+
+// sweepTTLCache is the default implementation of TTLCache interface.
+type sweepTTLCache struct {
+	ttl       time.Duration
+	entries   map[interface{}]*ttlEntry
+	onExpire  func(key, value interface{})
+	mutex     sync.Mutex
+	closeC    chan uint8
+	closeOnce sync.Once
+}
+
+func (c *sweepTTLCache) Get(key interface{}) (interface{}, bool) {
+	c.mutex.Lock()
+	entry, ok := c.entries[key]
+	if ok && entry.expired(time.Now()) {
+		delete(c.entries, key)
+		onExpire := c.onExpire
+		c.mutex.Unlock()
+		if onExpire != nil {
+			onExpire(key, entry.value)
+		}
+		return nil, false
+	}
+	c.mutex.Unlock()
+	if !ok {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (c *sweepTTLCache) Put(key, value interface{}) {
+	c.PutWithTTL(key, value, c.ttl)
+}
+
+func (c *sweepTTLCache) PutWithTTL(key, value interface{}, ttl time.Duration) {
+	entry := &ttlEntry{value: value}
+	if ttl > 0 {
+		entry.expireAt = time.Now().Add(ttl)
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries[key] = entry
+}
+
+func (c *sweepTTLCache) Remove(key interface{}) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.entries, key)
+}
+
+// Len returns the number of entries including expired ones which have not been swept.
+func (c *sweepTTLCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.entries)
+}
+
+func (c *sweepTTLCache) Clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries = make(map[interface{}]*ttlEntry)
+}
+
+func (c *sweepTTLCache) OnExpire(callback func(key, value interface{})) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.onExpire = callback
+}
+
+func (c *sweepTTLCache) Close() {
+	c.closeOnce.Do(func() {
+		close(c.closeC)
+	})
+}
+
+// sweep remove all expired entries and invoke expiration callback.
+func (c *sweepTTLCache) sweep() {
+	now := time.Now()
+	expired := make(map[interface{}]interface{})
+	c.mutex.Lock()
+	for key, entry := range c.entries {
+		if entry.expired(now) {
+			expired[key] = entry.value
+			delete(c.entries, key)
+		}
+	}
+	onExpire := c.onExpire
+	c.mutex.Unlock()
+	if onExpire != nil {
+		for key, value := range expired {
+			onExpire(key, value)
+		}
+	}
+}
+
+func (c *sweepTTLCache) sweepLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closeC:
+			return
+		case <-ticker.C:
+			c.sweep()
+		}
+	}
+}
+
+// NewTTLCache create a new instance of TTLCache with default ttl of entries, and interval of
+// background sweeping. Zero or negative ttl means never expire, and expired entries are only
+// removed while accessed if interval is zero or negative.
+func NewTTLCache(ttl, sweepInterval time.Duration) TTLCache {
+	cache := &sweepTTLCache{
+		ttl:     ttl,
+		entries: make(map[interface{}]*ttlEntry),
+		closeC:  make(chan uint8),
+	}
+	if sweepInterval > 0 {
+		go cache.sweepLoop(sweepInterval)
+	}
+	return cache
+}
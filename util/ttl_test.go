@@ -0,0 +1,69 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2018 Mervin
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package util_test
+
+import (
+	"github.com/mervinkid/matcha/util"
+	"testing"
+	"time"
+)
+
+func TestTTLCache(t *testing.T) {
+	cache := util.NewTTLCache(20*time.Millisecond, 5*time.Millisecond)
+	defer cache.Close()
+	expireC := make(chan interface{}, 4)
+	cache.OnExpire(func(key, value interface{}) {
+		expireC <- key
+	})
+
+	cache.Put("session", 1)
+	cache.PutWithTTL("forever", 2, 0)
+	if value, ok := cache.Get("session"); !ok || value != 1 {
+		t.Fatal("unexpected value", value)
+	}
+	select {
+	case key := <-expireC:
+		if key != "session" {
+			t.Fatal("unexpected expired key", key)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expect session expired")
+	}
+	if _, ok := cache.Get("session"); ok {
+		t.Fatal("expect session removed")
+	}
+	if _, ok := cache.Get("forever"); !ok || cache.Len() != 1 {
+		t.Fatal("expect forever kept")
+	}
+
+	// Lazy expiration without background sweeping
+	lazy := util.NewTTLCache(time.Millisecond, 0)
+	lazy.OnExpire(func(key, value interface{}) {
+		expireC <- key
+	})
+	lazy.Put("ack", 3)
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := lazy.Get("ack"); ok || <-expireC != "ack" {
+		t.Fatal("expect ack expired")
+	}
+}
@@ -23,21 +23,19 @@
 package util
 
 import (
-	"regexp"
+	"net"
+	neturl "net/url"
+	"sort"
 	"strconv"
 	"strings"
 )
 
-var (
-	regexpProtocol = regexp.MustCompile("^[\\w-_.]+://")
-	regexpAuth     = regexp.MustCompile("^[\\w-_]+(:[\\w-_!@#$%^&*]+)*@")
-	regexpHost     = regexp.MustCompile("^[\\w-_.]+")
-	regexpPort     = regexp.MustCompile("^:(\\d)+")
-	regexpPath     = regexp.MustCompile("^(/[\\w-_]*)+")
-	regexpParam    = regexp.MustCompile("^(\\?[\\w-_]+=[\\w\\W]+)(&[\\w-_]+=[\\w\\W]+)*")
-)
-
 // URL represents a Uniform Resource Locator, a pointer to a "resource" on the World Wide Web.
+// Host of IPv6 address is stored without brackets, and User, Password, Path, Param and Fragment
+// are stored unescaped.
+//  redis://user:x%40y@[::1]:6379/0?db=1#main
+//  → Protocol: redis, User: user, Password: x@y, Host: ::1, Port: 6379, Path: /0,
+//    Param: {db: 1}, Fragment: main
 type URL struct {
 	Protocol string
 	User     string
@@ -46,6 +44,13 @@ type URL struct {
 	Port     int
 	Path     string
 	Param    map[string]string
+	Fragment string
+}
+
+// Address returns host and port joined like "10.0.0.1:6379" or "[::1]:6379", which can be used
+// to dial.
+func (url *URL) Address() string {
+	return net.JoinHostPort(url.Host, strconv.Itoa(url.Port))
 }
 
 func (url *URL) String() string {
@@ -54,87 +59,164 @@ func (url *URL) String() string {
 		result += url.Protocol + "://"
 	}
 	if url.User != "" {
-		result += url.User
 		if url.Password != "" {
-			result += ":" + url.Password
+			result += neturl.UserPassword(url.User, url.Password).String()
+		} else {
+			result += neturl.User(url.User).String()
 		}
 		result += "@"
 	}
-	if url.Host != "" {
-		result += url.Host
-	}
+	result += url.host()
 	if url.Port != 0 {
 		result += ":" + strconv.Itoa(url.Port)
 	}
 	if url.Path != "" {
-		result += url.Path
+		result += (&neturl.URL{Path: url.Path}).EscapedPath()
 	}
 	if len(url.Param) > 0 {
-		result += "?"
-		paramIndex := 0
-		for k, v := range url.Param {
-			if paramIndex != 0 {
-				result += "&"
-			}
-			result += k + "=" + v
-			paramIndex ++
-		}
+		result += "?" + url.query()
+	}
+	if url.Fragment != "" {
+		result += "#" + neturl.PathEscape(url.Fragment)
 	}
 	return result
 }
 
-// ParseUrl parse url instance from string.
+// host returns host wrapped with brackets if it is IPv6 address.
+func (url *URL) host() string {
+	if strings.Contains(url.Host, ":") {
+		return "[" + url.Host + "]"
+	}
+	return url.Host
+}
+
+// query returns escaped params sorted by key.
+func (url *URL) query() string {
+	keys := make([]string, 0, len(url.Param))
+	for k := range url.Param {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	params := make([]string, len(keys))
+	for i, k := range keys {
+		params[i] = neturl.QueryEscape(k) + "=" + neturl.QueryEscape(url.Param[k])
+	}
+	return strings.Join(params, "&")
+}
+
+// Parse parse url data from string. Protocol can be omitted like "m.jd.com/signin", and escaped
+// sequence which is invalid is kept as it is.
 func (url *URL) Parse(src string) {
 	src = strings.Trim(src, " ")
+	*url = URL{}
+
+	// Parse fragment
+	if i := strings.Index(src, "#"); i >= 0 {
+		url.Fragment = unescape(src[i+1:], neturl.PathUnescape)
+		src = src[:i]
+	}
+
+	// Parse params
+	if i := strings.Index(src, "?"); i >= 0 {
+		for _, param := range strings.Split(src[i+1:], "&") {
+			paramParts := strings.SplitN(param, "=", 2)
+			if len(paramParts) < 2 || paramParts[0] == "" {
+				continue
+			}
+			if url.Param == nil {
+				url.Param = make(map[string]string)
+			}
+			key := unescape(paramParts[0], neturl.QueryUnescape)
+			url.Param[key] = unescape(paramParts[1], neturl.QueryUnescape)
+		}
+		src = src[:i]
+	}
 
 	// Parse protocol
-	protocolSeq := regexpProtocol.FindString(src)
-	if len(protocolSeq) >= 3 {
-		url.Protocol = protocolSeq[:len(protocolSeq)-3]
-	} else {
-		url.Protocol = ""
+	if i := strings.Index(src, "://"); i >= 0 {
+		url.Protocol = src[:i]
+		src = src[i+3:]
+	}
+
+	// Parse path
+	if i := strings.Index(src, "/"); i >= 0 {
+		url.Path = unescape(src[i:], neturl.PathUnescape)
+		src = src[:i]
 	}
-	src = strings.Replace(src, protocolSeq, "", 1)
 
 	// Parse auth
-	authSeq := regexpAuth.FindString(src)
-	if len(authSeq) > 1 {
-		authParts := strings.Split(authSeq[:len(authSeq)-1], ":")
-		url.User = authParts[0]
+	if i := strings.LastIndex(src, "@"); i >= 0 {
+		authParts := strings.SplitN(src[:i], ":", 2)
+		url.User = unescape(authParts[0], neturl.PathUnescape)
 		if len(authParts) > 1 {
-			url.Password = authParts[1]
+			url.Password = unescape(authParts[1], neturl.PathUnescape)
 		}
+		src = src[i+1:]
 	}
-	src = strings.Replace(src, authSeq, "", 1)
 
-	// Parse host
-	hostSeq := regexpHost.FindString(src)
-	url.Host = hostSeq
-	src = strings.Replace(src, hostSeq, "", 1)
-
-	// Parse port
-	portSeq := regexpPort.FindString(src)
-	url.Port, _ = strconv.Atoi(strings.Replace(portSeq, ":", "", 1))
-	src = strings.Replace(src, portSeq, "", 1)
-
-	// Parse path
-	pathSeq := regexpPath.FindString(src)
-	url.Path = pathSeq
-	src = strings.Replace(src, pathSeq, "", 1)
+	// Parse host and port
+	if strings.HasPrefix(src, "[") {
+		if i := strings.Index(src, "]"); i >= 0 {
+			url.Host = src[1:i]
+			src = src[i+1:]
+		}
+	} else if i := strings.LastIndex(src, ":"); i >= 0 {
+		url.Host = src[:i]
+		src = src[i:]
+	} else {
+		url.Host = src
+		src = ""
+	}
+	if strings.HasPrefix(src, ":") {
+		url.Port, _ = strconv.Atoi(src[1:])
+	}
+}
 
-	// Parse params
-	paramSeq := regexpParam.FindString(src)
-	if len(paramSeq) > 0 {
-		if url.Param == nil {
-			url.Param = make(map[string]string)
+// StdURL returns a new net/url URL instance with data of url. Only the first value of each param
+// is kept while converting back with FromStdURL.
+func (url *URL) StdURL() *neturl.URL {
+	result := &neturl.URL{
+		Scheme:   url.Protocol,
+		Host:     url.host(),
+		Path:     url.Path,
+		Fragment: url.Fragment,
+	}
+	if url.Port != 0 {
+		result.Host = url.Address()
+	}
+	if url.User != "" {
+		if url.Password != "" {
+			result.User = neturl.UserPassword(url.User, url.Password)
+		} else {
+			result.User = neturl.User(url.User)
 		}
-		for _, param := range strings.Split(paramSeq[1:], "&") {
-			paramParts := strings.Split(param, "=")
-			if len(paramParts) >= 2 {
-				url.Param[paramParts[0]] = paramParts[1]
-			}
+	}
+	if len(url.Param) > 0 {
+		result.RawQuery = url.query()
+	}
+	return result
+}
+
+// FromStdURL returns a new URL instance with data of specified net/url URL.
+func FromStdURL(src *neturl.URL) URL {
+	url := URL{
+		Protocol: src.Scheme,
+		Host:     src.Hostname(),
+		Path:     src.Path,
+		Fragment: src.Fragment,
+	}
+	url.Port, _ = strconv.Atoi(src.Port())
+	if src.User != nil {
+		url.User = src.User.Username()
+		url.Password, _ = src.User.Password()
+	}
+	if query := src.Query(); len(query) > 0 {
+		url.Param = make(map[string]string, len(query))
+		for k, v := range query {
+			url.Param[k] = v[0]
 		}
 	}
+	return url
 }
 
 // ParseUrl parse url data from string and returns a new URL instance.
@@ -143,3 +225,11 @@ func ParseUrl(src string) URL {
 	url.Parse(src)
 	return url
 }
+
+// unescape returns unescaped s, or s itself if it is not escaped properly.
+func unescape(s string, fn func(string) (string, error)) string {
+	if result, err := fn(s); err == nil {
+		return result
+	}
+	return s
+}
@@ -24,6 +24,8 @@ package util_test
 
 import (
 	"github.com/mervinkid/matcha/util"
+	neturl "net/url"
+	"reflect"
 	"testing"
 )
 
@@ -42,3 +44,40 @@ func TestURL_Parse(t *testing.T) {
 		t.Log("result:", url.String())
 	}
 }
+
+func TestURL_ParseEscaped(t *testing.T) {
+	url := util.ParseUrl("redis://admin:p%3Ass@[::1]:6379/0?password=x%40y&master=my+master#main")
+	if url.Protocol != "redis" || url.User != "admin" || url.Password != "p:ss" || url.Host != "::1" ||
+		url.Port != 6379 || url.Path != "/0" || url.Param["password"] != "x@y" ||
+		url.Param["master"] != "my master" || url.Fragment != "main" {
+		t.Fatalf("unexpected url %+v", url)
+	}
+	if address := url.Address(); address != "[::1]:6379" {
+		t.Fatalf("unexpected address %s", address)
+	}
+	expected := "redis://admin:p%3Ass@[::1]:6379/0?master=my+master&password=x%40y#main"
+	if result := url.String(); result != expected {
+		t.Fatalf("expected %s but got %s", expected, result)
+	}
+
+	url = util.ParseUrl("http://cdn.test.com/static/app.v1.2.js")
+	if url.Host != "cdn.test.com" || url.Path != "/static/app.v1.2.js" {
+		t.Fatalf("unexpected url %+v", url)
+	}
+}
+
+func TestURL_StdURL(t *testing.T) {
+	url := util.ParseUrl("redis://admin:p%3Ass@[::1]:6379/0?password=x%40y#main")
+	std := url.StdURL()
+	if std.Scheme != "redis" || std.Hostname() != "::1" || std.Port() != "6379" ||
+		std.Query().Get("password") != "x@y" || std.Fragment != "main" {
+		t.Fatalf("unexpected std url %s", std.String())
+	}
+	parsed, err := neturl.Parse(std.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back := util.FromStdURL(parsed); !reflect.DeepEqual(back, url) {
+		t.Fatalf("expected %+v but got %+v", url, back)
+	}
+}